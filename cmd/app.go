@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
@@ -45,6 +46,12 @@ func Run() {
 	defer db.Close()
 	logger.Info("База данных подключена")
 
+	// Приводим схему существующей базы к текущей версии
+	if err := postgres.Migrate(context.Background(), db); err != nil {
+		logger.Error("Ошибка миграции схемы базы данных", "error", err)
+		os.Exit(1)
+	}
+
 	// Запускаем HTTP сервер с передачей порта и соединения с БД
 	httpAdapter.StartServer(*port, db)
 }
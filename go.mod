@@ -2,4 +2,8 @@ module 1337b04rd
 
 go 1.22.4
 
-require github.com/lib/pq v1.10.9
+require (
+	github.com/lib/pq v1.10.9
+	golang.org/x/image v0.18.0
+	golang.org/x/text v0.21.0
+)
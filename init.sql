@@ -4,11 +4,20 @@ CREATE TABLE IF NOT EXISTS posts (
     title VARCHAR(255) NOT NULL,
     content TEXT NOT NULL,
     image_url VARCHAR(255),
+    -- Размеры оригинала и миниатюры для треда и каталога, пустые без миниатюр
+    image_width INT NOT NULL DEFAULT 0,
+    image_height INT NOT NULL DEFAULT 0,
+    thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
+    catalog_thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
     user_id BIGINT NOT NULL,
     user_name VARCHAR(255) NOT NULL,
     avatar_url VARCHAR(255),
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
-    is_archived BOOLEAN NOT NULL DEFAULT false
+    is_archived BOOLEAN NOT NULL DEFAULT false,
+    is_sticky BOOLEAN NOT NULL DEFAULT false,
+    is_locked BOOLEAN NOT NULL DEFAULT false,
+    moderation_status VARCHAR(20) NOT NULL DEFAULT 'visible',
+    spam_score REAL NOT NULL DEFAULT 0
 );
 
 -- Создание таблицы для комментариев
@@ -20,12 +29,62 @@ CREATE TABLE IF NOT EXISTS comments (
     avatar_url VARCHAR(255),
     content TEXT NOT NULL,
     image_url VARCHAR(255),
+    image_width INT NOT NULL DEFAULT 0,
+    image_height INT NOT NULL DEFAULT 0,
+    thumbnail_url VARCHAR(255) NOT NULL DEFAULT '',
     created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
     reply_to_id BIGINT,
+    moderation_status VARCHAR(20) NOT NULL DEFAULT 'visible',
+    spam_score REAL NOT NULL DEFAULT 0,
     FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
     FOREIGN KEY (reply_to_id) REFERENCES comments (id) ON DELETE CASCADE
 );
 
+-- Постраничная загрузка комментариев треда по курсору (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments (post_id, created_at, id);
+
+-- Спуск по веткам ответов в древовидном представлении
+CREATE INDEX IF NOT EXISTS idx_comments_reply_to_id ON comments (reply_to_id);
+
+-- Цитаты комментариев: reply_to_id и ссылки >>id на комментарии того же треда
+CREATE TABLE IF NOT EXISTS comment_quotes (
+    comment_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    quoted_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+    PRIMARY KEY (comment_id, quoted_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_comment_quotes_quoted_id ON comment_quotes (quoted_id);
+
+-- Опросы тредов: у треда не больше одного опроса
+CREATE TABLE IF NOT EXISTS polls (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT NOT NULL UNIQUE REFERENCES posts (id) ON DELETE CASCADE,
+    multiple BOOLEAN NOT NULL DEFAULT false,
+    closes_at TIMESTAMP,
+    closed BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS poll_options (
+    id BIGSERIAL PRIMARY KEY,
+    poll_id BIGINT NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+    position INT NOT NULL,
+    text VARCHAR(255) NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_options_poll_id ON poll_options (poll_id, position);
+
+-- Голоса: у каждой сессии свой анонимный пользователь, поэтому user_id определяет сессию
+CREATE TABLE IF NOT EXISTS poll_votes (
+    poll_id BIGINT NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    option_id BIGINT NOT NULL REFERENCES poll_options (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (poll_id, user_id, option_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_poll_votes_option_id ON poll_votes (option_id);
+
 -- Создание таблицы для пользовательских сессий
 CREATE TABLE IF NOT EXISTS sessions (
     id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
@@ -74,4 +133,94 @@ VALUES
     (2, 'https://rickandmortyapi.com/api/character/avatar/2.jpeg', '2024-01-15 00:00:00'),
     (3, 'https://rickandmortyapi.com/api/character/avatar/3.jpeg', '2024-02-01 00:00:00'),
     (4, 'https://rickandmortyapi.com/api/character/avatar/4.jpeg', '2024-02-15 00:00:00'),
-    (5, 'https://rickandmortyapi.com/api/character/avatar/5.jpeg', '2024-03-01 00:00:00');
\ No newline at end of file
+    (5, 'https://rickandmortyapi.com/api/character/avatar/5.jpeg', '2024-03-01 00:00:00');
+
+-- Корзины токенов для ограничения частоты запросов (используется при RATE_LIMIT_STORE=postgres)
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key VARCHAR(255) PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Использованные задачи капчи (используется при CAPTCHA_STORE=postgres)
+CREATE TABLE IF NOT EXISTS captcha_replays (
+    id VARCHAR(64) PRIMARY KEY,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_captcha_replays_expires_at ON captcha_replays (expires_at);
+
+-- Правила фильтра содержимого, редактируются из админки
+CREATE TABLE IF NOT EXISTS content_filter_rules (
+    id BIGSERIAL PRIMARY KEY,
+    pattern TEXT NOT NULL,
+    action VARCHAR(20) NOT NULL,
+    replacement TEXT NOT NULL DEFAULT '',
+    note VARCHAR(255) NOT NULL DEFAULT '',
+    enabled BOOLEAN NOT NULL DEFAULT true,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Отпечатки последних отправок для поиска повторов спама
+CREATE TABLE IF NOT EXISTS content_fingerprints (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(10) NOT NULL,
+    ref_id BIGINT NOT NULL,
+    user_id BIGINT NOT NULL,
+    normalized TEXT NOT NULL,
+    image_hash VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Объекты хранилища изображений с числом ссылок. Ключ объекта это SHA-256 содержимого,
+-- поэтому повторная загрузка того же файла только увеличивает счетчик
+CREATE TABLE IF NOT EXISTS image_objects (
+    bucket VARCHAR(63) NOT NULL,
+    object_key VARCHAR(255) NOT NULL,
+    ref_count INT NOT NULL DEFAULT 1,
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    -- Перцептивный хэш (dHash) оригинала, пустой для миниатюр и SVG
+    perceptual_hash BIGINT,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Время последней добавленной ссылки: сборщик не трогает объекты недавних загрузок
+    acquired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    -- Объект записан в хранилище. Пока загрузка первой ссылки не завершилась,
+    -- следующие загрузки того же файла отправляют его сами
+    uploaded BOOLEAN NOT NULL DEFAULT FALSE,
+    PRIMARY KEY (bucket, object_key)
+);
+
+-- Запрещенные изображения: загрузка отклоняется, если перцептивный хэш
+-- отличается от запрещенного не больше чем на threshold бит
+CREATE TABLE IF NOT EXISTS banned_image_hashes (
+    id BIGSERIAL PRIMARY KEY,
+    hash BIGINT NOT NULL,
+    threshold INT NOT NULL DEFAULT 8,
+    reason VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Файлы постов и комментариев, до MaxAttachments на запись. Первый файл (position 0)
+-- дублируется в image_url записи и служит обложкой в каталоге и архиве
+CREATE TABLE IF NOT EXISTS attachments (
+    id BIGSERIAL PRIMARY KEY,
+    owner_type VARCHAR(10) NOT NULL CHECK (owner_type IN ('post', 'comment')),
+    owner_id BIGINT NOT NULL,
+    position INT NOT NULL DEFAULT 0,
+    bucket VARCHAR(63) NOT NULL,
+    object_key VARCHAR(255) NOT NULL,
+    mime_type VARCHAR(100) NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    width INT NOT NULL DEFAULT 0,
+    height INT NOT NULL DEFAULT 0,
+    thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+    -- Длительность видео, 0 для изображений
+    duration_ms BIGINT NOT NULL DEFAULT 0,
+    -- Статичный первый кадр анимированного GIF
+    poster_key VARCHAR(255) NOT NULL DEFAULT '',
+    original_filename VARCHAR(255) NOT NULL DEFAULT '',
+    is_spoiler BOOLEAN NOT NULL DEFAULT false,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (owner_type, owner_id, position)
+);
@@ -0,0 +1,291 @@
+package http
+
+import (
+	"crypto/rand"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/s3"
+	"1337b04rd/internal/domain/models"
+)
+
+// boardsFromEnv возвращает список досок из переменной BOARDS (через запятую)
+func boardsFromEnv() []string {
+	boards := []string{models.DefaultBoard}
+	for _, board := range strings.Split(os.Getenv("BOARDS"), ",") {
+		board = strings.TrimSpace(board)
+		if board == "" || board == models.DefaultBoard {
+			continue
+		}
+		boards = append(boards, models.NormalizeBoard(board))
+	}
+	return boards
+}
+
+// envBool читает булеву переменную окружения
+func envBool(name string, fallback bool) bool {
+	switch strings.ToLower(strings.TrimSpace(os.Getenv(name))) {
+	case "1", "true", "yes", "on":
+		return true
+	case "0", "false", "no", "off":
+		return false
+	default:
+		return fallback
+	}
+}
+
+// rateLimitConfigFromEnv собирает настройки ограничения частоты.
+// Общие правила задаются RATE_LIMIT_THREAD, RATE_LIMIT_REPLY и RATE_LIMIT_IMAGE,
+// переопределения для доски - RATE_LIMIT_<ДОСКА>_THREAD и т.д. Формат правила: "3/5m"
+func rateLimitConfigFromEnv() models.RateLimitConfig {
+	config := models.DefaultRateLimitConfig()
+	actions := []models.RateLimitAction{models.RateLimitThread, models.RateLimitReply, models.RateLimitImage}
+
+	for _, action := range actions {
+		name := "RATE_LIMIT_" + strings.ToUpper(string(action))
+		if rule, ok := rateLimitRuleFromEnv(name); ok {
+			config.Default[action] = rule
+		}
+	}
+
+	boards := boardsFromEnv()
+	config.Known = models.NewBoardSet(boards...)
+	for _, board := range boards {
+		for _, action := range actions {
+			name := "RATE_LIMIT_" + strings.ToUpper(board) + "_" + strings.ToUpper(string(action))
+			rule, ok := rateLimitRuleFromEnv(name)
+			if !ok {
+				continue
+			}
+			if config.Boards[board] == nil {
+				config.Boards[board] = make(models.RateLimitPolicy)
+			}
+			config.Boards[board][action] = rule
+		}
+	}
+
+	return config
+}
+
+// rateLimitRuleFromEnv читает одно правило из переменной окружения
+func rateLimitRuleFromEnv(name string) (models.RateLimitRule, bool) {
+	value := os.Getenv(name)
+	if value == "" {
+		return models.RateLimitRule{}, false
+	}
+
+	rule, err := models.ParseRateLimitRule(value)
+	if err != nil {
+		slog.Warn("Некорректное правило ограничения частоты, используется значение по умолчанию", "variable", name, "error", err)
+		return models.RateLimitRule{}, false
+	}
+	return rule, true
+}
+
+// captchaConfigFromEnv собирает настройки капчи.
+// CAPTCHA_BOARDS - доски с постоянной капчей (через запятую),
+// CAPTCHA_VELOCITY_THRESHOLD и CAPTCHA_VELOCITY_WINDOW - порог автоматического включения.
+// Использованные задачи по умолчанию хранятся в памяти процесса: решенную капчу можно
+// повторить на другом экземпляре или после перезапуска. Для нескольких экземпляров
+// задается CAPTCHA_STORE=postgres
+func captchaConfigFromEnv() models.CaptchaConfig {
+	config := models.DefaultCaptchaConfig()
+
+	config.Known = models.NewBoardSet(boardsFromEnv()...)
+	for _, board := range strings.Split(os.Getenv("CAPTCHA_BOARDS"), ",") {
+		if strings.TrimSpace(board) != "" {
+			config.Boards[models.NormalizeBoard(board)] = true
+		}
+	}
+
+	if value := os.Getenv("CAPTCHA_VELOCITY_THRESHOLD"); value != "" {
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 0 {
+			slog.Warn("Некорректный порог капчи, используется значение по умолчанию", "value", value)
+		} else {
+			config.VelocityThreshold = threshold
+		}
+	}
+
+	config.VelocityWindow = envDuration("CAPTCHA_VELOCITY_WINDOW", config.VelocityWindow)
+	config.TTL = envDuration("CAPTCHA_TTL", config.TTL)
+
+	return config
+}
+
+// captchaSecretFromEnv возвращает секрет подписи капчи из CAPTCHA_SECRET.
+// Без него генерируется случайный секрет, и выданные задачи не переживут перезапуск
+func captchaSecretFromEnv() []byte {
+	if secret := os.Getenv("CAPTCHA_SECRET"); secret != "" {
+		return []byte(secret)
+	}
+
+	slog.Warn("CAPTCHA_SECRET не задан, используется случайный секрет")
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		panic("не удалось сгенерировать секрет капчи: " + err.Error())
+	}
+	return secret
+}
+
+// envDuration читает длительность из переменной окружения
+func envDuration(name string, fallback time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		slog.Warn("Некорректная длительность, используется значение по умолчанию", "variable", name, "value", value)
+		return fallback
+	}
+	return duration
+}
+
+// spamConfigFromEnv собирает настройки спам-оценки.
+// SPAM_HISTORY_SIZE - сколько последних отправок сравнивать,
+// SPAM_QUEUE_THRESHOLD и SPAM_REJECT_THRESHOLD - пороги модерации и отклонения
+func spamConfigFromEnv() models.SpamConfig {
+	config := models.DefaultSpamConfig()
+
+	if value := os.Getenv("SPAM_HISTORY_SIZE"); value != "" {
+		size, err := strconv.Atoi(value)
+		if err != nil || size <= 0 {
+			slog.Warn("Некорректный размер истории спам-фильтра, используется значение по умолчанию", "value", value)
+		} else {
+			config.HistorySize = size
+		}
+	}
+
+	config.QueueThreshold = envFloat("SPAM_QUEUE_THRESHOLD", config.QueueThreshold)
+	config.RejectThreshold = envFloat("SPAM_REJECT_THRESHOLD", config.RejectThreshold)
+	config.NewSessionAge = envDuration("SPAM_NEW_SESSION_AGE", config.NewSessionAge)
+
+	return config
+}
+
+// imageGCConfigFromEnv собирает настройки сборщика изображений без ссылок.
+// IMAGE_GC_INTERVAL - период проходов, IMAGE_GC_GRACE_PERIOD - возраст, с которого
+// объект можно удалить, IMAGE_GC_DRY_RUN - только отчет без удаления
+func imageGCConfigFromEnv() models.ImageGCConfig {
+	config := models.DefaultImageGCConfig()
+
+	config.Interval = envDuration("IMAGE_GC_INTERVAL", config.Interval)
+	config.GracePeriod = envDuration("IMAGE_GC_GRACE_PERIOD", config.GracePeriod)
+	config.DryRun = envBool("IMAGE_GC_DRY_RUN", config.DryRun)
+
+	return config
+}
+
+// envFloat читает неотрицательное число из переменной окружения
+func envFloat(name string, fallback float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	number, err := strconv.ParseFloat(value, 64)
+	if err != nil || number < 0 {
+		slog.Warn("Некорректное число, используется значение по умолчанию", "variable", name, "value", value)
+		return fallback
+	}
+	return number
+}
+
+// imageURLConfigFromEnv собирает настройки адресов загруженных файлов.
+// IMAGE_URL_STRATEGY - proxy, direct или signed, IMAGE_PUBLIC_BASE_URL - публичный адрес
+// хранилища для direct, IMAGE_URL_SECRET и IMAGE_URL_TTL - ключ и срок подписанных адресов
+func imageURLConfigFromEnv() models.ImageURLConfig {
+	config := models.DefaultImageURLConfig()
+
+	if value := strings.ToLower(strings.TrimSpace(os.Getenv("IMAGE_URL_STRATEGY"))); value != "" {
+		config.Strategy = models.ImageURLStrategy(value)
+	}
+	config.BaseURL = strings.TrimSpace(os.Getenv("IMAGE_PUBLIC_BASE_URL"))
+	config.TTL = envDuration("IMAGE_URL_TTL", config.TTL)
+
+	if config.Strategy == models.ImageURLSigned {
+		if secret := os.Getenv("IMAGE_URL_SECRET"); secret != "" {
+			config.Secret = []byte(secret)
+		} else {
+			// Адреса, выданные до перезапуска, перестанут открываться
+			slog.Warn("IMAGE_URL_SECRET не задан, используется случайный ключ подписи адресов")
+			config.Secret = make([]byte, 32)
+			if _, err := rand.Read(config.Secret); err != nil {
+				panic("не удалось сгенерировать ключ подписи адресов: " + err.Error())
+			}
+		}
+	}
+
+	return config
+}
+
+// proxyCacheConfigFromEnv собирает настройки дискового кэша прокси хранилища.
+// S3_PROXY_CACHE_DIR включает кэш, S3_PROXY_CACHE_SIZE_MB и S3_PROXY_CACHE_MAX_OBJECT_MB
+// ограничивают общий размер кэша и размер одного объекта
+func proxyCacheConfigFromEnv() models.ProxyCacheConfig {
+	config := models.DefaultProxyCacheConfig()
+
+	config.Dir = strings.TrimSpace(os.Getenv("S3_PROXY_CACHE_DIR"))
+	config.MaxBytes = envSize("S3_PROXY_CACHE_SIZE_MB", config.MaxBytes)
+	config.MaxObjectBytes = envSize("S3_PROXY_CACHE_MAX_OBJECT_MB", config.MaxObjectBytes)
+
+	return config
+}
+
+// mediaConfigFromEnv собирает ограничения загружаемых файлов.
+// MEDIA_MAX_IMAGE_SIZE_MB и MEDIA_MAX_VIDEO_SIZE_MB - размеры в мегабайтах, 0 для видео
+// запрещает его загрузку, MEDIA_MAX_VIDEO_DURATION - наибольшая длительность видео.
+// Переопределения для доски - MEDIA_<ДОСКА>_MAX_IMAGE_SIZE_MB и т.д.
+func mediaConfigFromEnv() models.MediaConfig {
+	config := models.DefaultMediaConfig()
+	config.Default = mediaLimitsFromEnv("MEDIA_", config.Default)
+
+	for _, board := range boardsFromEnv() {
+		prefix := "MEDIA_" + strings.ToUpper(board) + "_"
+		if limits := mediaLimitsFromEnv(prefix, config.Default); limits != config.Default {
+			config.Boards[board] = limits
+		}
+	}
+
+	return config
+}
+
+// mediaLimitsFromEnv читает ограничения файлов с префиксом prefix поверх fallback
+func mediaLimitsFromEnv(prefix string, fallback models.MediaLimits) models.MediaLimits {
+	return models.MediaLimits{
+		MaxImageSize:     envMegabytes(prefix+"MAX_IMAGE_SIZE_MB", fallback.MaxImageSize),
+		MaxVideoSize:     envMegabytes(prefix+"MAX_VIDEO_SIZE_MB", fallback.MaxVideoSize),
+		MaxVideoDuration: envDuration(prefix+"MAX_VIDEO_DURATION", fallback.MaxVideoDuration),
+	}
+}
+
+// envSize читает размер в мегабайтах и возвращает его в байтах
+func envSize(name string, fallback int64) int64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback
+	}
+
+	megabytes, err := strconv.ParseFloat(value, 64)
+	if err != nil || megabytes < 0 {
+		slog.Warn("Некорректный размер, используется значение по умолчанию", "variable", name, "value", value)
+		return fallback
+	}
+	return int64(megabytes * (1 << 20))
+}
+
+// envMegabytes читает размер загрузки в мегабайтах и возвращает его в байтах.
+// Размер больше s3.MaxFileSize хранилище все равно не примет, поэтому он уменьшается
+func envMegabytes(name string, fallback int64) int64 {
+	size := envSize(name, fallback)
+	if size > s3.MaxFileSize {
+		slog.Warn("Размер больше допустимого хранилищем, используется предел хранилища", "variable", name, "value", os.Getenv(name))
+		return s3.MaxFileSize
+	}
+	return size
+}
@@ -0,0 +1,564 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// AdminHandler обрабатывает HTTP запросы админки
+type AdminHandler struct {
+	admin             *middleware.AdminMiddleware
+	contentFilter     *services.ContentFilter
+	moderationService *services.ModerationService
+}
+
+// NewAdminHandler создает новый обработчик админки
+func NewAdminHandler(
+	admin *middleware.AdminMiddleware,
+	contentFilter *services.ContentFilter,
+	moderationService *services.ModerationService,
+) *AdminHandler {
+	return &AdminHandler{
+		admin:             admin,
+		contentFilter:     contentFilter,
+		moderationService: moderationService,
+	}
+}
+
+// FilterRulesPageData содержит данные для шаблона правил фильтра
+type FilterRulesPageData struct {
+	Rules   []*models.FilterRule
+	Actions []models.FilterAction
+	Error   string
+}
+
+// moderatedPost пост в очереди модерации вместе со служебными полями
+type moderatedPost struct {
+	*models.Post
+	Status    models.ModerationStatus `json:"status"`
+	SpamScore float64                 `json:"spam_score"`
+}
+
+// moderatedComment комментарий в очереди модерации вместе со служебными полями
+type moderatedComment struct {
+	*models.Comment
+	Status    models.ModerationStatus `json:"status"`
+	SpamScore float64                 `json:"spam_score"`
+}
+
+// moderationQueueView очередь модерации для админки
+type moderationQueueView struct {
+	Posts    []moderatedPost    `json:"posts"`
+	Comments []moderatedComment `json:"comments"`
+}
+
+// HandleLogin показывает форму входа и проверяет токен администратора
+func (h *AdminHandler) HandleLogin(w http.ResponseWriter, r *http.Request) {
+	if !h.admin.Enabled() {
+		http.NotFound(w, r)
+		return
+	}
+
+	data := struct{ Error string }{}
+	status := http.StatusOK
+
+	if r.Method == http.MethodPost {
+		if h.admin.CheckToken(r.FormValue("token")) {
+			h.admin.SetSessionCookie(w)
+			http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+			return
+		}
+		slog.Warn("Неверный токен администратора", "remote_addr", r.RemoteAddr)
+		data.Error = "Неверный токен"
+		status = http.StatusUnauthorized
+	}
+
+	if err := RenderTemplateStatus(w, status, "admin-login.html", data, "Админка", "Вход в админку"); err != nil {
+		slog.Error("Ошибка рендеринга шаблона", "template", "admin-login.html", "error", err)
+	}
+}
+
+// HandleFilterRules выводит список правил фильтра (GET) или создает правило (POST)
+func (h *AdminHandler) HandleFilterRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.renderFilterRules(w, r, http.StatusOK, "")
+	case http.MethodPost:
+		rule, err := filterRuleFromRequest(r, &models.FilterRule{Enabled: true})
+		if err == nil {
+			err = h.contentFilter.CreateRule(r.Context(), rule)
+		}
+		if err != nil {
+			h.filterRuleError(w, r, err)
+			return
+		}
+
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusCreated, rule)
+			return
+		}
+		http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+	default:
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+	}
+}
+
+// HandleFilterRule изменяет одно правило фильтра.
+// JSON API: PUT и DELETE /admin/filters/{id}.
+// HTML формы: POST /admin/filters/{id}/toggle и /admin/filters/{id}/delete
+func (h *AdminHandler) HandleFilterRule(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/admin/filters/")
+	idStr, formAction, _ := strings.Cut(path, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID правила", http.StatusBadRequest)
+		return
+	}
+
+	ctx := r.Context()
+	switch {
+	case r.Method == http.MethodPut && formAction == "":
+		var rule *models.FilterRule
+		rule, err = filterRuleFromRequest(r, &models.FilterRule{})
+		if err == nil {
+			rule.ID = id
+			err = h.contentFilter.UpdateRule(ctx, rule)
+		}
+		if err == nil {
+			writeJSON(w, http.StatusOK, rule)
+			return
+		}
+	case r.Method == http.MethodDelete && formAction == "",
+		r.Method == http.MethodPost && formAction == "delete":
+		err = h.contentFilter.DeleteRule(ctx, id)
+	case r.Method == http.MethodPost && formAction == "toggle":
+		err = h.contentFilter.SetRuleEnabled(ctx, id, r.FormValue("enabled") == "true")
+	default:
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		h.filterRuleError(w, r, err)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+}
+
+// HandleReloadFilters сбрасывает кэш правил, например после правки таблицы напрямую в БД
+func (h *AdminHandler) HandleReloadFilters(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h.contentFilter.Invalidate()
+	slog.Info("Кэш правил фильтра сброшен администратором")
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/filters", http.StatusSeeOther)
+}
+
+// HandleQueue выводит очередь модерации
+func (h *AdminHandler) HandleQueue(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	queue, err := h.moderationService.Queue(r.Context(), 100)
+	if err != nil {
+		slog.Error("Ошибка получения очереди модерации", "error", err)
+		http.Error(w, "Не удалось получить очередь модерации", http.StatusInternalServerError)
+		return
+	}
+
+	// Статус и спам-оценка скрыты из публичного JSON, модератору отдаем их явно
+	view := moderationQueueView{
+		Posts:    make([]moderatedPost, 0, len(queue.Posts)),
+		Comments: make([]moderatedComment, 0, len(queue.Comments)),
+	}
+	for _, post := range queue.Posts {
+		view.Posts = append(view.Posts, moderatedPost{Post: post, Status: post.Status, SpamScore: post.SpamScore})
+	}
+	for _, comment := range queue.Comments {
+		view.Comments = append(view.Comments, moderatedComment{Comment: comment, Status: comment.Status, SpamScore: comment.SpamScore})
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, view)
+		return
+	}
+
+	if err := RenderTemplate(w, "admin-queue.html", view, "Модерация", "Очередь модерации"); err != nil {
+		slog.Error("Ошибка рендеринга шаблона", "template", "admin-queue.html", "error", err)
+	}
+}
+
+// HandleModerate выносит решение по записи из очереди:
+// POST /admin/queue/posts/{id} или /admin/queue/comments/{id} с полем status
+func (h *AdminHandler) HandleModerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind, idStr, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/queue/"), "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID записи", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Status models.ModerationStatus `json:"status"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "неверный формат данных")
+			return
+		}
+	} else {
+		body.Status = models.ModerationStatus(r.FormValue("status"))
+	}
+
+	switch kind {
+	case "posts":
+		err = h.moderationService.SetPostStatus(r.Context(), id, body.Status)
+	case "comments":
+		err = h.moderationService.SetCommentStatus(r.Context(), id, body.Status)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		slog.Warn("Ошибка модерации", "kind", kind, "id", id, "error", err)
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/queue", http.StatusSeeOther)
+}
+
+// HandleThreads выводит активные треды с флагами закрепления и закрытия
+func (h *AdminHandler) HandleThreads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	posts, err := h.moderationService.Threads(r.Context(), 100)
+	if err != nil {
+		slog.Error("Ошибка получения тредов", "error", err)
+		http.Error(w, "Не удалось получить треды", http.StatusInternalServerError)
+		return
+	}
+	if posts == nil {
+		posts = []*models.Post{}
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, posts)
+		return
+	}
+
+	if err := RenderTemplate(w, "admin-threads.html", posts, "Треды", "Закрепление и закрытие тредов"); err != nil {
+		slog.Error("Ошибка рендеринга шаблона", "template", "admin-threads.html", "error", err)
+	}
+}
+
+// HandleThreadFlags меняет флаги треда: POST /admin/threads/{id} с полями is_sticky и is_locked.
+// Отсутствующее поле оставляет флаг без изменений
+func (h *AdminHandler) HandleThreadFlags(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(strings.TrimPrefix(r.URL.Path, "/admin/threads/"), 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID треда", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Sticky *bool `json:"is_sticky"`
+		Locked *bool `json:"is_locked"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "неверный формат данных")
+			return
+		}
+	} else {
+		body.Sticky, body.Locked = formBool(r, "is_sticky"), formBool(r, "is_locked")
+	}
+	if body.Sticky == nil && body.Locked == nil {
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusBadRequest, "не указан флаг треда")
+			return
+		}
+		http.Error(w, "Не указан флаг треда", http.StatusBadRequest)
+		return
+	}
+
+	if body.Sticky != nil {
+		err = h.moderationService.SetPostSticky(r.Context(), id, *body.Sticky)
+	}
+	if err == nil && body.Locked != nil {
+		err = h.moderationService.SetPostLocked(r.Context(), id, *body.Locked)
+	}
+	if err != nil {
+		slog.Warn("Ошибка изменения флагов треда", "id", id, "error", err)
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/threads", http.StatusSeeOther)
+}
+
+// HandleDeleteThread удаляет тред вместе с ответами.
+// JSON API: DELETE /admin/threads/{id}. HTML форма: POST /admin/threads/{id}/delete
+func (h *AdminHandler) HandleDeleteThread(w http.ResponseWriter, r *http.Request) {
+	idStr, formAction, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/threads/"), "/")
+	if !(r.Method == http.MethodDelete && formAction == "") && !(r.Method == http.MethodPost && formAction == "delete") {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID треда", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.moderationService.DeletePost(r.Context(), id); err != nil {
+		slog.Warn("Ошибка удаления треда", "id", id, "error", err)
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/threads", http.StatusSeeOther)
+}
+
+// HandleImageBans выводит запреты изображений (GET) и запрещает изображение треда
+// или комментария (POST /admin/bans с полями post_id или comment_id, reason и threshold)
+func (h *AdminHandler) HandleImageBans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		bans, err := h.moderationService.ImageBans(r.Context())
+		if err != nil {
+			slog.Error("Ошибка получения запретов изображений", "error", err)
+			http.Error(w, "Не удалось получить запреты изображений", http.StatusInternalServerError)
+			return
+		}
+		if bans == nil {
+			bans = []*models.ImageBan{}
+		}
+
+		if wantsJSON(r) {
+			writeJSON(w, http.StatusOK, bans)
+			return
+		}
+		if err := RenderTemplate(w, "admin-bans.html", bans, "Запреты", "Запрещенные изображения"); err != nil {
+			slog.Error("Ошибка рендеринга шаблона", "template", "admin-bans.html", "error", err)
+		}
+	case http.MethodPost:
+		h.banImage(w, r)
+	default:
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+	}
+}
+
+// banImage запрещает изображение записи, указанной в запросе
+func (h *AdminHandler) banImage(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		PostID    int64  `json:"post_id"`
+		CommentID int64  `json:"comment_id"`
+		Reason    string `json:"reason"`
+		Threshold *int   `json:"threshold"`
+	}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "неверный формат данных")
+			return
+		}
+	} else {
+		body.PostID, _ = strconv.ParseInt(r.FormValue("post_id"), 10, 64)
+		body.CommentID, _ = strconv.ParseInt(r.FormValue("comment_id"), 10, 64)
+		body.Reason = r.FormValue("reason")
+		if threshold, err := strconv.Atoi(r.FormValue("threshold")); err == nil {
+			body.Threshold = &threshold
+		}
+	}
+
+	threshold := services.DefaultBanThreshold
+	if body.Threshold != nil {
+		threshold = *body.Threshold
+	}
+
+	var ban *models.ImageBan
+	var err error
+	switch {
+	case body.PostID > 0:
+		ban, err = h.moderationService.BanPostImage(r.Context(), body.PostID, body.Reason, threshold)
+	case body.CommentID > 0:
+		ban, err = h.moderationService.BanCommentImage(r.Context(), body.CommentID, body.Reason, threshold)
+	default:
+		err = fmt.Errorf("%w: не указана запись", services.ErrInvalidImageBan)
+	}
+	if err != nil {
+		slog.Warn("Ошибка запрета изображения", "post_id", body.PostID, "comment_id", body.CommentID, "error", err)
+		status := http.StatusNotFound
+		if errors.Is(err, services.ErrInvalidImageBan) {
+			status = http.StatusBadRequest
+		}
+		if wantsJSON(r) {
+			writeJSONError(w, status, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusCreated, ban)
+		return
+	}
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+}
+
+// HandleImageBan снимает запрет изображения.
+// JSON API: DELETE /admin/bans/{id}. HTML форма: POST /admin/bans/{id}/delete
+func (h *AdminHandler) HandleImageBan(w http.ResponseWriter, r *http.Request) {
+	idStr, formAction, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/bans/"), "/")
+	if !(r.Method == http.MethodDelete && formAction == "") && !(r.Method == http.MethodPost && formAction == "delete") {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		http.Error(w, "Неверный ID запрета", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.moderationService.DeleteImageBan(r.Context(), id); err != nil {
+		slog.Warn("Ошибка снятия запрета изображения", "id", id, "error", err)
+		if wantsJSON(r) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	if wantsJSON(r) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Redirect(w, r, "/admin/bans", http.StatusSeeOther)
+}
+
+// formBool читает логическое поле формы, nil означает, что поле не передано или неверно
+func formBool(r *http.Request, name string) *bool {
+	value, err := strconv.ParseBool(r.FormValue(name))
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+// renderFilterRules выводит правила в формате JSON или HTML
+func (h *AdminHandler) renderFilterRules(w http.ResponseWriter, r *http.Request, status int, message string) {
+	rules, err := h.contentFilter.Rules(r.Context())
+	if err != nil {
+		slog.Error("Ошибка получения правил фильтра", "error", err)
+		http.Error(w, "Не удалось получить правила", http.StatusInternalServerError)
+		return
+	}
+
+	if wantsJSON(r) {
+		if rules == nil {
+			rules = []*models.FilterRule{}
+		}
+		writeJSON(w, status, rules)
+		return
+	}
+
+	data := FilterRulesPageData{
+		Rules:   rules,
+		Actions: []models.FilterAction{models.FilterReject, models.FilterReplace, models.FilterShadowHide, models.FilterFlag},
+		Error:   message,
+	}
+	if err := RenderTemplateStatus(w, status, "admin-filters.html", data, "Фильтр", "Правила фильтра содержимого"); err != nil {
+		slog.Error("Ошибка рендеринга шаблона", "template", "admin-filters.html", "error", err)
+	}
+}
+
+// filterRuleError сообщает об ошибке сохранения правила
+func (h *AdminHandler) filterRuleError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Warn("Ошибка изменения правила фильтра", "error", err)
+	if wantsJSON(r) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	h.renderFilterRules(w, r, http.StatusBadRequest, err.Error())
+}
+
+// filterRuleFromRequest заполняет правило из тела JSON или из полей формы
+func filterRuleFromRequest(r *http.Request, rule *models.FilterRule) (*models.FilterRule, error) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if err := json.NewDecoder(r.Body).Decode(rule); err != nil {
+			return nil, err
+		}
+		return rule, nil
+	}
+
+	rule.Pattern = r.FormValue("pattern")
+	rule.Action = models.FilterAction(r.FormValue("action"))
+	rule.Replacement = r.FormValue("replacement")
+	rule.Note = r.FormValue("note")
+	return rule, nil
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// CaptchaHandler обрабатывает HTTP запросы для капчи
+type CaptchaHandler struct {
+	captchaService *services.CaptchaService
+}
+
+// NewCaptchaHandler создает новый обработчик капчи
+func NewCaptchaHandler(captchaService *services.CaptchaService) *CaptchaHandler {
+	return &CaptchaHandler{
+		captchaService: captchaService,
+	}
+}
+
+// HandleNewChallenge выдает новую задачу и сообщает, требуется ли капча на доске
+func (h *CaptchaHandler) HandleNewChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	challenge, err := h.captchaService.NewChallenge()
+	if err != nil {
+		slog.Error("Ошибка создания капчи", "error", err)
+		writeJSONError(w, http.StatusInternalServerError, "не удалось создать капчу")
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, struct {
+		Required bool `json:"required"`
+		*models.CaptchaChallenge
+	}{
+		Required:         h.captchaService.Required(r.Context(), middleware.BoardFromRequest(r)),
+		CaptchaChallenge: challenge,
+	})
+}
+
+// HandleImage отдает изображение задачи по токену
+func (h *CaptchaHandler) HandleImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	image, err := h.captchaService.Image(r.URL.Query().Get("token"))
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, services.ErrCaptchaExpired) {
+			status = http.StatusGone
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(image)
+}
@@ -2,21 +2,27 @@ package handlers
 
 import (
 	"encoding/json"
-	"io"
+	"errors"
 	"log/slog"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"1337b04rd/internal/adapters/primary/http/middleware"
-	"1337b04rd/internal/adapters/secondary/s3"
+	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/domain/validation"
+	"1337b04rd/internal/ports/external"
 )
 
 // CommentHandler обрабатывает HTTP запросы для комментариев
 type CommentHandler struct {
 	commentService *services.CommentService
 	userService    *services.UserService
+	rateLimiter    *middleware.RateLimitMiddleware
+	postPage       *PostHandler
+	imageService   *services.ImageService
+	urls           imageURLs
 }
 
 // NewCommentHandler создает новый обработчик комментариев
@@ -27,6 +33,27 @@ func NewCommentHandler(commentService *services.CommentService, userService *ser
 	}
 }
 
+// SetRateLimiter включает ограничение частоты загрузки изображений
+func (h *CommentHandler) SetRateLimiter(rateLimiter *middleware.RateLimitMiddleware) {
+	h.rateLimiter = rateLimiter
+}
+
+// SetImageService включает загрузку изображений комментариев с миниатюрами
+func (h *CommentHandler) SetImageService(imageService *services.ImageService) {
+	h.imageService = imageService
+}
+
+// SetURLBuilder задает способ построения адресов загруженных файлов.
+// По умолчанию файлы отдаются через прокси хранилища
+func (h *CommentHandler) SetURLBuilder(builder external.URLBuilder) {
+	h.urls = imageURLs{builder: builder}
+}
+
+// SetPostPage позволяет возвращать форму комментария с ошибками на странице поста
+func (h *CommentHandler) SetPostPage(postHandler *PostHandler) {
+	h.postPage = postHandler
+}
+
 // HandleGetComment обрабатывает GET запрос для получения комментария
 func (h *CommentHandler) HandleGetComment(w http.ResponseWriter, r *http.Request) {
 	// Получаем пользователя из контекста
@@ -53,6 +80,13 @@ func (h *CommentHandler) HandleGetComment(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	// Скрытый комментарий видит только его автор
+	if !comment.Status.VisibleTo(comment.UserID, user.ID) {
+		http.Error(w, "Комментарий не найден", http.StatusNotFound)
+		return
+	}
+
+	h.urls.comment(comment)
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comment)
 }
@@ -97,12 +131,55 @@ func (h *CommentHandler) HandleGetPostComments(w http.ResponseWriter, r *http.Re
 		}
 	}
 
+	// Курсорная выборка: after для постраничной загрузки, since для опроса новых ответов
+	cursor := r.URL.Query().Get("after")
+	if since := r.URL.Query().Get("since"); since != "" {
+		cursor = since
+	}
+	if cursor != "" {
+		afterID, err := strconv.ParseInt(cursor, 10, 64)
+		if err != nil || afterID < 0 {
+			http.Error(w, "Неверный курсор комментариев", http.StatusBadRequest)
+			return
+		}
+		if limitStr == "" {
+			limit = 0
+		}
+		page, err := h.commentService.GetCommentPage(r.Context(), postID, user.ID, afterID, limit)
+		if err != nil {
+			slog.Error("Ошибка получения страницы комментариев", "post_id", postID, "after", afterID, "error", err)
+			http.Error(w, "Не удалось получить комментарии", http.StatusInternalServerError)
+			return
+		}
+		h.urls.comments(page.Comments)
+		writeJSON(w, http.StatusOK, page)
+		return
+	}
+
+	// В древовидном представлении limit и offset считаются по корневым веткам
+	if r.URL.Query().Get("view") == "tree" {
+		if limitStr == "" {
+			limit = 0
+		}
+		tree, err := h.commentService.GetCommentTree(r.Context(), postID, user.ID, limit, offset)
+		if err != nil {
+			slog.Error("Ошибка получения дерева комментариев", "post_id", postID, "error", err)
+			http.Error(w, "Не удалось получить комментарии", http.StatusInternalServerError)
+			return
+		}
+		h.urls.comments(tree.Comments)
+		writeJSON(w, http.StatusOK, tree)
+		return
+	}
+
 	comments, err := h.commentService.GetCommentsByPostID(r.Context(), postID, limit, offset)
 	if err != nil {
 		slog.Error("Ошибка получения комментариев", "post_id", postID, "error", err)
 		http.Error(w, "Не удалось получить комментарии", http.StatusInternalServerError)
 		return
 	}
+	comments = models.VisibleComments(comments, user.ID)
+	h.urls.comments(comments)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(comments)
@@ -129,7 +206,12 @@ func (h *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Requ
 	}
 
 	// Парсим данные формы
-	if err := r.ParseMultipartForm(10 << 20); err != nil { // 10 МБ
+	if err := parseUploadForm(w, r); err != nil {
+		if isRequestTooLarge(err) {
+			slog.Warn("Слишком большой запрос", "user_id", user.ID, "error", err)
+			http.Error(w, "Файл слишком большой", http.StatusRequestEntityTooLarge)
+			return
+		}
 		slog.Error("Ошибка парсинга multipart формы", "error", err)
 		if err = r.ParseForm(); err != nil {
 			slog.Error("Ошибка парсинга формы", "error", err)
@@ -155,61 +237,81 @@ func (h *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	// Получаем текст комментария
+	// Получаем текст комментария, пустой допустим при наличии изображения
 	content := r.FormValue("comment")
 	slog.Info("Получен текст комментария", "content_length", len(content))
 
-	if content == "" {
-		slog.Error("Текст комментария пуст")
-		http.Error(w, "Комментарий не может быть пустым", http.StatusBadRequest)
-		return
-	}
-
 	// Получаем ID родительского комментария (если это ответ)
 	replyToIDStr := r.FormValue("reply_to_id")
 	var replyToID int64 = 0
 	if replyToIDStr != "" {
 		replyToID, err = strconv.ParseInt(replyToIDStr, 10, 64)
-		if err != nil {
-			slog.Error("Невозможно преобразовать ID родительского комментария в число", "reply_to_id", replyToIDStr, "error", err)
-			// Не возвращаем ошибку, просто игнорируем reply_to_id
-			replyToID = 0
+		if err != nil || replyToID <= 0 {
+			slog.Warn("Невозможно преобразовать ID родительского комментария в число", "reply_to_id", replyToIDStr, "error", err)
+			h.rejectInvalidComment(w, r, postID, 0, validation.Errors{{
+				Field:   validation.FieldReplyTo,
+				Message: "Неверный ID комментария для ответа",
+			}})
+			return
 		}
 	}
 
-	// Получаем файл изображения (если есть)
-	var imageURL string
-	file, handler, err := r.FormFile("file")
-	if err == nil && file != nil {
-		defer file.Close()
-		slog.Info("Файл получен", "filename", handler.Filename, "size", handler.Size)
+	// Получаем файлы изображений (если есть), до models.MaxAttachments в одной форме
+	headers := formFiles(r)
+	if errs := tooManyFiles(headers); errs != nil {
+		h.rejectInvalidComment(w, r, postID, replyToID, errs)
+		return
+	}
+	uploaded := &uploadedFiles{}
+	if len(headers) > 0 {
+		// Проверяем лимит на загрузку изображений
+		if !allowImageUpload(w, r, h.rateLimiter) {
+			return
+		}
 
-		// Читаем содержимое файла
-		buffer, err := io.ReadAll(file)
+		uploaded, err = uploadFiles(r.Context(), h.imageService, middleware.BoardFromRequest(r), headers, r.FormValue("spoiler") != "",
+			h.imageService.UploadCommentImage, h.imageService.UploadCommentImage)
+		if errors.Is(err, services.ErrImageRejected) {
+			h.rejectInvalidComment(w, r, postID, replyToID, validation.Errors{{Field: validation.FieldFile, Message: err.Error()}})
+			return
+		}
 		if err != nil {
 			slog.Error("Ошибка чтения файла", "error", err)
 			http.Error(w, "Ошибка при чтении файла", http.StatusInternalServerError)
 			return
 		}
-
-		// Генерируем ключ для объекта и загружаем изображение, если доступно хранилище
-		if storage := s3.GetImageStorage(); storage != nil {
-			objectKey := storage.GenerateObjectKey(handler.Filename)
-			imageURL, err = storage.UploadImage(r.Context(), "comments", objectKey, buffer)
-			if err != nil {
-				slog.Error("Ошибка загрузки изображения", "error", err)
-				// Продолжаем без изображения, если произошла ошибка
-				imageURL = ""
-			} else {
-				slog.Info("Изображение комментария загружено", "filename", handler.Filename, "size", handler.Size, "url", imageURL)
-			}
-		} else {
-			slog.Warn("Хранилище изображений не инициализировано")
-		}
 	}
 
 	// Создаем комментарий через сервис
-	comment, err := h.commentService.CreateComment(r.Context(), postID, user.ID, content, imageURL, replyToID)
+	comment, err := h.commentService.SubmitComment(r.Context(), &models.CommentDraft{
+		PostID:    postID,
+		UserID:    user.ID,
+		Content:   content,
+		ImageURL:  uploaded.cover.URL,
+		ImageHash: uploaded.hash,
+		ReplyToID: replyToID,
+
+		ImageWidth:   uploaded.cover.Width,
+		ImageHeight:  uploaded.cover.Height,
+		ThumbnailURL: uploaded.cover.ThumbnailURL,
+		Attachments:  uploaded.attachments,
+	})
+	if err != nil && h.imageService != nil {
+		// Отклоненная запись не ссылается на загруженные изображения
+		h.imageService.Release(r.Context(), uploaded.urls)
+	}
+	if errs, ok := validationErrors(err); ok {
+		h.rejectInvalidComment(w, r, postID, replyToID, errs)
+		return
+	}
+	if isSubmissionRejected(err) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, services.ErrThreadLocked) {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
 	if err != nil {
 		slog.Error("Ошибка создания комментария", "error", err)
 		http.Error(w, "Не удалось создать комментарий: "+err.Error(), http.StatusInternalServerError)
@@ -222,6 +324,25 @@ func (h *CommentHandler) HandleCreateComment(w http.ResponseWriter, r *http.Requ
 	http.Redirect(w, r, "/post/"+strconv.FormatInt(postID, 10), http.StatusSeeOther)
 }
 
+// rejectInvalidComment возвращает ошибки полей комментария со статусом 422:
+// JSON-клиентам списком, браузеру - страницей поста с заполненной формой
+func (h *CommentHandler) rejectInvalidComment(w http.ResponseWriter, r *http.Request, postID, replyToID int64, errs validation.Errors) {
+	if wantsJSON(r) {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if h.postPage == nil {
+		http.Error(w, errs.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	h.postPage.RenderPostPage(w, r, http.StatusUnprocessableEntity, postID, &CommentFormData{
+		Content:   r.FormValue("comment"),
+		ReplyToID: replyToID,
+		Errors:    errs.Fields(),
+	})
+}
+
 // HandleDeleteComment обрабатывает DELETE запрос для удаления комментария
 func (h *CommentHandler) HandleDeleteComment(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
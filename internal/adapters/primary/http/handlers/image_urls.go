@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+)
+
+// defaultProxyPrefix путь прокси хранилища, если построитель адресов не задан
+const defaultProxyPrefix = "/s3-proxy/"
+
+// imageURLs переводит ссылки на объекты хранилища из записей в адреса для браузера
+type imageURLs struct {
+	builder external.URLBuilder
+}
+
+// url возвращает адрес для браузера. Ссылки bucket/key строятся построителем адресов,
+// адреса сторонних сайтов возвращаются без изменений
+func (u imageURLs) url(ref string) string {
+	bucket, key, ok := models.ParseObjectPath(ref)
+	if !ok {
+		return ref
+	}
+	return u.objectURL(bucket, key)
+}
+
+// objectURL возвращает адрес объекта хранилища
+func (u imageURLs) objectURL(bucket, key string) string {
+	if u.builder == nil {
+		return defaultProxyPrefix + models.ObjectPath(bucket, key)
+	}
+	return u.builder.ObjectURL(bucket, key)
+}
+
+// post заполняет адреса изображения поста, его миниатюр и файлов галереи
+func (u imageURLs) post(post *models.Post) {
+	post.ImageURL = u.url(post.ImageURL)
+	post.ThumbnailURL = u.url(post.ThumbnailURL)
+	post.CatalogThumbnailURL = u.url(post.CatalogThumbnailURL)
+	u.attachments(post.Attachments)
+}
+
+// comment заполняет адреса изображения комментария, его миниатюры и файлов галереи
+func (u imageURLs) comment(comment *models.Comment) {
+	comment.ImageURL = u.url(comment.ImageURL)
+	comment.ThumbnailURL = u.url(comment.ThumbnailURL)
+	u.attachments(comment.Attachments)
+}
+
+// comments заполняет адреса изображений комментариев
+func (u imageURLs) comments(comments []*models.Comment) {
+	for _, comment := range comments {
+		u.comment(comment)
+	}
+}
+
+// attachments заполняет адреса файлов галереи
+func (u imageURLs) attachments(attachments []*models.Attachment) {
+	for _, attachment := range attachments {
+		attachment.URL = u.objectURL(attachment.Bucket, attachment.Key)
+		if attachment.ThumbnailKey != "" {
+			attachment.ThumbnailURL = u.objectURL(attachment.Bucket, attachment.ThumbnailKey)
+		}
+		if attachment.PosterKey != "" {
+			attachment.PosterURL = u.objectURL(attachment.Bucket, attachment.PosterKey)
+		}
+	}
+}
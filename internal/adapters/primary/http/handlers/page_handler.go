@@ -17,6 +17,11 @@ type TemplateData struct {
 
 // RenderTemplate рендерит шаблон с данными
 func RenderTemplate(w http.ResponseWriter, templateName string, data interface{}, title string, pageTitle string) error {
+	return RenderTemplateStatus(w, http.StatusOK, templateName, data, title, pageTitle)
+}
+
+// RenderTemplateStatus рендерит шаблон с данными и указанным кодом ответа
+func RenderTemplateStatus(w http.ResponseWriter, status int, templateName string, data interface{}, title string, pageTitle string) error {
 	// Загружаем шаблоны
 	tmpl, err := template.ParseFiles("templates/base.html", "templates/"+templateName)
 	if err != nil {
@@ -33,6 +38,7 @@ func RenderTemplate(w http.ResponseWriter, templateName string, data interface{}
 
 	// Рендерим шаблон
 	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
 	return tmpl.Execute(w, templateData)
 }
 
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/domain/services"
+)
+
+// PollHandler обрабатывает HTTP запросы для опросов в тредах
+type PollHandler struct {
+	pollService *services.PollService
+	postService *services.PostService
+}
+
+// NewPollHandler создает новый обработчик опросов
+func NewPollHandler(pollService *services.PollService, postService *services.PostService) *PollHandler {
+	return &PollHandler{
+		pollService: pollService,
+		postService: postService,
+	}
+}
+
+// pollVoteRequest описывает JSON тело голосования
+type pollVoteRequest struct {
+	OptionIDs []int64 `json:"option_ids"`
+}
+
+// HandlePoll обрабатывает /api/posts/{id}/poll: GET возвращает результаты, POST принимает голос
+func (h *PollHandler) HandlePoll(w http.ResponseWriter, r *http.Request) {
+	// Получаем пользователя из контекста
+	user := middleware.GetUserFromContext(r.Context())
+	if user == nil {
+		slog.Error("Пользователь не найден в контексте")
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
+
+	// Парсим ID поста из пути
+	path := strings.TrimPrefix(r.URL.Path, "/api/posts/")
+	path = strings.TrimSuffix(path, "/poll")
+	postID, err := strconv.ParseInt(path, 10, 64)
+	if err != nil {
+		slog.Error("Невозможно преобразовать ID в число", "path", path, "error", err)
+		http.Error(w, "Неверный ID поста", http.StatusBadRequest)
+		return
+	}
+
+	// Опрос скрытого треда недоступен так же, как сам тред
+	post, err := h.postService.GetPostByID(r.Context(), postID)
+	if err != nil || !post.Status.VisibleTo(post.UserID, user.ID) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		poll, err := h.pollService.GetPoll(r.Context(), postID, user.ID)
+		if err != nil {
+			h.writePollError(w, r, postID, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, poll)
+	case http.MethodPost:
+		h.handleVote(w, r, postID, user.ID)
+	default:
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVote принимает голос из JSON тела или из формы на странице треда
+func (h *PollHandler) handleVote(w http.ResponseWriter, r *http.Request, postID, userID int64) {
+	jsonBody := strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+
+	var optionIDs []int64
+	if jsonBody {
+		var req pollVoteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "Неверный формат запроса")
+			return
+		}
+		optionIDs = req.OptionIDs
+	} else {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Ошибка обработки данных формы", http.StatusBadRequest)
+			return
+		}
+		for _, value := range r.Form["option"] {
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				http.Error(w, services.ErrInvalidVote.Error(), http.StatusBadRequest)
+				return
+			}
+			optionIDs = append(optionIDs, id)
+		}
+	}
+
+	poll, err := h.pollService.Vote(r.Context(), postID, userID, optionIDs)
+	if err != nil {
+		h.writePollError(w, r, postID, err)
+		return
+	}
+
+	if jsonBody || wantsJSON(r) {
+		writeJSON(w, http.StatusOK, poll)
+		return
+	}
+	http.Redirect(w, r, "/post/"+strconv.FormatInt(postID, 10)+"#poll", http.StatusSeeOther)
+}
+
+// writePollError переводит ошибку сервиса опросов в HTTP статус
+func (h *PollHandler) writePollError(w http.ResponseWriter, r *http.Request, postID int64, err error) {
+	var status int
+	switch {
+	case errors.Is(err, services.ErrPollNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, services.ErrPollClosed), errors.Is(err, services.ErrAlreadyVoted):
+		status = http.StatusConflict
+	case errors.Is(err, services.ErrInvalidVote):
+		status = http.StatusBadRequest
+	default:
+		slog.Error("Ошибка обработки опроса", "post_id", postID, "error", err)
+		status = http.StatusInternalServerError
+		err = errors.New("не удалось обработать опрос")
+	}
+
+	if wantsJSON(r) || strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		writeJSONError(w, status, err.Error())
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -2,8 +2,8 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"html/template"
-	"io"
 	"log/slog"
 	"math"
 	"net/http"
@@ -12,9 +12,11 @@ import (
 	"time"
 
 	"1337b04rd/internal/adapters/primary/http/middleware"
-	"1337b04rd/internal/adapters/secondary/s3"
+	"1337b04rd/internal/domain/markup"
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/domain/validation"
+	"1337b04rd/internal/ports/external"
 )
 
 // PostHandler обрабатывает HTTP запросы для постов
@@ -22,6 +24,12 @@ type PostHandler struct {
 	postService    *services.PostService
 	userService    *services.UserService
 	commentService *services.CommentService
+	rateLimiter    *middleware.RateLimitMiddleware
+	captchaService *services.CaptchaService
+	pollService    *services.PollService
+	imageService   *services.ImageService
+	markup         *markup.Renderer
+	urls           imageURLs
 }
 
 // NewPostHandler создает новый обработчик постов
@@ -30,9 +38,134 @@ func NewPostHandler(postService *services.PostService, userService *services.Use
 		postService:    postService,
 		userService:    userService,
 		commentService: commentService,
+		markup:         markup.NewRenderer(1000),
 	}
 }
 
+// SetRateLimiter включает ограничение частоты загрузки изображений
+func (h *PostHandler) SetRateLimiter(rateLimiter *middleware.RateLimitMiddleware) {
+	h.rateLimiter = rateLimiter
+}
+
+// SetCaptchaService включает проверку капчи при создании треда
+func (h *PostHandler) SetCaptchaService(captchaService *services.CaptchaService) {
+	h.captchaService = captchaService
+}
+
+// SetImageService включает загрузку изображений тредов с миниатюрами
+func (h *PostHandler) SetImageService(imageService *services.ImageService) {
+	h.imageService = imageService
+}
+
+// SetURLBuilder задает способ построения адресов загруженных файлов.
+// По умолчанию файлы отдаются через прокси хранилища
+func (h *PostHandler) SetURLBuilder(builder external.URLBuilder) {
+	h.urls = imageURLs{builder: builder}
+}
+
+// SetPollService включает вывод опросов на странице треда
+func (h *PostHandler) SetPollService(pollService *services.PollService) {
+	h.pollService = pollService
+}
+
+// CreatePostPageData содержит данные для шаблона создания поста
+type CreatePostPageData struct {
+	Board   string
+	Captcha *models.CaptchaChallenge
+	Error   string
+	// Errors сообщения об ошибках по именам полей формы
+	Errors  map[string]string
+	Name    string
+	Subject string
+	Comment string
+	// Поля опроса: варианты по одному на строку, выбор нескольких и срок в часах
+	PollOptions  string
+	PollMultiple bool
+	PollClosesIn string
+}
+
+// HandleCreatePostPage отображает форму создания поста
+func (h *PostHandler) HandleCreatePostPage(w http.ResponseWriter, r *http.Request) {
+	data := &CreatePostPageData{Board: middleware.BoardFromRequest(r)}
+	h.renderCreatePostPage(w, r, http.StatusOK, data)
+}
+
+// renderCreatePostPage рендерит форму создания поста, при необходимости с новой капчей
+func (h *PostHandler) renderCreatePostPage(w http.ResponseWriter, r *http.Request, status int, data *CreatePostPageData) {
+	if h.captchaService != nil && h.captchaService.Required(r.Context(), data.Board) {
+		challenge, err := h.captchaService.NewChallenge()
+		if err != nil {
+			slog.Error("Ошибка создания капчи", "error", err)
+		} else {
+			data.Captcha = challenge
+		}
+	}
+
+	err := RenderTemplateStatus(w, status, "create-post.html", data, "Создать пост", "Создание нового поста")
+	if err != nil {
+		slog.Error("Ошибка рендеринга шаблона", "template", "create-post.html", "error", err)
+		http.Error(w, "Ошибка шаблона", http.StatusInternalServerError)
+	}
+}
+
+// rejectCreatePost сообщает об ошибке в форме создания поста:
+// JSON-клиентам возвращает ошибку, браузеру - форму с сохраненными значениями
+func (h *PostHandler) rejectCreatePost(w http.ResponseWriter, r *http.Request, status int, message string) {
+	if wantsJSON(r) {
+		writeJSONError(w, status, message)
+		return
+	}
+
+	data := createPostFormData(r)
+	data.Error = message
+	h.renderCreatePostPage(w, r, status, data)
+}
+
+// rejectInvalidPost возвращает ошибки полей формы создания поста со статусом 422
+func (h *PostHandler) rejectInvalidPost(w http.ResponseWriter, r *http.Request, errs validation.Errors) {
+	if wantsJSON(r) {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	data := createPostFormData(r)
+	data.Errors = errs.Fields()
+	h.renderCreatePostPage(w, r, http.StatusUnprocessableEntity, data)
+}
+
+// createPostFormData заполняет форму создания поста отправленными значениями
+func createPostFormData(r *http.Request) *CreatePostPageData {
+	return &CreatePostPageData{
+		Board:   middleware.BoardFromRequest(r),
+		Name:    r.FormValue("name"),
+		Subject: r.FormValue("subject"),
+		Comment: r.FormValue("comment"),
+
+		PollOptions:  r.FormValue("poll_options"),
+		PollMultiple: r.FormValue("poll_multiple") != "",
+		PollClosesIn: r.FormValue("poll_closes_in"),
+	}
+}
+
+// pollDraftFromRequest собирает черновик опроса из формы создания треда.
+// Пустое поле вариантов означает тред без опроса
+func pollDraftFromRequest(r *http.Request) *models.PollDraft {
+	options := r.FormValue("poll_options")
+	if strings.TrimSpace(options) == "" {
+		return nil
+	}
+
+	draft := &models.PollDraft{
+		Options:  strings.Split(strings.ReplaceAll(options, "\r\n", "\n"), "\n"),
+		Multiple: r.FormValue("poll_multiple") != "",
+	}
+	if hours, err := strconv.Atoi(r.FormValue("poll_closes_in")); err == nil && hours != 0 {
+		closesAt := time.Now().Add(time.Duration(hours) * time.Hour)
+		draft.ClosesAt = &closesAt
+	}
+	return draft
+}
+
 // PaginationData содержит информацию о пагинации для шаблонов
 type PaginationData struct {
 	Posts       []*models.Post
@@ -44,13 +177,6 @@ type PaginationData struct {
 	Limit       int
 }
 
-// FixImageURL преобразует URL изображения для доступа из браузера
-
-func FixImageURL(url string) string {
-	// Заменяем http://s3:9000/ на /s3-proxy/
-	return strings.Replace(url, "http://s3:9000", "http://localhost:9000", 1)
-}
-
 // HandleGetPost обрабатывает GET запрос для получения поста
 func (h *PostHandler) HandleGetPost(w http.ResponseWriter, r *http.Request) {
 	// Получаем пользователя из контекста
@@ -77,11 +203,15 @@ func (h *PostHandler) HandleGetPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Исправляем URL изображения для доступа из браузера
-	if post.ImageURL != "" {
-		post.ImageURL = FixImageURL(post.ImageURL)
+	// Скрытый пост видит только его автор
+	if !post.Status.VisibleTo(post.UserID, user.ID) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
 	}
 
+	// Исправляем URL изображения для доступа из браузера
+	h.urls.post(post)
+
 	// Проверяем, нужно ли вернуть JSON или HTML
 	contentType := r.Header.Get("Accept")
 	if strings.Contains(contentType, "application/json") {
@@ -90,42 +220,133 @@ func (h *PostHandler) HandleGetPost(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(post)
 	} else {
 		// Возвращаем HTML страницу поста
-		tmpl, err := template.ParseFiles("templates/post.html")
-		if err != nil {
-			slog.Error("Ошибка загрузки шаблона", "error", err)
-			http.Error(w, "Ошибка шаблона", http.StatusInternalServerError)
-			return
-		}
+		h.renderPostPage(w, r, http.StatusOK, post, user, nil)
+	}
+}
 
-		// Получаем комментарии к посту
-		comments, err := h.commentService.GetCommentsByPostID(r.Context(), post.ID, 50, 0)
-		if err != nil {
-			slog.Error("Ошибка при получении комментариев", "post_id", post.ID, "error", err)
-			http.Error(w, "Ошибка при получении комментариев", http.StatusInternalServerError)
-			return
-		}
+// CommentFormData содержит отправленные значения формы комментария и ошибки по полям
+type CommentFormData struct {
+	Content   string
+	ReplyToID int64
+	Errors    map[string]string
+}
+
+// RenderPostPage отображает страницу поста с формой комментария, возвращенной с ошибками
+func (h *PostHandler) RenderPostPage(w http.ResponseWriter, r *http.Request, status int, postID int64, form *CommentFormData) {
+	user := middleware.GetUserFromContext(r.Context())
+	if user == nil {
+		http.Error(w, "Ошибка авторизации", http.StatusUnauthorized)
+		return
+	}
 
-		// Исправляем URL изображений в комментариях
-		for i := range comments {
-			if comments[i].ImageURL != "" {
-				comments[i].ImageURL = FixImageURL(comments[i].ImageURL)
+	post, err := h.postService.GetPostByID(r.Context(), postID)
+	if err != nil || !post.Status.VisibleTo(post.UserID, user.ID) {
+		http.Error(w, "Пост не найден", http.StatusNotFound)
+		return
+	}
+	h.urls.post(post)
+
+	h.renderPostPage(w, r, status, post, user, form)
+}
+
+// renderPostPage рендерит страницу поста с комментариями
+func (h *PostHandler) renderPostPage(w http.ResponseWriter, r *http.Request, status int, post *models.Post, user *models.User, form *CommentFormData) {
+	// Разметка сообщений рендерится при показе, в БД хранится исходный текст
+	tmpl, err := template.New("post.html").
+		Funcs(template.FuncMap{"markup": h.markup.Render}).
+		ParseFiles("templates/post.html")
+	if err != nil {
+		slog.Error("Ошибка загрузки шаблона", "error", err)
+		http.Error(w, "Ошибка шаблона", http.StatusInternalServerError)
+		return
+	}
+
+	// Получаем комментарии к посту: хронологически по курсору или ветками с постраничным выводом корней
+	treeView := r.URL.Query().Get("view") == "tree"
+	page, prevPage, nextPage := 1, 0, 0
+	var after, nextAfter int64
+	var comments []*models.Comment
+	if treeView {
+		if p, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil && p > 1 {
+			page = p
+		}
+		var tree *models.CommentTree
+		tree, err = h.commentService.GetCommentTree(r.Context(), post.ID, user.ID, services.DefaultTreeBranches, (page-1)*services.DefaultTreeBranches)
+		if err == nil {
+			comments = tree.Comments
+			prevPage = page - 1
+			if tree.HasMore {
+				nextPage = page + 1
+			}
+		}
+	} else {
+		if a, err := strconv.ParseInt(r.URL.Query().Get("after"), 10, 64); err == nil && a > 0 {
+			after = a
+		}
+		var commentPage *models.CommentPage
+		commentPage, err = h.commentService.GetCommentPage(r.Context(), post.ID, user.ID, after, services.DefaultCommentPage)
+		if err == nil {
+			comments = commentPage.Comments
+			if commentPage.HasMore {
+				nextAfter = commentPage.NextAfter
 			}
 		}
+	}
+	if err != nil {
+		slog.Error("Ошибка при получении комментариев", "post_id", post.ID, "error", err)
+		http.Error(w, "Ошибка при получении комментариев", http.StatusInternalServerError)
+		return
+	}
 
-		// Создаем данные для шаблона
-		templateData := struct {
-			*models.Post
-			Comments []*models.Comment
-			User     *models.User
-		}{
-			Post:     post,
-			Comments: comments,
-			User:     user,
+	comments = models.VisibleComments(comments, user.ID)
+
+	// Исправляем URL изображений в комментариях
+	for i := range comments {
+		h.urls.comment(comments[i])
+	}
+
+	if form == nil {
+		form = &CommentFormData{}
+	}
+
+	// Опрос выводится над комментариями, ошибка не мешает показать тред
+	var poll *models.Poll
+	if h.pollService != nil {
+		poll, err = h.pollService.GetPoll(r.Context(), post.ID, user.ID)
+		if err != nil && !errors.Is(err, services.ErrPollNotFound) {
+			slog.Error("Ошибка получения опроса", "post_id", post.ID, "error", err)
 		}
+	}
 
-		// Передаем данные в шаблон
-		tmpl.Execute(w, templateData)
+	// Создаем данные для шаблона
+	templateData := struct {
+		*models.Post
+		Comments    []*models.Comment
+		User        *models.User
+		CommentForm *CommentFormData
+		TreeView    bool
+		PrevPage    int
+		NextPage    int
+		After       int64
+		NextAfter   int64
+		Poll        *models.Poll
+	}{
+		Post:        post,
+		Comments:    comments,
+		User:        user,
+		CommentForm: form,
+		TreeView:    treeView,
+		PrevPage:    prevPage,
+		NextPage:    nextPage,
+		After:       after,
+		NextAfter:   nextAfter,
+		Poll:        poll,
 	}
+
+	// Передаем данные в шаблон
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	tmpl.Execute(w, templateData)
 }
 
 // HandleGetAllPosts обрабатывает GET запрос для получения списка постов с пагинацией
@@ -167,35 +388,29 @@ func (h *PostHandler) HandleGetAllPosts(w http.ResponseWriter, r *http.Request)
 		archived = true
 	}
 
-	// Получаем общее количество постов для расчета пагинации
-	posts, err := h.postService.GetAllPosts(r.Context(), limit, offset, archived)
+	// Получаем карточки каталога со сводкой по ответам
+	posts, totalPosts, err := h.postService.GetCatalog(r.Context(), limit, offset, archived)
 	if err != nil {
 		slog.Error("Ошибка получения списка постов", "error", err)
 		http.Error(w, "Не удалось получить список постов", http.StatusInternalServerError)
 		return
 	}
 
-	// Исправляем URL изображений для всех постов
+	// Исправляем URL изображений для всех постов и превью ответов
 	for i := range posts {
-		if posts[i].ImageURL != "" {
-			posts[i].ImageURL = FixImageURL(posts[i].ImageURL)
-		}
-	}
-	// Исправляем URL изображений для всех постов
-	for i := range posts {
-		if posts[i].ImageURL != "" {
-			posts[i].ImageURL = FixImageURL(posts[i].ImageURL)
+		h.urls.post(posts[i].Post)
+		for _, reply := range posts[i].LastReplies {
+			h.urls.comment(reply)
 		}
 	}
 
-	// Используем предполагаемое общее количество постов для демонстрации
-	// В реальном приложении следует получить точное количество из базы данных
-	totalPosts := 100 // Предполагаемое количество для демонстрации
-	if archived {
-		totalPosts = 50 // Меньше постов в архиве
+	if wantsJSON(r) {
+		writeJSON(w, http.StatusOK, posts)
+		return
 	}
 
-	totalPages := int(math.Ceil(float64(totalPosts) / float64(limit)))
+	// Пустой каталог выводится одной страницей
+	totalPages := max(int(math.Ceil(float64(totalPosts)/float64(limit))), 1)
 	prevPage := page - 1
 	if prevPage < 1 {
 		prevPage = 1
@@ -229,7 +444,7 @@ func (h *PostHandler) HandleGetAllPosts(w http.ResponseWriter, r *http.Request)
 		Title       string
 		PageTitle   string
 		CurrentYear int
-		Posts       []*models.Post
+		Posts       []*models.CatalogEntry
 		CurrentPage int
 		PrevPage    int
 		NextPage    int
@@ -289,61 +504,105 @@ func (h *PostHandler) HandleCreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Получаем данные формы
-	err := r.ParseMultipartForm(10 << 20) // 10 MB
+	err := parseUploadForm(w, r)
+	if isRequestTooLarge(err) {
+		slog.Warn("Слишком большой запрос", "user_id", user.ID, "error", err)
+		http.Error(w, "Файл слишком большой", http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		slog.Error("Ошибка парсинга формы", "error", err)
 		http.Error(w, "Неверный формат данных", http.StatusBadRequest)
 		return
 	}
 
-	// Получаем имя пользователя из формы или используем имя из сессии
+	// Имя из формы подписывает только этот пост, пустое - имя из сессии
 	name := r.FormValue("name")
-	if name != "" && name != user.Username {
-		// В реальной реализации здесь нужно обновить имя пользователя в БД
-		user.Username = name
-	}
-
 	subject := r.FormValue("subject")
 	comment := r.FormValue("comment")
 
-	// Получаем файл изображения
-	file, handler, err := r.FormFile("file")
-	var imageURL string
-	if err == nil && file != nil {
-		defer file.Close()
+	// Доска треда проверена по настроенным доскам: форма ошибки, капча
+	// и ограничения загрузок используют одно и то же значение
+	board := middleware.BoardFromRequest(r)
 
-		// Читаем содержимое файла
-		buffer, err := io.ReadAll(file)
+	// Проверяем капчу, если она требуется на этой доске
+	if h.captchaService != nil && h.captchaService.Required(r.Context(), board) {
+		err := h.captchaService.Verify(r.Context(), r.FormValue("captcha_token"), r.FormValue("captcha_answer"))
 		if err != nil {
-			slog.Error("Ошибка чтения файла", "error", err)
-			http.Error(w, "Ошибка при чтении файла", http.StatusInternalServerError)
+			slog.Warn("Капча не пройдена", "user_id", user.ID, "error", err)
+			h.rejectCreatePost(w, r, http.StatusBadRequest, err.Error())
 			return
 		}
+	}
 
-		// Генерируем ключ для объекта и загружаем изображение, если доступно хранилище
-		if storage := s3.GetImageStorage(); storage != nil {
-			objectKey := storage.GenerateObjectKey(handler.Filename)
-			imageURL, err = storage.UploadImage(r.Context(), "posts", objectKey, buffer)
-			if err != nil {
-				slog.Error("Ошибка загрузки изображения", "error", err)
-				// Продолжаем без изображения, если произошла ошибка
-				imageURL = ""
-			} else {
-				slog.Info("Изображение загружено", "filename", handler.Filename, "size", handler.Size, "url", imageURL)
-			}
-		} else {
-			slog.Warn("Хранилище изображений не инициализировано")
+	// Получаем файлы изображений, до models.MaxAttachments в одной форме
+	headers := formFiles(r)
+	if errs := tooManyFiles(headers); errs != nil {
+		h.rejectInvalidPost(w, r, errs)
+		return
+	}
+	uploaded := &uploadedFiles{}
+	if len(headers) > 0 {
+		// Проверяем лимит на загрузку изображений
+		if !allowImageUpload(w, r, h.rateLimiter) {
+			return
+		}
+
+		// Обложка получает миниатюру для каталога, остальные файлы только для треда
+		uploaded, err = uploadFiles(r.Context(), h.imageService, board, headers, r.FormValue("spoiler") != "",
+			h.imageService.UploadPostImage, h.imageService.UploadPostAttachment)
+		if errors.Is(err, services.ErrImageRejected) {
+			h.rejectInvalidPost(w, r, validation.Errors{{Field: validation.FieldFile, Message: err.Error()}})
+			return
+		}
+		if err != nil {
+			slog.Error("Ошибка чтения файла", "error", err)
+			http.Error(w, "Ошибка при чтении файла", http.StatusInternalServerError)
+			return
 		}
 	}
 
 	// Создаем пост, используя ID пользователя из сессии
-	post, err := h.postService.CreatePost(r.Context(), subject, comment, imageURL, user.ID)
+	post, err := h.postService.SubmitPost(r.Context(), &models.PostDraft{
+		Name:      name,
+		Title:     subject,
+		Content:   comment,
+		ImageURL:  uploaded.cover.URL,
+		ImageHash: uploaded.hash,
+		UserID:    user.ID,
+		Poll:      pollDraftFromRequest(r),
+
+		ImageWidth:          uploaded.cover.Width,
+		ImageHeight:         uploaded.cover.Height,
+		ThumbnailURL:        uploaded.cover.ThumbnailURL,
+		CatalogThumbnailURL: uploaded.cover.CatalogThumbnailURL,
+		Attachments:         uploaded.attachments,
+	})
+	if err != nil && h.imageService != nil {
+		// Отклоненная запись не ссылается на загруженные изображения
+		h.imageService.Release(r.Context(), uploaded.urls)
+	}
+	if errs, ok := validationErrors(err); ok {
+		h.rejectInvalidPost(w, r, errs)
+		return
+	}
+	if isSubmissionRejected(err) {
+		h.rejectCreatePost(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
 	if err != nil {
 		slog.Error("Ошибка создания поста", "error", err)
 		http.Error(w, "Не удалось создать пост", http.StatusInternalServerError)
 		return
 	}
 
+	// JSON-клиентам возвращаем созданный пост
+	if wantsJSON(r) {
+		h.urls.post(post)
+		writeJSON(w, http.StatusCreated, post)
+		return
+	}
+
 	// Перенаправляем на страницу созданного поста
 	http.Redirect(w, r, "/post/"+strconv.FormatInt(post.ID, 10), http.StatusSeeOther)
 }
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// cacheFileSuffix расширение файлов кэша. При запуске удаляются только такие файлы,
+// поэтому кэш можно направить в каталог с другими данными
+const cacheFileSuffix = ".s3cache"
+
+// errObjectTooLarge возвращается, когда объект больше наибольшего размера для кэша
+var errObjectTooLarge = errors.New("объект слишком большой для кэша")
+
+// cachedObject сведения об объекте в кэше, которые нужны для ответа браузеру
+type cachedObject struct {
+	ContentType  string
+	ETag         string
+	LastModified time.Time
+	Size         int64
+}
+
+// proxyCacheEntry элемент LRU-кэша
+type proxyCacheEntry struct {
+	name   string
+	object cachedObject
+}
+
+// ProxyCacheStats статистика дискового кэша прокси
+type ProxyCacheStats struct {
+	Hits      int64
+	Misses    int64
+	Evictions int64
+	Objects   int
+	Bytes     int64
+	MaxBytes  int64
+}
+
+// ProxyCache ограниченный по размеру дисковый LRU-кэш объектов хранилища.
+// Объекты адресуются по содержимому и не меняются, поэтому кэш не проверяет их свежесть.
+// Сведения об объектах хранятся в памяти, после перезапуска кэш начинается с нуля
+type ProxyCache struct {
+	dir       string
+	maxBytes  int64
+	maxObject int64
+
+	mu        sync.Mutex
+	size      int64
+	order     *list.List
+	entries   map[string]*list.Element
+	hits      int64
+	misses    int64
+	evictions int64
+}
+
+// NewProxyCache создает кэш в каталоге dir размером до maxBytes. Объекты больше
+// maxObject не кэшируются. Файлы кэша от прошлого запуска удаляются
+func NewProxyCache(dir string, maxBytes, maxObject int64) (*ProxyCache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("ошибка создания каталога кэша: %w", err)
+	}
+
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+cacheFileSuffix+"*"))
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения каталога кэша: %w", err)
+	}
+	for _, name := range stale {
+		os.Remove(name)
+	}
+
+	return &ProxyCache{
+		dir:       dir,
+		maxBytes:  maxBytes,
+		maxObject: min(maxObject, maxBytes),
+		order:     list.New(),
+		entries:   make(map[string]*list.Element),
+	}, nil
+}
+
+// Open возвращает открытый файл объекта из кэша. Файл, вытесненный после открытия,
+// остается доступным для чтения до закрытия
+func (c *ProxyCache) Open(objectPath string) (*os.File, cachedObject, bool) {
+	name := c.fileName(objectPath)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[name]
+	if !ok {
+		c.misses++
+		return nil, cachedObject{}, false
+	}
+	file, err := os.Open(filepath.Join(c.dir, name))
+	if err != nil {
+		// Файл удален снаружи, запись больше не нужна
+		c.remove(elem)
+		c.misses++
+		return nil, cachedObject{}, false
+	}
+	c.order.MoveToFront(elem)
+	c.hits++
+	return file, elem.Value.(*proxyCacheEntry).object, true
+}
+
+// Store записывает тело объекта в кэш и возвращает файл, открытый с начала.
+// Для объекта больше наибольшего размера возвращается errObjectTooLarge и файл
+// с уже прочитанной частью тела, чтобы ответ можно было продолжить из body
+func (c *ProxyCache) Store(objectPath string, object cachedObject, body io.Reader) (*os.File, error) {
+	if object.Size > c.maxObject {
+		return nil, errObjectTooLarge
+	}
+
+	name := c.fileName(objectPath)
+	file, err := os.CreateTemp(c.dir, name+".*.tmp")
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания файла кэша: %w", err)
+	}
+
+	written, err := io.Copy(file, io.LimitReader(body, c.maxObject+1))
+	if err == nil && written > c.maxObject {
+		err = errObjectTooLarge
+	}
+	if _, seekErr := file.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if err != nil {
+		// Временный файл удаляется сразу, открытый дескриптор остается читаемым
+		os.Remove(file.Name())
+		if errors.Is(err, errObjectTooLarge) {
+			return file, err
+		}
+		file.Close()
+		return nil, fmt.Errorf("ошибка записи файла кэша: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(file.Name())
+		return file, nil
+	}
+
+	object.Size = written
+	c.mu.Lock()
+	if elem, ok := c.entries[name]; ok {
+		// Тот же объект сохранил параллельный запрос, его файл уже заменен новым
+		previous := c.order.Remove(elem).(*proxyCacheEntry)
+		c.size -= previous.object.Size
+	}
+	c.entries[name] = c.order.PushFront(&proxyCacheEntry{name: name, object: object})
+	c.size += written
+	for c.size > c.maxBytes && c.order.Len() > 1 {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+	c.mu.Unlock()
+
+	return file, nil
+}
+
+// Stats возвращает статистику кэша
+func (c *ProxyCache) Stats() ProxyCacheStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return ProxyCacheStats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Objects:   c.order.Len(),
+		Bytes:     c.size,
+		MaxBytes:  c.maxBytes,
+	}
+}
+
+// remove удаляет запись и файл кэша. Вызывается под блокировкой
+func (c *ProxyCache) remove(elem *list.Element) {
+	entry := c.order.Remove(elem).(*proxyCacheEntry)
+	delete(c.entries, entry.name)
+	c.size -= entry.object.Size
+	if err := os.Remove(filepath.Join(c.dir, entry.name)); err != nil && !os.IsNotExist(err) {
+		slog.Warn("Ошибка удаления файла кэша", "file", entry.name, "error", err)
+	}
+}
+
+// fileName возвращает имя файла кэша для объекта bucket/key
+func (c *ProxyCache) fileName(objectPath string) string {
+	sum := sha256.Sum256([]byte(objectPath))
+	return hex.EncodeToString(sum[:]) + cacheFileSuffix
+}
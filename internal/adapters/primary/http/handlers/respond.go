@@ -0,0 +1,48 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/domain/validation"
+)
+
+// wantsJSON сообщает, что клиент ожидает ответ в формате JSON
+func wantsJSON(r *http.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+// writeJSON отправляет значение в формате JSON с указанным статусом
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeJSONError отправляет ошибку в формате JSON
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// isSubmissionRejected сообщает, что отправку отклонил фильтр содержимого или спам-оценщик
+func isSubmissionRejected(err error) bool {
+	return errors.Is(err, services.ErrContentRejected) || errors.Is(err, services.ErrSpamRejected)
+}
+
+// validationErrors извлекает ошибки полей из ошибки сервиса
+func validationErrors(err error) (validation.Errors, bool) {
+	var errs validation.Errors
+	ok := errors.As(err, &errs)
+	return errs, ok
+}
+
+// writeValidationErrors отвечает 422 с сообщениями по полям
+func writeValidationErrors(w http.ResponseWriter, errs validation.Errors) {
+	writeJSON(w, http.StatusUnprocessableEntity, map[string]interface{}{
+		"error":  errs.Error(),
+		"fields": errs.Fields(),
+	})
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+const (
+	// immutableCacheControl для объектов с ключом по SHA-256 содержимого: по такому
+	// адресу всегда отдаются одни и те же байты
+	immutableCacheControl = "max-age=31536000, immutable"
+	// legacyCacheControl для объектов, загруженных до ключей по содержимому
+	legacyCacheControl = "max-age=3600"
+
+	// maxSpoolSize наибольший объект, который прокси сохраняет во временный файл,
+	// чтобы ответить на Range без поддержки диапазонов в хранилище
+	maxSpoolSize = 20 << 20 // 20 МБ
+)
+
+// contentAddressedKey ключ объекта по SHA-256 содержимого с необязательным суффиксом копии
+var contentAddressedKey = regexp.MustCompile(`^[0-9a-f]{64}(_[a-z]+)?\.[a-z0-9]+$`)
+
+// proxiedUploadHeaders заголовки ответа хранилища, которые передаются браузеру
+var proxiedUploadHeaders = []string{"Content-Length", "Content-Range", "Accept-Ranges", "ETag", "Last-Modified"}
+
+// forwardedRequestHeaders условные заголовки и диапазоны запроса, которые передаются хранилищу
+var forwardedRequestHeaders = []string{"Range", "If-Range", "If-None-Match", "If-Modified-Since"}
+
+// inlineUploadTypes растровые форматы и видео, которые браузер может показывать на странице
+var inlineUploadTypes = map[string]bool{
+	"image/jpeg": true,
+	"image/png":  true,
+	"image/gif":  true,
+	"image/webp": true,
+	"video/webm": true,
+	"video/mp4":  true,
+}
+
+// HTTPDoer выполняет запросы к хранилищу
+type HTTPDoer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// URLVerifier проверяет подпись адреса объекта по параметрам запроса
+type URLVerifier interface {
+	Verify(bucket, key string, query url.Values) error
+}
+
+// StorageProxy отдает объекты хранилища браузеру с защитными заголовками.
+// Соединения с хранилищем переиспользуются, ETag, Last-Modified и Range обрабатываются
+// с ответами 304 и 206, даже если хранилище их не поддерживает
+type StorageProxy struct {
+	prefix    string
+	upstream  func(bucket, key string) string
+	transport *http.Transport
+	client    HTTPDoer
+	verifier  URLVerifier
+	cache     *ProxyCache
+}
+
+// NewStorageProxy создает прокси для путей вида prefix/bucket/key. upstream возвращает
+// адрес объекта в хранилище, см. external.ImageStorage.ObjectURL
+func NewStorageProxy(prefix string, upstream func(bucket, key string) string) *StorageProxy {
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   32,
+		IdleConnTimeout:       90 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+	}
+
+	return &StorageProxy{
+		prefix:    prefix,
+		upstream:  upstream,
+		transport: transport,
+		// Общий таймаут не задается: видео может передаваться дольше, чем ждать заголовков
+		client: &http.Client{Transport: transport},
+	}
+}
+
+// Transport возвращает пул соединений прокси с хранилищем. Клиент из SetClient
+// должен использовать его, чтобы сохранить переиспользование соединений и таймауты
+func (p *StorageProxy) Transport() http.RoundTripper {
+	return p.transport
+}
+
+// SetClient задает клиент хранилища, например с повторными попытками и автоматом защиты
+func (p *StorageProxy) SetClient(client HTTPDoer) {
+	p.client = client
+}
+
+// SetVerifier включает проверку подписанных адресов. Без действующей подписи
+// объекты не отдаются
+func (p *StorageProxy) SetVerifier(verifier URLVerifier) {
+	p.verifier = verifier
+}
+
+// SetCache включает дисковый кэш часто запрашиваемых объектов
+func (p *StorageProxy) SetCache(cache *ProxyCache) {
+	p.cache = cache
+}
+
+// CacheStats возвращает статистику кэша, nil без кэша
+func (p *StorageProxy) CacheStats() *ProxyCacheStats {
+	if p.cache == nil {
+		return nil
+	}
+	stats := p.cache.Stats()
+	return &stats
+}
+
+// ServeHTTP отдает объект хранилища
+func (p *StorageProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Списки бакетов и вложенные пути не отдаются
+	bucket, objectKey, ok := models.ParseObjectPath(strings.TrimPrefix(r.URL.Path, p.prefix))
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Со стратегией signed отдаются только объекты по действующей подписи
+	if p.verifier != nil {
+		if err := p.verifier.Verify(bucket, objectKey, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+	}
+
+	objectPath := models.ObjectPath(bucket, objectKey)
+	if p.cache != nil {
+		if file, object, ok := p.cache.Open(objectPath); ok {
+			defer file.Close()
+			p.serveFile(w, r, objectKey, file, object)
+			return
+		}
+	}
+
+	req, err := http.NewRequestWithContext(r.Context(), http.MethodGet, p.upstream(bucket, objectKey), nil)
+	if err != nil {
+		slog.Error("Ошибка создания запроса к S3", "error", err)
+		http.Error(w, "Ошибка получения изображения", http.StatusInternalServerError)
+		return
+	}
+	// Для кэша нужен весь объект, диапазоны и условия тогда проверяются по файлу
+	if p.cache == nil {
+		for _, key := range forwardedRequestHeaders {
+			if value := r.Header.Get(key); value != "" {
+				req.Header.Set(key, value)
+			}
+		}
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		slog.Error("Ошибка при запросе к S3", "path", objectPath, "error", err)
+		http.Error(w, "Ошибка получения изображения", http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		p.serveUpstream(w, r, objectPath, objectKey, resp)
+	case http.StatusNotModified, http.StatusPartialContent:
+		// Хранилище само проверило условия запроса
+		copyUploadHeaders(w.Header(), resp.Header, objectKey, p.cacheControl(objectKey))
+		w.WriteHeader(resp.StatusCode)
+		if r.Method != http.MethodHead {
+			io.Copy(w, resp.Body)
+		}
+	case http.StatusNotFound, http.StatusForbidden:
+		http.NotFound(w, r)
+	case http.StatusRequestedRangeNotSatisfiable:
+		w.Header().Set("Content-Range", resp.Header.Get("Content-Range"))
+		http.Error(w, "Диапазон недоступен", resp.StatusCode)
+	default:
+		slog.Error("Неожиданный ответ S3", "path", objectPath, "status", resp.StatusCode)
+		http.Error(w, "Ошибка получения изображения", http.StatusBadGateway)
+	}
+}
+
+// serveUpstream отдает полный ответ хранилища. Объект сохраняется в кэш или
+// во временный файл для запроса Range, остальные ответы передаются потоком
+func (p *StorageProxy) serveUpstream(w http.ResponseWriter, r *http.Request, objectPath, objectKey string, resp *http.Response) {
+	object := cachedObject{
+		ContentType: resp.Header.Get("Content-Type"),
+		ETag:        resp.Header.Get("ETag"),
+		Size:        resp.ContentLength,
+	}
+	if object.ETag == "" && contentAddressedKey.MatchString(objectKey) {
+		// Ключ по содержимому годится как сильный ETag
+		object.ETag = `"` + objectKey + `"`
+	}
+	if modified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		object.LastModified = modified
+	}
+
+	var body io.Reader = resp.Body
+	var file *os.File
+	var err error
+	switch {
+	case p.cache != nil:
+		file, err = p.cache.Store(objectPath, object, resp.Body)
+	case r.Header.Get("Range") != "" && r.Method == http.MethodGet:
+		file, err = spool(object.Size, resp.Body)
+	}
+	if file != nil {
+		defer file.Close()
+	}
+
+	switch {
+	case file != nil && err == nil:
+		p.serveFile(w, r, objectKey, file, object)
+		return
+	case errors.Is(err, errObjectTooLarge):
+		// Уже прочитанная часть лежит в файле, остальное еще в теле ответа
+		if file != nil {
+			body = io.MultiReader(file, resp.Body)
+		}
+	case err != nil:
+		slog.Error("Ошибка сохранения объекта во временный файл", "key", objectKey, "error", err)
+		http.Error(w, "Ошибка получения изображения", http.StatusInternalServerError)
+		return
+	}
+
+	p.setHeaders(w.Header(), objectKey, object)
+	if object.Size >= 0 {
+		w.Header().Set("Content-Length", fmt.Sprint(object.Size))
+	}
+	if notModified(r, object) {
+		w.Header().Del("Content-Length")
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	if r.Method != http.MethodHead {
+		io.Copy(w, body)
+	}
+}
+
+// serveFile отдает объект из файла. http.ServeContent обрабатывает Range,
+// If-Range, If-None-Match и If-Modified-Since
+func (p *StorageProxy) serveFile(w http.ResponseWriter, r *http.Request, objectKey string, file *os.File, object cachedObject) {
+	p.setHeaders(w.Header(), objectKey, object)
+	http.ServeContent(w, r, objectKey, object.LastModified, file)
+}
+
+// setHeaders задает заголовки ответа объекта
+func (p *StorageProxy) setHeaders(dst http.Header, objectKey string, object cachedObject) {
+	src := http.Header{}
+	src.Set("Content-Type", object.ContentType)
+	src.Set("ETag", object.ETag)
+	if !object.LastModified.IsZero() {
+		// Без Last-Modified браузер не присылает If-Modified-Since
+		src.Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+	}
+	copyUploadHeaders(dst, src, objectKey, p.cacheControl(objectKey))
+	dst.Set("Accept-Ranges", "bytes")
+}
+
+// cacheControl возвращает Cache-Control объекта. Подписанные адреса не кэшируются
+// общими кэшами, иначе объект был бы доступен после истечения подписи
+func (p *StorageProxy) cacheControl(objectKey string) string {
+	scope := "public"
+	if p.verifier != nil {
+		scope = "private"
+	}
+	if contentAddressedKey.MatchString(objectKey) {
+		return scope + ", " + immutableCacheControl
+	}
+	return scope + ", " + legacyCacheControl
+}
+
+// copyUploadHeaders переносит разрешенные заголовки ответа S3 и добавляет защиту
+// от хранимого XSS: nosniff, запрещающую все CSP и Content-Disposition.
+// Растровые изображения и видео отдаются inline, SVG и прочие файлы только для скачивания
+func copyUploadHeaders(dst, src http.Header, objectKey, cacheControl string) {
+	for _, key := range proxiedUploadHeaders {
+		if value := src.Get(key); value != "" {
+			dst.Set(key, value)
+		}
+	}
+
+	contentType, _, _ := strings.Cut(src.Get("Content-Type"), ";")
+	contentType = strings.ToLower(strings.TrimSpace(contentType))
+	disposition := "inline"
+	switch {
+	case inlineUploadTypes[contentType]:
+	case contentType == "image/svg+xml":
+		disposition = "attachment"
+	default:
+		contentType, disposition = "application/octet-stream", "attachment"
+	}
+
+	filename := strings.ReplaceAll(objectKey, `"`, "")
+	dst.Set("Content-Type", contentType)
+	dst.Set("Content-Disposition", fmt.Sprintf("%s; filename=%q", disposition, filename))
+	dst.Set("Cache-Control", cacheControl)
+	dst.Set("X-Content-Type-Options", "nosniff")
+	dst.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+}
+
+// notModified сообщает, что копия браузера совпадает с объектом: по If-None-Match,
+// а без него по If-Modified-Since
+func notModified(r *http.Request, object cachedObject) bool {
+	if match := r.Header.Get("If-None-Match"); match != "" {
+		if object.ETag == "" {
+			return false
+		}
+		for _, candidate := range strings.Split(match, ",") {
+			candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+			if candidate == "*" || candidate == strings.TrimPrefix(object.ETag, "W/") {
+				return true
+			}
+		}
+		return false
+	}
+
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil || object.LastModified.IsZero() {
+		return false
+	}
+	return !object.LastModified.Truncate(time.Second).After(since)
+}
+
+// spool сохраняет тело ответа во временный файл, чтобы ответить на Range.
+// Файл удаляется сразу, данные доступны через открытый дескриптор
+func spool(size int64, body io.Reader) (*os.File, error) {
+	if size > maxSpoolSize {
+		return nil, errObjectTooLarge
+	}
+
+	file, err := os.CreateTemp("", "s3-proxy-*")
+	if err != nil {
+		return nil, err
+	}
+	os.Remove(file.Name())
+
+	written, err := io.Copy(file, io.LimitReader(body, maxSpoolSize+1))
+	if err == nil && written > maxSpoolSize {
+		err = errObjectTooLarge
+	}
+	if _, seekErr := file.Seek(0, io.SeekStart); err == nil {
+		err = seekErr
+	}
+	if err != nil && !errors.Is(err, errObjectTooLarge) {
+		file.Close()
+		return nil, err
+	}
+	return file, err
+}
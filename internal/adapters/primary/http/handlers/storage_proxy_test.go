@@ -0,0 +1,170 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"1337b04rd/internal/adapters/primary/http/handlers"
+)
+
+// contentKey ключ объекта по SHA-256 содержимого
+const contentKey = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef.png"
+
+// upstreamModified время изменения объектов хранилища
+const upstreamModified = "Thu, 08 May 2025 15:01:54 GMT"
+
+// newUpstream создает хранилище без поддержки Range и ETag, как triple-s
+func newUpstream(t *testing.T, body string) (*httptest.Server, *int32) {
+	t.Helper()
+
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !strings.HasSuffix(r.URL.Path, "/posts/"+contentKey) {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Last-Modified", upstreamModified)
+		w.Header().Set("Set-Cookie", "upstream=1")
+		w.Header().Set("X-Amz-Request-Id", "42")
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+// newStorageProxy создает прокси к хранилищу server
+func newStorageProxy(server *httptest.Server) *handlers.StorageProxy {
+	return handlers.NewStorageProxy("/s3-proxy/", func(bucket, key string) string {
+		return server.URL + "/" + bucket + "/" + key
+	})
+}
+
+// proxyGet выполняет запрос к прокси с заголовками headers
+func proxyGet(proxy http.Handler, path string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	rec := httptest.NewRecorder()
+	proxy.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestStorageProxyHeaders проверяет защитные заголовки, ETag и кэширование неизменяемых объектов
+func TestStorageProxyHeaders(t *testing.T) {
+	server, _ := newUpstream(t, "png-bytes")
+	proxy := newStorageProxy(server)
+
+	rec := proxyGet(proxy, "/s3-proxy/posts/"+contentKey, nil)
+	if rec.Code != http.StatusOK || rec.Body.String() != "png-bytes" {
+		t.Fatalf("Ожидался объект, получено %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=31536000, immutable" {
+		t.Errorf("Неверный Cache-Control: %q", got)
+	}
+	if got := rec.Header().Get("ETag"); got != `"`+contentKey+`"` {
+		t.Errorf("Неверный ETag: %q", got)
+	}
+	if rec.Header().Get("X-Content-Type-Options") != "nosniff" || rec.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("Нет защитных заголовков: %v", rec.Header())
+	}
+	if rec.Header().Get("Set-Cookie") != "" || rec.Header().Get("X-Amz-Request-Id") != "" {
+		t.Errorf("Заголовки хранилища вне списка не должны передаваться: %v", rec.Header())
+	}
+
+	rec = proxyGet(proxy, "/s3-proxy/posts/missing.png", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Для отсутствующего объекта ожидался 404, получено %d", rec.Code)
+	}
+	rec = proxyGet(proxy, "/s3-proxy/posts", nil)
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Для списка бакета ожидался 404, получено %d", rec.Code)
+	}
+}
+
+// TestStorageProxyConditional проверяет ответы 304 и 206 при хранилище без их поддержки
+func TestStorageProxyConditional(t *testing.T) {
+	server, _ := newUpstream(t, "0123456789")
+	proxy := newStorageProxy(server)
+	path := "/s3-proxy/posts/" + contentKey
+
+	rec := proxyGet(proxy, path, map[string]string{"If-None-Match": `"` + contentKey + `"`})
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Errorf("Ожидался 304 без тела, получено %d %q", rec.Code, rec.Body.String())
+	}
+
+	// Потоковый ответ передает Last-Modified, по которому браузер присылает If-Modified-Since
+	rec = proxyGet(proxy, path, nil)
+	if got := rec.Header().Get("Last-Modified"); got != upstreamModified {
+		t.Errorf("Неверный Last-Modified: %q", got)
+	}
+	rec = proxyGet(proxy, path, map[string]string{"If-Modified-Since": upstreamModified})
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("Ожидался 304 по If-Modified-Since, получено %d", rec.Code)
+	}
+
+	rec = proxyGet(proxy, path, map[string]string{"Range": "bytes=2-5"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "2345" {
+		t.Errorf("Ожидался 206 с диапазоном, получено %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Range"); got != "bytes 2-5/10" {
+		t.Errorf("Неверный Content-Range: %q", got)
+	}
+}
+
+// TestStorageProxyCache проверяет, что повторные запросы отдаются из кэша
+func TestStorageProxyCache(t *testing.T) {
+	server, requests := newUpstream(t, "0123456789")
+	proxy := newStorageProxy(server)
+	cache, err := handlers.NewProxyCache(t.TempDir(), 1<<20, 1<<20)
+	if err != nil {
+		t.Fatalf("Ошибка создания кэша: %v", err)
+	}
+	proxy.SetCache(cache)
+	path := "/s3-proxy/posts/" + contentKey
+
+	if rec := proxyGet(proxy, path, nil); rec.Body.String() != "0123456789" {
+		t.Fatalf("Неверное тело первого ответа: %q", rec.Body.String())
+	}
+	rec := proxyGet(proxy, path, map[string]string{"Range": "bytes=7-"})
+	if rec.Code != http.StatusPartialContent || rec.Body.String() != "789" {
+		t.Errorf("Ожидался 206 из кэша, получено %d %q", rec.Code, rec.Body.String())
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("Ожидался один запрос к хранилищу, получено %d", got)
+	}
+
+	stats := proxy.CacheStats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Objects != 1 || stats.Bytes != 10 {
+		t.Errorf("Неверная статистика кэша: %+v", stats)
+	}
+}
+
+// rejectingVerifier отклоняет все подписи
+type rejectingVerifier struct{}
+
+func (rejectingVerifier) Verify(bucket, key string, query url.Values) error {
+	return errors.New("неверная подпись")
+}
+
+// TestStorageProxyVerifier проверяет отказ без действующей подписи
+func TestStorageProxyVerifier(t *testing.T) {
+	server, requests := newUpstream(t, "png-bytes")
+	proxy := newStorageProxy(server)
+	proxy.SetVerifier(rejectingVerifier{})
+
+	rec := proxyGet(proxy, "/s3-proxy/posts/"+contentKey, nil)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Ожидался 403, получено %d", rec.Code)
+	}
+	if got := atomic.LoadInt32(requests); got != 0 {
+		t.Errorf("Запрос без подписи не должен доходить до хранилища, получено %d", got)
+	}
+}
@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/domain/validation"
+)
+
+const (
+	// maxUploadSize наибольший размер запроса с файлами. Размер каждого файла
+	// дополнительно ограничивается настройками доски, см. models.MediaConfig
+	maxUploadSize = 40 << 20 // 40 МБ
+
+	// uploadMemory сколько данных формы держится в памяти. Файлы больше этого
+	// записываются во временные файлы, поэтому память не растет с числом
+	// одновременных загрузок
+	uploadMemory = 64 << 10 // 64 КБ
+)
+
+// parseUploadForm разбирает multipart форму с файлом, ограничивая размер тела запроса
+func parseUploadForm(w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
+	return r.ParseMultipartForm(uploadMemory)
+}
+
+// isRequestTooLarge сообщает, что тело запроса превысило maxUploadSize
+func isRequestTooLarge(err error) bool {
+	var maxBytesErr *http.MaxBytesError
+	return errors.As(err, &maxBytesErr)
+}
+
+// allowImageUpload проверяет лимит загрузки изображений.
+// Если лимит превышен, отвечает 429 и возвращает false
+func allowImageUpload(w http.ResponseWriter, r *http.Request, rateLimiter *middleware.RateLimitMiddleware) bool {
+	if rateLimiter == nil {
+		return true
+	}
+
+	decision, err := rateLimiter.Check(r, models.RateLimitImage)
+	if err != nil {
+		slog.Error("Ошибка проверки лимита загрузки изображений", "error", err)
+		return true
+	}
+
+	if !decision.Allowed {
+		middleware.WriteRateLimited(w, r, decision)
+		return false
+	}
+
+	return true
+}
+
+// imageHash возвращает SHA-256 содержимого файла в hex. Файл читается потоком,
+// после подсчета чтение возвращается к началу
+func imageHash(file io.ReadSeeker) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// formFiles возвращает файлы поля file в порядке формы
+func formFiles(r *http.Request) []*multipart.FileHeader {
+	if r.MultipartForm == nil {
+		return nil
+	}
+	return r.MultipartForm.File[validation.FieldFile]
+}
+
+// tooManyFiles возвращает ошибку поля file, если файлов больше models.MaxAttachments.
+// Проверка выполняется до загрузки, чтобы не обрабатывать лишние файлы
+func tooManyFiles(headers []*multipart.FileHeader) validation.Errors {
+	if len(headers) <= models.MaxAttachments {
+		return nil
+	}
+	return validation.Errors{{
+		Field:   validation.FieldFile,
+		Message: fmt.Sprintf("Не больше %d файлов в одном сообщении", models.MaxAttachments),
+	}}
+}
+
+// imageUploader сохраняет один файл в хранилище, см. методы Upload* сервиса изображений
+type imageUploader func(ctx context.Context, board, filename string, file io.ReadSeeker) (*models.StoredImage, error)
+
+// uploadedFiles файлы сообщения, загруженные в хранилище. Первый файл служит
+// изображением записи, его SHA-256 участвует в поиске повторов спама
+type uploadedFiles struct {
+	cover       models.StoredImage
+	hash        string
+	attachments []*models.Attachment
+	urls        []string
+}
+
+// uploadFiles загружает файлы формы по порядку: первый сохраненный файл функцией cover,
+// остальные функцией rest. Отклоненный файл возвращается с services.ErrImageRejected,
+// уже загруженные файлы при этом освобождаются. Файл, который не удалось сохранить
+// из-за ошибки хранилища, пропускается. Без хранилища считается только хэш первого файла.
+// Ограничения размера и длительности берутся из настроек доски board
+func uploadFiles(ctx context.Context, imageService *services.ImageService, board string, headers []*multipart.FileHeader, spoiler bool, cover, rest imageUploader) (*uploadedFiles, error) {
+	files := &uploadedFiles{}
+	for _, header := range headers {
+		if imageService == nil {
+			slog.Warn("Хранилище изображений не инициализировано")
+			hash, err := fileHash(header)
+			files.hash = hash
+			return files, err
+		}
+
+		upload := rest
+		if len(files.attachments) == 0 {
+			upload = cover
+		}
+		image, hash, err := uploadFile(ctx, board, header, upload)
+		if errors.Is(err, services.ErrImageRejected) {
+			imageService.Release(ctx, files.urls)
+			return nil, err
+		}
+		if err != nil {
+			// Продолжаем без этого файла, если произошла ошибка
+			slog.Error("Ошибка загрузки изображения", "filename", header.Filename, "error", err)
+			continue
+		}
+
+		if len(files.attachments) == 0 {
+			files.cover, files.hash = *image, hash
+		}
+		files.attachments = append(files.attachments, image.Attachment(header.Filename, spoiler))
+		files.urls = append(files.urls, image.URLs()...)
+		slog.Info("Изображение загружено", "filename", header.Filename, "size", header.Size, "url", image.URL)
+	}
+	return files, nil
+}
+
+// uploadFile загружает один файл формы и возвращает его вместе с SHA-256 содержимого
+func uploadFile(ctx context.Context, board string, header *multipart.FileHeader, upload imageUploader) (*models.StoredImage, string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return nil, "", err
+	}
+	defer file.Close()
+
+	// Хэш считается потоком, файл не читается в память целиком
+	hash, err := imageHash(file)
+	if err != nil {
+		return nil, "", err
+	}
+	image, err := upload(ctx, board, header.Filename, file)
+	return image, hash, err
+}
+
+// fileHash возвращает SHA-256 файла формы в hex
+func fileHash(header *multipart.FileHeader) (string, error) {
+	file, err := header.Open()
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return imageHash(file)
+}
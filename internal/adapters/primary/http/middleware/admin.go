@@ -0,0 +1,82 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+const (
+	adminCookieName   = "admin_token"
+	adminCookieMaxAge = 12 * 60 * 60 // 12 часов в секундах
+)
+
+// AdminMiddleware пропускает в админку только запросы с токеном ADMIN_TOKEN.
+// Токен передается заголовком "Authorization: Bearer <токен>" или в куки после входа
+type AdminMiddleware struct {
+	token string
+}
+
+// NewAdminMiddleware создает новый экземпляр middleware админки.
+// С пустым токеном админка отключена
+func NewAdminMiddleware(token string) *AdminMiddleware {
+	return &AdminMiddleware{
+		token: token,
+	}
+}
+
+// Enabled сообщает, включена ли админка
+func (m *AdminMiddleware) Enabled() bool {
+	return m.token != ""
+}
+
+// CheckToken сравнивает токен с ADMIN_TOKEN за постоянное время
+func (m *AdminMiddleware) CheckToken(token string) bool {
+	return m.Enabled() && subtle.ConstantTimeCompare([]byte(token), []byte(m.token)) == 1
+}
+
+// SetSessionCookie сохраняет токен в куки после успешного входа
+func (m *AdminMiddleware) SetSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     adminCookieName,
+		Value:    m.token,
+		Path:     "/admin/",
+		MaxAge:   adminCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+// Handler проверяет доступ к админке
+func (m *AdminMiddleware) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !m.Enabled() {
+			http.NotFound(w, r)
+			return
+		}
+
+		if m.CheckToken(requestAdminToken(r)) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		slog.Warn("Отказано в доступе к админке", "path", r.URL.Path, "remote_addr", r.RemoteAddr)
+		if strings.Contains(r.Header.Get("Accept"), "application/json") || r.Header.Get("Authorization") != "" {
+			http.Error(w, "Требуется авторизация администратора", http.StatusUnauthorized)
+			return
+		}
+		http.Redirect(w, r, "/admin/login", http.StatusSeeOther)
+	})
+}
+
+// requestAdminToken извлекает токен администратора из заголовка или куки
+func requestAdminToken(r *http.Request) string {
+	if token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	if cookie, err := r.Cookie(adminCookieName); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
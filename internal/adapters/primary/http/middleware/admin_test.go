@@ -0,0 +1,51 @@
+package middleware_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+)
+
+// TestAdminMiddleware проверяет доступ к админке по токену
+func TestAdminMiddleware(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		cookie string
+		want   int
+	}{
+		{name: "админка отключена", token: "", header: "Bearer ", want: http.StatusNotFound},
+		{name: "верный токен в заголовке", token: "secret", header: "Bearer secret", want: http.StatusOK},
+		{name: "неверный токен в заголовке", token: "secret", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{name: "верный токен в куки", token: "secret", cookie: "secret", want: http.StatusOK},
+		{name: "без токена", token: "secret", want: http.StatusSeeOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := middleware.NewAdminMiddleware(tt.token).Handler(next)
+
+			req := httptest.NewRequest(http.MethodGet, "/admin/filters", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "admin_token", Value: tt.cookie})
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("Ожидался статус %d, получено: %d", tt.want, rec.Code)
+			}
+		})
+	}
+}
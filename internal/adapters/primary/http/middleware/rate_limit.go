@@ -0,0 +1,127 @@
+package middleware
+
+import (
+	"encoding/json"
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// RateLimitMiddleware ограничивает частоту записи по сессии и IP-адресу клиента
+type RateLimitMiddleware struct {
+	limiter           *services.RateLimitService
+	trustForwardedFor bool
+}
+
+// NewRateLimitMiddleware создает новый экземпляр middleware ограничения частоты.
+// Если trustForwardedFor включен, IP клиента берется из X-Forwarded-For
+func NewRateLimitMiddleware(limiter *services.RateLimitService, trustForwardedFor bool) *RateLimitMiddleware {
+	return &RateLimitMiddleware{
+		limiter:           limiter,
+		trustForwardedFor: trustForwardedFor,
+	}
+}
+
+// Handler ограничивает POST-запросы для указанного действия.
+// Должен вызываться после AuthMiddleware, чтобы в контексте был пользователь
+func (m *RateLimitMiddleware) Handler(action models.RateLimitAction, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		decision, err := m.Check(r, action)
+		if err != nil {
+			// При недоступности хранилища не блокируем пользователей
+			slog.Error("Ошибка проверки ограничения частоты, запрос пропущен", "action", action, "error", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !decision.Allowed {
+			WriteRateLimited(w, r, decision)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Check проверяет ограничение для действия по ключам текущего запроса
+func (m *RateLimitMiddleware) Check(r *http.Request, action models.RateLimitAction) (models.RateLimitDecision, error) {
+	board := BoardFromRequest(r)
+	return m.limiter.Allow(r.Context(), board, action, m.keys(r)...)
+}
+
+// keys возвращает ключи корзин для запроса: сессия пользователя и IP клиента
+func (m *RateLimitMiddleware) keys(r *http.Request) []string {
+	keys := []string{"ip:" + ClientIP(r, m.trustForwardedFor)}
+	if user := GetUserFromContext(r.Context()); user != nil {
+		keys = append(keys, "session:"+strconv.FormatInt(user.ID, 10))
+	}
+	return keys
+}
+
+// WriteRateLimited отвечает 429 с заголовком Retry-After
+func WriteRateLimited(w http.ResponseWriter, r *http.Request, decision models.RateLimitDecision) {
+	retryAfter := int(math.Ceil(decision.RetryAfter.Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusTooManyRequests)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":       "слишком много запросов",
+			"retry_after": retryAfter,
+		})
+		return
+	}
+
+	http.Error(w, "Слишком много запросов, повторите через "+strconv.Itoa(retryAfter)+" с", http.StatusTooManyRequests)
+}
+
+// knownBoards доски из настроек, другие имена из запроса заменяются доской по умолчанию
+var knownBoards = models.NewBoardSet()
+
+// SetBoards задает настроенные доски. Вызывается один раз при запуске
+func SetBoards(boards []string) {
+	knownBoards = models.NewBoardSet(boards...)
+}
+
+// BoardFromRequest возвращает имя доски из параметров запроса. Имя от клиента
+// проверяется по настроенным доскам, неизвестное заменяется доской по умолчанию,
+// поэтому от него не зависят отдельные лимиты, капча и ограничения загрузок
+func BoardFromRequest(r *http.Request) string {
+	return knownBoards.Resolve(r.URL.Query().Get("board"))
+}
+
+// ClientIP возвращает IP-адрес клиента. Заголовку X-Forwarded-For
+// доверяем только если приложение работает за своим reverse proxy
+func ClientIP(r *http.Request, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			// Первый адрес в списке принадлежит исходному клиенту
+			ip := strings.TrimSpace(strings.Split(forwarded, ",")[0])
+			if net.ParseIP(ip) != nil {
+				return ip
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,87 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/adapters/secondary/memory"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// TestRateLimitMiddleware проверяет ответ 429 с Retry-After после исчерпания лимита
+func TestRateLimitMiddleware(t *testing.T) {
+	config := models.DefaultRateLimitConfig()
+	config.Default[models.RateLimitThread] = models.RateLimitRule{Burst: 1, Interval: 30 * time.Second}
+
+	limiter := services.NewRateLimitService(memory.NewRateLimitRepository(), config)
+	rateLimit := middleware.NewRateLimitMiddleware(limiter, false)
+
+	handler := rateLimit.Handler(models.RateLimitThread, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	user := &models.User{ID: 7, Username: "anonymous"}
+	newRequest := func(method string) *http.Request {
+		req := httptest.NewRequest(method, "/submit-post", nil)
+		req.RemoteAddr = "10.0.0.1:5555"
+		return req.WithContext(context.WithValue(req.Context(), middleware.UserContextKey, user))
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Первый запрос должен пройти, получено %d", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodPost))
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Ожидался статус 429, получено %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Errorf("Не установлен заголовок Retry-After")
+	}
+
+	// GET-запросы не ограничиваются
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, newRequest(http.MethodGet))
+	if rr.Code != http.StatusOK {
+		t.Errorf("GET-запрос не должен ограничиваться, получено %d", rr.Code)
+	}
+}
+
+// TestBoardFromRequest проверяет, что доска из запроса берется только из настроенных
+func TestBoardFromRequest(t *testing.T) {
+	middleware.SetBoards([]string{"g"})
+	defer middleware.SetBoards(nil)
+
+	tests := map[string]string{
+		"/submit-post":            models.DefaultBoard,
+		"/submit-post?board=G":    "g",
+		"/submit-post?board=none": models.DefaultBoard,
+	}
+	for target, want := range tests {
+		if got := middleware.BoardFromRequest(httptest.NewRequest(http.MethodPost, target, nil)); got != want {
+			t.Errorf("Для %s ожидалась доска %q, получено %q", target, want, got)
+		}
+	}
+}
+
+// TestClientIP проверяет определение IP-адреса клиента
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "192.168.1.10:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.5, 10.0.0.1")
+
+	if ip := middleware.ClientIP(req, false); ip != "192.168.1.10" {
+		t.Errorf("Без доверия к прокси ожидался RemoteAddr, получено %s", ip)
+	}
+	if ip := middleware.ClientIP(req, true); ip != "203.0.113.5" {
+		t.Errorf("С доверием к прокси ожидался адрес из X-Forwarded-For, получено %s", ip)
+	}
+}
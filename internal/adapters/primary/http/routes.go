@@ -6,8 +6,6 @@ import (
 	"context"
 	"database/sql"
 	"encoding/json"
-	"fmt"
-	"io"
 	"log"
 	"log/slog"
 	"net/http"
@@ -20,10 +18,18 @@ import (
 
 	"1337b04rd/internal/adapters/primary/http/handlers"
 	"1337b04rd/internal/adapters/primary/http/middleware"
+	"1337b04rd/internal/adapters/secondary/captcha"
+	"1337b04rd/internal/adapters/secondary/httpclient"
+	"1337b04rd/internal/adapters/secondary/imaging"
+	"1337b04rd/internal/adapters/secondary/memory"
 	"1337b04rd/internal/adapters/secondary/postgres"
+	"1337b04rd/internal/adapters/secondary/publicurl"
 	"1337b04rd/internal/adapters/secondary/rickandmorty"
 	"1337b04rd/internal/adapters/secondary/s3"
+	"1337b04rd/internal/adapters/secondary/video"
+	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/ports/repositories"
 )
 
 // RegisterRoutes регистрирует все маршруты приложения
@@ -59,20 +65,134 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 	commentService := services.NewCommentService(commentRepo, userRepo, postRepo)
 	archiverService := services.NewArchiverService(postRepo, commentRepo)
 
+	// Опросы создаются вместе с тредом и закрываются при его архивации
+	pollService := services.NewPollService(postgres.NewPollRepository(db), postRepo)
+	postService.SetPollService(pollService)
+	archiverService.SetPollService(pollService)
+
+	// Галереи постов и комментариев сохраняются их репозиториями, сервисы только читают их
+	attachmentRepo := postgres.NewAttachmentRepository(db)
+	postService.SetAttachmentRepository(attachmentRepo)
+	commentService.SetAttachmentRepository(attachmentRepo)
+
+	// Фильтр содержимого перечитывает правила из БД без перезапуска
+	contentFilter := services.NewContentFilter(postgres.NewFilterRuleRepository(db),
+		envDuration("CONTENT_FILTER_RELOAD_INTERVAL", time.Minute))
+	postService.SetContentFilter(contentFilter)
+	commentService.SetContentFilter(contentFilter)
+
+	// Спам-оценка по повторам среди последних отправок
+	spamScorer := services.NewSpamScorer(postgres.NewFingerprintRepository(db), spamConfigFromEnv())
+	postService.SetSpamScorer(spamScorer)
+	commentService.SetSpamScorer(spamScorer)
+	moderationService := services.NewModerationService(postRepo, commentRepo)
+
+	// Хранилище ограничений частоты: в памяти для одного экземпляра,
+	// в PostgreSQL для нескольких экземпляров за балансировщиком
+	var rateLimitRepo repositories.RateLimitRepository = memory.NewRateLimitRepository()
+	if os.Getenv("RATE_LIMIT_STORE") == "postgres" {
+		rateLimitRepo = postgres.NewRateLimitRepository(db)
+	}
+	rateLimitService := services.NewRateLimitService(rateLimitRepo, rateLimitConfigFromEnv())
+
+	// Использованные капчи: в памяти решенную задачу можно повторить на другом
+	// экземпляре или после перезапуска, поэтому за балансировщиком нужен PostgreSQL
+	var captchaReplayRepo repositories.CaptchaReplayRepository = memory.NewCaptchaReplayRepository()
+	if os.Getenv("CAPTCHA_STORE") == "postgres" {
+		captchaReplayRepo = postgres.NewCaptchaReplayRepository(db)
+	}
+	captchaService := services.NewCaptchaService(
+		captchaSecretFromEnv(),
+		captcha.NewRenderer(),
+		captchaReplayRepo,
+		postRepo,
+		captchaConfigFromEnv(),
+	)
+
 	// Запускаем фоновую задачу архивирования
 	archiverService.StartArchiveJob(ctx)
 
+	// Запускаем очистку устаревших корзин ограничения частоты
+	rateLimitService.StartCleanupJob(ctx, time.Hour)
+
+	// Запускаем очистку старых отпечатков отправок
+	spamScorer.StartCleanupJob(ctx, time.Hour)
+
 	// Инициализируем глобальное хранилище для использования в обработчиках
 	s3.InitImageStorage(imageStorage)
 
+	// Доска из запроса принимается только из списка BOARDS
+	middleware.SetBoards(boardsFromEnv())
+
 	// Создание middleware
 	authMiddleware := middleware.NewAuthMiddleware(userService)
 	loggingMiddleware := middleware.NewLoggingMiddleware(true)
+	rateLimitMiddleware := middleware.NewRateLimitMiddleware(rateLimitService, envBool("TRUST_PROXY_HEADERS", false))
+	adminMiddleware := middleware.NewAdminMiddleware(os.Getenv("ADMIN_TOKEN"))
 
 	// Создание обработчиков
 	userHandler := handlers.NewUserHandler(userService)
 	postHandler := handlers.NewPostHandler(postService, userService, commentService)
 	commentHandler := handlers.NewCommentHandler(commentService, userService)
+	captchaHandler := handlers.NewCaptchaHandler(captchaService)
+	pollHandler := handlers.NewPollHandler(pollService, postService)
+	adminHandler := handlers.NewAdminHandler(adminMiddleware, contentFilter, moderationService)
+	postHandler.SetRateLimiter(rateLimitMiddleware)
+	postHandler.SetCaptchaService(captchaService)
+	postHandler.SetPollService(pollService)
+	commentHandler.SetRateLimiter(rateLimitMiddleware)
+
+	// В БД хранятся только бакет и ключ, адреса для браузера строятся по стратегии
+	// из IMAGE_URL_STRATEGY. Подписанные адреса проверяются прокси хранилища
+	imageURLConfig := imageURLConfigFromEnv()
+	urlBuilder, err := publicurl.New(imageURLConfig)
+	if err != nil {
+		slog.Warn("Некорректные настройки адресов изображений, используется прокси", "error", err)
+		urlBuilder = publicurl.NewProxyBuilder(imageURLConfig.ProxyPrefix)
+	}
+	postHandler.SetURLBuilder(urlBuilder)
+	commentHandler.SetURLBuilder(urlBuilder)
+
+	// Прокси хранилища переиспользует соединения и может держать часто
+	// запрашиваемые объекты в дисковом кэше из S3_PROXY_CACHE_DIR. Запросы идут
+	// через пул прокси с повторами и автоматом защиты. Ожидание заголовков ограничено
+	// пулом, вся передача, включая отдачу видео медленному клиенту, S3_PROXY_TIMEOUT
+	storageProxy := handlers.NewStorageProxy(imageURLConfig.ProxyPrefix, imageStorage.ObjectURL)
+	storageClient := httpclient.New("s3-proxy", envDuration("S3_PROXY_TIMEOUT", 5*time.Minute))
+	storageClient.SetTransport(storageProxy.Transport())
+	storageProxy.SetClient(storageClient)
+	if signedURLs, ok := urlBuilder.(*publicurl.SignedBuilder); ok {
+		storageProxy.SetVerifier(signedURLs)
+	}
+	if cacheConfig := proxyCacheConfigFromEnv(); cacheConfig.Dir != "" {
+		cache, err := handlers.NewProxyCache(cacheConfig.Dir, cacheConfig.MaxBytes, cacheConfig.MaxObjectBytes)
+		if err != nil {
+			slog.Error("Ошибка создания кэша прокси, кэш отключен", "dir", cacheConfig.Dir, "error", err)
+		} else {
+			storageProxy.SetCache(cache)
+		}
+	}
+
+	// Изображения сохраняются вместе с миниатюрами для треда и каталога, видео после
+	// проверки контейнера. Объекты адресуются по содержимому и удаляются,
+	// когда на них не остается ссылок
+	imageService := services.NewImageService(imageStorage, imaging.NewProcessor())
+	imageService.SetVideoProber(video.NewProber())
+	imageService.SetMediaConfig(mediaConfigFromEnv())
+	imageObjectRepo := postgres.NewImageObjectRepository(db)
+	imageService.SetObjectRepository(imageObjectRepo)
+	imageService.SetBanRepository(postgres.NewImageBanRepository(db))
+	commentService.SetImageService(imageService)
+	moderationService.SetImageService(imageService)
+
+	// Сборщик удаляет объекты, на которые не ссылаются посты и комментарии
+	imageGCService := services.NewImageGCService(imageStorage, imageObjectRepo, imageGCConfigFromEnv())
+	if envBool("IMAGE_GC_ENABLED", true) {
+		imageGCService.StartGCJob(ctx)
+	}
+	postHandler.SetImageService(imageService)
+	commentHandler.SetImageService(imageService)
+	commentHandler.SetPostPage(postHandler)
 	pageHandler := handlers.HandlePage
 
 	// Функция-помощник для оборачивания обработчиков с аутентификацией
@@ -80,6 +200,9 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 		return loggingMiddleware.Handler(authMiddleware.Handler(handler))
 	}
 
+	// Создание треда ограничивается так же, как отправка формы
+	createPost := rateLimitMiddleware.Handler(models.RateLimitThread, http.HandlerFunc(postHandler.HandleCreatePost))
+
 	// Регистрация маршрутов для API с аутентификацией
 	mux.Handle("/api/", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -92,7 +215,13 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 
 		// Маршруты для постов
 		if strings.HasPrefix(path, "/api/posts/") {
-			handlePostRoutes(w, r, postHandler, commentHandler)
+			handlePostRoutes(w, r, postHandler, commentHandler, pollHandler, createPost)
+			return
+		}
+
+		// Выдача задачи капчи
+		if path == "/api/captcha" {
+			captchaHandler.HandleNewChallenge(w, r)
 			return
 		}
 
@@ -113,13 +242,26 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 	})))
 
 	// Маршруты для отправки форм
-	mux.Handle("/submit-post", withAuth(http.HandlerFunc(postHandler.HandleCreatePost)))
+	mux.Handle("/submit-post", withAuth(createPost))
+
+	// Форма создания поста с капчей
+	mux.Handle("/create-post.html", withAuth(http.HandlerFunc(postHandler.HandleCreatePostPage)))
+
+	// Изображение задачи капчи
+	mux.Handle("/captcha/image", http.HandlerFunc(captchaHandler.HandleImage))
 
 	// Обработчик для создания комментариев
-	mux.Handle("/submit-comment", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("Получен запрос на создание комментария: %s %s", r.Method, r.URL.Path)
-		commentHandler.HandleCreateComment(w, r)
-	})))
+	mux.Handle("/submit-comment", withAuth(rateLimitMiddleware.Handler(models.RateLimitReply,
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.Printf("Получен запрос на создание комментария: %s %s", r.Method, r.URL.Path)
+			commentHandler.HandleCreateComment(w, r)
+		}))))
+
+	// Админка, доступна только при заданном ADMIN_TOKEN
+	mux.Handle("/admin/login", loggingMiddleware.Handler(http.HandlerFunc(adminHandler.HandleLogin)))
+	mux.Handle("/admin/", loggingMiddleware.Handler(adminMiddleware.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handleAdminRoutes(w, r, adminHandler)
+	}))))
 
 	// Маршруты для страниц каталога и архива
 	mux.Handle("/catalog.html", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -134,56 +276,43 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 	})))
 
 	// Прокси для изображений из S3
-	mux.Handle("/s3-proxy/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Получаем путь к изображению
-		path := strings.TrimPrefix(r.URL.Path, "/s3-proxy/")
-
-		// Формируем URL для запроса к S3
-		s3URL := fmt.Sprintf("http://s3:9000/%s", path)
+	mux.Handle(imageURLConfig.ProxyPrefix, storageProxy)
 
-		// Создаем новый запрос к S3
-		req, err := http.NewRequestWithContext(r.Context(), "GET", s3URL, nil)
-		if err != nil {
-			slog.Error("Ошибка создания запроса к S3", "error", err)
-			http.Error(w, "Ошибка получения изображения", http.StatusInternalServerError)
+	// Добавление маршрута для получения статистики архивации
+	mux.Handle("/api/monitoring/archiver", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		// Выполняем запрос
-		client := http.Client{Timeout: 10 * time.Second}
-		resp, err := client.Do(req)
-		if err != nil {
-			slog.Error("Ошибка при запросе к S3", "error", err)
-			http.Error(w, "Ошибка получения изображения", http.StatusInternalServerError)
-			return
-		}
-		defer resp.Body.Close()
+		stats := archiverService.GetStats()
 
-		// Копируем заголовки ответа
-		for key, values := range resp.Header {
-			for _, value := range values {
-				w.Header().Add(key, value)
-			}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})))
+
+	// Добавление маршрута для получения статистики сборщика изображений
+	mux.Handle("/api/monitoring/image-gc", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
 		}
 
-		// Устанавливаем статус ответа
-		w.WriteHeader(resp.StatusCode)
+		stats := imageGCService.GetStats()
 
-		// Копируем тело ответа
-		io.Copy(w, resp.Body)
-	}))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(stats)
+	})))
 
-	// Добавление маршрута для получения статистики архивации
-	mux.Handle("/api/monitoring/archiver", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	// Добавление маршрута для получения статистики кэша прокси хранилища
+	mux.Handle("/api/monitoring/s3-proxy", withAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
 
-		stats := archiverService.GetStats()
-
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(stats)
+		json.NewEncoder(w).Encode(storageProxy.CacheStats())
 	})))
 
 	// Добавление маршрута для получения общей статистики приложения
@@ -207,6 +336,8 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 			HeapMB     uint64    `json:"heap_mb"`
 			DatabaseOK bool      `json:"database_ok"`
 			Uptime     string    `json:"uptime"`
+			// Outbound состояние автоматов защиты внешних сервисов
+			Outbound []httpclient.BreakerStats `json:"outbound"`
 		}{
 			Status:     "ok",
 			Time:       time.Now(),
@@ -214,6 +345,7 @@ func RegisterRoutes(mux *http.ServeMux, db *sql.DB) {
 			HeapMB:     m.Alloc / 1024 / 1024,
 			DatabaseOK: dbErr == nil,
 			Uptime:     time.Since(startTime).String(),
+			Outbound:   httpclient.DefaultBreakers.Stats(),
 		}
 
 		w.Header().Set("Content-Type", "application/json")
@@ -248,7 +380,7 @@ func handleUserRoutes(w http.ResponseWriter, r *http.Request, handler *handlers.
 }
 
 // handlePostRoutes обрабатывает маршруты постов
-func handlePostRoutes(w http.ResponseWriter, r *http.Request, postHandler *handlers.PostHandler, commentHandler *handlers.CommentHandler) {
+func handlePostRoutes(w http.ResponseWriter, r *http.Request, postHandler *handlers.PostHandler, commentHandler *handlers.CommentHandler, pollHandler *handlers.PollHandler, createPost http.Handler) {
 	path := r.URL.Path
 
 	// Маршрут для архивации поста
@@ -257,6 +389,12 @@ func handlePostRoutes(w http.ResponseWriter, r *http.Request, postHandler *handl
 		return
 	}
 
+	// Маршрут опроса треда
+	if strings.HasSuffix(path, "/poll") {
+		pollHandler.HandlePoll(w, r)
+		return
+	}
+
 	// Проверка на маршрут комментариев
 	if strings.HasSuffix(path, "/comments") {
 		switch r.Method {
@@ -273,6 +411,8 @@ func handlePostRoutes(w http.ResponseWriter, r *http.Request, postHandler *handl
 		switch r.Method {
 		case http.MethodGet:
 			postHandler.HandleGetAllPosts(w, r)
+		case http.MethodPost:
+			createPost.ServeHTTP(w, r)
 		default:
 			http.Error(w, "Метод не разрешен", http.StatusMethodNotAllowed)
 		}
@@ -288,6 +428,38 @@ func handlePostRoutes(w http.ResponseWriter, r *http.Request, postHandler *handl
 	}
 }
 
+// handleAdminRoutes обрабатывает маршруты админки
+func handleAdminRoutes(w http.ResponseWriter, r *http.Request, handler *handlers.AdminHandler) {
+	path := r.URL.Path
+
+	switch {
+	case path == "/admin/":
+		http.Redirect(w, r, "/admin/filters", http.StatusFound)
+	case path == "/admin/filters":
+		handler.HandleFilterRules(w, r)
+	case path == "/admin/filters/reload":
+		handler.HandleReloadFilters(w, r)
+	case strings.HasPrefix(path, "/admin/filters/"):
+		handler.HandleFilterRule(w, r)
+	case path == "/admin/queue":
+		handler.HandleQueue(w, r)
+	case strings.HasPrefix(path, "/admin/queue/"):
+		handler.HandleModerate(w, r)
+	case path == "/admin/threads":
+		handler.HandleThreads(w, r)
+	case path == "/admin/bans":
+		handler.HandleImageBans(w, r)
+	case strings.HasPrefix(path, "/admin/bans/"):
+		handler.HandleImageBan(w, r)
+	case strings.HasPrefix(path, "/admin/threads/") && (r.Method == http.MethodDelete || strings.HasSuffix(path, "/delete")):
+		handler.HandleDeleteThread(w, r)
+	case strings.HasPrefix(path, "/admin/threads/"):
+		handler.HandleThreadFlags(w, r)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
 // handleCommentRoutes обрабатывает маршруты комментариев
 func handleCommentRoutes(w http.ResponseWriter, r *http.Request, handler *handlers.CommentHandler) {
 	switch r.Method {
@@ -0,0 +1,165 @@
+package captcha
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	// Размер изображения капчи
+	imageWidth  = 220
+	imageHeight = 70
+
+	// Размер одного пикселя глифа в точках изображения
+	glyphScale = 5
+)
+
+// glyphs растровый шрифт 5x7 для символов, используемых в задачах
+var glyphs = map[rune][7]string{
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"####.", "....#", "....#", ".###.", "....#", "....#", "####."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+	'+': {".....", "..#..", "..#..", "#####", "..#..", "..#..", "....."},
+	'-': {".....", ".....", ".....", "#####", ".....", ".....", "....."},
+	'=': {".....", ".....", "#####", ".....", "#####", ".....", "....."},
+	'?': {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+	' ': {".....", ".....", ".....", ".....", ".....", ".....", "....."},
+}
+
+// Renderer рисует задачи капчи средствами стандартной библиотеки image
+type Renderer struct {
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// NewRenderer создает новый экземпляр отрисовщика капчи
+func NewRenderer() *Renderer {
+	return &Renderer{
+		rnd: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Render рисует искаженный текст и возвращает PNG
+func (r *Renderer) Render(text string) ([]byte, error) {
+	if text == "" {
+		return nil, fmt.Errorf("пустой текст капчи")
+	}
+	for _, ch := range text {
+		if _, ok := glyphs[ch]; !ok {
+			return nil, fmt.Errorf("символ %q не поддерживается шрифтом капчи", ch)
+		}
+	}
+
+	// rand.Rand не потокобезопасен
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	img := image.NewRGBA(image.Rect(0, 0, imageWidth, imageHeight))
+	background := color.RGBA{R: 240, G: 240, B: 235, A: 255}
+	for y := 0; y < imageHeight; y++ {
+		for x := 0; x < imageWidth; x++ {
+			img.Set(x, y, background)
+		}
+	}
+
+	// Фоновый шум
+	for i := 0; i < imageWidth*imageHeight/12; i++ {
+		img.Set(r.rnd.Intn(imageWidth), r.rnd.Intn(imageHeight), r.randomColor(120, 200))
+	}
+
+	// Параметры волнового искажения
+	amplitude := 3 + r.rnd.Float64()*3
+	period := 25 + r.rnd.Float64()*20
+	phase := r.rnd.Float64() * 2 * math.Pi
+
+	runes := []rune(text)
+	advance := (imageWidth - 20) / len(runes)
+	for i, ch := range runes {
+		glyph := glyphs[ch]
+		originX := 10 + i*advance + r.rnd.Intn(5)
+		originY := (imageHeight-7*glyphScale)/2 + r.rnd.Intn(9) - 4
+		ink := r.randomColor(10, 90)
+		slant := (r.rnd.Float64() - 0.5) * 0.5
+
+		for gy, row := range glyph {
+			for gx, cell := range row {
+				if cell != '#' {
+					continue
+				}
+				for dy := 0; dy < glyphScale; dy++ {
+					for dx := 0; dx < glyphScale; dx++ {
+						py := originY + gy*glyphScale + dy
+						px := originX + gx*glyphScale + dx + int(slant*float64(py-originY))
+						py += int(amplitude * math.Sin(float64(px)/period+phase))
+						if image.Pt(px, py).In(img.Bounds()) {
+							img.Set(px, py, ink)
+						}
+					}
+				}
+			}
+		}
+	}
+
+	// Перечеркивающие линии
+	for i := 0; i < 4; i++ {
+		r.drawLine(img, r.rnd.Intn(imageWidth/4), r.rnd.Intn(imageHeight),
+			imageWidth-r.rnd.Intn(imageWidth/4), r.rnd.Intn(imageHeight), r.randomColor(40, 140))
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("ошибка кодирования изображения капчи: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// drawLine рисует отрезок алгоритмом Брезенхэма
+func (r *Renderer) drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.Color) {
+	dx := int(math.Abs(float64(x1 - x0)))
+	dy := -int(math.Abs(float64(y1 - y0)))
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+
+	for {
+		img.Set(x0, y0, c)
+		img.Set(x0, y0+1, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+// randomColor возвращает случайный серо-цветной оттенок в диапазоне яркости
+func (r *Renderer) randomColor(min, max int) color.RGBA {
+	channel := func() uint8 { return uint8(min + r.rnd.Intn(max-min)) }
+	return color.RGBA{R: channel(), G: channel(), B: channel(), A: 255}
+}
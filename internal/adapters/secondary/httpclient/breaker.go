@@ -0,0 +1,182 @@
+package httpclient
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen возвращается без запроса, пока хост считается недоступным
+var ErrCircuitOpen = errors.New("хост временно недоступен, запросы приостановлены")
+
+// BreakerState состояние автомата защиты хоста
+type BreakerState string
+
+const (
+	// BreakerClosed запросы проходят, ошибки подряд считаются
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen запросы отклоняются до конца паузы
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen после паузы проходит один пробный запрос
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// BreakerConfig настройки автоматов защиты
+type BreakerConfig struct {
+	// FailureThreshold сколько ошибок подряд размыкает автомат
+	FailureThreshold int
+	// OpenTimeout пауза до пробного запроса
+	OpenTimeout time.Duration
+}
+
+// DefaultBreakerConfig возвращает настройки автоматов по умолчанию
+func DefaultBreakerConfig() BreakerConfig {
+	return BreakerConfig{
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// BreakerStats состояние автомата защиты одного хоста
+type BreakerStats struct {
+	Host      string       `json:"host"`
+	State     BreakerState `json:"state"`
+	Failures  int          `json:"failures"`
+	Rejected  int64        `json:"rejected"`
+	OpenedAt  *time.Time   `json:"opened_at,omitempty"`
+	LastError string       `json:"last_error,omitempty"`
+}
+
+// outcome итог запроса для автомата
+type outcome int
+
+const (
+	// outcomeSuccess хост ответил, в том числе ошибкой клиента 4xx
+	outcomeSuccess outcome = iota
+	// outcomeFailure ошибка соединения или ответ 5xx
+	outcomeFailure
+	// outcomeIgnored запрос отменил вызывающий, о хосте ничего не известно
+	outcomeIgnored
+)
+
+// breaker автомат защиты одного хоста
+type breaker struct {
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	rejected  int64
+	lastError string
+}
+
+// Breakers автоматы защиты по хостам. Клиенты с общим набором автоматов
+// вместе замечают недоступность хоста
+type Breakers struct {
+	config BreakerConfig
+	now    func() time.Time
+
+	mu    sync.Mutex
+	hosts map[string]*breaker
+}
+
+// DefaultBreakers общий набор автоматов исходящих адаптеров, его состояние
+// отдается в /api/monitoring/health
+var DefaultBreakers = NewBreakers(DefaultBreakerConfig())
+
+// NewBreakers создает набор автоматов защиты
+func NewBreakers(config BreakerConfig) *Breakers {
+	return &Breakers{
+		config: config,
+		now:    time.Now,
+		hosts:  make(map[string]*breaker),
+	}
+}
+
+// allow решает, можно ли выполнить запрос к хосту. После паузы разомкнутый автомат
+// пропускает один пробный запрос, остальные отклоняются до его итога
+func (b *Breakers) allow(host string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	switch h.state {
+	case BreakerOpen:
+		if b.now().Sub(h.openedAt) < b.config.OpenTimeout {
+			h.rejected++
+			return ErrCircuitOpen
+		}
+		h.state = BreakerHalfOpen
+		h.probing = true
+		return nil
+	case BreakerHalfOpen:
+		if h.probing {
+			h.rejected++
+			return ErrCircuitOpen
+		}
+		h.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// record учитывает итог запроса, пропущенного allow
+func (b *Breakers) record(host string, result outcome, cause string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	h := b.host(host)
+	wasProbe := h.state == BreakerHalfOpen
+	if wasProbe {
+		h.probing = false
+	}
+
+	switch result {
+	case outcomeSuccess:
+		h.state = BreakerClosed
+		h.failures = 0
+	case outcomeFailure:
+		h.failures++
+		h.lastError = cause
+		if wasProbe || h.failures >= b.config.FailureThreshold {
+			h.state = BreakerOpen
+			h.openedAt = b.now()
+		}
+	}
+}
+
+// Stats возвращает состояние автоматов всех хостов, к которым были запросы
+func (b *Breakers) Stats() []BreakerStats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	stats := make([]BreakerStats, 0, len(b.hosts))
+	for host, h := range b.hosts {
+		item := BreakerStats{
+			Host:      host,
+			State:     h.state,
+			Failures:  h.failures,
+			Rejected:  h.rejected,
+			LastError: h.lastError,
+		}
+		if h.state != BreakerClosed {
+			openedAt := h.openedAt
+			item.OpenedAt = &openedAt
+		}
+		stats = append(stats, item)
+	}
+	slices.SortFunc(stats, func(a, b BreakerStats) int { return strings.Compare(a.Host, b.Host) })
+	return stats
+}
+
+// host возвращает автомат хоста, создавая его при первом запросе. Вызывается под блокировкой
+func (b *Breakers) host(host string) *breaker {
+	h, ok := b.hosts[host]
+	if !ok {
+		h = &breaker{state: BreakerClosed}
+		b.hosts[host] = h
+	}
+	return h
+}
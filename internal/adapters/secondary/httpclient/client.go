@@ -0,0 +1,222 @@
+// Package httpclient содержит общий HTTP-клиент исходящих адаптеров: повторные
+// попытки с экспоненциальной задержкой и автоматы защиты по хостам
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"net/http"
+	"time"
+)
+
+// SharedTransport пул соединений, общий для всех исходящих адаптеров
+var SharedTransport = &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	DialContext:           (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+	ForceAttemptHTTP2:     true,
+	MaxIdleConns:          100,
+	MaxIdleConnsPerHost:   32,
+	IdleConnTimeout:       90 * time.Second,
+	TLSHandshakeTimeout:   5 * time.Second,
+	ResponseHeaderTimeout: 10 * time.Second,
+}
+
+// Policy настройки повторных попыток
+type Policy struct {
+	// MaxAttempts сколько всего попыток делается для повторяемого запроса
+	MaxAttempts int
+	// BaseDelay задержка перед второй попыткой, дальше она удваивается
+	BaseDelay time.Duration
+	// MaxDelay наибольшая задержка между попытками
+	MaxDelay time.Duration
+}
+
+// DefaultPolicy возвращает настройки повторных попыток по умолчанию
+func DefaultPolicy() Policy {
+	return Policy{
+		MaxAttempts: 3,
+		BaseDelay:   200 * time.Millisecond,
+		MaxDelay:    2 * time.Second,
+	}
+}
+
+// Client выполняет запросы с повторными попытками через автоматы защиты хостов.
+// Повторяются только идемпотентные запросы, тело которых можно отправить заново
+type Client struct {
+	name     string
+	client   *http.Client
+	policy   Policy
+	breakers *Breakers
+}
+
+// New создает клиент адаптера name с общим пулом соединений и общими автоматами.
+// timeout ограничивает одну попытку, 0 снимает ограничение
+func New(name string, timeout time.Duration) *Client {
+	return &Client{
+		name:     name,
+		client:   &http.Client{Transport: SharedTransport, Timeout: timeout},
+		policy:   DefaultPolicy(),
+		breakers: DefaultBreakers,
+	}
+}
+
+// SetPolicy задает настройки повторных попыток
+func (c *Client) SetPolicy(policy Policy) {
+	c.policy = policy
+}
+
+// SetTransport задает пул соединений вместо общего, например настроенный под один хост
+func (c *Client) SetTransport(transport http.RoundTripper) {
+	c.client.Transport = transport
+}
+
+// SetBreakers задает набор автоматов защиты вместо общего
+func (c *Client) SetBreakers(breakers *Breakers) {
+	c.breakers = breakers
+}
+
+// Do выполняет запрос. Ошибки соединения и ответы 502, 503 и 504 повторяются
+// с задержкой, пока не кончатся попытки или контекст запроса. Запрос к хосту
+// с разомкнутым автоматом не выполняется и возвращает ErrCircuitOpen
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	host := req.URL.Host
+
+	attempts := 1
+	if retryable(req) {
+		attempts = max(c.policy.MaxAttempts, 1)
+	}
+
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 && req.GetBody != nil {
+			// Тело прошлой попытки прочитано, отправляется его новая копия.
+			// Запрос без тела (nil или http.NoBody) отправляется как есть
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, fmt.Errorf("ошибка повторного чтения тела запроса: %w", err)
+			}
+			req.Body = body
+		}
+		if err := c.breakers.allow(host); err != nil {
+			return nil, fmt.Errorf("%s: %s: %w", c.name, host, err)
+		}
+
+		body := trackBody(req)
+		resp, err := c.client.Do(req)
+		if err != nil && body != nil && body.err != nil {
+			// Тело не прочиталось у вызывающего, хост тут ни при чем
+			c.breakers.record(host, outcomeIgnored, "")
+			return nil, err
+		}
+
+		result, cause := classify(ctx, resp, err)
+		c.breakers.record(host, result, cause)
+		if result != outcomeFailure || !retryStatus(resp) || attempt >= attempts {
+			return resp, err
+		}
+
+		if resp != nil {
+			// Тело читается до конца, чтобы соединение вернулось в пул
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		delay := c.policy.backoff(attempt)
+		slog.Warn("Ошибка исходящего запроса, повторная попытка",
+			"client", c.name, "host", host, "method", req.Method,
+			"attempt", attempt, "delay", delay, "error", cause)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, fmt.Errorf("%s: запрос отменен после %d попыток: %w", c.name, attempt, ctx.Err())
+		}
+	}
+}
+
+// backoff возвращает задержку после попытки attempt: экспоненциальную
+// со случайной половиной, чтобы клиенты не повторяли запросы одновременно
+func (p Policy) backoff(attempt int) time.Duration {
+	delay := p.MaxDelay
+	if shift := attempt - 1; shift < 30 && p.BaseDelay<<shift < p.MaxDelay {
+		delay = p.BaseDelay << shift
+	}
+	if delay <= 0 {
+		return 0
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(delay-half)+1))
+}
+
+// retryable сообщает, что запрос можно отправить повторно: метод идемпотентен
+// или запрос несет Idempotency-Key, а тело отсутствует или читается заново через GetBody
+func retryable(req *http.Request) bool {
+	idempotent := false
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		idempotent = true
+	default:
+		idempotent = req.Header.Get("Idempotency-Key") != ""
+	}
+	replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+	return idempotent && replayable
+}
+
+// retryStatus сообщает, что ошибку можно повторить: ошибка соединения
+// или ответ о временной недоступности
+func retryStatus(resp *http.Response) bool {
+	if resp == nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// classify возвращает итог запроса для автомата и описание ошибки
+func classify(ctx context.Context, resp *http.Response, err error) (outcome, string) {
+	switch {
+	case err != nil && ctx.Err() != nil:
+		// Вызывающий сам отменил запрос или истек его срок
+		return outcomeIgnored, err.Error()
+	case err != nil:
+		return outcomeFailure, err.Error()
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return outcomeFailure, resp.Status
+	default:
+		return outcomeSuccess, ""
+	}
+}
+
+// trackedBody запоминает ошибку чтения тела запроса
+type trackedBody struct {
+	io.ReadCloser
+	err error
+}
+
+// Read читает тело и запоминает ошибку, кроме конца данных
+func (b *trackedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if err != nil && !errors.Is(err, io.EOF) {
+		b.err = err
+	}
+	return n, err
+}
+
+// trackBody оборачивает тело запроса, чтобы отличить ошибку его чтения от ошибки хоста
+func trackBody(req *http.Request) *trackedBody {
+	if req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	body := &trackedBody{ReadCloser: req.Body}
+	req.Body = body
+	return body
+}
@@ -0,0 +1,235 @@
+package httpclient_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/httpclient"
+)
+
+// newTestClient создает клиент с быстрыми повторами и собственными автоматами
+func newTestClient(config httpclient.BreakerConfig) (*httpclient.Client, *httpclient.Breakers) {
+	breakers := httpclient.NewBreakers(config)
+	client := httpclient.New("test", time.Second)
+	client.SetBreakers(breakers)
+	client.SetPolicy(httpclient.Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond})
+	return client, breakers
+}
+
+// TestRetryReplaysBody проверяет, что повторная попытка PUT отправляет тело целиком
+func TestRetryReplaysBody(t *testing.T) {
+	var requests int32
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(data))
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(httpclient.DefaultBreakerConfig())
+	req, _ := http.NewRequest(http.MethodPut, server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK || len(bodies) != 2 || bodies[1] != "payload" {
+		t.Errorf("Ожидался повтор с тем же телом, получено %d %q", resp.StatusCode, bodies)
+	}
+}
+
+// TestRetryWithoutBody проверяет повтор запроса без тела после ответа 503
+func TestRetryWithoutBody(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(httpclient.DefaultBreakerConfig())
+	for _, body := range []io.Reader{nil, http.NoBody} {
+		atomic.StoreInt32(&requests, 0)
+		req, _ := http.NewRequest(http.MethodGet, server.URL, body)
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Ошибка запроса: %v", err)
+		}
+		data, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK || string(data) != "ok" || atomic.LoadInt32(&requests) != 2 {
+			t.Errorf("Ожидался повтор GET, получено %d %q после %d запросов", resp.StatusCode, data, atomic.LoadInt32(&requests))
+		}
+	}
+}
+
+// TestNoRetryForPost проверяет, что неидемпотентный запрос не повторяется
+func TestNoRetryForPost(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(httpclient.DefaultBreakerConfig())
+	req, _ := http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("POST не должен повторяться, запросов %d", got)
+	}
+
+	// С ключом идемпотентности запрос повторяется
+	atomic.StoreInt32(&requests, 0)
+	req, _ = http.NewRequest(http.MethodPost, server.URL, strings.NewReader("payload"))
+	req.Header.Set("Idempotency-Key", "42")
+	resp, err = client.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(&requests); got != 3 {
+		t.Errorf("Ожидалось 3 попытки с Idempotency-Key, получено %d", got)
+	}
+}
+
+// TestBreakerHalfOpen проверяет размыкание автомата и пробный запрос после паузы
+func TestBreakerHalfOpen(t *testing.T) {
+	var healthy atomic.Bool
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if !healthy.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, breakers := newTestClient(httpclient.BreakerConfig{FailureThreshold: 2, OpenTimeout: 50 * time.Millisecond})
+	get := func() (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+		resp, err := client.Do(req)
+		if resp != nil {
+			resp.Body.Close()
+		}
+		return resp, err
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := get(); err != nil {
+			t.Fatalf("Ошибка запроса до размыкания: %v", err)
+		}
+	}
+	if _, err := get(); !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Fatalf("Ожидалась ErrCircuitOpen, получено %v", err)
+	}
+	if got := atomic.LoadInt32(&requests); got != 2 {
+		t.Errorf("Разомкнутый автомат не должен пропускать запросы, запросов %d", got)
+	}
+	stats := breakers.Stats()
+	if len(stats) != 1 || stats[0].State != httpclient.BreakerOpen || stats[0].Rejected != 1 || stats[0].OpenedAt == nil {
+		t.Errorf("Неверное состояние автомата: %+v", stats)
+	}
+
+	// Неудачный пробный запрос снова размыкает автомат
+	time.Sleep(60 * time.Millisecond)
+	if _, err := get(); err != nil {
+		t.Fatalf("Пробный запрос должен пройти: %v", err)
+	}
+	if _, err := get(); !errors.Is(err, httpclient.ErrCircuitOpen) {
+		t.Fatalf("После неудачной пробы ожидалась ErrCircuitOpen, получено %v", err)
+	}
+
+	// Удачный пробный запрос замыкает автомат
+	healthy.Store(true)
+	time.Sleep(60 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if resp, err := get(); err != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("После восстановления запросы должны проходить: %v", err)
+		}
+	}
+	if stats := breakers.Stats(); stats[0].State != httpclient.BreakerClosed || stats[0].Failures != 0 {
+		t.Errorf("Автомат должен быть замкнут: %+v", stats)
+	}
+}
+
+// TestRetryStopsOnCancel проверяет, что задержка между попытками прерывается контекстом
+func TestRetryStopsOnCancel(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	client, breakers := newTestClient(httpclient.DefaultBreakerConfig())
+	client.SetPolicy(httpclient.Policy{MaxAttempts: 5, BaseDelay: time.Hour, MaxDelay: time.Hour})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+
+	start := time.Now()
+	if _, err := client.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Ожидалась отмена по контексту, получено %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Задержка не прервана отменой контекста: %v", elapsed)
+	}
+	if stats := breakers.Stats(); stats[0].Failures != 1 {
+		t.Errorf("Ожидалась одна учтенная ошибка, получено %+v", stats)
+	}
+}
+
+// countingTransport считает запросы, прошедшие через пул
+type countingTransport struct {
+	requests int32
+}
+
+func (t *countingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	atomic.AddInt32(&t.requests, 1)
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// TestSetTransport проверяет, что запросы идут через заданный пул соединений
+func TestSetTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, _ := newTestClient(httpclient.DefaultBreakerConfig())
+	transport := &countingTransport{}
+	client.SetTransport(transport)
+
+	req, _ := http.NewRequest(http.MethodGet, server.URL, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Ошибка запроса: %v", err)
+	}
+	resp.Body.Close()
+	if got := atomic.LoadInt32(&transport.requests); got != 1 {
+		t.Errorf("Запрос должен пройти через заданный пул, запросов %d", got)
+	}
+}
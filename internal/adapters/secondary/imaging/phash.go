@@ -0,0 +1,28 @@
+package imaging
+
+import (
+	"image"
+
+	"golang.org/x/image/draw"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// dHash вычисляет разностный хэш: изображение уменьшается до 9x8 в оттенках серого,
+// каждый бит показывает, светлее ли пиксель своего соседа справа. Хэш не меняется
+// при масштабировании и перекодировании и почти не меняется при сжатии
+func dHash(src image.Image) models.PerceptualHash {
+	gray := image.NewGray(image.Rect(0, 0, 9, 8))
+	draw.CatmullRom.Scale(gray, gray.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var hash uint64
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 8; x++ {
+			hash <<= 1
+			if gray.GrayAt(x, y).Y > gray.GrayAt(x+1, y).Y {
+				hash |= 1
+			}
+		}
+	}
+	return models.PerceptualHash(hash)
+}
@@ -0,0 +1,67 @@
+package imaging_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"testing"
+
+	"1337b04rd/internal/adapters/secondary/imaging"
+	"1337b04rd/internal/domain/models"
+)
+
+// encodeGradientJPEG кодирует диагональный градиент, при invert яркость обращается
+func encodeGradientJPEG(t *testing.T, width, height, quality int, invert bool) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*255/width + y*128/height) % 256)
+			if invert {
+				v = 255 - v
+			}
+			img.Set(x, y, color.RGBA{v, v / 2, 255 - v, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("Ошибка кодирования JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestProcessPerceptualHash проверяет устойчивость хэша к масштабу и сжатию
+func TestProcessPerceptualHash(t *testing.T) {
+	processor := imaging.NewProcessor()
+	hash := func(data []byte) models.PerceptualHash {
+		t.Helper()
+		processed, err := processor.Process(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatalf("Ошибка обработки: %v", err)
+		}
+		if processed.PerceptualHash == nil {
+			t.Fatal("Хэш не вычислен")
+		}
+		return *processed.PerceptualHash
+	}
+
+	original := hash(encodeGradientJPEG(t, 640, 480, 95, false))
+	resized := hash(encodeGradientJPEG(t, 320, 240, 40, false))
+	inverted := hash(encodeGradientJPEG(t, 640, 480, 95, true))
+
+	if d := original.Distance(resized); d > 8 {
+		t.Errorf("Уменьшенная копия отличается на %d бит", d)
+	}
+	if d := original.Distance(inverted); d <= 8 {
+		t.Errorf("Обращенное изображение отличается только на %d бит", d)
+	}
+
+	processed, err := processor.Process(bytes.NewReader([]byte(`<svg xmlns="http://www.w3.org/2000/svg"></svg>`)), nil)
+	if err != nil {
+		t.Fatalf("Ошибка обработки SVG: %v", err)
+	}
+	if processed.PerceptualHash != nil {
+		t.Error("Для SVG хэш не считается")
+	}
+}
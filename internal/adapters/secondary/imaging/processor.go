@@ -0,0 +1,286 @@
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+)
+
+const (
+	// MaxPixels наибольшая площадь изображения, которое декодируется целиком.
+	// Защищает от файлов, которые при распаковке занимают гигабайты памяти
+	MaxPixels = 40 * 1000 * 1000
+
+	// MaxAnimationPixels наибольшая суммарная площадь всех кадров GIF
+	MaxAnimationPixels = 100 * 1000 * 1000
+
+	// originalQuality качество перекодированного оригинала JPEG
+	originalQuality = 92
+
+	// jpegQuality качество миниатюр без прозрачности
+	jpegQuality = 85
+
+	// headerSize сколько первых байт файла читается для поиска EXIF и признаков SVG.
+	// Сегмент APP1 с EXIF не длиннее 64 КБ и идет в начале файла
+	headerSize = 128 << 10
+)
+
+// ErrTooLarge возвращается для изображений, площадь которых превышает ограничения
+var ErrTooLarge = errors.New("слишком большое разрешение изображения")
+
+// Processor декодирует изображения JPEG, PNG, GIF и WebP, перекодирует оригинал
+// без метаданных и строит миниатюры. SVG пропускается через строгий фильтр разметки
+type Processor struct {
+	maxPixels          int
+	maxAnimationPixels int
+}
+
+// NewProcessor создает новый обработчик изображений
+func NewProcessor() *Processor {
+	return &Processor{
+		maxPixels:          MaxPixels,
+		maxAnimationPixels: MaxAnimationPixels,
+	}
+}
+
+// Process декодирует изображение, перекодирует оригинал и строит уменьшенные копии.
+// Перекодирование удаляет EXIF, XMP, ICC-профили и комментарии. Ориентация из EXIF
+// применяется к пикселям JPEG до удаления метаданных. WebP сохраняется как JPEG
+// или PNG, потому что кодировщика WebP в стандартной библиотеке нет.
+// Непрозрачные копии кодируются в JPEG, копии с прозрачностью в PNG, у GIF берется первый кадр.
+// Перцептивный хэш считается по оригиналу после поворота. Файл читается из src
+// без копирования в память целиком
+func (p *Processor) Process(src io.ReadSeeker, sizes []models.ThumbnailSize) (*models.ProcessedImage, error) {
+	// Начало файла нужно для EXIF и распознавания SVG
+	header := make([]byte, headerSize)
+	n, err := io.ReadFull(src, header)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, fmt.Errorf("ошибка чтения изображения: %w", err)
+	}
+	header = header[:n]
+
+	// Размеры читаются из заголовка до декодирования всего файла. Длинные метаданные
+	// JPEG могут не поместиться в header, поэтому чтение продолжается из src
+	config, format, err := image.DecodeConfig(io.MultiReader(bytes.NewReader(header), src))
+	if err != nil {
+		if isSVG(header) {
+			if err := rewind(src); err != nil {
+				return nil, err
+			}
+			return processSVG(src)
+		}
+		return nil, fmt.Errorf("%w: %v", external.ErrUnsupportedImage, err)
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width*config.Height > p.maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, config.Width, config.Height)
+	}
+	if err := rewind(src); err != nil {
+		return nil, err
+	}
+
+	var img image.Image
+	var original, poster *models.ImageVariant
+	if format == "gif" {
+		img, original, poster, err = p.sanitizeGIF(src)
+	} else {
+		img, original, err = sanitize(src, header, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	bounds := img.Bounds()
+	original.Name = "original"
+	original.Width, original.Height = bounds.Dx(), bounds.Dy()
+	hash := dHash(img)
+	result := &models.ProcessedImage{
+		Format:         format,
+		Width:          bounds.Dx(),
+		Height:         bounds.Dy(),
+		Original:       original,
+		Variants:       make([]*models.ImageVariant, 0, len(sizes)),
+		PerceptualHash: &hash,
+		Poster:         poster,
+	}
+	for _, size := range sizes {
+		variant, err := thumbnail(img, size)
+		if err != nil {
+			return nil, err
+		}
+		result.Variants = append(result.Variants, variant)
+	}
+	return result, nil
+}
+
+// rewind возвращает чтение файла к началу
+func rewind(src io.Seeker) error {
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("ошибка чтения изображения: %w", err)
+	}
+	return nil
+}
+
+// processSVG очищает SVG по списку разрешенных элементов. Растровые миниатюры
+// для SVG не строятся, страницы показывают очищенный оригинал
+func processSVG(src io.Reader) (*models.ProcessedImage, error) {
+	clean, err := sanitizeSVG(src)
+	if err != nil {
+		return nil, err
+	}
+	return &models.ProcessedImage{
+		Format: "svg",
+		Original: &models.ImageVariant{
+			Name:        "original",
+			ContentType: "image/svg+xml",
+			Extension:   ".svg",
+			Data:        clean,
+		},
+	}, nil
+}
+
+// sanitize декодирует одиночное изображение, поворачивает JPEG по EXIF из header
+// и кодирует его заново без метаданных
+func sanitize(r io.Reader, header []byte, format string) (image.Image, *models.ImageVariant, error) {
+	src, _, err := image.Decode(r)
+	if err != nil {
+		return nil, nil, fmt.Errorf("ошибка декодирования изображения %s: %w", format, err)
+	}
+
+	var buf bytes.Buffer
+	original := &models.ImageVariant{}
+	switch format {
+	case "jpeg":
+		src = orient(src, exifOrientation(header))
+		if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: originalQuality}); err != nil {
+			return nil, nil, fmt.Errorf("ошибка кодирования изображения: %w", err)
+		}
+		original.ContentType, original.Extension = "image/jpeg", ".jpg"
+	case "png":
+		if err := png.Encode(&buf, src); err != nil {
+			return nil, nil, fmt.Errorf("ошибка кодирования изображения: %w", err)
+		}
+		original.ContentType, original.Extension = "image/png", ".png"
+	default:
+		if original, err = encode(src, originalQuality); err != nil {
+			return nil, nil, err
+		}
+		return src, original, nil
+	}
+	original.Data = buf.Bytes()
+	return src, original, nil
+}
+
+// sanitizeGIF перекодирует все кадры GIF. Расширения с комментариями и XMP
+// при этом отбрасываются, задержки, способ смены кадров и число повторов сохраняются.
+// Возвращает первый кадр на полном холсте, а для анимации еще и его статичную копию (постер)
+func (p *Processor) sanitizeGIF(r io.Reader) (image.Image, *models.ImageVariant, *models.ImageVariant, error) {
+	animation, err := gif.DecodeAll(r)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка декодирования изображения gif: %w", err)
+	}
+	if len(animation.Image) == 0 {
+		return nil, nil, nil, fmt.Errorf("%w: gif без кадров", external.ErrUnsupportedImage)
+	}
+
+	pixels := 0
+	for _, frame := range animation.Image {
+		pixels += frame.Bounds().Dx() * frame.Bounds().Dy()
+		if pixels > p.maxAnimationPixels {
+			return nil, nil, nil, fmt.Errorf("%w: %d кадров", ErrTooLarge, len(animation.Image))
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка кодирования изображения: %w", err)
+	}
+	original := &models.ImageVariant{
+		ContentType: "image/gif",
+		Extension:   ".gif",
+		Data:        buf.Bytes(),
+	}
+
+	first := firstFrame(animation)
+	if len(animation.Image) == 1 {
+		return first, original, nil, nil
+	}
+	poster, err := encode(first, originalQuality)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("ошибка кодирования постера: %w", err)
+	}
+	poster.Name = "poster"
+	poster.Width, poster.Height = first.Bounds().Dx(), first.Bounds().Dy()
+	return first, original, poster, nil
+}
+
+// firstFrame рисует первый кадр на холсте анимации. Кадр GIF может занимать
+// только часть холста, остальное остается прозрачным
+func firstFrame(animation *gif.GIF) image.Image {
+	frame := animation.Image[0]
+	canvas := image.Rect(0, 0, animation.Config.Width, animation.Config.Height)
+	if canvas.Empty() || frame.Bounds() == canvas {
+		return frame
+	}
+	dst := image.NewRGBA(canvas)
+	draw.Draw(dst, frame.Bounds(), frame, frame.Bounds().Min, draw.Src)
+	return dst
+}
+
+// thumbnail вписывает изображение в прямоугольник size и кодирует результат
+func thumbnail(src image.Image, size models.ThumbnailSize) (*models.ImageVariant, error) {
+	width, height := fit(src.Bounds().Dx(), src.Bounds().Dy(), size.Width, size.Height)
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	variant, err := encode(dst, jpegQuality)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка кодирования миниатюры %s: %w", size.Name, err)
+	}
+	variant.Name, variant.Width, variant.Height = size.Name, width, height
+	return variant, nil
+}
+
+// encode кодирует непрозрачное изображение в JPEG, изображение с прозрачностью в PNG
+func encode(img image.Image, quality int) (*models.ImageVariant, error) {
+	var buf bytes.Buffer
+	variant := &models.ImageVariant{}
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality}); err != nil {
+			return nil, err
+		}
+		variant.ContentType, variant.Extension = "image/jpeg", ".jpg"
+	} else {
+		if err := png.Encode(&buf, img); err != nil {
+			return nil, err
+		}
+		variant.ContentType, variant.Extension = "image/png", ".png"
+	}
+	variant.Data = buf.Bytes()
+	return variant, nil
+}
+
+// fit возвращает размеры, в которые вписывается изображение width x height
+// с сохранением пропорций. Изображения меньше прямоугольника не увеличиваются
+func fit(width, height, maxWidth, maxHeight int) (int, int) {
+	if width <= maxWidth && height <= maxHeight {
+		return width, height
+	}
+
+	// Сравнение через произведения избавляет от округления при делении
+	if width*maxHeight > height*maxWidth {
+		return maxWidth, max(1, height*maxWidth/width)
+	}
+	return max(1, width*maxHeight/height), maxHeight
+}
@@ -0,0 +1,274 @@
+package imaging_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"1337b04rd/internal/adapters/secondary/imaging"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+)
+
+// encodePNG рисует однотонное изображение заданного размера и кодирует его в PNG
+func encodePNG(t *testing.T, width, height int, fill color.Color) []byte {
+	t.Helper()
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, fill)
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Ошибка кодирования PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestProcessThumbnails проверяет размеры и формат миниатюр
+func TestProcessThumbnails(t *testing.T) {
+	processor := imaging.NewProcessor()
+	sizes := []models.ThumbnailSize{
+		{Name: "thread", Width: 350, Height: 350},
+		{Name: "catalog", Width: 250, Height: 250},
+	}
+
+	result, err := processor.Process(bytes.NewReader(encodePNG(t, 800, 400, color.NRGBA{R: 200, A: 255})), sizes)
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	if result.Format != "png" || result.Width != 800 || result.Height != 400 {
+		t.Errorf("Неверные данные оригинала: %s %dx%d", result.Format, result.Width, result.Height)
+	}
+
+	thread := result.Variant("thread")
+	if thread == nil || thread.Width != 350 || thread.Height != 175 {
+		t.Fatalf("Неверная миниатюра треда: %+v", thread)
+	}
+	if thread.ContentType != "image/jpeg" || thread.Extension != ".jpg" {
+		t.Errorf("Непрозрачная миниатюра должна быть JPEG, получено %s", thread.ContentType)
+	}
+	decoded, err := jpeg.Decode(bytes.NewReader(thread.Data))
+	if err != nil {
+		t.Fatalf("Миниатюра не декодируется: %v", err)
+	}
+	if decoded.Bounds().Dx() != 350 || decoded.Bounds().Dy() != 175 {
+		t.Errorf("Неверный размер закодированной миниатюры: %v", decoded.Bounds())
+	}
+
+	if catalog := result.Variant("catalog"); catalog == nil || catalog.Width != 250 || catalog.Height != 125 {
+		t.Errorf("Неверная миниатюра каталога: %+v", catalog)
+	}
+}
+
+// TestProcessKeepsSmallAndTransparent проверяет, что маленькие изображения не увеличиваются,
+// а прозрачные кодируются в PNG
+func TestProcessKeepsSmallAndTransparent(t *testing.T) {
+	processor := imaging.NewProcessor()
+
+	result, err := processor.Process(bytes.NewReader(encodePNG(t, 40, 100, color.NRGBA{G: 100, A: 128})),
+		[]models.ThumbnailSize{{Name: "thread", Width: 350, Height: 350}})
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	variant := result.Variant("thread")
+	if variant.Width != 40 || variant.Height != 100 {
+		t.Errorf("Маленькое изображение изменило размер: %dx%d", variant.Width, variant.Height)
+	}
+	if variant.ContentType != "image/png" {
+		t.Errorf("Прозрачная миниатюра должна быть PNG, получено %s", variant.ContentType)
+	}
+}
+
+// TestProcessRejects проверяет отказ для неизображений и слишком больших изображений
+func TestProcessRejects(t *testing.T) {
+	processor := imaging.NewProcessor()
+
+	if _, err := processor.Process(bytes.NewReader([]byte("просто текст")), nil); !errors.Is(err, external.ErrUnsupportedImage) {
+		t.Errorf("Ожидалась ошибка формата, получено %v", err)
+	}
+
+	// Заголовок GIF объявляет холст 10000x10000 при кадре 1x1
+	frame := image.NewPaletted(image.Rect(0, 0, 1, 1), color.Palette{color.Black, color.White})
+	var buf bytes.Buffer
+	err := gif.EncodeAll(&buf, &gif.GIF{
+		Image:  []*image.Paletted{frame},
+		Delay:  []int{0},
+		Config: image.Config{ColorModel: frame.Palette, Width: 10000, Height: 10000},
+	})
+	if err != nil {
+		t.Fatalf("Ошибка кодирования GIF: %v", err)
+	}
+	if _, err := processor.Process(bytes.NewReader(buf.Bytes()), nil); !errors.Is(err, imaging.ErrTooLarge) {
+		t.Errorf("Ожидалась ошибка размера, получено %v", err)
+	}
+}
+
+// withEXIF вставляет после SOI сегмент APP1 с тегом ориентации и строкой, имитирующей координаты GPS
+func withEXIF(jpegData []byte, orientation uint16) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01")
+	tiff = binary.BigEndian.AppendUint16(tiff, 0x0112)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientation)
+	tiff = append(tiff, 0, 0, 0, 0, 0, 0)
+	tiff = append(tiff, "GPSLatitude 55.7558"...)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1}
+	segment = binary.BigEndian.AppendUint16(segment, uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	result := append([]byte{}, jpegData[:2]...)
+	result = append(result, segment...)
+	return append(result, jpegData[2:]...)
+}
+
+// TestProcessStripsEXIFAndOrients проверяет поворот по тегу ориентации и удаление EXIF
+func TestProcessStripsEXIFAndOrients(t *testing.T) {
+	// Левая половина красная, правая синяя
+	src := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				src.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				src.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: 95}); err != nil {
+		t.Fatalf("Ошибка кодирования JPEG: %v", err)
+	}
+
+	// Ориентация 6: изображение нужно повернуть на 90 градусов по часовой стрелке
+	result, err := imaging.NewProcessor().Process(bytes.NewReader(withEXIF(buf.Bytes(), 6)), nil)
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	if bytes.Contains(result.Original.Data, []byte("Exif")) || bytes.Contains(result.Original.Data, []byte("GPSLatitude")) {
+		t.Error("Метаданные EXIF остались в оригинале")
+	}
+	if result.Width != 20 || result.Height != 40 {
+		t.Fatalf("Ориентация не применена: %dx%d", result.Width, result.Height)
+	}
+
+	decoded, err := jpeg.Decode(bytes.NewReader(result.Original.Data))
+	if err != nil {
+		t.Fatalf("Оригинал не декодируется: %v", err)
+	}
+	// После поворота красная половина оказывается сверху
+	if r, _, b, _ := decoded.At(10, 5).RGBA(); r < b {
+		t.Errorf("Верх изображения должен быть красным")
+	}
+	if r, _, b, _ := decoded.At(10, 35).RGBA(); b < r {
+		t.Errorf("Низ изображения должен быть синим")
+	}
+}
+
+// TestProcessLongMetadata проверяет JPEG, у которого метаданные длиннее читаемого заголовка
+func TestProcessLongMetadata(t *testing.T) {
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 30, 20)), nil); err != nil {
+		t.Fatalf("Ошибка кодирования JPEG: %v", err)
+	}
+
+	// Четыре сегмента APP2 по 60 КБ, как у длинного ICC-профиля
+	data := append([]byte{}, buf.Bytes()[:2]...)
+	for i := 0; i < 4; i++ {
+		payload := bytes.Repeat([]byte{'x'}, 60<<10)
+		data = append(data, 0xFF, 0xE2)
+		data = binary.BigEndian.AppendUint16(data, uint16(len(payload)+2))
+		data = append(data, payload...)
+	}
+	data = append(data, buf.Bytes()[2:]...)
+
+	result, err := imaging.NewProcessor().Process(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	if result.Width != 30 || result.Height != 20 || len(result.Original.Data) >= len(data) {
+		t.Errorf("Неверный результат: %dx%d, %d байт", result.Width, result.Height, len(result.Original.Data))
+	}
+}
+
+// TestProcessStripsPNGText проверяет удаление текстовых блоков PNG
+func TestProcessStripsPNGText(t *testing.T) {
+	data := encodePNG(t, 10, 10, color.NRGBA{B: 255, A: 255})
+
+	// Текстовый блок вставляется перед IEND
+	text := append([]byte("tEXt"), "Comment\x00secret"...)
+	chunk := binary.BigEndian.AppendUint32(nil, uint32(len(text)-4))
+	chunk = append(chunk, text...)
+	chunk = binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(text))
+	iend := len(data) - 12
+	data = append(data[:iend:iend], append(chunk, data[iend:]...)...)
+
+	result, err := imaging.NewProcessor().Process(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	if bytes.Contains(result.Original.Data, []byte("secret")) {
+		t.Error("Текстовый блок остался в оригинале")
+	}
+	if result.Original.ContentType != "image/png" {
+		t.Errorf("PNG должен остаться PNG, получено %s", result.Original.ContentType)
+	}
+}
+
+// TestProcessKeepsGIFFrames проверяет, что перекодирование GIF сохраняет все кадры
+func TestProcessKeepsGIFFrames(t *testing.T) {
+	palette := color.Palette{color.Black, color.White}
+	animation := &gif.GIF{
+		Image: []*image.Paletted{
+			image.NewPaletted(image.Rect(0, 0, 8, 8), palette),
+			image.NewPaletted(image.Rect(0, 0, 8, 8), palette),
+		},
+		Delay: []int{10, 20},
+	}
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatalf("Ошибка кодирования GIF: %v", err)
+	}
+
+	result, err := imaging.NewProcessor().Process(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil {
+		t.Fatalf("Ошибка обработки изображения: %v", err)
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(result.Original.Data))
+	if err != nil {
+		t.Fatalf("Оригинал не декодируется: %v", err)
+	}
+	if len(decoded.Image) != 2 || decoded.Delay[1] != 20 {
+		t.Errorf("Кадры GIF не сохранены: %d кадров, задержки %v", len(decoded.Image), decoded.Delay)
+	}
+
+	// Для анимации сохраняется статичный первый кадр
+	poster := result.Poster
+	if poster == nil || poster.Name != "poster" || poster.Width != 8 || poster.Height != 8 {
+		t.Fatalf("Неверный постер анимации: %+v", poster)
+	}
+	if _, _, err := image.Decode(bytes.NewReader(poster.Data)); err != nil {
+		t.Errorf("Постер не декодируется: %v", err)
+	}
+
+	// У GIF из одного кадра постера нет
+	buf.Reset()
+	animation.Image, animation.Delay = animation.Image[:1], animation.Delay[:1]
+	if err := gif.EncodeAll(&buf, animation); err != nil {
+		t.Fatalf("Ошибка кодирования GIF: %v", err)
+	}
+	result, err = imaging.NewProcessor().Process(bytes.NewReader(buf.Bytes()), nil)
+	if err != nil || result.Poster != nil {
+		t.Errorf("У статичного GIF не должно быть постера: %+v, %v", result, err)
+	}
+}
@@ -0,0 +1,169 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Пространства имен, которые разрешено объявлять в SVG
+const (
+	svgNamespace   = "http://www.w3.org/2000/svg"
+	xlinkNamespace = "http://www.w3.org/1999/xlink"
+)
+
+// ErrUnsafeSVG возвращается для SVG, которые не удалось разобрать или которые не являются SVG
+var ErrUnsafeSVG = errors.New("недопустимый SVG")
+
+// svgElements элементы, которые остаются в SVG. Все остальные удаляются вместе
+// с содержимым: script, foreignObject, image, a, style, анимации и элементы других пространств имен
+var svgElements = setOf(
+	"svg", "g", "defs", "title", "desc", "symbol", "use",
+	"path", "rect", "circle", "ellipse", "line", "polyline", "polygon",
+	"text", "tspan", "linearGradient", "radialGradient", "stop",
+	"clipPath", "mask", "pattern", "filter",
+	"feGaussianBlur", "feOffset", "feBlend", "feColorMatrix", "feFlood",
+	"feComposite", "feMerge", "feMergeNode", "feDropShadow",
+)
+
+// svgAttributes атрибуты без префикса, которые остаются в SVG. Обработчики событий
+// on* и внешние ссылки в список не входят
+var svgAttributes = setOf(
+	"id", "class", "version", "x", "y", "x1", "y1", "x2", "y2", "cx", "cy", "r", "rx", "ry",
+	"fx", "fy", "dx", "dy", "rotate", "width", "height", "d", "points", "viewBox",
+	"preserveAspectRatio", "transform", "fill", "fill-opacity", "fill-rule", "stroke",
+	"stroke-width", "stroke-opacity", "stroke-linecap", "stroke-linejoin", "stroke-dasharray",
+	"stroke-dashoffset", "stroke-miterlimit", "opacity", "clip-path", "clip-rule", "mask",
+	"filter", "font-family", "font-size", "font-weight", "font-style", "text-anchor",
+	"dominant-baseline", "letter-spacing", "offset", "stop-color", "stop-opacity",
+	"gradientUnits", "gradientTransform", "spreadMethod", "patternUnits", "patternTransform",
+	"patternContentUnits", "clipPathUnits", "maskUnits", "maskContentUnits", "filterUnits",
+	"visibility", "display", "color", "in", "in2", "stdDeviation", "result", "mode",
+	"values", "type", "operator", "k1", "k2", "k3", "k4", "flood-color", "flood-opacity",
+	"style",
+)
+
+// setOf строит множество строк
+func setOf(values ...string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
+
+// isSVG сообщает, что данные похожи на документ SVG
+func isSVG(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("<svg"))
+}
+
+// sanitizeSVG пересобирает SVG по списку разрешенных элементов и атрибутов.
+// Удаляются скрипты, обработчики событий, внешние ссылки, комментарии, инструкции
+// обработки и DOCTYPE. Результат всегда начинается с <svg
+func sanitizeSVG(src io.Reader) ([]byte, error) {
+	decoder := xml.NewDecoder(src)
+	decoder.Strict = true
+
+	var out bytes.Buffer
+	depth, skip := 0, 0
+	for {
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnsafeSVG, err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skip > 0 || (depth == 0 && out.Len() > 0) {
+				// Содержимое удаленного элемента и второй корень пропускаются
+				skip++
+				continue
+			}
+			if depth == 0 && (t.Name.Space != "" || t.Name.Local != "svg") {
+				return nil, fmt.Errorf("%w: корневой элемент %s", ErrUnsafeSVG, t.Name.Local)
+			}
+			if t.Name.Space != "" || !svgElements[t.Name.Local] {
+				skip++
+				continue
+			}
+			depth++
+			out.WriteString("<" + t.Name.Local)
+			for _, attr := range t.Attr {
+				if name, ok := safeSVGAttribute(attr); ok {
+					out.WriteString(" " + name + `="`)
+					xml.EscapeText(&out, []byte(attr.Value))
+					out.WriteString(`"`)
+				}
+			}
+			out.WriteString(">")
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			depth--
+			out.WriteString("</" + t.Name.Local + ">")
+		case xml.CharData:
+			if skip == 0 && depth > 0 {
+				xml.EscapeText(&out, t)
+			}
+		}
+		// Комментарии, инструкции обработки и DOCTYPE не переносятся
+	}
+
+	if out.Len() == 0 || depth != 0 {
+		return nil, fmt.Errorf("%w: документ не содержит svg", ErrUnsafeSVG)
+	}
+	return out.Bytes(), nil
+}
+
+// safeSVGAttribute возвращает имя атрибута для вывода, если атрибут разрешен
+func safeSVGAttribute(attr xml.Attr) (string, bool) {
+	switch {
+	case attr.Name.Space == "" && attr.Name.Local == "xmlns":
+		return "xmlns", attr.Value == svgNamespace
+	case attr.Name.Space == "xmlns" && attr.Name.Local == "xlink":
+		return "xmlns:xlink", attr.Value == xlinkNamespace
+	case attr.Name.Local == "href" && (attr.Name.Space == "" || attr.Name.Space == "xlink"):
+		// Ссылки допускаются только на элементы того же документа
+		name := "href"
+		if attr.Name.Space != "" {
+			name = "xlink:href"
+		}
+		return name, strings.HasPrefix(strings.TrimSpace(attr.Value), "#")
+	case attr.Name.Space != "" || !svgAttributes[attr.Name.Local]:
+		return "", false
+	}
+	return attr.Name.Local, safeSVGValue(attr.Value)
+}
+
+// safeSVGValue проверяет значение атрибута: url() разрешен только с локальной
+// ссылкой, схемы javascript: и data:, выражения и импорт CSS запрещены
+func safeSVGValue(value string) bool {
+	compact := strings.ToLower(strings.Join(strings.Fields(value), ""))
+	for _, banned := range []string{"javascript:", "data:", "expression(", "@import", "\\", "<"} {
+		if strings.Contains(compact, banned) {
+			return false
+		}
+	}
+	for rest := compact; ; {
+		i := strings.Index(rest, "url(")
+		if i < 0 {
+			return true
+		}
+		rest = strings.TrimLeft(rest[i+len("url("):], `'"`)
+		if !strings.HasPrefix(rest, "#") {
+			return false
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package imaging_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"1337b04rd/internal/adapters/secondary/imaging"
+)
+
+// TestProcessSanitizesSVG проверяет удаление скриптов, обработчиков событий и внешних ссылок из SVG
+func TestProcessSanitizesSVG(t *testing.T) {
+	processor := imaging.NewProcessor()
+
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Скрипт и обработчик события",
+			input: `<svg xmlns="http://www.w3.org/2000/svg" onload="alert(1)"><script>alert(2)</script><rect width="10" height="10" fill="red" onclick="alert(3)"/></svg>`,
+			want:  `<svg xmlns="http://www.w3.org/2000/svg"><rect width="10" height="10" fill="red"></rect></svg>`,
+		},
+		{
+			name:  "Внешние ссылки",
+			input: `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use xlink:href="http://evil/x.svg#a"/><use href="#local"/><image href="http://evil/x.png"/><rect fill="url(http://evil/p)" stroke="url(#grad)"/></svg>`,
+			want:  `<svg xmlns:xlink="http://www.w3.org/1999/xlink"><use></use><use href="#local"></use><rect stroke="url(#grad)"></rect></svg>`,
+		},
+		{
+			name:  "Встроенный HTML и стили",
+			input: `<?xml version="1.0"?><!-- комментарий --><svg><style>@import url(http://evil)</style><foreignObject><iframe src="javascript:alert(1)"/></foreignObject><text style="fill: blue">a &lt; b</text><g style="background:url(javascript:alert(1))"/></svg>`,
+			want:  `<svg><text style="fill: blue">a &lt; b</text><g></g></svg>`,
+		},
+		{
+			name:  "Ссылка javascript",
+			input: `<svg><a href="javascript:alert(1)"><circle r="5"/></a><animate attributeName="href" to="javascript:alert(1)"/></svg>`,
+			want:  `<svg></svg>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := processor.Process(strings.NewReader(tt.input), nil)
+			if err != nil {
+				t.Fatalf("Ошибка обработки SVG: %v", err)
+			}
+			if result.Original.ContentType != "image/svg+xml" || result.Original.Extension != ".svg" || len(result.Variants) != 0 {
+				t.Errorf("Неверное описание SVG: %+v", result.Original)
+			}
+			if got := string(result.Original.Data); got != tt.want {
+				t.Errorf("Неверный результат очистки:\n%s\nожидалось:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// TestProcessRejectsSVG проверяет отказ для поврежденных SVG и документов с другим корнем
+func TestProcessRejectsSVG(t *testing.T) {
+	processor := imaging.NewProcessor()
+
+	inputs := []string{
+		`<svg><rect></svg>`,
+		`<html><svg></svg></html>`,
+		`<!DOCTYPE svg [<!ENTITY xxe SYSTEM "file:///etc/passwd">]><svg><text>&xxe;</text></svg>`,
+	}
+	for _, input := range inputs {
+		if _, err := processor.Process(strings.NewReader(input), nil); !errors.Is(err, imaging.ErrUnsafeSVG) {
+			t.Errorf("Ожидался отказ для %q, получено %v", strings.TrimSpace(input), err)
+		}
+	}
+}
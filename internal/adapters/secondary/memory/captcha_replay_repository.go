@@ -0,0 +1,52 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// CaptchaReplayRepository хранит использованные задачи капчи в памяти процесса
+type CaptchaReplayRepository struct {
+	mu        sync.Mutex
+	used      map[string]time.Time
+	lastSweep time.Time
+}
+
+// NewCaptchaReplayRepository создает новое хранилище использованных задач
+func NewCaptchaReplayRepository() *CaptchaReplayRepository {
+	return &CaptchaReplayRepository{
+		used: make(map[string]time.Time),
+	}
+}
+
+// MarkUsed отмечает задачу как использованную.
+// Возвращает false, если задача уже была использована
+func (r *CaptchaReplayRepository) MarkUsed(_ context.Context, id string, expiresAt time.Time) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.sweep(now)
+
+	if exp, ok := r.used[id]; ok && exp.After(now) {
+		return false, nil
+	}
+
+	r.used[id] = expiresAt
+	return true, nil
+}
+
+// sweep удаляет записи об истекших задачах. Вызывается под блокировкой
+func (r *CaptchaReplayRepository) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	for id, exp := range r.used {
+		if !exp.After(now) {
+			delete(r.used, id)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// sweepInterval как часто удалять полностью восстановившиеся корзины
+const sweepInterval = time.Minute
+
+// bucketEntry хранит корзину вместе с правилом, по которому она пополняется
+type bucketEntry struct {
+	bucket models.TokenBucket
+	rule   models.RateLimitRule
+}
+
+// RateLimitRepository хранит корзины токенов в памяти процесса.
+// Подходит для запуска в одном экземпляре
+type RateLimitRepository struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucketEntry
+	lastSweep time.Time
+}
+
+// NewRateLimitRepository создает новое хранилище корзин в памяти
+func NewRateLimitRepository() *RateLimitRepository {
+	return &RateLimitRepository{
+		buckets: make(map[string]*bucketEntry),
+	}
+}
+
+// Take пополняет корзину по ключу и забирает из нее один токен
+func (r *RateLimitRepository) Take(_ context.Context, key string, rule models.RateLimitRule, now time.Time) (models.RateLimitDecision, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.sweep(now)
+
+	entry, ok := r.buckets[key]
+	if !ok {
+		entry = &bucketEntry{bucket: models.NewTokenBucket(rule, now)}
+		r.buckets[key] = entry
+	}
+	entry.rule = rule
+
+	return entry.bucket.Take(rule, now), nil
+}
+
+// Refund возвращает токен в корзину по ключу
+func (r *RateLimitRepository) Refund(_ context.Context, key string, rule models.RateLimitRule) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if entry, ok := r.buckets[key]; ok {
+		entry.bucket.Refund(rule)
+	}
+	return nil
+}
+
+// Len возвращает количество отслеживаемых корзин
+func (r *RateLimitRepository) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.buckets)
+}
+
+// sweep удаляет корзины, которые уже полностью восстановились.
+// Вызывается под блокировкой
+func (r *RateLimitRepository) sweep(now time.Time) {
+	if now.Sub(r.lastSweep) < sweepInterval {
+		return
+	}
+	r.lastSweep = now
+
+	for key, entry := range r.buckets {
+		if entry.bucket.Idle(entry.rule, now) {
+			delete(r.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/lib/pq"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// AttachmentRepository реализует интерфейс репозитория файлов для PostgreSQL
+type AttachmentRepository struct {
+	db *sql.DB
+}
+
+// NewAttachmentRepository создает новый экземпляр репозитория файлов
+func NewAttachmentRepository(db *sql.DB) *AttachmentRepository {
+	return &AttachmentRepository{
+		db: db,
+	}
+}
+
+// GetByOwners возвращает файлы записей вида ownerType по ID записи в порядке галереи
+func (r *AttachmentRepository) GetByOwners(ctx context.Context, ownerType string, ownerIDs []int64) (map[int64][]*models.Attachment, error) {
+	attachments := make(map[int64][]*models.Attachment)
+	if len(ownerIDs) == 0 {
+		return attachments, nil
+	}
+
+	query := `SELECT id, owner_type, owner_id, position, bucket, object_key, mime_type, size_bytes, width, height, 
+        thumbnail_key, duration_ms, poster_key, original_filename, is_spoiler, created_at 
+        FROM attachments 
+        WHERE owner_type = $1 AND owner_id = ANY($2) 
+        ORDER BY owner_id, position`
+
+	rows, err := r.db.QueryContext(ctx, query, ownerType, pq.Array(ownerIDs))
+	if err != nil {
+		slog.Error("Ошибка запроса файлов", "owner_type", ownerType, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var attachment models.Attachment
+		var durationMS int64
+		err := rows.Scan(&attachment.ID, &attachment.OwnerType, &attachment.OwnerID, &attachment.Position,
+			&attachment.Bucket, &attachment.Key, &attachment.ContentType, &attachment.Size, &attachment.Width, &attachment.Height,
+			&attachment.ThumbnailKey, &durationMS, &attachment.PosterKey, &attachment.Filename, &attachment.IsSpoiler, &attachment.CreatedAt)
+		if err != nil {
+			slog.Error("Ошибка сканирования файла", "error", err)
+			return nil, err
+		}
+		attachment.Duration = time.Duration(durationMS) * time.Millisecond
+		attachments[attachment.OwnerID] = append(attachments[attachment.OwnerID], &attachment)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк из БД", "error", err)
+		return nil, err
+	}
+	return attachments, nil
+}
+
+// insertAttachments сохраняет файлы новой записи в транзакции ее создания.
+// Позиция файла задается его местом в списке
+func insertAttachments(ctx context.Context, tx *sql.Tx, ownerType string, ownerID int64, attachments []*models.Attachment) error {
+	query := `INSERT INTO attachments 
+        (owner_type, owner_id, position, bucket, object_key, mime_type, size_bytes, width, height, thumbnail_key, 
+        duration_ms, poster_key, original_filename, is_spoiler) 
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)`
+
+	for position, attachment := range attachments {
+		_, err := tx.ExecContext(ctx, query, ownerType, ownerID, position,
+			attachment.Bucket, attachment.Key, attachment.ContentType, attachment.Size, attachment.Width, attachment.Height,
+			attachment.ThumbnailKey, attachment.Duration.Milliseconds(), attachment.PosterKey, attachment.Filename, attachment.IsSpoiler)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// captchaSweepInterval как часто удалять записи об истекших задачах
+const captchaSweepInterval = time.Minute
+
+// CaptchaReplayRepository хранит использованные задачи капчи в PostgreSQL,
+// чтобы решенную капчу нельзя было повторить на другом экземпляре
+type CaptchaReplayRepository struct {
+	db *sql.DB
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewCaptchaReplayRepository создает новый экземпляр репозитория использованных задач
+func NewCaptchaReplayRepository(db *sql.DB) *CaptchaReplayRepository {
+	return &CaptchaReplayRepository{
+		db: db,
+	}
+}
+
+// MarkUsed отмечает задачу как использованную до expiresAt.
+// Возвращает false, если задача уже была использована
+func (r *CaptchaReplayRepository) MarkUsed(ctx context.Context, id string, expiresAt time.Time) (bool, error) {
+	now := time.Now()
+	r.sweep(ctx, now)
+
+	// Запись истекшей задачи с тем же ID перезаписывается
+	query := `INSERT INTO captcha_replays (id, expires_at) VALUES ($1, $2)
+		ON CONFLICT (id) DO UPDATE SET expires_at = EXCLUDED.expires_at
+		WHERE captcha_replays.expires_at <= $3`
+
+	result, err := r.db.ExecContext(ctx, query, id, expiresAt, now)
+	if err != nil {
+		slog.Error("Ошибка отметки использованной капчи", "error", err)
+		return false, fmt.Errorf("ошибка отметки капчи: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected == 1, nil
+}
+
+// sweep удаляет записи об истекших задачах не чаще captchaSweepInterval
+func (r *CaptchaReplayRepository) sweep(ctx context.Context, now time.Time) {
+	r.mu.Lock()
+	if now.Sub(r.lastSweep) < captchaSweepInterval {
+		r.mu.Unlock()
+		return
+	}
+	r.lastSweep = now
+	r.mu.Unlock()
+
+	if _, err := r.db.ExecContext(ctx, `DELETE FROM captcha_replays WHERE expires_at <= $1`, now); err != nil {
+		slog.Error("Ошибка удаления истекших капч", "error", err)
+	}
+}
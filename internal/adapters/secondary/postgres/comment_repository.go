@@ -7,6 +7,8 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/lib/pq"
+
 	"1337b04rd/internal/domain/models"
 )
 
@@ -25,7 +27,7 @@ func NewCommentRepository(db *sql.DB) *CommentRepository {
 // GetByID возвращает комментарий по его ID
 func (r *CommentRepository) GetByID(ctx context.Context, id int64) (*models.Comment, error) {
 	query := `SELECT 
-        id, post_id, user_id, user_name, avatar_url, content, image_url, created_at, reply_to_id
+        id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score
         FROM comments 
         WHERE id = $1`
 
@@ -41,8 +43,13 @@ func (r *CommentRepository) GetByID(ctx context.Context, id int64) (*models.Comm
 		&avatarURL,
 		&comment.Content,
 		&imageURL,
+		&comment.ImageWidth,
+		&comment.ImageHeight,
+		&comment.ThumbnailURL,
 		&comment.CreatedAt,
 		&replyToID,
+		&comment.Status,
+		&comment.SpamScore,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -80,7 +87,7 @@ func (r *CommentRepository) GetByPostID(ctx context.Context, postID int64, limit
 
 	// SQL-запрос с выборкой всех полей
 	query := `SELECT 
-        id, post_id, user_id, user_name, avatar_url, content, image_url, created_at, reply_to_id
+        id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score
         FROM comments 
         WHERE post_id = $1 
         ORDER BY created_at ASC 
@@ -122,8 +129,13 @@ func (r *CommentRepository) GetByPostID(ctx context.Context, postID int64, limit
 			&avatarURL,
 			&comment.Content,
 			&imageURL,
+			&comment.ImageWidth,
+			&comment.ImageHeight,
+			&comment.ThumbnailURL,
 			&comment.CreatedAt,
 			&replyToID,
+			&comment.Status,
+			&comment.SpamScore,
 		)
 		if err != nil {
 			slog.Error("Ошибка сканирования строки комментария",
@@ -161,12 +173,239 @@ func (r *CommentRepository) GetByPostID(ctx context.Context, postID int64, limit
 	return comments, nil
 }
 
+// GetPageAfter возвращает страницу комментариев поста после курсора.
+// Курсор задается ID комментария, сравнение по паре (created_at, id) не пропускает
+// комментарии с одинаковым временем. Если комментария-курсора нет в посте, страница пуста
+func (r *CommentRepository) GetPageAfter(ctx context.Context, postID, viewerID, afterID int64, limit int) ([]*models.Comment, error) {
+	query := `SELECT 
+        id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score
+        FROM comments 
+        WHERE post_id = $1 
+            AND (moderation_status IN ('visible', 'flagged') OR user_id = $2)
+            AND ($3 = 0 OR (created_at, id) > (
+                SELECT created_at, id FROM comments WHERE id = $3 AND post_id = $1))
+        ORDER BY created_at ASC, id ASC 
+        LIMIT $4`
+
+	rows, err := r.db.QueryContext(ctx, query, postID, viewerID, afterID, limit)
+	if err != nil {
+		slog.Error("Ошибка запроса страницы комментариев", "post_id", postID, "after", afterID, "error", err)
+		return nil, fmt.Errorf("ошибка запроса комментариев: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var avatarURL, imageURL sql.NullString
+		var replyToID sql.NullInt64
+
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.UserName,
+			&avatarURL,
+			&comment.Content,
+			&imageURL,
+			&comment.ImageWidth,
+			&comment.ImageHeight,
+			&comment.ThumbnailURL,
+			&comment.CreatedAt,
+			&replyToID,
+			&comment.Status,
+			&comment.SpamScore,
+		)
+		if err != nil {
+			slog.Error("Ошибка сканирования строки комментария", "error", err.Error())
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+
+		comment.AvatarURL = avatarURL.String
+		comment.ImageURL = imageURL.String
+		comment.ReplyToID = replyToID.Int64
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Ошибка после итерации по комментариям", "error", err.Error())
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+
+	slog.Info("Получена страница комментариев", "post_id", postID, "after", afterID, "count", len(comments))
+	return comments, nil
+}
+
+// GetTreeByPostID возвращает ветки ответов по reply_to_id для страницы корневых комментариев.
+// Рекурсивный запрос спускается от корней не глубже maxDepth и накапливает путь,
+// сортировка по пути дает обход в глубину. У комментариев на глубине maxDepth
+// заполняется число скрытых прямых ответов
+func (r *CommentRepository) GetTreeByPostID(ctx context.Context, postID, viewerID int64, maxDepth, limit, offset int) ([]*models.Comment, error) {
+	query := `WITH RECURSIVE roots AS (
+            SELECT id FROM comments
+            WHERE post_id = $1 AND reply_to_id IS NULL 
+                AND (moderation_status IN ('visible', 'flagged') OR user_id = $2)
+            ORDER BY created_at ASC, id ASC
+            LIMIT $4 OFFSET $5
+        ), tree AS (
+            SELECT c.*, 0 AS depth, ARRAY[c.id] AS path
+            FROM comments c
+            JOIN roots ON roots.id = c.id
+            UNION ALL
+            SELECT c.*, tree.depth + 1, tree.path || c.id
+            FROM comments c
+            JOIN tree ON c.reply_to_id = tree.id
+            WHERE tree.depth < $3
+                AND (c.moderation_status IN ('visible', 'flagged') OR c.user_id = $2)
+        )
+        SELECT id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, 
+            moderation_status, spam_score, depth, path,
+            CASE WHEN depth = $3 THEN (
+                SELECT COUNT(*) FROM comments r
+                WHERE r.reply_to_id = tree.id
+                    AND (r.moderation_status IN ('visible', 'flagged') OR r.user_id = $2)
+            ) ELSE 0 END AS more_replies
+        FROM tree
+        ORDER BY path`
+
+	rows, err := r.db.QueryContext(ctx, query, postID, viewerID, maxDepth, limit, offset)
+	if err != nil {
+		slog.Error("Ошибка запроса дерева комментариев", "post_id", postID, "error", err)
+		return nil, fmt.Errorf("ошибка запроса дерева комментариев: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var avatarURL, imageURL sql.NullString
+		var replyToID sql.NullInt64
+		var path pq.Int64Array
+
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.UserName,
+			&avatarURL,
+			&comment.Content,
+			&imageURL,
+			&comment.ImageWidth,
+			&comment.ImageHeight,
+			&comment.ThumbnailURL,
+			&comment.CreatedAt,
+			&replyToID,
+			&comment.Status,
+			&comment.SpamScore,
+			&comment.Depth,
+			&path,
+			&comment.MoreReplies,
+		)
+		if err != nil {
+			slog.Error("Ошибка сканирования строки комментария", "error", err.Error())
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+
+		comment.AvatarURL = avatarURL.String
+		comment.ImageURL = imageURL.String
+		comment.ReplyToID = replyToID.Int64
+		comment.Path = path
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Ошибка после итерации по дереву комментариев", "error", err.Error())
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+
+	slog.Info("Получено дерево комментариев", "post_id", postID, "count", len(comments))
+	return comments, nil
+}
+
+// GetLinks возвращает цитаты указанных комментариев и опубликованные ответы на них.
+// Одна выборка по comment_quotes покрывает оба направления
+func (r *CommentRepository) GetLinks(ctx context.Context, ids []int64) (*models.CommentLinks, error) {
+	links := &models.CommentLinks{
+		Quotes:  make(map[int64][]int64),
+		Replies: make(map[int64][]int64),
+	}
+	if len(ids) == 0 {
+		return links, nil
+	}
+
+	query := `SELECT q.comment_id, q.quoted_id, c.moderation_status IN ('visible', 'flagged')
+        FROM comment_quotes q
+        JOIN comments c ON c.id = q.comment_id
+        WHERE q.comment_id = ANY($1) OR q.quoted_id = ANY($1)
+        ORDER BY q.comment_id, q.quoted_id`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		slog.Error("Ошибка запроса цитат комментариев", "error", err)
+		return nil, fmt.Errorf("ошибка запроса цитат: %w", err)
+	}
+	defer rows.Close()
+
+	wanted := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		wanted[id] = true
+	}
+
+	for rows.Next() {
+		var commentID, quotedID int64
+		var public bool
+		if err := rows.Scan(&commentID, &quotedID, &public); err != nil {
+			slog.Error("Ошибка сканирования цитаты", "error", err.Error())
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+		if wanted[commentID] {
+			links.Quotes[commentID] = append(links.Quotes[commentID], quotedID)
+		}
+		if wanted[quotedID] && public {
+			links.Replies[quotedID] = append(links.Replies[quotedID], commentID)
+		}
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Ошибка после итерации по цитатам", "error", err.Error())
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+	return links, nil
+}
+
+// FindInPost возвращает те из указанных ID, которые принадлежат комментариям поста
+func (r *CommentRepository) FindInPost(ctx context.Context, postID int64, ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT id FROM comments WHERE post_id = $1 AND id = ANY($2)`, postID, pq.Array(ids))
+	if err != nil {
+		slog.Error("Ошибка проверки комментариев поста", "post_id", postID, "error", err)
+		return nil, fmt.Errorf("ошибка проверки комментариев: %w", err)
+	}
+	defer rows.Close()
+
+	var found []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+		found = append(found, id)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+	return found, nil
+}
+
 // Create создает новый комментарий
 func (r *CommentRepository) Create(ctx context.Context, comment *models.Comment) (int64, error) {
 	// SQL запрос на вставку комментария
 	query := `INSERT INTO comments 
-        (post_id, user_id, user_name, avatar_url, content, image_url, created_at, reply_to_id) 
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8) 
+        (post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score) 
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) 
         RETURNING id`
 
 	slog.Info("Создание комментария",
@@ -182,59 +421,131 @@ func (r *CommentRepository) Create(ctx context.Context, comment *models.Comment)
 		replyToID = comment.ReplyToID
 	}
 
+	status := comment.Status
+	if status == "" {
+		status = models.ModerationVisible
+	}
+
+	// Комментарий, его цитаты и файлы сохраняются в одной транзакции
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err.Error())
+		return 0, fmt.Errorf("ошибка создания комментария: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Выполняем запрос
-	err := r.db.QueryRowContext(ctx, query,
+	err = tx.QueryRowContext(ctx, query,
 		comment.PostID,
 		comment.UserID,
 		comment.UserName,
 		comment.AvatarURL,
 		comment.Content,
 		comment.ImageURL,
+		comment.ImageWidth,
+		comment.ImageHeight,
+		comment.ThumbnailURL,
 		time.Now(),
 		replyToID,
+		status,
+		comment.SpamScore,
 	).Scan(&id)
 	if err != nil {
 		slog.Error("Ошибка при создании комментария", "error", err.Error())
 		return 0, fmt.Errorf("ошибка создания комментария: %w", err)
 	}
 
+	if len(comment.Quotes) > 0 {
+		_, err = tx.ExecContext(ctx, `INSERT INTO comment_quotes (comment_id, quoted_id)
+            SELECT $1, unnest($2::BIGINT[])
+            ON CONFLICT DO NOTHING`, id, pq.Array(comment.Quotes))
+		if err != nil {
+			slog.Error("Ошибка сохранения цитат комментария", "error", err.Error())
+			return 0, fmt.Errorf("ошибка сохранения цитат: %w", err)
+		}
+	}
+
+	if err := insertAttachments(ctx, tx, models.AttachmentComment, id, comment.Attachments); err != nil {
+		slog.Error("Ошибка сохранения файлов комментария", "error", err.Error())
+		return 0, fmt.Errorf("ошибка сохранения файлов: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err.Error())
+		return 0, fmt.Errorf("ошибка создания комментария: %w", err)
+	}
+
 	slog.Info("Комментарий успешно создан", "id", id, "post_id", comment.PostID)
 	return id, nil
 }
 
-// Delete удаляет комментарий по ID
-func (r *CommentRepository) Delete(ctx context.Context, id int64) error {
-	query := `DELETE FROM comments WHERE id = $1`
-
+// Delete удаляет комментарий по ID вместе с ветками ответов и возвращает
+// адреса изображений всех удаленных комментариев
+func (r *CommentRepository) Delete(ctx context.Context, id int64) ([]string, error) {
 	slog.Info("Удаление комментария", "id", id)
 
-	result, err := r.db.ExecContext(ctx, query, id)
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err.Error())
+		return nil, fmt.Errorf("ошибка удаления комментария: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Ответы удаляются каскадно, поэтому их изображения собираются до удаления
+	// Файлы ветки удаляются тем же запросом, первый файл освобождается по столбцам комментария.
+	// Постеры есть только в attachments и освобождаются для всех файлов
+	imageURLs, err := queryImageURLs(ctx, tx, `WITH RECURSIVE branch AS (
+            SELECT id, image_url, thumbnail_url FROM comments WHERE id = $1
+            UNION ALL
+            SELECT c.id, c.image_url, c.thumbnail_url FROM comments c JOIN branch b ON c.reply_to_id = b.id
+        ), removed AS (
+            DELETE FROM attachments 
+            WHERE owner_type = 'comment' AND owner_id IN (SELECT id FROM branch) 
+            RETURNING position, bucket, object_key, thumbnail_key, poster_key
+        )
+        SELECT url FROM branch, LATERAL (VALUES (image_url), (thumbnail_url)) AS images(url)
+        UNION ALL
+        SELECT url FROM removed, 
+            LATERAL (VALUES (CASE WHEN position > 0 THEN bucket || '/' || object_key END), 
+                (CASE WHEN position > 0 THEN bucket || '/' || NULLIF(thumbnail_key, '') END), 
+                (bucket || '/' || NULLIF(poster_key, ''))) AS images(url)`, id)
+	if err != nil {
+		slog.Error("Ошибка получения изображений комментария", "id", id, "error", err.Error())
+		return nil, fmt.Errorf("ошибка удаления комментария: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM comments WHERE id = $1`, id)
 	if err != nil {
 		slog.Error("Ошибка при удалении комментария", "id", id, "error", err.Error())
-		return fmt.Errorf("ошибка удаления комментария: %w", err)
+		return nil, fmt.Errorf("ошибка удаления комментария: %w", err)
 	}
 
 	rowsAffected, err := result.RowsAffected()
 	if err != nil {
 		slog.Error("Ошибка получения количества затронутых строк", "error", err.Error())
-		return fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+		return nil, fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
 	}
 
 	if rowsAffected == 0 {
 		slog.Warn("Комментарий не найден", "id", id)
-		return fmt.Errorf("комментарий с id %d не найден", id)
+		return nil, fmt.Errorf("комментарий с id %d не найден", id)
 	}
 
-	slog.Info("Комментарий успешно удален", "id", id)
-	return nil
+	if err := tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err.Error())
+		return nil, fmt.Errorf("ошибка удаления комментария: %w", err)
+	}
+
+	slog.Info("Комментарий успешно удален", "id", id, "images", len(imageURLs))
+	return imageURLs, nil
 }
 
 // GetLastCommentByPostID возвращает последний комментарий к посту
 func (r *CommentRepository) GetLastCommentByPostID(ctx context.Context, postID int64) (*models.Comment, error) {
 	query := `SELECT 
-        id, post_id, user_id, user_name, avatar_url, content, image_url, created_at, reply_to_id
+        id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score
         FROM comments 
-        WHERE post_id = $1 
+        WHERE post_id = $1 AND moderation_status IN ('visible', 'flagged') 
         ORDER BY created_at DESC 
         LIMIT 1`
 
@@ -250,8 +561,13 @@ func (r *CommentRepository) GetLastCommentByPostID(ctx context.Context, postID i
 		&avatarURL,
 		&comment.Content,
 		&imageURL,
+		&comment.ImageWidth,
+		&comment.ImageHeight,
+		&comment.ThumbnailURL,
 		&comment.CreatedAt,
 		&replyToID,
+		&comment.Status,
+		&comment.SpamScore,
 	)
 
 	if err != nil {
@@ -276,3 +592,84 @@ func (r *CommentRepository) GetLastCommentByPostID(ctx context.Context, postID i
 
 	return &comment, nil
 }
+
+// GetByStatus возвращает комментарии с указанными статусами модерации, новые первыми
+func (r *CommentRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Comment, error) {
+	query := `SELECT 
+        id, post_id, user_id, user_name, avatar_url, content, image_url, image_width, image_height, thumbnail_url, created_at, reply_to_id, moderation_status, spam_score
+        FROM comments 
+        WHERE moderation_status = ANY($1) 
+        ORDER BY created_at DESC 
+        LIMIT $2`
+
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(names), limit)
+	if err != nil {
+		slog.Error("Ошибка запроса комментариев по статусу", "statuses", names, "error", err)
+		return nil, fmt.Errorf("ошибка запроса комментариев: %w", err)
+	}
+	defer rows.Close()
+
+	var comments []*models.Comment
+	for rows.Next() {
+		var comment models.Comment
+		var avatarURL, imageURL sql.NullString
+		var replyToID sql.NullInt64
+
+		err := rows.Scan(
+			&comment.ID,
+			&comment.PostID,
+			&comment.UserID,
+			&comment.UserName,
+			&avatarURL,
+			&comment.Content,
+			&imageURL,
+			&comment.ImageWidth,
+			&comment.ImageHeight,
+			&comment.ThumbnailURL,
+			&comment.CreatedAt,
+			&replyToID,
+			&comment.Status,
+			&comment.SpamScore,
+		)
+		if err != nil {
+			slog.Error("Ошибка сканирования строки комментария", "error", err.Error())
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+
+		comment.AvatarURL = avatarURL.String
+		comment.ImageURL = imageURL.String
+		comment.ReplyToID = replyToID.Int64
+		comments = append(comments, &comment)
+	}
+
+	if err = rows.Err(); err != nil {
+		slog.Error("Ошибка после итерации по комментариям", "error", err.Error())
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+	return comments, nil
+}
+
+// SetStatus меняет статус модерации комментария
+func (r *CommentRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE comments SET moderation_status = $2 WHERE id = $1`, id, status)
+	if err != nil {
+		slog.Error("Ошибка изменения статуса комментария", "id", id, "error", err.Error())
+		return fmt.Errorf("ошибка изменения статуса комментария: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("ошибка получения количества затронутых строк: %w", err)
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("комментарий с id %d не найден", id)
+	}
+
+	slog.Info("Статус комментария изменен", "id", id, "status", status)
+	return nil
+}
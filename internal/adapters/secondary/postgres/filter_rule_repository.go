@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// FilterRuleRepository реализует интерфейс репозитория правил фильтра для PostgreSQL
+type FilterRuleRepository struct {
+	db *sql.DB
+}
+
+// NewFilterRuleRepository создает новый экземпляр репозитория правил фильтра
+func NewFilterRuleRepository(db *sql.DB) *FilterRuleRepository {
+	return &FilterRuleRepository{
+		db: db,
+	}
+}
+
+// GetAll возвращает все правила, включая отключенные
+func (r *FilterRuleRepository) GetAll(ctx context.Context) ([]*models.FilterRule, error) {
+	query := `SELECT 
+        id, pattern, action, replacement, note, enabled, created_at, updated_at
+        FROM content_filter_rules 
+        ORDER BY id`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Error("Ошибка запроса правил фильтра", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var rules []*models.FilterRule
+	for rows.Next() {
+		var rule models.FilterRule
+		err := rows.Scan(
+			&rule.ID, &rule.Pattern, &rule.Action, &rule.Replacement,
+			&rule.Note, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt)
+		if err != nil {
+			slog.Error("Ошибка сканирования правила фильтра", "error", err)
+			return nil, err
+		}
+		rules = append(rules, &rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк из БД", "error", err)
+		return nil, err
+	}
+	return rules, nil
+}
+
+// GetByID возвращает правило по его ID
+func (r *FilterRuleRepository) GetByID(ctx context.Context, id int64) (*models.FilterRule, error) {
+	query := `SELECT 
+        id, pattern, action, replacement, note, enabled, created_at, updated_at
+        FROM content_filter_rules 
+        WHERE id = $1`
+
+	var rule models.FilterRule
+	err := r.db.QueryRowContext(ctx, query, id).Scan(
+		&rule.ID, &rule.Pattern, &rule.Action, &rule.Replacement,
+		&rule.Note, &rule.Enabled, &rule.CreatedAt, &rule.UpdatedAt)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("правило с id %d не найдено", id)
+		}
+		slog.Error("Ошибка получения правила фильтра", "id", id, "error", err)
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// Create создает новое правило
+func (r *FilterRuleRepository) Create(ctx context.Context, rule *models.FilterRule) (int64, error) {
+	query := `INSERT INTO content_filter_rules 
+        (pattern, action, replacement, note, enabled, created_at, updated_at) 
+        VALUES ($1, $2, $3, $4, $5, $6, $6) 
+        RETURNING id`
+
+	now := time.Now()
+	var id int64
+	err := r.db.QueryRowContext(ctx, query,
+		rule.Pattern, rule.Action, rule.Replacement, rule.Note, rule.Enabled, now).Scan(&id)
+	if err != nil {
+		slog.Error("Ошибка создания правила фильтра", "error", err)
+		return 0, err
+	}
+
+	rule.CreatedAt = now
+	rule.UpdatedAt = now
+	slog.Info("Правило фильтра создано", "id", id, "action", rule.Action)
+	return id, nil
+}
+
+// Update обновляет правило
+func (r *FilterRuleRepository) Update(ctx context.Context, rule *models.FilterRule) error {
+	query := `UPDATE content_filter_rules 
+        SET pattern = $2, action = $3, replacement = $4, note = $5, enabled = $6, updated_at = $7 
+        WHERE id = $1`
+
+	now := time.Now()
+	result, err := r.db.ExecContext(ctx, query,
+		rule.ID, rule.Pattern, rule.Action, rule.Replacement, rule.Note, rule.Enabled, now)
+	if err != nil {
+		slog.Error("Ошибка обновления правила фильтра", "id", rule.ID, "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("правило с id %d не найдено", rule.ID)
+	}
+
+	rule.UpdatedAt = now
+	slog.Info("Правило фильтра обновлено", "id", rule.ID)
+	return nil
+}
+
+// Delete удаляет правило по ID
+func (r *FilterRuleRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM content_filter_rules WHERE id = $1`, id)
+	if err != nil {
+		slog.Error("Ошибка удаления правила фильтра", "id", id, "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("правило с id %d не найдено", id)
+	}
+
+	slog.Info("Правило фильтра удалено", "id", id)
+	return nil
+}
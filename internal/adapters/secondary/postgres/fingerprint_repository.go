@@ -0,0 +1,84 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// FingerprintRepository реализует интерфейс репозитория отпечатков для PostgreSQL
+type FingerprintRepository struct {
+	db *sql.DB
+}
+
+// NewFingerprintRepository создает новый экземпляр репозитория отпечатков
+func NewFingerprintRepository(db *sql.DB) *FingerprintRepository {
+	return &FingerprintRepository{
+		db: db,
+	}
+}
+
+// Recent возвращает последние limit отпечатков, новые первыми
+func (r *FingerprintRepository) Recent(ctx context.Context, limit int) ([]*models.ContentFingerprint, error) {
+	query := `SELECT 
+        kind, ref_id, user_id, normalized, image_hash, created_at 
+        FROM content_fingerprints 
+        ORDER BY id DESC 
+        LIMIT $1`
+
+	rows, err := r.db.QueryContext(ctx, query, limit)
+	if err != nil {
+		slog.Error("Ошибка запроса отпечатков", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var fingerprints []*models.ContentFingerprint
+	for rows.Next() {
+		var fp models.ContentFingerprint
+		if err := rows.Scan(&fp.Kind, &fp.RefID, &fp.UserID, &fp.Text, &fp.ImageHash, &fp.CreatedAt); err != nil {
+			slog.Error("Ошибка сканирования отпечатка", "error", err)
+			return nil, err
+		}
+		fingerprints = append(fingerprints, &fp)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк из БД", "error", err)
+		return nil, err
+	}
+	return fingerprints, nil
+}
+
+// Save сохраняет отпечаток
+func (r *FingerprintRepository) Save(ctx context.Context, fp *models.ContentFingerprint) error {
+	query := `INSERT INTO content_fingerprints 
+        (kind, ref_id, user_id, normalized, image_hash, created_at) 
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	_, err := r.db.ExecContext(ctx, query, fp.Kind, fp.RefID, fp.UserID, fp.Text, fp.ImageHash, fp.CreatedAt)
+	if err != nil {
+		slog.Error("Ошибка сохранения отпечатка", "kind", fp.Kind, "ref_id", fp.RefID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Trim удаляет все отпечатки, кроме последних keep
+func (r *FingerprintRepository) Trim(ctx context.Context, keep int) error {
+	query := `DELETE FROM content_fingerprints 
+        WHERE id <= (SELECT id FROM content_fingerprints ORDER BY id DESC OFFSET $1 LIMIT 1)`
+
+	result, err := r.db.ExecContext(ctx, query, keep)
+	if err != nil {
+		slog.Error("Ошибка удаления старых отпечатков", "error", err)
+		return err
+	}
+
+	if deleted, err := result.RowsAffected(); err == nil && deleted > 0 {
+		slog.Info("Удалены старые отпечатки", "count", deleted)
+	}
+	return nil
+}
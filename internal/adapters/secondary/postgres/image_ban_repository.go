@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ImageBanRepository реализует интерфейс репозитория запрещенных изображений для PostgreSQL
+type ImageBanRepository struct {
+	db *sql.DB
+}
+
+// NewImageBanRepository создает новый экземпляр репозитория запрещенных изображений
+func NewImageBanRepository(db *sql.DB) *ImageBanRepository {
+	return &ImageBanRepository{
+		db: db,
+	}
+}
+
+// GetAll возвращает все запреты, новые первыми
+func (r *ImageBanRepository) GetAll(ctx context.Context) ([]*models.ImageBan, error) {
+	query := `SELECT id, hash, threshold, reason, created_at 
+        FROM banned_image_hashes 
+        ORDER BY id DESC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		slog.Error("Ошибка запроса запрещенных изображений", "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var bans []*models.ImageBan
+	for rows.Next() {
+		var ban models.ImageBan
+		var hash int64
+		if err := rows.Scan(&ban.ID, &hash, &ban.Threshold, &ban.Reason, &ban.CreatedAt); err != nil {
+			slog.Error("Ошибка сканирования запрета", "error", err)
+			return nil, err
+		}
+		ban.Hash = models.PerceptualHash(hash)
+		bans = append(bans, &ban)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк из БД", "error", err)
+		return nil, err
+	}
+	return bans, nil
+}
+
+// Create сохраняет запрет и возвращает его ID
+func (r *ImageBanRepository) Create(ctx context.Context, ban *models.ImageBan) (int64, error) {
+	query := `INSERT INTO banned_image_hashes (hash, threshold, reason, created_at) 
+        VALUES ($1, $2, $3, $4) 
+        RETURNING id`
+
+	var id int64
+	err := r.db.QueryRowContext(ctx, query, int64(ban.Hash), ban.Threshold, ban.Reason, ban.CreatedAt).Scan(&id)
+	if err != nil {
+		slog.Error("Ошибка сохранения запрета изображения", "hash", ban.Hash, "error", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// Delete снимает запрет
+func (r *ImageBanRepository) Delete(ctx context.Context, id int64) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM banned_image_hashes WHERE id = $1`, id)
+	if err != nil {
+		slog.Error("Ошибка удаления запрета изображения", "id", id, "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("запрет с id %d не найден", id)
+	}
+	return nil
+}
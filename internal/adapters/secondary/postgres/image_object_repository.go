@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ImageObjectRepository реализует интерфейс учета ссылок на изображения для PostgreSQL
+type ImageObjectRepository struct {
+	db *sql.DB
+}
+
+// NewImageObjectRepository создает новый экземпляр репозитория объектов изображений
+func NewImageObjectRepository(db *sql.DB) *ImageObjectRepository {
+	return &ImageObjectRepository{
+		db: db,
+	}
+}
+
+// Acquire добавляет ссылку на объект. Возвращает true, если объект еще не загружен
+func (r *ImageObjectRepository) Acquire(ctx context.Context, object *models.ImageObject) (bool, error) {
+	query := `INSERT INTO image_objects (bucket, object_key, ref_count, size_bytes, perceptual_hash) 
+        VALUES ($1, $2, 1, $3, $4) 
+        ON CONFLICT (bucket, object_key) DO UPDATE 
+        SET ref_count = image_objects.ref_count + 1, acquired_at = CURRENT_TIMESTAMP 
+        RETURNING NOT uploaded`
+
+	var hash sql.NullInt64
+	if object.PerceptualHash != nil {
+		// BIGINT знаковый, биты хэша сохраняются без изменений
+		hash = sql.NullInt64{Int64: int64(*object.PerceptualHash), Valid: true}
+	}
+
+	var pending bool
+	err := r.db.QueryRowContext(ctx, query, object.Bucket, object.Key, object.Size, hash).Scan(&pending)
+	if err != nil {
+		slog.Error("Ошибка учета ссылки на изображение", "bucket", object.Bucket, "key", object.Key, "error", err)
+		return false, err
+	}
+	return pending, nil
+}
+
+// MarkUploaded отмечает, что объект записан в хранилище
+func (r *ImageObjectRepository) MarkUploaded(ctx context.Context, bucket, objectKey string) error {
+	query := `UPDATE image_objects SET uploaded = TRUE WHERE bucket = $1 AND object_key = $2`
+
+	if _, err := r.db.ExecContext(ctx, query, bucket, objectKey); err != nil {
+		slog.Error("Ошибка отметки загрузки изображения", "bucket", bucket, "key", objectKey, "error", err)
+		return err
+	}
+	return nil
+}
+
+// Get возвращает учтенный объект или nil, если объекта нет
+func (r *ImageObjectRepository) Get(ctx context.Context, bucket, objectKey string) (*models.ImageObject, error) {
+	query := `SELECT bucket, object_key, ref_count, size_bytes, perceptual_hash, created_at, uploaded 
+        FROM image_objects 
+        WHERE bucket = $1 AND object_key = $2`
+
+	var object models.ImageObject
+	var hash sql.NullInt64
+	err := r.db.QueryRowContext(ctx, query, bucket, objectKey).Scan(
+		&object.Bucket, &object.Key, &object.RefCount, &object.Size, &hash, &object.CreatedAt, &object.Uploaded)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("Ошибка получения объекта изображения", "bucket", bucket, "key", objectKey, "error", err)
+		return nil, err
+	}
+	if hash.Valid {
+		perceptual := models.PerceptualHash(hash.Int64)
+		object.PerceptualHash = &perceptual
+	}
+	return &object, nil
+}
+
+// Release убирает ссылку на объект и удаляет запись, когда ссылок не осталось.
+// Запись удаляется отдельным запросом с повторной проверкой счетчика, поэтому
+// ссылка, добавленная между запросами, сохраняет объект
+func (r *ImageObjectRepository) Release(ctx context.Context, bucket, objectKey string) (bool, error) {
+	query := `UPDATE image_objects SET ref_count = ref_count - 1 
+        WHERE bucket = $1 AND object_key = $2 
+        RETURNING ref_count`
+
+	var refCount int
+	err := r.db.QueryRowContext(ctx, query, bucket, objectKey).Scan(&refCount)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		slog.Error("Ошибка освобождения ссылки на изображение", "bucket", bucket, "key", objectKey, "error", err)
+		return false, err
+	}
+	if refCount > 0 {
+		return false, nil
+	}
+
+	result, err := r.db.ExecContext(ctx, `DELETE FROM image_objects 
+        WHERE bucket = $1 AND object_key = $2 AND ref_count <= 0`, bucket, objectKey)
+	if err != nil {
+		slog.Error("Ошибка удаления записи изображения", "bucket", bucket, "key", objectKey, "error", err)
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return deleted > 0, nil
+}
+
+// ReferencedURLs возвращает адреса оригиналов и миниатюр всех постов, комментариев и их файлов.
+// Файлы галерей возвращаются путями bucket/key
+func (r *ImageObjectRepository) ReferencedURLs(ctx context.Context) ([]string, error) {
+	urls, err := queryImageURLs(ctx, r.db, `SELECT DISTINCT url FROM (
+            SELECT url FROM posts, 
+                LATERAL (VALUES (image_url), (thumbnail_url), (catalog_thumbnail_url)) AS images(url)
+            UNION ALL
+            SELECT url FROM comments, 
+                LATERAL (VALUES (image_url), (thumbnail_url)) AS images(url)
+            UNION ALL
+            SELECT url FROM attachments, 
+                LATERAL (VALUES (bucket || '/' || object_key), (bucket || '/' || NULLIF(thumbnail_key, '')), 
+                    (bucket || '/' || NULLIF(poster_key, ''))) AS images(url)
+        ) AS referenced`)
+	if err != nil {
+		slog.Error("Ошибка получения адресов изображений", "error", err)
+		return nil, err
+	}
+	return urls, nil
+}
+
+// Forget удаляет запись объекта, ссылка на который добавлена до before. Удаление и проверка
+// выполняются одним запросом, поэтому обе части видят одно состояние таблицы
+func (r *ImageObjectRepository) Forget(ctx context.Context, bucket, objectKey string, before time.Time) (bool, error) {
+	query := `WITH deleted AS (
+            DELETE FROM image_objects 
+            WHERE bucket = $1 AND object_key = $2 AND acquired_at < $3
+        )
+        SELECT NOT EXISTS (
+            SELECT 1 FROM image_objects 
+            WHERE bucket = $1 AND object_key = $2 AND acquired_at >= $3
+        )`
+
+	var forgotten bool
+	if err := r.db.QueryRowContext(ctx, query, bucket, objectKey, before).Scan(&forgotten); err != nil {
+		slog.Error("Ошибка удаления учета изображения", "bucket", bucket, "key", objectKey, "error", err)
+		return false, err
+	}
+	return forgotten, nil
+}
+
+// queryer выполняет запросы в транзакции или вне ее
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// queryImageURLs выполняет запрос, возвращающий один столбец с адресами изображений,
+// и отбрасывает пустые адреса
+func queryImageURLs(ctx context.Context, q queryer, query string, args ...any) ([]string, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var urls []string
+	for rows.Next() {
+		var url sql.NullString
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		if url.String != "" {
+			urls = append(urls, url.String)
+		}
+	}
+	return urls, rows.Err()
+}
@@ -0,0 +1,322 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+)
+
+// migrationLock ключ рекомендательной блокировки: экземпляры приложения,
+// запущенные одновременно, применяют миграции по очереди
+const migrationLock = 1337004
+
+// migration шаг схемы для базы, созданной раньше текущего init.sql.
+// init.sql выполняется только на пустой базе, поэтому новые таблицы, столбцы
+// и перенос данных попадают в существующие базы только через миграции.
+// Шаги пишутся так, чтобы на базе из текущего init.sql они ничего не меняли
+type migration struct {
+	version int
+	name    string
+	query   string
+}
+
+// migrations шаги схемы по возрастанию версии. Примененный шаг не меняется,
+// изменения схемы добавляются новым шагом в конец списка
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "rate_limit_buckets",
+		query: `CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+			key VARCHAR(255) PRIMARY KEY,
+			tokens DOUBLE PRECISION NOT NULL,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	{
+		version: 2,
+		name:    "captcha_replays",
+		query: `CREATE TABLE IF NOT EXISTS captcha_replays (
+			id VARCHAR(64) PRIMARY KEY,
+			expires_at TIMESTAMP NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_captcha_replays_expires_at ON captcha_replays (expires_at)`,
+	},
+	{
+		version: 3,
+		name:    "content_filter",
+		query: `ALTER TABLE posts ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(20) NOT NULL DEFAULT 'visible';
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS moderation_status VARCHAR(20) NOT NULL DEFAULT 'visible';
+		CREATE TABLE IF NOT EXISTS content_filter_rules (
+			id BIGSERIAL PRIMARY KEY,
+			pattern TEXT NOT NULL,
+			action VARCHAR(20) NOT NULL,
+			replacement TEXT NOT NULL DEFAULT '',
+			note VARCHAR(255) NOT NULL DEFAULT '',
+			enabled BOOLEAN NOT NULL DEFAULT true,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	{
+		version: 4,
+		name:    "spam_scoring",
+		query: `ALTER TABLE posts ADD COLUMN IF NOT EXISTS spam_score REAL NOT NULL DEFAULT 0;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS spam_score REAL NOT NULL DEFAULT 0;
+		CREATE TABLE IF NOT EXISTS content_fingerprints (
+			id BIGSERIAL PRIMARY KEY,
+			kind VARCHAR(10) NOT NULL,
+			ref_id BIGINT NOT NULL,
+			user_id BIGINT NOT NULL,
+			normalized TEXT NOT NULL,
+			image_hash VARCHAR(64) NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	{
+		version: 5,
+		name:    "comment_quotes",
+		query: `CREATE TABLE IF NOT EXISTS comment_quotes (
+			comment_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+			quoted_id BIGINT NOT NULL REFERENCES comments (id) ON DELETE CASCADE,
+			PRIMARY KEY (comment_id, quoted_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_comment_quotes_quoted_id ON comment_quotes (quoted_id);
+		INSERT INTO comment_quotes (comment_id, quoted_id)
+		SELECT c.id, c.reply_to_id FROM comments c
+		JOIN comments quoted ON quoted.id = c.reply_to_id AND quoted.post_id = c.post_id
+		ON CONFLICT DO NOTHING`,
+	},
+	{
+		version: 6,
+		name:    "comment_tree",
+		query:   `CREATE INDEX IF NOT EXISTS idx_comments_reply_to_id ON comments (reply_to_id)`,
+	},
+	{
+		version: 7,
+		name:    "comments_cursor_index",
+		query:   `CREATE INDEX IF NOT EXISTS idx_comments_post_created ON comments (post_id, created_at, id)`,
+	},
+	{
+		version: 8,
+		name:    "sticky_locked_threads",
+		query: `ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_sticky BOOLEAN NOT NULL DEFAULT false;
+		ALTER TABLE posts ADD COLUMN IF NOT EXISTS is_locked BOOLEAN NOT NULL DEFAULT false`,
+	},
+	{
+		version: 9,
+		name:    "polls",
+		query: `CREATE TABLE IF NOT EXISTS polls (
+			id BIGSERIAL PRIMARY KEY,
+			post_id BIGINT NOT NULL UNIQUE REFERENCES posts (id) ON DELETE CASCADE,
+			multiple BOOLEAN NOT NULL DEFAULT false,
+			closes_at TIMESTAMP,
+			closed BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		);
+		CREATE TABLE IF NOT EXISTS poll_options (
+			id BIGSERIAL PRIMARY KEY,
+			poll_id BIGINT NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+			position INT NOT NULL,
+			text VARCHAR(255) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_poll_options_poll_id ON poll_options (poll_id, position);
+		CREATE TABLE IF NOT EXISTS poll_votes (
+			poll_id BIGINT NOT NULL REFERENCES polls (id) ON DELETE CASCADE,
+			user_id BIGINT NOT NULL,
+			option_id BIGINT NOT NULL REFERENCES poll_options (id) ON DELETE CASCADE,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (poll_id, user_id, option_id)
+		);
+		CREATE INDEX IF NOT EXISTS idx_poll_votes_option_id ON poll_votes (option_id)`,
+	},
+	{
+		version: 10,
+		name:    "thumbnails",
+		query: `ALTER TABLE posts ADD COLUMN IF NOT EXISTS image_width INT NOT NULL DEFAULT 0;
+		ALTER TABLE posts ADD COLUMN IF NOT EXISTS image_height INT NOT NULL DEFAULT 0;
+		ALTER TABLE posts ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE posts ADD COLUMN IF NOT EXISTS catalog_thumbnail_url VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS image_width INT NOT NULL DEFAULT 0;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS image_height INT NOT NULL DEFAULT 0;
+		ALTER TABLE comments ADD COLUMN IF NOT EXISTS thumbnail_url VARCHAR(255) NOT NULL DEFAULT ''`,
+	},
+	{
+		version: 11,
+		name:    "image_objects",
+		query: `CREATE TABLE IF NOT EXISTS image_objects (
+			bucket VARCHAR(63) NOT NULL,
+			object_key VARCHAR(255) NOT NULL,
+			ref_count INT NOT NULL DEFAULT 1,
+			size_bytes BIGINT NOT NULL DEFAULT 0,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			uploaded BOOLEAN NOT NULL DEFAULT FALSE,
+			PRIMARY KEY (bucket, object_key)
+		);
+		-- Объекты, учтенные до появления столбца, уже записаны в хранилище
+		ALTER TABLE image_objects ADD COLUMN IF NOT EXISTS uploaded BOOLEAN NOT NULL DEFAULT TRUE;
+		ALTER TABLE image_objects ALTER COLUMN uploaded SET DEFAULT FALSE;
+		-- Объекты, на которые уже ссылаются посты и комментарии, получают счетчик
+		-- по числу ссылок, иначе сборщик удалит их как неучтенные. Учтенные объекты не меняются
+		INSERT INTO image_objects (bucket, object_key, ref_count, uploaded)
+		SELECT parts[1], parts[2], COUNT(*), TRUE
+		FROM (
+			SELECT image_url AS url FROM posts
+			UNION ALL SELECT thumbnail_url FROM posts
+			UNION ALL SELECT catalog_thumbnail_url FROM posts
+			UNION ALL SELECT image_url FROM comments
+			UNION ALL SELECT thumbnail_url FROM comments
+		) AS refs
+		CROSS JOIN LATERAL regexp_match(refs.url, '^(?:https?://(?:localhost|s3):9000/)?(posts|comments)/([^/?#]+)$') AS m(parts)
+		WHERE parts IS NOT NULL
+		GROUP BY parts[1], parts[2]
+		ON CONFLICT (bucket, object_key) DO NOTHING`,
+	},
+	{
+		version: 12,
+		name:    "image_bans",
+		query: `ALTER TABLE image_objects ADD COLUMN IF NOT EXISTS perceptual_hash BIGINT;
+		CREATE TABLE IF NOT EXISTS banned_image_hashes (
+			id BIGSERIAL PRIMARY KEY,
+			hash BIGINT NOT NULL,
+			threshold INT NOT NULL DEFAULT 8,
+			reason VARCHAR(255) NOT NULL DEFAULT '',
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`,
+	},
+	{
+		version: 13,
+		name:    "image_gc",
+		query:   `ALTER TABLE image_objects ADD COLUMN IF NOT EXISTS acquired_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP`,
+	},
+	{
+		version: 14,
+		name:    "attachments",
+		query: `CREATE TABLE IF NOT EXISTS attachments (
+			id BIGSERIAL PRIMARY KEY,
+			owner_type VARCHAR(10) NOT NULL CHECK (owner_type IN ('post', 'comment')),
+			owner_id BIGINT NOT NULL,
+			position INT NOT NULL DEFAULT 0,
+			bucket VARCHAR(63) NOT NULL,
+			object_key VARCHAR(255) NOT NULL,
+			mime_type VARCHAR(100) NOT NULL DEFAULT '',
+			size_bytes BIGINT NOT NULL DEFAULT 0,
+			width INT NOT NULL DEFAULT 0,
+			height INT NOT NULL DEFAULT 0,
+			thumbnail_key VARCHAR(255) NOT NULL DEFAULT '',
+			original_filename VARCHAR(255) NOT NULL DEFAULT '',
+			is_spoiler BOOLEAN NOT NULL DEFAULT false,
+			created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+			UNIQUE (owner_type, owner_id, position)
+		);
+		-- Перенос одиночных изображений из image_url. Переносятся только объекты
+		-- собственного хранилища, адреса сторонних сайтов остаются в image_url.
+		-- Повторный запуск не создает дубликатов
+		INSERT INTO attachments (owner_type, owner_id, position, bucket, object_key, mime_type, size_bytes, width, height, thumbnail_key, created_at)
+		SELECT owner.owner_type, owner.owner_id, 0, parts[1], parts[2],
+			CASE lower(substring(parts[2] FROM '\.([A-Za-z0-9]+)$'))
+				WHEN 'jpg' THEN 'image/jpeg'
+				WHEN 'jpeg' THEN 'image/jpeg'
+				WHEN 'png' THEN 'image/png'
+				WHEN 'gif' THEN 'image/gif'
+				WHEN 'webp' THEN 'image/webp'
+				WHEN 'svg' THEN 'image/svg+xml'
+				WHEN 'webm' THEN 'video/webm'
+				WHEN 'mp4' THEN 'video/mp4'
+				ELSE ''
+			END,
+			COALESCE(o.size_bytes, 0), owner.image_width, owner.image_height,
+			COALESCE(substring(owner.thumbnail_url FROM '^(?:https?://[^/]+/)?[^/]+/([^/?#]+)$'), ''),
+			owner.created_at
+		FROM (
+			SELECT 'post' AS owner_type, id AS owner_id, image_url, image_width, image_height, thumbnail_url, created_at FROM posts
+			UNION ALL
+			SELECT 'comment', id, image_url, image_width, image_height, thumbnail_url, created_at FROM comments
+		) AS owner
+		CROSS JOIN LATERAL regexp_match(owner.image_url, '^(?:https?://(?:localhost|s3):9000/)?(posts|comments)/([^/?#]+)$') AS m(parts)
+		LEFT JOIN image_objects o ON o.bucket = parts[1] AND o.object_key = parts[2]
+		WHERE parts IS NOT NULL
+		ON CONFLICT (owner_type, owner_id, position) DO NOTHING`,
+	},
+	{
+		version: 15,
+		name:    "video_attachments",
+		query: `ALTER TABLE attachments ADD COLUMN IF NOT EXISTS duration_ms BIGINT NOT NULL DEFAULT 0;
+		ALTER TABLE attachments ADD COLUMN IF NOT EXISTS poster_key VARCHAR(255) NOT NULL DEFAULT ''`,
+	},
+	// Адреса файлов собственного хранилища хранятся как bucket/key, адрес для браузера
+	// строится приложением. Абсолютные адреса старых записей переписываются,
+	// адреса сторонних сайтов не меняются
+	{
+		version: 16,
+		name:    "object_paths",
+		query: `UPDATE posts SET
+			image_url = regexp_replace(image_url, '^https?://(?:localhost|s3):9000/', ''),
+			thumbnail_url = regexp_replace(thumbnail_url, '^https?://(?:localhost|s3):9000/', ''),
+			catalog_thumbnail_url = regexp_replace(catalog_thumbnail_url, '^https?://(?:localhost|s3):9000/', '')
+		WHERE image_url ~ '^https?://(?:localhost|s3):9000/'
+			OR thumbnail_url ~ '^https?://(?:localhost|s3):9000/'
+			OR catalog_thumbnail_url ~ '^https?://(?:localhost|s3):9000/';
+		UPDATE comments SET
+			image_url = regexp_replace(image_url, '^https?://(?:localhost|s3):9000/', ''),
+			thumbnail_url = regexp_replace(thumbnail_url, '^https?://(?:localhost|s3):9000/', '')
+		WHERE image_url ~ '^https?://(?:localhost|s3):9000/'
+			OR thumbnail_url ~ '^https?://(?:localhost|s3):9000/'`,
+	},
+}
+
+// Migrate применяет шаги схемы, которых еще нет в schema_migrations.
+// Каждый шаг выполняется в своей транзакции вместе с записью его версии
+func Migrate(ctx context.Context, db *sql.DB) error {
+	query := `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INT PRIMARY KEY,
+		name VARCHAR(255) NOT NULL,
+		applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`
+	if _, err := db.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("ошибка создания таблицы миграций: %w", err)
+	}
+
+	for _, m := range migrations {
+		if err := applyMigration(ctx, db, m); err != nil {
+			return fmt.Errorf("ошибка миграции %d (%s): %w", m.version, m.name, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration применяет шаг m, если он еще не применен
+func applyMigration(ctx context.Context, db *sql.DB, m migration) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err = tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+
+	var applied bool
+	query := `SELECT EXISTS (SELECT 1 FROM schema_migrations WHERE version = $1)`
+	if err = tx.QueryRowContext(ctx, query, m.version).Scan(&applied); err != nil {
+		return err
+	}
+	if applied {
+		return nil
+	}
+
+	if _, err = tx.ExecContext(ctx, m.query); err != nil {
+		return err
+	}
+	query = `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`
+	if _, err = tx.ExecContext(ctx, query, m.version, m.name); err != nil {
+		return err
+	}
+	if err = tx.Commit(); err != nil {
+		return err
+	}
+
+	slog.Info("Применена миграция схемы", "version", m.version, "name", m.name)
+	return nil
+}
@@ -0,0 +1,247 @@
+package postgres_test
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/postgres"
+)
+
+// legacySchema схема базы до миграций: таблицы первой версии init.sql
+const legacySchema = `
+CREATE TABLE posts (
+    id BIGSERIAL PRIMARY KEY,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    image_url VARCHAR(255),
+    user_id BIGINT NOT NULL,
+    user_name VARCHAR(255) NOT NULL,
+    avatar_url VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    is_archived BOOLEAN NOT NULL DEFAULT false
+);
+CREATE TABLE comments (
+    id BIGSERIAL PRIMARY KEY,
+    post_id BIGINT NOT NULL REFERENCES posts (id) ON DELETE CASCADE,
+    user_id BIGINT NOT NULL,
+    user_name VARCHAR(255) NOT NULL,
+    avatar_url VARCHAR(255),
+    content TEXT NOT NULL,
+    image_url VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    reply_to_id BIGINT REFERENCES comments (id) ON DELETE CASCADE
+);`
+
+// legacyDB создает в тестовой базе отдельную схему со старыми таблицами.
+// Тест пропускается без TEST_POSTGRES_DSN, например
+// TEST_POSTGRES_DSN="host=localhost port=5433 user=elite_user password=elite_pass dbname=eliteboard_db sslmode=disable"
+func legacyDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN не задан, тест миграций пропущен")
+	}
+
+	admin, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatalf("Ошибка подключения к тестовой базе: %v", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+
+	schema := fmt.Sprintf("migrations_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec("CREATE SCHEMA " + schema); err != nil {
+		t.Fatalf("Ошибка создания схемы: %v", err)
+	}
+	t.Cleanup(func() { admin.Exec("DROP SCHEMA " + schema + " CASCADE") })
+
+	db, err := sql.Open("postgres", dsn+" search_path="+schema)
+	if err != nil {
+		t.Fatalf("Ошибка подключения к схеме: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	if _, err := db.Exec(legacySchema); err != nil {
+		t.Fatalf("Ошибка создания старых таблиц: %v", err)
+	}
+	return db
+}
+
+// TestMigrateLegacySchema проверяет, что миграции доводят старую базу до текущей
+// схемы и повторный запуск ничего не меняет
+func TestMigrateLegacySchema(t *testing.T) {
+	db := legacyDB(t)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if err := postgres.Migrate(ctx, db); err != nil {
+			t.Fatalf("Ошибка миграции (запуск %d): %v", i+1, err)
+		}
+	}
+
+	var applied int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&applied); err != nil || applied == 0 {
+		t.Fatalf("Миграции не записаны: %d %v", applied, err)
+	}
+
+	// Таблицы и столбцы, которых нет в старой схеме
+	columns := [][2]string{
+		{"rate_limit_buckets", "tokens"},
+		{"captcha_replays", "expires_at"},
+		{"posts", "moderation_status"},
+		{"comments", "moderation_status"},
+		{"content_filter_rules", "pattern"},
+		{"posts", "spam_score"},
+		{"comments", "spam_score"},
+		{"content_fingerprints", "normalized"},
+		{"comment_quotes", "quoted_id"},
+		{"posts", "is_sticky"},
+		{"posts", "is_locked"},
+		{"polls", "closes_at"},
+		{"poll_options", "text"},
+		{"poll_votes", "option_id"},
+		{"posts", "image_width"},
+		{"posts", "image_height"},
+		{"posts", "thumbnail_url"},
+		{"posts", "catalog_thumbnail_url"},
+		{"comments", "image_width"},
+		{"comments", "image_height"},
+		{"comments", "thumbnail_url"},
+		{"image_objects", "ref_count"},
+		{"image_objects", "uploaded"},
+		{"image_objects", "perceptual_hash"},
+		{"banned_image_hashes", "hash"},
+		{"image_objects", "acquired_at"},
+		{"attachments", "thumbnail_key"},
+		{"attachments", "duration_ms"},
+		{"attachments", "poster_key"},
+	}
+	for _, column := range columns {
+		var exists bool
+		query := `SELECT EXISTS (SELECT 1 FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2)`
+		if err := db.QueryRow(query, column[0], column[1]).Scan(&exists); err != nil || !exists {
+			t.Errorf("Нет столбца %s.%s: %v", column[0], column[1], err)
+		}
+	}
+}
+
+// TestMigrateBackfillsImageObjects проверяет учет ссылок старых записей на объекты хранилища
+func TestMigrateBackfillsImageObjects(t *testing.T) {
+	db := legacyDB(t)
+
+	_, err := db.Exec(`INSERT INTO posts (id, title, content, image_url, user_id, user_name)
+		VALUES (1, 'Тред', 'текст', 'http://localhost:9000/posts/a.png', 1, 'Rick');
+		INSERT INTO comments (post_id, user_id, user_name, content, image_url) VALUES
+			(1, 2, 'Morty', 'ответ', 'http://s3:9000/posts/a.png'),
+			(1, 2, 'Morty', 'ответ', 'https://example.com/posts/b.png')`)
+	if err != nil {
+		t.Fatalf("Ошибка вставки старых записей: %v", err)
+	}
+	if err := postgres.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Ошибка миграции: %v", err)
+	}
+
+	var refs int
+	var uploaded bool
+	query := `SELECT ref_count, uploaded FROM image_objects WHERE bucket = 'posts' AND object_key = 'a.png'`
+	if err := db.QueryRow(query).Scan(&refs, &uploaded); err != nil {
+		t.Fatalf("Объект старых записей не учтен: %v", err)
+	}
+	if refs != 2 || !uploaded {
+		t.Errorf("Ожидалось 2 ссылки на записанный объект, получено %d, uploaded=%v", refs, uploaded)
+	}
+
+	var objects int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM image_objects`).Scan(&objects); err != nil || objects != 1 {
+		t.Errorf("Адреса сторонних сайтов не должны учитываться: %d %v", objects, err)
+	}
+}
+
+// TestMigrateBackfillsAttachments проверяет перенос изображений старых записей в файлы
+func TestMigrateBackfillsAttachments(t *testing.T) {
+	db := legacyDB(t)
+
+	_, err := db.Exec(`INSERT INTO posts (id, title, content, image_url, user_id, user_name) VALUES
+			(1, 'Тред', 'текст', 'http://localhost:9000/posts/a.png', 1, 'Rick'),
+			(2, 'Тред', 'текст', 'https://images.unsplash.com/photo-1', 1, 'Rick');
+		INSERT INTO comments (id, post_id, user_id, user_name, content, image_url)
+			VALUES (1, 1, 2, 'Morty', 'ответ', 'http://s3:9000/comments/b.JPG')`)
+	if err != nil {
+		t.Fatalf("Ошибка вставки старых записей: %v", err)
+	}
+	if err := postgres.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Ошибка миграции: %v", err)
+	}
+
+	rows, err := db.Query(`SELECT owner_type, owner_id, bucket, object_key, mime_type FROM attachments ORDER BY owner_type, owner_id`)
+	if err != nil {
+		t.Fatalf("Ошибка чтения файлов: %v", err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var ownerType, bucket, key, mimeType string
+		var ownerID int64
+		if err := rows.Scan(&ownerType, &ownerID, &bucket, &key, &mimeType); err != nil {
+			t.Fatalf("Ошибка сканирования файла: %v", err)
+		}
+		got = append(got, fmt.Sprintf("%s:%d %s/%s %s", ownerType, ownerID, bucket, key, mimeType))
+	}
+	want := []string{"comment:1 comments/b.JPG image/jpeg", "post:1 posts/a.png image/png"}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Неверные файлы: ожидалось %v, получено %v", want, got)
+	}
+}
+
+// TestMigrateRewritesObjectURLs проверяет перевод абсолютных адресов хранилища в bucket/key
+func TestMigrateRewritesObjectURLs(t *testing.T) {
+	db := legacyDB(t)
+
+	// База с миниатюрами, но с абсолютными адресами хранилища
+	_, err := db.Exec(`ALTER TABLE posts ADD COLUMN thumbnail_url VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE posts ADD COLUMN catalog_thumbnail_url VARCHAR(255) NOT NULL DEFAULT '';
+		ALTER TABLE comments ADD COLUMN thumbnail_url VARCHAR(255) NOT NULL DEFAULT '';
+		INSERT INTO posts (id, title, content, image_url, thumbnail_url, catalog_thumbnail_url, user_id, user_name) VALUES
+			(1, 'Тред', 'текст', 'http://localhost:9000/posts/a.png', 'http://localhost:9000/posts/a_t.jpg', 'https://s3:9000/posts/a_c.jpg', 1, 'Rick'),
+			(2, 'Тред', 'текст', 'https://images.unsplash.com/photo-1', '', '', 1, 'Rick'),
+			(3, 'Тред', 'текст', 'posts/c.png', '', '', 1, 'Rick');
+		INSERT INTO comments (id, post_id, user_id, user_name, content, image_url, thumbnail_url)
+			VALUES (1, 1, 2, 'Morty', 'ответ', 'http://s3:9000/comments/b.gif', 'http://s3:9000/comments/b_t.jpg')`)
+	if err != nil {
+		t.Fatalf("Ошибка вставки старых записей: %v", err)
+	}
+	if err := postgres.Migrate(context.Background(), db); err != nil {
+		t.Fatalf("Ошибка миграции: %v", err)
+	}
+
+	posts := map[int64][3]string{
+		1: {"posts/a.png", "posts/a_t.jpg", "posts/a_c.jpg"},
+		2: {"https://images.unsplash.com/photo-1", "", ""},
+		3: {"posts/c.png", "", ""},
+	}
+	for id, want := range posts {
+		var got [3]string
+		query := `SELECT image_url, thumbnail_url, catalog_thumbnail_url FROM posts WHERE id = $1`
+		if err := db.QueryRow(query, id).Scan(&got[0], &got[1], &got[2]); err != nil {
+			t.Fatalf("Ошибка чтения поста %d: %v", id, err)
+		}
+		if got != want {
+			t.Errorf("Пост %d: ожидалось %q, получено %q", id, want, got)
+		}
+	}
+
+	var image, thumbnail string
+	query := `SELECT image_url, thumbnail_url FROM comments WHERE id = 1`
+	if err := db.QueryRow(query).Scan(&image, &thumbnail); err != nil {
+		t.Fatalf("Ошибка чтения комментария: %v", err)
+	}
+	if image != "comments/b.gif" || thumbnail != "comments/b_t.jpg" {
+		t.Errorf("Адреса комментария не переписаны: %q, %q", image, thumbnail)
+	}
+}
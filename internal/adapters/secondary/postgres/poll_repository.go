@@ -0,0 +1,178 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"github.com/lib/pq"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// PollRepository реализует интерфейс репозитория опросов для PostgreSQL
+type PollRepository struct {
+	db *sql.DB
+}
+
+// NewPollRepository создает новый экземпляр репозитория опросов
+func NewPollRepository(db *sql.DB) *PollRepository {
+	return &PollRepository{db: db}
+}
+
+// Create сохраняет опрос и его варианты в одной транзакции, порядок вариантов сохраняется
+func (r *PollRepository) Create(ctx context.Context, poll *models.Poll) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err)
+		return 0, fmt.Errorf("ошибка создания опроса: %w", err)
+	}
+	defer tx.Rollback()
+
+	var closesAt interface{}
+	if poll.ClosesAt != nil {
+		closesAt = *poll.ClosesAt
+	}
+
+	var id int64
+	err = tx.QueryRowContext(ctx, `INSERT INTO polls (post_id, multiple, closes_at)
+        VALUES ($1, $2, $3)
+        RETURNING id`, poll.PostID, poll.Multiple, closesAt).Scan(&id)
+	if err != nil {
+		slog.Error("Ошибка создания опроса", "post_id", poll.PostID, "error", err)
+		return 0, fmt.Errorf("ошибка создания опроса: %w", err)
+	}
+
+	texts := make([]string, len(poll.Options))
+	for i, option := range poll.Options {
+		texts[i] = option.Text
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO poll_options (poll_id, position, text)
+        SELECT $1, o.position, o.text FROM unnest($2::TEXT[]) WITH ORDINALITY AS o(text, position)`,
+		id, pq.Array(texts))
+	if err != nil {
+		slog.Error("Ошибка сохранения вариантов опроса", "poll_id", id, "error", err)
+		return 0, fmt.Errorf("ошибка сохранения вариантов опроса: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err)
+		return 0, fmt.Errorf("ошибка создания опроса: %w", err)
+	}
+
+	slog.Info("Опрос создан", "id", id, "post_id", poll.PostID, "options", len(texts))
+	return id, nil
+}
+
+// GetByPostID возвращает опрос треда. Число голосов по вариантам и выбор сессии
+// считаются одной выборкой по poll_votes
+func (r *PollRepository) GetByPostID(ctx context.Context, postID, viewerID int64) (*models.Poll, error) {
+	var poll models.Poll
+	var closesAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, `SELECT
+        p.id, p.post_id, p.multiple, p.closes_at, p.closed, p.created_at,
+        (SELECT COUNT(DISTINCT v.user_id) FROM poll_votes v WHERE v.poll_id = p.id)
+        FROM polls p
+        WHERE p.post_id = $1`, postID).Scan(
+		&poll.ID, &poll.PostID, &poll.Multiple, &closesAt, &poll.Closed, &poll.CreatedAt, &poll.Voters)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		slog.Error("Ошибка получения опроса", "post_id", postID, "error", err)
+		return nil, fmt.Errorf("ошибка получения опроса: %w", err)
+	}
+	if closesAt.Valid {
+		poll.ClosesAt = &closesAt.Time
+	}
+
+	rows, err := r.db.QueryContext(ctx, `SELECT
+        o.id, o.text, COUNT(v.user_id), COALESCE(BOOL_OR(v.user_id = $2), false)
+        FROM poll_options o
+        LEFT JOIN poll_votes v ON v.option_id = o.id
+        WHERE o.poll_id = $1
+        GROUP BY o.id
+        ORDER BY o.position`, poll.ID, viewerID)
+	if err != nil {
+		slog.Error("Ошибка получения вариантов опроса", "poll_id", poll.ID, "error", err)
+		return nil, fmt.Errorf("ошибка получения вариантов опроса: %w", err)
+	}
+	defer rows.Close()
+
+	poll.Voted = []int64{}
+	for rows.Next() {
+		var option models.PollOption
+		var voted bool
+		if err := rows.Scan(&option.ID, &option.Text, &option.Votes, &voted); err != nil {
+			slog.Error("Ошибка сканирования варианта опроса", "error", err)
+			return nil, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+		if voted {
+			poll.Voted = append(poll.Voted, option.ID)
+		}
+		poll.Options = append(poll.Options, &option)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка после итерации по вариантам опроса", "error", err)
+		return nil, fmt.Errorf("ошибка итерации: %w", err)
+	}
+
+	return &poll, nil
+}
+
+// Vote сохраняет голос сессии. Строка опроса блокируется на время транзакции,
+// поэтому два одновременных запроса одной сессии не проголосуют дважды
+func (r *PollRepository) Vote(ctx context.Context, pollID, userID int64, optionIDs []int64) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err)
+		return false, fmt.Errorf("ошибка голосования: %w", err)
+	}
+	defer tx.Rollback()
+
+	var voted bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS (
+            SELECT 1 FROM poll_votes WHERE poll_id = p.id AND user_id = $2
+        )
+        FROM polls p
+        WHERE p.id = $1
+        FOR UPDATE OF p`, pollID, userID).Scan(&voted)
+	if err != nil {
+		slog.Error("Ошибка проверки голоса", "poll_id", pollID, "user_id", userID, "error", err)
+		return false, fmt.Errorf("ошибка голосования: %w", err)
+	}
+	if voted {
+		return false, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO poll_votes (poll_id, user_id, option_id)
+        SELECT $1, $2, id FROM poll_options WHERE poll_id = $1 AND id = ANY($3)`,
+		pollID, userID, pq.Array(optionIDs))
+	if err != nil {
+		slog.Error("Ошибка сохранения голоса", "poll_id", pollID, "user_id", userID, "error", err)
+		return false, fmt.Errorf("ошибка голосования: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err)
+		return false, fmt.Errorf("ошибка голосования: %w", err)
+	}
+
+	slog.Info("Голос сохранен", "poll_id", pollID, "user_id", userID, "options", optionIDs)
+	return true, nil
+}
+
+// CloseByPostID закрывает опрос треда
+func (r *PollRepository) CloseByPostID(ctx context.Context, postID int64) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE polls SET closed = true WHERE post_id = $1 AND closed = false`, postID)
+	if err != nil {
+		slog.Error("Ошибка закрытия опроса", "post_id", postID, "error", err)
+		return err
+	}
+
+	if rowsAffected, err := result.RowsAffected(); err == nil && rowsAffected > 0 {
+		slog.Info("Опрос закрыт", "post_id", postID)
+	}
+	return nil
+}
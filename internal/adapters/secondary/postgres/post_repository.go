@@ -3,13 +3,23 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/lib/pq"
+
 	"1337b04rd/internal/domain/models"
 )
 
+// replyCountColumn считает опубликованные комментарии поста, использует индекс по post_id
+const replyCountColumn = `(SELECT COUNT(*) FROM comments c 
+            WHERE c.post_id = posts.id AND c.moderation_status IN ('visible', 'flagged')) AS reply_count`
+
+// catalogPreviewLength наибольшая длина текста ответа в превью каталога, в символах
+const catalogPreviewLength = 200
+
 // PostRepository реализует интерфейс репозитория постов для PostgreSQL
 type PostRepository struct {
 	db *sql.DB
@@ -25,15 +35,16 @@ func NewPostRepository(db *sql.DB) *PostRepository {
 // GetByID возвращает пост по его ID
 func (r *PostRepository) GetByID(ctx context.Context, id int64) (*models.Post, error) {
 	query := `SELECT 
-        id, title, content, image_url, user_id, user_name, avatar_url, created_at, is_archived 
+        id, title, content, image_url, image_width, image_height, thumbnail_url, catalog_thumbnail_url, user_id, user_name, avatar_url, created_at, is_archived, is_sticky, is_locked, moderation_status, spam_score, 
+        ` + replyCountColumn + `
         FROM posts 
         WHERE id = $1`
 
 	var post models.Post
 	err := r.db.QueryRowContext(ctx, query, id).Scan(
-		&post.ID, &post.Title, &post.Content, &post.ImageURL,
+		&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.ImageWidth, &post.ImageHeight, &post.ThumbnailURL, &post.CatalogThumbnailURL,
 		&post.UserID, &post.UserName, &post.AvatarURL,
-		&post.CreatedAt, &post.IsArchived)
+		&post.CreatedAt, &post.IsArchived, &post.IsSticky, &post.IsLocked, &post.Status, &post.SpamScore, &post.ReplyCount)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			slog.Error("Пост не найден", "id", id)
@@ -49,18 +60,28 @@ func (r *PostRepository) GetByID(ctx context.Context, id int64) (*models.Post, e
 		"title", post.Title,
 		"content_length", len(post.Content),
 		"image_url", post.ImageURL,
+		"attachments", len(post.Attachments),
 		"user_id", post.UserID,
 		"user_name", post.UserName,
 		"created_at", post.CreatedAt,
-		"is_archived", post.IsArchived)
+		"is_archived", post.IsArchived,
+		"is_sticky", post.IsSticky,
+		"is_locked", post.IsLocked)
 
 	return &post, nil
 }
 
 // GetAll возвращает все посты с возможной фильтрацией
 func (r *PostRepository) GetAll(ctx context.Context, limit, offset int, archived bool) ([]*models.Post, error) {
-	// TODO: реализовать получение всех постов из БД
-	query := `SELECT * FROM posts WHERE is_archived = $3 ORDER BY created_at DESC LIMIT $1 OFFSET $2`
+	// Скрытые и ожидающие модерации посты не попадают в каталог,
+	// автор видит их только по прямой ссылке
+	query := `SELECT 
+        id, title, content, image_url, image_width, image_height, thumbnail_url, catalog_thumbnail_url, user_id, user_name, avatar_url, created_at, is_archived, is_sticky, is_locked, moderation_status, spam_score, 
+        ` + replyCountColumn + `
+        FROM posts 
+        WHERE is_archived = $3 AND moderation_status IN ('visible', 'flagged') 
+        ORDER BY is_sticky DESC, created_at DESC 
+        LIMIT $1 OFFSET $2`
 
 	rows, err := r.db.QueryContext(ctx, query, limit, offset, archived)
 	if err != nil {
@@ -72,7 +93,7 @@ func (r *PostRepository) GetAll(ctx context.Context, limit, offset int, archived
 
 	for rows.Next() {
 		var post models.Post
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.UserID, &post.UserName, &post.AvatarURL, &post.CreatedAt, &post.IsArchived)
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.ImageWidth, &post.ImageHeight, &post.ThumbnailURL, &post.CatalogThumbnailURL, &post.UserID, &post.UserName, &post.AvatarURL, &post.CreatedAt, &post.IsArchived, &post.IsSticky, &post.IsLocked, &post.Status, &post.SpamScore, &post.ReplyCount)
 		if err != nil {
 			return nil, err
 		}
@@ -85,37 +106,163 @@ func (r *PostRepository) GetAll(ctx context.Context, limit, offset int, archived
 	return posts, nil
 }
 
+// GetCatalog возвращает карточки каталога. Сводка и последние ответы собираются
+// боковыми подзапросами по индексу comments (post_id, created_at, id), ответы приходят
+// JSON-массивом, текст ответа обрезается до длины превью. Общее число постов
+// считается оконной функцией в том же запросе
+func (r *PostRepository) GetCatalog(ctx context.Context, limit, offset int, archived bool, previews int) ([]*models.CatalogEntry, int, error) {
+	query := `SELECT 
+        p.id, p.title, p.content, p.image_url, p.image_width, p.image_height, p.thumbnail_url, p.catalog_thumbnail_url, p.user_id, p.user_name, p.avatar_url, p.created_at, p.is_archived, 
+        p.is_sticky, p.is_locked, p.moderation_status, p.spam_score, stats.reply_count, stats.image_count, stats.last_reply_at, 
+        COALESCE(preview.replies, '[]'::json), COUNT(*) OVER () AS total
+        FROM posts p
+        CROSS JOIN LATERAL (
+            SELECT COUNT(*) AS reply_count,
+                COUNT(*) FILTER (WHERE c.image_url IS NOT NULL AND c.image_url <> '') AS image_count,
+                MAX(c.created_at) AS last_reply_at
+            FROM comments c
+            WHERE c.post_id = p.id AND c.moderation_status IN ('visible', 'flagged')
+        ) stats
+        LEFT JOIN LATERAL (
+            SELECT json_agg(json_build_object(
+                    'id', last.id, 'post_id', last.post_id, 'user_id', last.user_id, 'user_name', last.user_name,
+                    'avatar_url', COALESCE(last.avatar_url, ''), 'content', last.content,
+                    'image_url', COALESCE(last.image_url, ''), 'thumbnail_url', last.thumbnail_url,
+                    'image_width', last.image_width, 'image_height', last.image_height,
+                    'created_at', last.created_at AT TIME ZONE 'UTC'
+                ) ORDER BY last.created_at, last.id) AS replies
+            FROM (
+                SELECT c.id, c.post_id, c.user_id, c.user_name, c.avatar_url, LEFT(c.content, $5) AS content, 
+                    c.image_url, c.image_width, c.image_height, c.thumbnail_url, c.created_at
+                FROM comments c
+                WHERE c.post_id = p.id AND c.moderation_status IN ('visible', 'flagged')
+                ORDER BY c.created_at DESC, c.id DESC
+                LIMIT $4
+            ) last
+        ) preview ON true
+        WHERE p.is_archived = $3 AND p.moderation_status IN ('visible', 'flagged') 
+        ORDER BY p.is_sticky DESC, p.created_at DESC 
+        LIMIT $1 OFFSET $2`
+
+	rows, err := r.db.QueryContext(ctx, query, limit, offset, archived, previews, catalogPreviewLength)
+	if err != nil {
+		slog.Error("Ошибка запроса каталога", "error", err)
+		return nil, 0, fmt.Errorf("ошибка запроса каталога: %w", err)
+	}
+	defer rows.Close()
+
+	var entries []*models.CatalogEntry
+	total := 0
+	for rows.Next() {
+		post := &models.Post{}
+		entry := &models.CatalogEntry{Post: post}
+		var lastReplyAt sql.NullTime
+		var replies []byte
+
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.ImageWidth, &post.ImageHeight, &post.ThumbnailURL, &post.CatalogThumbnailURL, &post.UserID, &post.UserName, &post.AvatarURL,
+			&post.CreatedAt, &post.IsArchived, &post.IsSticky, &post.IsLocked, &post.Status, &post.SpamScore, &post.ReplyCount, &entry.ImageCount,
+			&lastReplyAt, &replies, &total)
+		if err != nil {
+			slog.Error("Ошибка сканирования строки каталога", "error", err)
+			return nil, 0, fmt.Errorf("ошибка сканирования: %w", err)
+		}
+		if lastReplyAt.Valid {
+			entry.LastReplyAt = &lastReplyAt.Time
+		}
+		if err := json.Unmarshal(replies, &entry.LastReplies); err != nil {
+			slog.Error("Ошибка разбора последних ответов", "post_id", post.ID, "error", err)
+			return nil, 0, fmt.Errorf("ошибка разбора последних ответов: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк каталога", "error", err)
+		return nil, 0, err
+	}
+
+	// Страница за концом каталога пуста, и оконная функция не вернула число постов
+	if len(entries) == 0 && offset > 0 {
+		query := `SELECT COUNT(*) FROM posts WHERE is_archived = $1 AND moderation_status IN ('visible', 'flagged')`
+		if err := r.db.QueryRowContext(ctx, query, archived).Scan(&total); err != nil {
+			slog.Error("Ошибка подсчета постов каталога", "error", err)
+			return nil, 0, err
+		}
+	}
+	return entries, total, nil
+}
+
+// CountCreatedSince возвращает количество постов, созданных после указанного момента
+func (r *PostRepository) CountCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	query := `SELECT COUNT(*) FROM posts WHERE created_at > $1`
+
+	var count int
+	if err := r.db.QueryRowContext(ctx, query, since).Scan(&count); err != nil {
+		slog.Error("Ошибка подсчета новых постов", "since", since, "error", err)
+		return 0, err
+	}
+	return count, nil
+}
+
 // Create создает новый пост
 func (r *PostRepository) Create(ctx context.Context, post *models.Post) (int64, error) {
 	currentTime := time.Now()
 
-	query := `INSERT INTO posts (title, content, image_url, user_id, user_name, avatar_url, created_at, is_archived)
-	VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id
+	status := post.Status
+	if status == "" {
+		status = models.ModerationVisible
+	}
+
+	query := `INSERT INTO posts (title, content, image_url, user_id, user_name, avatar_url, created_at, is_archived, moderation_status, spam_score, 
+        image_width, image_height, thumbnail_url, catalog_thumbnail_url)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14) RETURNING id
 	`
+	// Пост и его файлы сохраняются в одной транзакции
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err)
+		return 0, err
+	}
+	defer tx.Rollback()
+
 	var newID int64
-	err := r.db.QueryRowContext(ctx, query, post.Title, post.Content, post.ImageURL, post.UserID, post.UserName, post.AvatarURL, currentTime, post.IsArchived).Scan(&newID)
+	err = tx.QueryRowContext(ctx, query, post.Title, post.Content, post.ImageURL, post.UserID, post.UserName, post.AvatarURL, currentTime, post.IsArchived, status, post.SpamScore,
+		post.ImageWidth, post.ImageHeight, post.ThumbnailURL, post.CatalogThumbnailURL).Scan(&newID)
 	if err != nil {
 		slog.Error("Ошибка создания поста", "error", err)
 		return 0, err
 	}
+
+	if err := insertAttachments(ctx, tx, models.AttachmentPost, newID, post.Attachments); err != nil {
+		slog.Error("Ошибка сохранения файлов поста", "error", err)
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err)
+		return 0, err
+	}
 	slog.Info("Пост создан",
 		"id", newID,
 		"title", post.Title,
 		"content_length", len(post.Content),
 		"image_url", post.ImageURL,
+		"attachments", len(post.Attachments),
 		"user_id", post.UserID,
 		"user_name", post.UserName,
 		"created_at", currentTime,
-		"is_archived", post.IsArchived)
+		"is_archived", post.IsArchived,
+		"moderation_status", status,
+		"spam_score", post.SpamScore)
 	return newID, err
 }
 
-// GetAllForArchiving возвращает все неархивированные посты для проверки архивации
+// GetAllForArchiving возвращает неархивированные посты для проверки архивации.
+// Закрепленные треды не архивируются и в выборку не попадают
 func (r *PostRepository) GetAllForArchiving(ctx context.Context) ([]*models.Post, error) {
 	query := `SELECT 
-        id, title, content, image_url, user_id, user_name, avatar_url, created_at, is_archived 
+        id, title, content, image_url, image_width, image_height, thumbnail_url, catalog_thumbnail_url, user_id, user_name, avatar_url, created_at, is_archived, is_sticky, is_locked, moderation_status, spam_score 
         FROM posts 
-        WHERE is_archived = false`
+        WHERE is_archived = false AND is_sticky = false`
 
 	rows, err := r.db.QueryContext(ctx, query)
 	if err != nil {
@@ -129,9 +276,9 @@ func (r *PostRepository) GetAllForArchiving(ctx context.Context) ([]*models.Post
 	for rows.Next() {
 		var post models.Post
 		err := rows.Scan(
-			&post.ID, &post.Title, &post.Content, &post.ImageURL,
+			&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.ImageWidth, &post.ImageHeight, &post.ThumbnailURL, &post.CatalogThumbnailURL,
 			&post.UserID, &post.UserName, &post.AvatarURL,
-			&post.CreatedAt, &post.IsArchived)
+			&post.CreatedAt, &post.IsArchived, &post.IsSticky, &post.IsLocked, &post.Status, &post.SpamScore)
 		if err != nil {
 			slog.Error("Ошибка сканирования поста", "error", err)
 			return nil, err
@@ -172,3 +319,157 @@ func (r *PostRepository) Archive(ctx context.Context, id int64) error {
 	slog.Info("Пост успешно архивирован", "id", id)
 	return nil
 }
+
+// Delete удаляет пост вместе с комментариями и опросом и возвращает адреса
+// изображений поста и всех его комментариев
+func (r *PostRepository) Delete(ctx context.Context, id int64) ([]string, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции", "error", err)
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// Комментарии удаляются каскадно, поэтому их изображения собираются до удаления.
+	// Файлы поста и комментариев удаляются тем же запросом. Первый файл совпадает
+	// с изображением записи и освобождается по ее столбцам, кроме постера, которого в них нет
+	imageURLs, err := queryImageURLs(ctx, tx, `WITH removed AS (
+            DELETE FROM attachments 
+            WHERE (owner_type = 'post' AND owner_id = $1) 
+                OR (owner_type = 'comment' AND owner_id IN (SELECT id FROM comments WHERE post_id = $1)) 
+            RETURNING position, bucket, object_key, thumbnail_key, poster_key
+        )
+        SELECT url FROM posts, 
+            LATERAL (VALUES (image_url), (thumbnail_url), (catalog_thumbnail_url)) AS images(url) 
+            WHERE id = $1
+        UNION ALL
+        SELECT url FROM comments, 
+            LATERAL (VALUES (image_url), (thumbnail_url)) AS images(url) 
+            WHERE post_id = $1
+        UNION ALL
+        SELECT url FROM removed, 
+            LATERAL (VALUES (CASE WHEN position > 0 THEN bucket || '/' || object_key END), 
+                (CASE WHEN position > 0 THEN bucket || '/' || NULLIF(thumbnail_key, '') END), 
+                (bucket || '/' || NULLIF(poster_key, ''))) AS images(url)`, id)
+	if err != nil {
+		slog.Error("Ошибка получения изображений поста", "id", id, "error", err)
+		return nil, err
+	}
+
+	result, err := tx.ExecContext(ctx, `DELETE FROM posts WHERE id = $1`, id)
+	if err != nil {
+		slog.Error("Ошибка при удалении поста", "id", id, "error", err)
+		return nil, err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		slog.Error("Ошибка получения количества затронутых строк", "error", err)
+		return nil, err
+	}
+
+	if rowsAffected == 0 {
+		slog.Warn("Пост для удаления не найден", "id", id)
+		return nil, fmt.Errorf("пост с id %d не найден", id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("Ошибка фиксации транзакции", "error", err)
+		return nil, err
+	}
+
+	slog.Info("Пост успешно удален", "id", id, "images", len(imageURLs))
+	return imageURLs, nil
+}
+
+// GetByStatus возвращает посты с указанными статусами модерации, новые первыми
+func (r *PostRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Post, error) {
+	query := `SELECT 
+        id, title, content, image_url, image_width, image_height, thumbnail_url, catalog_thumbnail_url, user_id, user_name, avatar_url, created_at, is_archived, is_sticky, is_locked, moderation_status, spam_score 
+        FROM posts 
+        WHERE moderation_status = ANY($1) 
+        ORDER BY created_at DESC 
+        LIMIT $2`
+
+	names := make([]string, len(statuses))
+	for i, status := range statuses {
+		names[i] = string(status)
+	}
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(names), limit)
+	if err != nil {
+		slog.Error("Ошибка запроса постов по статусу", "statuses", names, "error", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*models.Post
+	for rows.Next() {
+		var post models.Post
+		err := rows.Scan(
+			&post.ID, &post.Title, &post.Content, &post.ImageURL, &post.ImageWidth, &post.ImageHeight, &post.ThumbnailURL, &post.CatalogThumbnailURL,
+			&post.UserID, &post.UserName, &post.AvatarURL,
+			&post.CreatedAt, &post.IsArchived, &post.IsSticky, &post.IsLocked, &post.Status, &post.SpamScore)
+		if err != nil {
+			slog.Error("Ошибка сканирования поста", "error", err)
+			return nil, err
+		}
+		posts = append(posts, &post)
+	}
+
+	if err := rows.Err(); err != nil {
+		slog.Error("Ошибка при обработке строк из БД", "error", err)
+		return nil, err
+	}
+	return posts, nil
+}
+
+// SetStatus меняет статус модерации поста
+func (r *PostRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE posts SET moderation_status = $2 WHERE id = $1`, id, status)
+	if err != nil {
+		slog.Error("Ошибка изменения статуса поста", "id", id, "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("пост с id %d не найден", id)
+	}
+
+	slog.Info("Статус поста изменен", "id", id, "status", status)
+	return nil
+}
+
+// SetSticky закрепляет тред вверху каталога или снимает закрепление
+func (r *PostRepository) SetSticky(ctx context.Context, id int64, sticky bool) error {
+	return r.setFlag(ctx, id, "is_sticky", sticky)
+}
+
+// SetLocked закрывает тред для новых ответов или открывает его
+func (r *PostRepository) SetLocked(ctx context.Context, id int64, locked bool) error {
+	return r.setFlag(ctx, id, "is_locked", locked)
+}
+
+// setFlag меняет логический флаг поста, column берется только из констант репозитория
+func (r *PostRepository) setFlag(ctx context.Context, id int64, column string, value bool) error {
+	result, err := r.db.ExecContext(ctx, `UPDATE posts SET `+column+` = $2 WHERE id = $1`, id, value)
+	if err != nil {
+		slog.Error("Ошибка изменения флага поста", "id", id, "flag", column, "error", err)
+		return err
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rowsAffected == 0 {
+		return fmt.Errorf("пост с id %d не найден", id)
+	}
+
+	slog.Info("Флаг поста изменен", "id", id, "flag", column, "value", value)
+	return nil
+}
@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// RateLimitRepository хранит корзины токенов в PostgreSQL,
+// чтобы ограничения работали согласованно между несколькими экземплярами
+type RateLimitRepository struct {
+	db *sql.DB
+}
+
+// NewRateLimitRepository создает новый экземпляр репозитория ограничений
+func NewRateLimitRepository(db *sql.DB) *RateLimitRepository {
+	return &RateLimitRepository{
+		db: db,
+	}
+}
+
+// Take пополняет корзину по ключу и забирает из нее один токен.
+// Строка корзины блокируется на время транзакции
+func (r *RateLimitRepository) Take(ctx context.Context, key string, rule models.RateLimitRule, now time.Time) (models.RateLimitDecision, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		slog.Error("Ошибка начала транзакции ограничения частоты", "error", err)
+		return models.RateLimitDecision{}, err
+	}
+	defer tx.Rollback()
+
+	// Создаем полную корзину, если ее еще нет
+	insertQuery := `INSERT INTO rate_limit_buckets (key, tokens, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (key) DO NOTHING`
+	if _, err = tx.ExecContext(ctx, insertQuery, key, float64(rule.Burst), now); err != nil {
+		slog.Error("Ошибка создания корзины токенов", "key", key, "error", err)
+		return models.RateLimitDecision{}, fmt.Errorf("ошибка создания корзины: %w", err)
+	}
+
+	var bucket models.TokenBucket
+	selectQuery := `SELECT tokens, updated_at FROM rate_limit_buckets WHERE key = $1 FOR UPDATE`
+	if err = tx.QueryRowContext(ctx, selectQuery, key).Scan(&bucket.Tokens, &bucket.UpdatedAt); err != nil {
+		slog.Error("Ошибка чтения корзины токенов", "key", key, "error", err)
+		return models.RateLimitDecision{}, fmt.Errorf("ошибка чтения корзины: %w", err)
+	}
+
+	decision := bucket.Take(rule, now)
+
+	updateQuery := `UPDATE rate_limit_buckets SET tokens = $2, updated_at = $3 WHERE key = $1`
+	if _, err = tx.ExecContext(ctx, updateQuery, key, bucket.Tokens, bucket.UpdatedAt); err != nil {
+		slog.Error("Ошибка обновления корзины токенов", "key", key, "error", err)
+		return models.RateLimitDecision{}, fmt.Errorf("ошибка обновления корзины: %w", err)
+	}
+
+	if err = tx.Commit(); err != nil {
+		slog.Error("Ошибка при коммите транзакции", "error", err)
+		return models.RateLimitDecision{}, err
+	}
+
+	return decision, nil
+}
+
+// Refund возвращает токен в корзину по ключу, не больше емкости корзины
+func (r *RateLimitRepository) Refund(ctx context.Context, key string, rule models.RateLimitRule) error {
+	query := `UPDATE rate_limit_buckets SET tokens = LEAST(tokens + 1, $2) WHERE key = $1`
+
+	if _, err := r.db.ExecContext(ctx, query, key, float64(rule.Burst)); err != nil {
+		slog.Error("Ошибка возврата токена в корзину", "key", key, "error", err)
+		return fmt.Errorf("ошибка возврата токена: %w", err)
+	}
+	return nil
+}
+
+// DeleteStale удаляет корзины, которые не использовались дольше maxAge
+func (r *RateLimitRepository) DeleteStale(ctx context.Context, maxAge time.Duration) (int64, error) {
+	query := `DELETE FROM rate_limit_buckets WHERE updated_at < $1`
+
+	result, err := r.db.ExecContext(ctx, query, time.Now().Add(-maxAge))
+	if err != nil {
+		slog.Error("Ошибка удаления устаревших корзин", "error", err)
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,139 @@
+package publicurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+)
+
+var (
+	// ErrInvalidSignature возвращается для подписанного адреса с неверной подписью
+	ErrInvalidSignature = errors.New("неверная подпись адреса")
+	// ErrExpired возвращается для подписанного адреса с истекшим сроком действия
+	ErrExpired = errors.New("срок действия адреса истек")
+)
+
+// New создает построитель адресов по стратегии из настроек
+func New(config models.ImageURLConfig) (external.URLBuilder, error) {
+	switch config.Strategy {
+	case models.ImageURLProxy, "":
+		return NewProxyBuilder(config.ProxyPrefix), nil
+	case models.ImageURLDirect:
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("для стратегии %s нужен публичный адрес хранилища", config.Strategy)
+		}
+		return NewDirectBuilder(config.BaseURL), nil
+	case models.ImageURLSigned:
+		if len(config.Secret) == 0 || config.TTL <= 0 {
+			return nil, fmt.Errorf("для стратегии %s нужны ключ подписи и срок действия", config.Strategy)
+		}
+		return NewSignedBuilder(config.ProxyPrefix, config.Secret, config.TTL), nil
+	default:
+		return nil, fmt.Errorf("неизвестная стратегия адресов изображений: %q", config.Strategy)
+	}
+}
+
+// ProxyBuilder строит адреса прокси приложения, который добавляет защитные заголовки
+type ProxyBuilder struct {
+	prefix string
+}
+
+// NewProxyBuilder создает построитель адресов прокси с путем prefix, например /s3-proxy/
+func NewProxyBuilder(prefix string) *ProxyBuilder {
+	return &ProxyBuilder{prefix: normalizePrefix(prefix)}
+}
+
+// ObjectURL возвращает адрес объекта через прокси приложения
+func (b *ProxyBuilder) ObjectURL(bucket, key string) string {
+	return b.prefix + escapePath(bucket, key)
+}
+
+// DirectBuilder строит адреса от публичного адреса хранилища или CDN перед ним.
+// Защитные заголовки прокси в этом случае должен добавлять сам CDN или reverse proxy
+type DirectBuilder struct {
+	baseURL string
+}
+
+// NewDirectBuilder создает построитель адресов с публичным адресом baseURL
+func NewDirectBuilder(baseURL string) *DirectBuilder {
+	return &DirectBuilder{baseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// ObjectURL возвращает публичный адрес объекта
+func (b *DirectBuilder) ObjectURL(bucket, key string) string {
+	return b.baseURL + "/" + escapePath(bucket, key)
+}
+
+// SignedBuilder строит адреса прокси приложения с HMAC подписью и сроком действия.
+// Срок округляется до окна ttl, поэтому адрес не меняется при каждом показе страницы
+// и остается в кэше браузера, но действует не меньше ttl
+type SignedBuilder struct {
+	prefix string
+	secret []byte
+	ttl    time.Duration
+}
+
+// NewSignedBuilder создает построитель подписанных адресов
+func NewSignedBuilder(prefix string, secret []byte, ttl time.Duration) *SignedBuilder {
+	return &SignedBuilder{
+		prefix: normalizePrefix(prefix),
+		secret: secret,
+		ttl:    ttl,
+	}
+}
+
+// ObjectURL возвращает подписанный адрес объекта
+func (b *SignedBuilder) ObjectURL(bucket, key string) string {
+	expires := time.Now().Truncate(b.ttl).Add(2 * b.ttl).Unix()
+	query := url.Values{
+		"expires":   {strconv.FormatInt(expires, 10)},
+		"signature": {b.sign(bucket, key, expires)},
+	}
+	return b.prefix + escapePath(bucket, key) + "?" + query.Encode()
+}
+
+// Verify проверяет подпись и срок действия адреса объекта по параметрам запроса
+func (b *SignedBuilder) Verify(bucket, key string, query url.Values) error {
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(query.Get("signature"))
+	if err != nil {
+		return ErrInvalidSignature
+	}
+	expected, _ := base64.RawURLEncoding.DecodeString(b.sign(bucket, key, expires))
+	if !hmac.Equal(signature, expected) {
+		return ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return ErrExpired
+	}
+	return nil
+}
+
+// sign возвращает подпись объекта и срока действия
+func (b *SignedBuilder) sign(bucket, key string, expires int64) string {
+	mac := hmac.New(sha256.New, b.secret)
+	mac.Write([]byte(models.ObjectPath(bucket, key) + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// normalizePrefix добавляет к пути прокси начальную и конечную косую черту
+func normalizePrefix(prefix string) string {
+	return "/" + strings.Trim(prefix, "/") + "/"
+}
+
+// escapePath экранирует бакет и ключ для пути адреса
+func escapePath(bucket, key string) string {
+	return url.PathEscape(bucket) + "/" + url.PathEscape(key)
+}
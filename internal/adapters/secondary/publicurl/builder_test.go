@@ -0,0 +1,98 @@
+package publicurl_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/publicurl"
+	"1337b04rd/internal/domain/models"
+)
+
+// TestBuilders проверяет адреса стратегий proxy и direct
+func TestBuilders(t *testing.T) {
+	testCases := []struct {
+		config   models.ImageURLConfig
+		expected string
+	}{
+		{models.DefaultImageURLConfig(), "/s3-proxy/posts/abc.png"},
+		{models.ImageURLConfig{Strategy: models.ImageURLProxy, ProxyPrefix: "media"}, "/media/posts/abc.png"},
+		{models.ImageURLConfig{Strategy: models.ImageURLDirect, BaseURL: "https://cdn.example.com/"}, "https://cdn.example.com/posts/abc.png"},
+	}
+
+	for _, tc := range testCases {
+		builder, err := publicurl.New(tc.config)
+		if err != nil {
+			t.Fatalf("Ошибка создания построителя %s: %v", tc.config.Strategy, err)
+		}
+		if actual := builder.ObjectURL("posts", "abc.png"); actual != tc.expected {
+			t.Errorf("Стратегия %s: ожидалось %s, получено %s", tc.config.Strategy, tc.expected, actual)
+		}
+	}
+
+	invalid := []models.ImageURLConfig{
+		{Strategy: models.ImageURLDirect},
+		{Strategy: models.ImageURLSigned, ProxyPrefix: "/s3-proxy/", TTL: time.Hour},
+		{Strategy: "cdn"},
+	}
+	for _, config := range invalid {
+		if _, err := publicurl.New(config); err == nil {
+			t.Errorf("Ожидалась ошибка для настроек %+v", config)
+		}
+	}
+}
+
+// TestSignedBuilder проверяет подпись и срок действия подписанных адресов
+func TestSignedBuilder(t *testing.T) {
+	secret := []byte("secret")
+	builder := publicurl.NewSignedBuilder("/s3-proxy/", secret, time.Hour)
+
+	objectURL := builder.ObjectURL("posts", "abc.png")
+	if objectURL != builder.ObjectURL("posts", "abc.png") {
+		t.Error("Адрес должен быть одинаковым в пределах окна")
+	}
+	parsed, err := url.Parse(objectURL)
+	if err != nil || parsed.Path != "/s3-proxy/posts/abc.png" {
+		t.Fatalf("Неверный подписанный адрес: %s", objectURL)
+	}
+	query := parsed.Query()
+	expires, _ := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if remaining := time.Until(time.Unix(expires, 0)); remaining < time.Hour || remaining > 2*time.Hour {
+		t.Errorf("Неверный срок действия: %s", remaining)
+	}
+
+	if err := builder.Verify("posts", "abc.png", query); err != nil {
+		t.Errorf("Подпись не прошла проверку: %v", err)
+	}
+	if err := builder.Verify("posts", "other.png", query); !errors.Is(err, publicurl.ErrInvalidSignature) {
+		t.Errorf("Ожидалась ErrInvalidSignature для другого объекта, получено %v", err)
+	}
+	if err := builder.Verify("posts", "abc.png", url.Values{}); !errors.Is(err, publicurl.ErrInvalidSignature) {
+		t.Errorf("Ожидалась ErrInvalidSignature без подписи, получено %v", err)
+	}
+
+	// Продление срока без новой подписи не проходит проверку
+	extended := url.Values{"expires": {strconv.FormatInt(expires+3600, 10)}, "signature": {query.Get("signature")}}
+	if err := builder.Verify("posts", "abc.png", extended); !errors.Is(err, publicurl.ErrInvalidSignature) {
+		t.Errorf("Ожидалась ErrInvalidSignature для измененного срока, получено %v", err)
+	}
+
+	// Верно подписанный адрес с прошедшим сроком
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("posts/abc.png\n" + past))
+	expired := url.Values{"expires": {past}, "signature": {base64.RawURLEncoding.EncodeToString(mac.Sum(nil))}}
+	if err := builder.Verify("posts", "abc.png", expired); !errors.Is(err, publicurl.ErrExpired) {
+		t.Errorf("Ожидалась ErrExpired, получено %v", err)
+	}
+
+	if !strings.HasPrefix(builder.ObjectURL("comments", "x.webm"), "/s3-proxy/comments/x.webm?") {
+		t.Error("Неверный путь подписанного адреса")
+	}
+}
@@ -3,11 +3,14 @@ package rickandmorty
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
 	"math/rand"
 	"net/http"
 	"time"
+
+	"1337b04rd/internal/adapters/secondary/httpclient"
 )
 
 const (
@@ -15,11 +18,14 @@ const (
 	MaxCharacterID = 826 // По состоянию на 2023 год в API доступно 826 персонажей
 )
 
+// errCharacterNotFound возвращается, когда в API нет персонажа с выбранным ID
+var errCharacterNotFound = errors.New("персонаж не найден")
+
 // AvatarService представляет сервис для работы с API Rick and Morty
 type AvatarService struct {
-	client   *http.Client
+	client   *httpclient.Client
 	usedIDs  map[int]bool
-	maxRetry int
+	maxPicks int    // сколько случайных ID перебирается до стандартного аватара
 	baseURL  string // для тестирования
 	maxID    int    // для тестирования
 }
@@ -42,11 +48,9 @@ type CharacterResponse struct {
 // NewAvatarService создает новый экземпляр сервиса аватаров
 func NewAvatarService() *AvatarService {
 	return &AvatarService{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:   httpclient.New("rickandmorty", 10*time.Second),
 		usedIDs:  make(map[int]bool),
-		maxRetry: 5,
+		maxPicks: 5,
 	}
 }
 
@@ -54,11 +58,9 @@ func NewAvatarService() *AvatarService {
 // Используется для тестирования
 func NewAvatarServiceWithBaseURL(baseURL string, maxID int) *AvatarService {
 	return &AvatarService{
-		client: &http.Client{
-			Timeout: 10 * time.Second,
-		},
+		client:   httpclient.New("rickandmorty", 10*time.Second),
 		usedIDs:  make(map[int]bool),
-		maxRetry: 5,
+		maxPicks: 5,
 		baseURL:  baseURL,
 		maxID:    maxID,
 	}
@@ -80,8 +82,9 @@ func (s *AvatarService) GetRandomAvatar(ctx context.Context) (string, string, er
 		maxID = s.maxID
 	}
 
-	// Пробуем получить аватар несколько раз в случае ошибки
-	for i := 0; i < s.maxRetry; i++ {
+	// Перебираем несколько случайных ID. Ошибки соединения повторяет общий клиент,
+	// поэтому при недоступном API сразу используется стандартный аватар
+	for i := 0; i < s.maxPicks; i++ {
 		// Генерируем случайный ID персонажа
 		characterID := rnd.Intn(maxID) + 1
 
@@ -90,41 +93,13 @@ func (s *AvatarService) GetRandomAvatar(ctx context.Context) (string, string, er
 			continue // Если ID уже использовался, пробуем другой
 		}
 
-		// Формируем URL для запроса
-		url := fmt.Sprintf("%s/character/%d", baseURL, characterID)
-
-		// Создаем новый HTTP запрос
-		req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-		if err != nil {
-			slog.Error("Ошибка создания запроса", "error", err)
-			continue
+		character, err := s.fetchCharacter(ctx, baseURL, characterID)
+		if errors.Is(err, errCharacterNotFound) {
+			continue // Персонажа с таким ID нет, пробуем другой
 		}
-
-		// Выполняем запрос
-		resp, err := s.client.Do(req)
 		if err != nil {
-			slog.Error("Ошибка выполнения запроса", "error", err)
-			continue
-		}
-		defer resp.Body.Close()
-
-		// Проверяем код ответа
-		if resp.StatusCode != http.StatusOK {
-			slog.Error("Неудачный ответ API", "status", resp.StatusCode)
-			continue
-		}
-
-		// Декодируем ответ
-		var character CharacterResponse
-		if err := json.NewDecoder(resp.Body).Decode(&character); err != nil {
-			slog.Error("Ошибка декодирования ответа", "error", err)
-			continue
-		}
-
-		// Если получили ошибку в ответе, пробуем снова
-		if character.Error != "" {
-			slog.Error("Ошибка API", "error", character.Error)
-			continue
+			slog.Error("Ошибка получения персонажа", "id", characterID, "error", err)
+			break
 		}
 
 		// Отмечаем ID как использованный
@@ -139,6 +114,43 @@ func (s *AvatarService) GetRandomAvatar(ctx context.Context) (string, string, er
 	return "https://rickandmortyapi.com/api/character/avatar/1.jpeg", "Anonymous", nil
 }
 
+// fetchCharacter запрашивает персонажа по ID
+func (s *AvatarService) fetchCharacter(ctx context.Context, baseURL string, characterID int) (*CharacterResponse, error) {
+	// Формируем URL для запроса
+	url := fmt.Sprintf("%s/character/%d", baseURL, characterID)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	// Проверяем код ответа
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errCharacterNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("неудачный ответ API, статус: %d", resp.StatusCode)
+	}
+
+	// Декодируем ответ
+	var character CharacterResponse
+	if err := json.NewDecoder(resp.Body).Decode(&character); err != nil {
+		return nil, fmt.Errorf("ошибка декодирования ответа: %w", err)
+	}
+
+	// Ошибка в теле ответа означает, что персонажа нет
+	if character.Error != "" {
+		return nil, errCharacterNotFound
+	}
+	return &character, nil
+}
+
 // ResetUsedIDs сбрасывает список использованных ID
 // Это может понадобиться, если количество пользователей превысит количество персонажей
 func (s *AvatarService) ResetUsedIDs() {
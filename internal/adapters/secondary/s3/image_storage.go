@@ -5,27 +5,38 @@ package s3
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
+	"1337b04rd/internal/adapters/secondary/httpclient"
+	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/ports/external"
 )
 
 const (
-	// Максимальный размер файла в байтах (5 МБ)
-	MaxFileSize = 5 * 1024 * 1024
+	// Максимальный размер файла в байтах (20 МБ). Ограничения досок
+	// проверяются сервисом изображений и не могут быть больше этого
+	MaxFileSize = 20 * 1024 * 1024
 
-	// Разрешенные типы изображений
-	AllowedImageTypes = "image/jpeg,image/png,image/gif,image/svg+xml,image/webp"
+	// Разрешенные типы изображений и видео
+	AllowedImageTypes = "image/jpeg,image/png,image/gif,image/svg+xml,image/webp,video/webm,video/mp4"
+
+	// sniffLen сколько первых байт нужно для определения типа файла
+	sniffLen = 512
 )
 
+// ErrFileTooLarge возвращается для файлов больше MaxFileSize
+var ErrFileTooLarge = errors.New("размер файла превышает допустимый предел")
+
 // ImageStorageOptions содержит настройки для хранилища изображений
 type ImageStorageOptions struct {
 	MaxFileSize       int64
@@ -36,7 +47,7 @@ type ImageStorageOptions struct {
 // используя HTTP API S3-хранилища
 type ImageStorage struct {
 	baseURL    string
-	httpClient *http.Client
+	httpClient *httpclient.Client
 	options    ImageStorageOptions
 }
 
@@ -61,71 +72,84 @@ func NewImageStorage() external.ImageStorage {
 
 	return &ImageStorage{
 		baseURL: fmt.Sprintf("http://%s:%s", host, port),
-		httpClient: &http.Client{
-			Timeout: 10 * time.Second,
-		},
-		options: options,
+		// Повторные попытки и автомат защиты хоста общие для всех исходящих адаптеров
+		httpClient: httpclient.New("s3", 10*time.Second),
+		options:    options,
 	}
 }
 
-// UploadImage загружает изображение в S3-хранилище с проверками
-func (s *ImageStorage) UploadImage(ctx context.Context, bucketName, objectKey string, data []byte) (string, error) {
-	// Проверяем размер файла
-	if len(data) > int(s.options.MaxFileSize) {
-		return "", fmt.Errorf("размер файла превышает допустимый предел %d байт", s.options.MaxFileSize)
+// UploadImage загружает изображение в S3-хранилище с проверками. size - длина данных
+// или -1, если она неизвестна. Тип файла определяется по первым 512 байтам, остальные
+// данные передаются в хранилище потоком без чтения всего файла в память
+func (s *ImageStorage) UploadImage(ctx context.Context, bucketName, objectKey string, body io.Reader, size int64) (string, error) {
+	// Проверяем размер файла, если он известен заранее
+	if size > s.options.MaxFileSize {
+		return "", fmt.Errorf("%w: %d байт", ErrFileTooLarge, s.options.MaxFileSize)
 	}
 
-	// Определяем тип файла
-	fileType := http.DetectContentType(data)
-
-	// Проверяем, является ли тип файла разрешенным изображением
-	allowed := false
-	for _, allowedType := range s.options.AllowedImageTypes {
-		if fileType == allowedType {
-			allowed = true
-			break
+	// Запоминаем начало данных, чтобы при повторной попытке отправить их заново
+	seeker, rewindable := body.(io.Seeker)
+	var start int64
+	if rewindable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			rewindable = false
 		}
 	}
 
-	if !allowed {
+	// Определяем тип файла по началу данных
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+	head = head[:n]
+	fileType := detectContentType(head)
+
+	// Проверяем, является ли тип файла разрешенным изображением
+	if !s.allowedType(fileType) {
 		slog.Warn("Попытка загрузки файла неподдерживаемого типа", "type", fileType)
 		return "", fmt.Errorf("неподдерживаемый тип файла: %s. Разрешены только изображения", fileType)
 	}
 
 	// Создаем бакет, если он не существует
-	if err := s.createBucket(bucketName); err != nil {
+	if err := s.createBucket(ctx, bucketName); err != nil {
 		return "", fmt.Errorf("ошибка создания бакета: %w", err)
 	}
 
 	// Формируем URL для загрузки объекта
 	url := fmt.Sprintf("%s/%s/%s", s.baseURL, bucketName, objectKey)
-	slog.Info("Загрузка изображения", "url", url, "size", len(data), "type", fileType)
+	slog.Info("Загрузка изображения", "url", url, "size", size, "type", fileType)
 
-	// Создаем запрос на загрузку
-	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, bytes.NewReader(data))
+	// Создаем запрос на загрузку, тело ограничивается максимальным размером файла
+	content := io.MultiReader(bytes.NewReader(head), body)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, &limitedReader{r: content, remaining: s.options.MaxFileSize})
 	if err != nil {
 		return "", fmt.Errorf("ошибка создания запроса: %w", err)
 	}
+	// Без известной длины тело отправляется частями (chunked)
+	req.ContentLength = max(size, 0)
+
+	// Данные, которые можно перечитать, клиент отправит повторно при ошибке соединения.
+	// Поток без Seek прочитан частично и повторно не отправляется
+	if rewindable {
+		req.GetBody = func() (io.ReadCloser, error) {
+			if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+				return nil, err
+			}
+			return io.NopCloser(&limitedReader{r: body, remaining: s.options.MaxFileSize}), nil
+		}
+	}
 
 	// Устанавливаем Content-Type
 	req.Header.Set("Content-Type", fileType)
 
-	// Выполняем запрос с повторными попытками при ошибках соединения
-	var resp *http.Response
-	maxRetries := 3
-
-	for retry := 0; retry < maxRetries; retry++ {
-		resp, err = s.httpClient.Do(req)
-		if err != nil {
-			// Если это не последняя попытка, попробуем еще раз
-			if retry < maxRetries-1 {
-				slog.Warn("Ошибка соединения при загрузке, повторная попытка", "retry", retry+1, "error", err)
-				time.Sleep(time.Duration(retry+1) * 500 * time.Millisecond) // Экспоненциальная задержка
-				continue
-			}
-			return "", fmt.Errorf("ошибка выполнения запроса после %d попыток: %w", maxRetries, err)
-		}
-		break // Если успешно, выходим из цикла
+	resp, err := s.httpClient.Do(req)
+	if errors.Is(err, ErrFileTooLarge) {
+		return "", fmt.Errorf("%w: %d байт", ErrFileTooLarge, s.options.MaxFileSize)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
 
 	defer resp.Body.Close()
@@ -136,13 +160,34 @@ func (s *ImageStorage) UploadImage(ctx context.Context, bucketName, objectKey st
 		return "", fmt.Errorf("ошибка загрузки изображения: %s, статус: %d", string(body), resp.StatusCode)
 	}
 
-	// Возвращаем URL для доступа к изображению
-	// Используем localhost вместо имени сервиса s3 для доступа из браузера
-	imageURL := fmt.Sprintf("http://localhost:9000/%s/%s", bucketName, objectKey)
+	// Возвращаем адрес объекта в хранилище
+	imageURL := s.ObjectURL(bucketName, objectKey)
 	slog.Info("Изображение успешно загружено", "bucket", bucketName, "key", objectKey, "url", imageURL, "type", fileType)
 	return imageURL, nil
 }
 
+// limitedReader возвращает ErrFileTooLarge, когда поток длиннее remaining байт.
+// io.LimitReader молча обрезал бы такой файл
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+// Read читает не больше remaining байт и одного лишнего, по которому видно превышение
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	if int64(n) > l.remaining {
+		n = int(l.remaining)
+		l.remaining = 0
+		return n, ErrFileTooLarge
+	}
+	l.remaining -= int64(n)
+	return n, err
+}
+
 // GetImage получает изображение из S3-хранилища
 func (s *ImageStorage) GetImage(ctx context.Context, bucketName, objectKey string) ([]byte, error) {
 	// Формируем URL для получения объекта
@@ -154,24 +199,11 @@ func (s *ImageStorage) GetImage(ctx context.Context, bucketName, objectKey strin
 		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
 	}
 
-	// Выполняем запрос с повторными попытками
-	var resp *http.Response
-	maxRetries := 3
-
-	for retry := 0; retry < maxRetries; retry++ {
-		resp, err = s.httpClient.Do(req)
-		if err != nil {
-			// Если это не последняя попытка, попробуем еще раз
-			if retry < maxRetries-1 {
-				slog.Warn("Ошибка соединения при получении изображения, повторная попытка", "retry", retry+1, "error", err)
-				time.Sleep(time.Duration(retry+1) * 500 * time.Millisecond)
-				continue
-			}
-			return nil, fmt.Errorf("ошибка выполнения запроса после %d попыток: %w", maxRetries, err)
-		}
-		break
+	// Повторные попытки выполняет общий клиент
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
-
 	defer resp.Body.Close()
 
 	// Проверяем статус ответа
@@ -214,23 +246,11 @@ func (s *ImageStorage) DeleteImage(ctx context.Context, bucketName, objectKey st
 		return fmt.Errorf("ошибка создания запроса: %w", err)
 	}
 
-	// Выполняем запрос с повторными попытками
-	var resp *http.Response
-	maxRetries := 3
-
-	for retry := 0; retry < maxRetries; retry++ {
-		resp, err = s.httpClient.Do(req)
-		if err != nil {
-			if retry < maxRetries-1 {
-				slog.Warn("Ошибка соединения при удалении изображения, повторная попытка", "retry", retry+1, "error", err)
-				time.Sleep(time.Duration(retry+1) * 500 * time.Millisecond)
-				continue
-			}
-			return fmt.Errorf("ошибка выполнения запроса после %d попыток: %w", maxRetries, err)
-		}
-		break
+	// Повторные попытки выполняет общий клиент
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
-
 	defer resp.Body.Close()
 
 	// Проверяем статус ответа
@@ -247,35 +267,72 @@ func (s *ImageStorage) DeleteImage(ctx context.Context, bucketName, objectKey st
 	return nil
 }
 
+// objectList ответ хранилища на запрос списка объектов бакета
+type objectList struct {
+	XMLName xml.Name `xml:"Objects"`
+	Objects []struct {
+		ObjectKey    string `xml:"ObjectKey"`
+		Size         int64  `xml:"Size"`
+		LastModified string `xml:"LastModified"`
+	} `xml:"Object"`
+}
+
+// ListObjects возвращает список объектов бакета
+func (s *ImageStorage) ListObjects(ctx context.Context, bucketName string) ([]models.StoredObject, error) {
+	// Формируем URL списка объектов бакета
+	url := fmt.Sprintf("%s/%s", s.baseURL, bucketName)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания запроса: %w", err)
+	}
+
+	// Повторные попытки выполняет общий клиент
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка выполнения запроса: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("ошибка получения списка объектов: %s, статус: %d", string(body), resp.StatusCode)
+	}
+
+	var list objectList
+	if err := xml.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("ошибка разбора списка объектов: %w", err)
+	}
+
+	objects := make([]models.StoredObject, 0, len(list.Objects))
+	for _, item := range list.Objects {
+		object := models.StoredObject{Bucket: bucketName, Key: item.ObjectKey, Size: item.Size}
+		// Время без разбора остается нулевым, такие объекты сборщик не удаляет
+		if modified, err := time.Parse(time.RFC3339, item.LastModified); err == nil {
+			object.LastModified = modified
+		}
+		objects = append(objects, object)
+	}
+	return objects, nil
+}
+
 // createBucket создает бакет в S3-хранилище
-func (s *ImageStorage) createBucket(bucketName string) error {
+func (s *ImageStorage) createBucket(ctx context.Context, bucketName string) error {
 	// Формируем URL для создания бакета
 	url := fmt.Sprintf("%s/%s", s.baseURL, bucketName)
 	slog.Info("Создание бакета", "url", url)
 
 	// Создаем запрос на создание бакета
-	req, err := http.NewRequest(http.MethodPut, url, nil)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, url, nil)
 	if err != nil {
 		return fmt.Errorf("ошибка создания запроса: %w", err)
 	}
 
-	// Выполняем запрос с повторными попытками
-	var resp *http.Response
-	maxRetries := 3
-
-	for retry := 0; retry < maxRetries; retry++ {
-		resp, err = s.httpClient.Do(req)
-		if err != nil {
-			if retry < maxRetries-1 {
-				slog.Warn("Ошибка соединения при создании бакета, повторная попытка", "retry", retry+1, "error", err)
-				time.Sleep(time.Duration(retry+1) * 500 * time.Millisecond)
-				continue
-			}
-			return fmt.Errorf("ошибка выполнения запроса после %d попыток: %w", maxRetries, err)
-		}
-		break
+	// Повторные попытки выполняет общий клиент
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("ошибка выполнения запроса: %w", err)
 	}
-
 	defer resp.Body.Close()
 
 	// Статус 200 или 409 (уже существует) считаем успехом
@@ -288,21 +345,48 @@ func (s *ImageStorage) createBucket(bucketName string) error {
 	return nil
 }
 
-// GenerateObjectKey генерирует уникальный ключ для объекта
-func (s *ImageStorage) GenerateObjectKey(originalFilename string) string {
-	timestamp := time.Now().UnixNano()
-
-	// Получаем расширение файла
-	extension := filepath.Ext(originalFilename)
+// GenerateObjectKey возвращает ключ объекта по SHA-256 содержимого. Ключ не зависит
+// от времени загрузки, поэтому повторные загрузки и параллельные запросы не создают копий
+func (s *ImageStorage) GenerateObjectKey(data []byte, extension string) string {
 	if extension == "" {
 		// Если расширение отсутствует, используем .jpg по умолчанию
 		extension = ".jpg"
 	}
 
-	// Нормализуем расширение, приводя к нижнему регистру
-	extension = strings.ToLower(extension)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + strings.ToLower(extension)
+}
+
+// ObjectURL возвращает адрес объекта в хранилище. Адрес доступен только приложению,
+// браузер получает объекты по адресам из external.URLBuilder
+func (s *ImageStorage) ObjectURL(bucketName, objectKey string) string {
+	return fmt.Sprintf("%s/%s/%s", s.baseURL, bucketName, objectKey)
+}
+
+// detectContentType определяет тип файла по содержимому. Сниффер net/http
+// не знает SVG, поэтому очищенный SVG, который всегда начинается с <svg,
+// распознается отдельно. SVG с прологом или DOCTYPE остается текстом и отклоняется.
+// MP4 сниффер узнает только по бренду mp4*, а файлы isom, iso2 и avc1 встречаются чаще,
+// поэтому MP4 определяется по боксу ftyp в начале файла
+func detectContentType(data []byte) string {
+	fileType := http.DetectContentType(data)
+	if strings.HasPrefix(fileType, "text/") && bytes.HasPrefix(data, []byte("<svg")) {
+		return "image/svg+xml"
+	}
+	if len(data) >= 12 && string(data[4:8]) == "ftyp" {
+		return "video/mp4"
+	}
+	return fileType
+}
 
-	return fmt.Sprintf("%d%s", timestamp, extension)
+// allowedType сообщает, что тип файла входит в список разрешенных
+func (s *ImageStorage) allowedType(fileType string) bool {
+	for _, allowedType := range s.options.AllowedImageTypes {
+		if fileType == allowedType {
+			return true
+		}
+	}
+	return false
 }
 
 // ValidateImageData проверяет данные изображения
@@ -313,18 +397,10 @@ func (s *ImageStorage) ValidateImageData(data []byte) error {
 	}
 
 	// Проверяем тип файла
-	fileType := http.DetectContentType(data)
+	fileType := detectContentType(data)
 
 	// Проверяем, является ли тип файла разрешенным изображением
-	allowed := false
-	for _, allowedType := range s.options.AllowedImageTypes {
-		if fileType == allowedType {
-			allowed = true
-			break
-		}
-	}
-
-	if !allowed {
+	if !s.allowedType(fileType) {
 		return fmt.Errorf("неподдерживаемый тип файла: %s. Разрешены только изображения", fileType)
 	}
 
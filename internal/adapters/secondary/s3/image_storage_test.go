@@ -1,46 +1,47 @@
 package s3_test
 
 import (
+	"bytes"
 	"context"
-	"fmt"
-	"path/filepath"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
 	"time"
 
 	"1337b04rd/internal/adapters/secondary/s3"
+	"1337b04rd/internal/domain/models"
 )
 
-// TestGenerateObjectKey проверяет генерацию ключа объекта
+// TestGenerateObjectKey проверяет, что ключ объекта зависит только от содержимого и расширения
 func TestGenerateObjectKey(t *testing.T) {
 	// Создаем экземпляр хранилища
 	storage := &s3.ImageStorage{}
 
 	// Тестируем генерацию ключа для различных файлов
 	testCases := []struct {
-		filename     string
-		expectExtRaw string
+		data      string
+		extension string
+		expected  string
 	}{
-		{"test.jpg", ".jpg"},
-		{"image.png", ".png"},
-		{"document.pdf", ".pdf"},
-		{"noextension", ".jpg"}, // Должен использовать расширение по умолчанию
-		{"path/to/file.gif", ".gif"},
+		{"", ".png", "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855.png"},
+		{"abc", ".JPG", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad.jpg"},
+		{"abc", "", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad.jpg"}, // Должен использовать расширение по умолчанию
 	}
 
 	for _, tc := range testCases {
-		key := storage.GenerateObjectKey(tc.filename)
-
-		// Проверяем, что ключ не пустой
-		if key == "" {
-			t.Errorf("Пустой ключ для файла %s", tc.filename)
-			continue
+		key := storage.GenerateObjectKey([]byte(tc.data), tc.extension)
+		if key != tc.expected {
+			t.Errorf("Неверный ключ для %q%s: ожидалось %s, получено %s", tc.data, tc.extension, tc.expected, key)
 		}
+	}
 
-		// Проверяем, что ключ содержит ожидаемое расширение
-		if len(key) <= len(tc.expectExtRaw) || key[len(key)-len(tc.expectExtRaw):] != tc.expectExtRaw {
-			t.Errorf("Ключ %s не содержит ожидаемое расширение %s для файла %s", key, tc.expectExtRaw, tc.filename)
-		}
+	// Разное содержимое дает разные ключи
+	if storage.GenerateObjectKey([]byte("a"), ".png") == storage.GenerateObjectKey([]byte("b"), ".png") {
+		t.Errorf("Разное содержимое получило одинаковый ключ")
 	}
 }
 
@@ -52,7 +53,7 @@ func TestImageStorageMock(t *testing.T) {
 	}
 
 	// Проверяем генерацию ключа объекта
-	key := storage.GenerateObjectKey("test.jpg")
+	key := storage.GenerateObjectKey([]byte("test image data"), ".jpg")
 	if !strings.HasSuffix(key, ".jpg") {
 		t.Errorf("Неверный формат ключа: %s", key)
 	}
@@ -60,7 +61,7 @@ func TestImageStorageMock(t *testing.T) {
 	// Тестируем загрузку изображения
 	ctx := context.Background()
 	imageData := []byte("test image data")
-	imageURL, err := storage.UploadImage(ctx, "test-bucket", "test-object.jpg", imageData)
+	imageURL, err := storage.UploadImage(ctx, "test-bucket", "test-object.jpg", bytes.NewReader(imageData), int64(len(imageData)))
 	if err != nil {
 		t.Fatalf("Ошибка при загрузке изображения: %v", err)
 	}
@@ -84,6 +85,128 @@ func TestImageStorageMock(t *testing.T) {
 	}
 }
 
+// TestListObjects проверяет разбор списка объектов бакета
+func TestListObjects(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet || r.URL.Path != "/posts" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write([]byte(`<Objects><Object><ObjectKey>abc.jpg</ObjectKey><Size>0</Size>` +
+			`<ContentType>image/jpeg</ContentType><LastModified>2025-05-08T15:01:54Z</LastModified></Object>` +
+			`<Object><ObjectKey>def.png</ObjectKey><Size>0</Size><ContentType>image/png</ContentType>` +
+			`<LastModified>вчера</LastModified></Object></Objects>`))
+	}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("S3_HOST", host)
+	t.Setenv("S3_PORT", port)
+	storage := s3.NewImageStorage()
+
+	objects, err := storage.ListObjects(context.Background(), "posts")
+	if err != nil {
+		t.Fatalf("Ошибка получения списка объектов: %v", err)
+	}
+	if len(objects) != 2 {
+		t.Fatalf("Ожидалось 2 объекта, получено %d", len(objects))
+	}
+	if objects[0].Bucket != "posts" || objects[0].Key != "abc.jpg" {
+		t.Errorf("Неверный объект: %+v", objects[0])
+	}
+	if want := time.Date(2025, 5, 8, 15, 1, 54, 0, time.UTC); !objects[0].LastModified.Equal(want) {
+		t.Errorf("Неверное время изменения: %v", objects[0].LastModified)
+	}
+	if !objects[1].LastModified.IsZero() {
+		t.Errorf("Неразобранное время должно быть нулевым: %v", objects[1].LastModified)
+	}
+
+	if _, err := storage.ListObjects(context.Background(), "missing"); err == nil {
+		t.Error("Ожидалась ошибка для отсутствующего бакета")
+	}
+}
+
+// TestUploadImageStreams проверяет потоковую загрузку, определение типа и ограничение размера
+func TestUploadImageStreams(t *testing.T) {
+	var received []byte
+	var contentType string
+	var contentLength int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/posts" {
+			// Создание бакета
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received, contentType, contentLength = data, r.Header.Get("Content-Type"), r.ContentLength
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("S3_HOST", host)
+	t.Setenv("S3_PORT", port)
+	storage := s3.NewImageStorage()
+	ctx := context.Background()
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 2000)...)
+
+	// Поток неизвестной длины без Seek отправляется частями
+	stream := io.MultiReader(bytes.NewReader(png[:100]), bytes.NewReader(png[100:]))
+	if _, err := storage.UploadImage(ctx, "posts", "a.png", stream, -1); err != nil {
+		t.Fatalf("Ошибка загрузки потока: %v", err)
+	}
+	if !bytes.Equal(received, png) || contentType != "image/png" || contentLength != -1 {
+		t.Errorf("Неверная загрузка: %d байт, тип %q, длина %d", len(received), contentType, contentLength)
+	}
+
+	// Известная длина передается в Content-Length
+	if _, err := storage.UploadImage(ctx, "posts", "b.png", bytes.NewReader(png), int64(len(png))); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if !bytes.Equal(received, png) || contentLength != int64(len(png)) {
+		t.Errorf("Неверная загрузка: %d байт, длина %d", len(received), contentLength)
+	}
+
+	// MP4 с брендом isom определяется по боксу ftyp
+	mp4 := append([]byte("\x00\x00\x00\x18ftypisom\x00\x00\x02\x00isomiso2"), bytes.Repeat([]byte{0}, 100)...)
+	if _, err := storage.UploadImage(ctx, "posts", "f.mp4", bytes.NewReader(mp4), int64(len(mp4))); err != nil {
+		t.Fatalf("Ошибка загрузки видео: %v", err)
+	}
+	if contentType != "video/mp4" {
+		t.Errorf("Неверный тип видео: %q", contentType)
+	}
+
+	// Неразрешенный тип отклоняется до отправки
+	received = nil
+	if _, err := storage.UploadImage(ctx, "posts", "c.html", strings.NewReader("<html></html>"), -1); err == nil || received != nil {
+		t.Error("Ожидалась ошибка для HTML")
+	}
+
+	// Слишком длинный поток обрывается с ErrFileTooLarge
+	large := io.MultiReader(bytes.NewReader(png), io.LimitReader(zeroReader{}, s3.MaxFileSize))
+	if _, err := storage.UploadImage(ctx, "posts", "d.png", large, -1); !errors.Is(err, s3.ErrFileTooLarge) {
+		t.Errorf("Ожидалась ErrFileTooLarge, получено %v", err)
+	}
+	if _, err := storage.UploadImage(ctx, "posts", "e.png", bytes.NewReader(png), s3.MaxFileSize+1); !errors.Is(err, s3.ErrFileTooLarge) {
+		t.Errorf("Ожидалась ErrFileTooLarge для известной длины, получено %v", err)
+	}
+}
+
+// zeroReader бесконечный поток нулевых байт
+type zeroReader struct{}
+
+// Read заполняет p нулями
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
 // MockImageStorage - мок для тестирования без сетевых запросов
 type MockImageStorage struct {
 	baseURL string
@@ -91,7 +214,12 @@ type MockImageStorage struct {
 }
 
 // UploadImage загружает изображение (мок-версия)
-func (s *MockImageStorage) UploadImage(_ context.Context, bucketName, objectKey string, data []byte) (string, error) {
+func (s *MockImageStorage) UploadImage(_ context.Context, bucketName, objectKey string, body io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+
 	// Инициализируем карту при первом использовании
 	if s.objects == nil {
 		s.objects = make(map[string][]byte)
@@ -123,14 +251,61 @@ func (s *MockImageStorage) DeleteImage(_ context.Context, bucketName, objectKey
 	return nil
 }
 
-// GenerateObjectKey генерирует уникальный ключ для объекта (такой же как в ImageStorage)
-func (s *MockImageStorage) GenerateObjectKey(originalFilename string) string {
-	timestamp := time.Now().UnixNano()
-	extension := filepath.Ext(originalFilename)
-	if extension == "" {
-		extension = ".jpg" // Расширение по умолчанию
+// ListObjects возвращает объекты бакета (мок-версия)
+func (s *MockImageStorage) ListObjects(_ context.Context, bucketName string) ([]models.StoredObject, error) {
+	var objects []models.StoredObject
+	for key, data := range s.objects {
+		if objectKey, ok := strings.CutPrefix(key, bucketName+"/"); ok {
+			objects = append(objects, models.StoredObject{Bucket: bucketName, Key: objectKey, Size: int64(len(data))})
+		}
+	}
+	return objects, nil
+}
+
+// GenerateObjectKey генерирует ключ объекта по содержимому (такой же как в ImageStorage)
+func (s *MockImageStorage) GenerateObjectKey(data []byte, extension string) string {
+	return (&s3.ImageStorage{}).GenerateObjectKey(data, extension)
+}
+
+// ObjectURL возвращает адрес объекта (мок-версия)
+func (s *MockImageStorage) ObjectURL(bucketName, objectKey string) string {
+	return s.baseURL + "/" + bucketName + "/" + objectKey
+}
+
+// TestUploadImageRetryResendsBody проверяет, что повторная загрузка после ошибки
+// хранилища отправляет файл целиком, а не пустое тело
+func TestUploadImageRetryResendsBody(t *testing.T) {
+	var puts int
+	var received []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/posts" {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		puts++
+		if puts == 1 {
+			// Первая загрузка получает ответ о временной недоступности
+			io.ReadAll(r.Body)
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		received, _ = io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	host, port, _ := net.SplitHostPort(strings.TrimPrefix(server.URL, "http://"))
+	t.Setenv("S3_HOST", host)
+	t.Setenv("S3_PORT", port)
+	storage := s3.NewImageStorage()
+
+	png := append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{1}, 2000)...)
+	if _, err := storage.UploadImage(context.Background(), "posts", "a.png", bytes.NewReader(png), int64(len(png))); err != nil {
+		t.Fatalf("Ошибка загрузки: %v", err)
+	}
+	if puts != 2 || !bytes.Equal(received, png) {
+		t.Errorf("Ожидался повтор с полным телом: попыток %d, получено %d байт", puts, len(received))
 	}
-	return fmt.Sprintf("%d%s", timestamp, extension)
 }
 
 // TestGetImageStorage проверяет получение глобального хранилища
@@ -0,0 +1,275 @@
+package video
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"1337b04rd/internal/domain/models"
+)
+
+const (
+	// maxBoxHeader наибольший размер читаемых в память служебных боксов mvhd, mehd, hdlr и stsd
+	maxBoxHeader = 4096
+
+	// maxBoxes наибольшее число боксов на одном уровне. Ограничивает разбор
+	// фрагментированных файлов из множества мелких фрагментов
+	maxBoxes = 100000
+)
+
+// errStop прекращает обход боксов, когда нужные данные уже прочитаны
+var errStop = errors.New("обход завершен")
+
+// mp4Track сведения о дорожке из боксов hdlr и stsd
+type mp4Track struct {
+	handler string
+	codec   string
+	width   int
+	height  int
+}
+
+// mp4Probe состояние разбора бокса moov
+type mp4Probe struct {
+	src              io.ReadSeeker
+	timescale        uint32
+	duration         uint64
+	fragmentDuration uint64
+	tracks           []*mp4Track
+}
+
+// probeMP4 находит бокс moov (он может идти и до, и после mdat) и читает из него
+// длительность (mvhd, для фрагментированных файлов mehd), обработчики дорожек (hdlr)
+// и описания кодеков (stsd). Данные кадров не читаются
+func probeMP4(src io.ReadSeeker) (*models.VideoInfo, error) {
+	end, err := src.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+
+	probe := &mp4Probe{src: src}
+	found := false
+	err = probe.walk(0, end, func(boxType string, start, stop int64) error {
+		if boxType != "moov" {
+			return nil
+		}
+		found = true
+		if err := probe.walk(start, stop, probe.moov); err != nil {
+			return err
+		}
+		return errStop
+	})
+	if err != nil && err != errStop {
+		return nil, err
+	}
+	if !found {
+		return nil, errors.New("нет бокса moov")
+	}
+	if probe.timescale == 0 {
+		return nil, errMalformed
+	}
+
+	info := &models.VideoInfo{Container: "mp4", ContentType: "video/mp4", Extension: ".mp4"}
+	for _, track := range probe.tracks {
+		switch {
+		case track.handler == "vide" && info.VideoCodec == "":
+			info.VideoCodec, info.Width, info.Height = track.codec, track.width, track.height
+		case track.handler == "soun" && info.AudioCodec == "":
+			info.AudioCodec = track.codec
+		}
+	}
+	if err := checkCodecs(info, mp4VideoCodecs, mp4AudioCodecs); err != nil {
+		return nil, err
+	}
+
+	duration := probe.duration
+	if duration == 0 {
+		duration = probe.fragmentDuration
+	}
+	info.Duration = floatDuration(float64(duration) / float64(probe.timescale) * 1e9)
+	return info, nil
+}
+
+// moov разбирает дочерние боксы moov
+func (p *mp4Probe) moov(boxType string, start, stop int64) error {
+	switch boxType {
+	case "mvhd":
+		data, err := p.read(start, min(stop, start+maxBoxHeader))
+		if err != nil {
+			return err
+		}
+		return p.movieHeader(data)
+	case "mvex":
+		return p.walk(start, stop, func(boxType string, start, stop int64) error {
+			if boxType != "mehd" {
+				return nil
+			}
+			data, err := p.read(start, min(stop, start+maxBoxHeader))
+			if err != nil {
+				return err
+			}
+			p.fragmentDuration = fullBoxValue(data, 4)
+			return nil
+		})
+	case "trak":
+		track := &mp4Track{}
+		p.tracks = append(p.tracks, track)
+		return p.walk(start, stop, func(boxType string, start, stop int64) error {
+			if boxType != "mdia" {
+				return nil
+			}
+			return p.media(track, start, stop)
+		})
+	}
+	return nil
+}
+
+// movieHeader читает timescale и duration из mvhd версии 0 или 1
+func (p *mp4Probe) movieHeader(data []byte) error {
+	if len(data) < 4 {
+		return errMalformed
+	}
+	switch data[0] {
+	case 0:
+		if len(data) < 20 {
+			return errMalformed
+		}
+		p.timescale = binary.BigEndian.Uint32(data[12:16])
+		p.duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+		// Все единицы означают неизвестную длительность
+		if p.duration == math.MaxUint32 {
+			p.duration = 0
+		}
+	case 1:
+		if len(data) < 32 {
+			return errMalformed
+		}
+		p.timescale = binary.BigEndian.Uint32(data[20:24])
+		p.duration = binary.BigEndian.Uint64(data[24:32])
+		if p.duration == math.MaxUint64 {
+			p.duration = 0
+		}
+	default:
+		return errMalformed
+	}
+	return nil
+}
+
+// media разбирает mdia: тип дорожки из hdlr и первое описание кодека из minf/stbl/stsd
+func (p *mp4Probe) media(track *mp4Track, start, stop int64) error {
+	return p.walk(start, stop, func(boxType string, start, stop int64) error {
+		switch boxType {
+		case "hdlr":
+			data, err := p.read(start, min(stop, start+maxBoxHeader))
+			if err != nil {
+				return err
+			}
+			if len(data) < 12 {
+				return errMalformed
+			}
+			track.handler = string(data[8:12])
+		case "minf", "stbl":
+			return p.media(track, start, stop)
+		case "stsd":
+			data, err := p.read(start, min(stop, start+maxBoxHeader))
+			if err != nil {
+				return err
+			}
+			return sampleDescription(track, data)
+		}
+		return nil
+	})
+}
+
+// sampleDescription читает код кодека первой записи stsd. У видеозаписей
+// (VisualSampleEntry) размеры кадра идут после 24 байт служебных полей
+func sampleDescription(track *mp4Track, data []byte) error {
+	// Версия и флаги, число записей, размер и тип первой записи
+	if len(data) < 16 || binary.BigEndian.Uint32(data[4:8]) == 0 {
+		return errMalformed
+	}
+	track.codec = string(data[12:16])
+	if track.handler == "vide" {
+		if len(data) < 44 {
+			return errMalformed
+		}
+		track.width = int(binary.BigEndian.Uint16(data[40:42]))
+		track.height = int(binary.BigEndian.Uint16(data[42:44]))
+	}
+	return nil
+}
+
+// fullBoxValue читает поле длиной 4 байта для версии 0 или 8 байт для версии 1,
+// которое идет в полном боксе со смещения offset
+func fullBoxValue(data []byte, offset int) uint64 {
+	if len(data) < 4 {
+		return 0
+	}
+	if data[0] == 1 {
+		if len(data) < offset+8 {
+			return 0
+		}
+		return binary.BigEndian.Uint64(data[offset : offset+8])
+	}
+	if len(data) < offset+4 {
+		return 0
+	}
+	return uint64(binary.BigEndian.Uint32(data[offset : offset+4]))
+}
+
+// walk обходит боксы в диапазоне [start, stop) и вызывает fn с диапазоном данных каждого бокса
+func (p *mp4Probe) walk(start, stop int64, fn func(boxType string, start, stop int64) error) error {
+	for pos, count := start, 0; pos < stop; count++ {
+		if count >= maxBoxes || stop-pos < 8 {
+			return errMalformed
+		}
+		header, err := p.read(pos, pos+8)
+		if err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(header[:4]))
+		boxType := string(header[4:8])
+		headerSize := int64(8)
+
+		switch size {
+		case 0:
+			// Бокс до конца файла
+			size = stop - pos
+		case 1:
+			// Размер в 64-битном поле после типа
+			large, err := p.read(pos+8, pos+16)
+			if err != nil {
+				return err
+			}
+			largeSize := binary.BigEndian.Uint64(large)
+			if largeSize > math.MaxInt64 {
+				return errMalformed
+			}
+			size, headerSize = int64(largeSize), 16
+		}
+		if size < headerSize || size > stop-pos {
+			return errMalformed
+		}
+
+		if err := fn(boxType, pos+headerSize, pos+size); err != nil {
+			return err
+		}
+		pos += size
+	}
+	return nil
+}
+
+// read читает данные в диапазоне [start, stop), не больше maxBoxHeader байт
+func (p *mp4Probe) read(start, stop int64) ([]byte, error) {
+	if stop < start || stop-start > maxBoxHeader {
+		return nil, errMalformed
+	}
+	if _, err := p.src.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+	data := make([]byte, stop-start)
+	if _, err := io.ReadFull(p.src, data); err != nil {
+		return nil, noEOF(err)
+	}
+	return data, nil
+}
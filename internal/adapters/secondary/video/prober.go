@@ -0,0 +1,83 @@
+package video
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+)
+
+// MaxPixels наибольшая площадь кадра, 4K UHD
+const MaxPixels = 3840 * 2160
+
+// errMalformed возвращается парсерами для контейнеров с нарушенной структурой
+var errMalformed = errors.New("поврежденный контейнер")
+
+// Кодеки, которые воспроизводятся в распространенных браузерах
+var (
+	webmVideoCodecs = map[string]bool{"V_VP8": true, "V_VP9": true, "V_AV1": true}
+	webmAudioCodecs = map[string]bool{"A_VORBIS": true, "A_OPUS": true}
+	mp4VideoCodecs  = map[string]bool{"avc1": true, "avc3": true, "av01": true, "vp09": true}
+	mp4AudioCodecs  = map[string]bool{"mp4a": true, "Opus": true}
+)
+
+// Prober читает заголовки WebM (EBML) и MP4 (ISO-BMFF) без декодирования кадров
+type Prober struct {
+	maxPixels int
+}
+
+// NewProber создает новый обработчик видеоконтейнеров
+func NewProber() *Prober {
+	return &Prober{maxPixels: MaxPixels}
+}
+
+// Probe определяет контейнер по сигнатуре и читает из него длительность,
+// размеры кадра и кодеки. Файлы без сигнатуры WebM или MP4 возвращаются
+// с external.ErrNotVideo, видео с неподдерживаемыми кодеками
+// и поврежденные контейнеры - с external.ErrUnsupportedVideo
+func (p *Prober) Probe(src io.ReadSeeker) (*models.VideoInfo, error) {
+	signature := make([]byte, 12)
+	n, err := io.ReadFull(src, signature)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, fmt.Errorf("ошибка чтения видео: %w", err)
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("ошибка чтения видео: %w", err)
+	}
+	signature = signature[:n]
+
+	var info *models.VideoInfo
+	switch {
+	case bytes.HasPrefix(signature, ebmlMagic):
+		info, err = probeWebM(src)
+	case len(signature) >= 8 && string(signature[4:8]) == "ftyp":
+		info, err = probeMP4(src)
+	default:
+		return nil, external.ErrNotVideo
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", external.ErrUnsupportedVideo, err)
+	}
+
+	if info.Width <= 0 || info.Height <= 0 || info.Width*info.Height > p.maxPixels {
+		return nil, fmt.Errorf("%w: размер кадра %dx%d", external.ErrUnsupportedVideo, info.Width, info.Height)
+	}
+	return info, nil
+}
+
+// checkCodecs проверяет кодеки дорожек по списку разрешенных
+func checkCodecs(info *models.VideoInfo, videoCodecs, audioCodecs map[string]bool) error {
+	if info.VideoCodec == "" {
+		return errors.New("нет видеодорожки")
+	}
+	if !videoCodecs[info.VideoCodec] {
+		return fmt.Errorf("видеокодек %s не поддерживается", info.VideoCodec)
+	}
+	if info.AudioCodec != "" && !audioCodecs[info.AudioCodec] {
+		return fmt.Errorf("аудиокодек %s не поддерживается", info.AudioCodec)
+	}
+	return nil
+}
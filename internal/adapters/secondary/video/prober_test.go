@@ -0,0 +1,192 @@
+package video_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/video"
+	"1337b04rd/internal/ports/external"
+)
+
+// ebml кодирует элемент EBML с 8-байтовым размером. size < 0 записывает неизвестный размер
+func ebml(id uint32, size int, children ...[]byte) []byte {
+	var buf bytes.Buffer
+	idBytes := binary.BigEndian.AppendUint32(nil, id)
+	buf.Write(bytes.TrimLeft(idBytes, "\x00"))
+
+	body := bytes.Join(children, nil)
+	if size >= 0 {
+		size = len(body)
+	}
+	if size < 0 {
+		buf.Write([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+	} else {
+		buf.WriteByte(0x01)
+		buf.Write(binary.BigEndian.AppendUint64(nil, uint64(size))[1:])
+	}
+	buf.Write(body)
+	return buf.Bytes()
+}
+
+func ebmlUint(id uint32, value uint64) []byte {
+	return ebml(id, 0, binary.BigEndian.AppendUint64(nil, value))
+}
+
+func ebmlString(id uint32, value string) []byte {
+	return ebml(id, 0, []byte(value))
+}
+
+func ebmlFloat(id uint32, value float64) []byte {
+	return ebml(id, 0, binary.BigEndian.AppendUint64(nil, math.Float64bits(value)))
+}
+
+// webm собирает WebM из заголовка EBML, сегмента неизвестного размера и его элементов
+func webm(docType string, segment ...[]byte) []byte {
+	header := ebml(0x1A45DFA3, 0, ebmlUint(0x4286, 1), ebmlString(0x4282, docType))
+	return append(header, ebml(0x18538067, -1, segment...)...)
+}
+
+// webmTracks описывает видеодорожку и, если audio не пустой, аудиодорожку
+func webmTracks(videoCodec, audioCodec string, width, height uint64) []byte {
+	tracks := [][]byte{ebml(0xAE, 0,
+		ebmlUint(0xD7, 1), ebmlUint(0x83, 1), ebmlString(0x86, videoCodec),
+		ebml(0xE0, 0, ebmlUint(0xB0, width), ebmlUint(0xBA, height)))}
+	if audioCodec != "" {
+		tracks = append(tracks, ebml(0xAE, 0, ebmlUint(0xD7, 2), ebmlUint(0x83, 2), ebmlString(0x86, audioCodec)))
+	}
+	return ebml(0x1654AE6B, 0, tracks...)
+}
+
+// simpleBlock кодирует блок дорожки 1 со смещением метки времени offset
+func simpleBlock(offset int16) []byte {
+	return ebml(0xA3, 0, []byte{0x81, byte(uint16(offset) >> 8), byte(offset), 0x80, 0xDE, 0xAD})
+}
+
+// box кодирует бокс ISO-BMFF
+func box(boxType string, children ...[]byte) []byte {
+	body := bytes.Join(children, nil)
+	header := binary.BigEndian.AppendUint32(nil, uint32(8+len(body)))
+	return append(append(header, boxType...), body...)
+}
+
+// mp4 собирает MP4 с боксом moov после mdat, как пишут камеры без faststart
+func mp4(videoCodec string, width, height uint16, timescale, duration uint32) []byte {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], timescale)
+	binary.BigEndian.PutUint32(mvhd[16:], duration)
+
+	track := func(handler, codec string, entry []byte) []byte {
+		hdlr := append(make([]byte, 8), handler...)
+		hdlr = append(hdlr, make([]byte, 13)...)
+		stsd := binary.BigEndian.AppendUint32(make([]byte, 4), 1)
+		stsd = append(stsd, box(codec, entry)...)
+		return box("trak", box("tkhd", make([]byte, 84)),
+			box("mdia", box("mdhd", make([]byte, 24)), box("hdlr", hdlr),
+				box("minf", box("stbl", box("stsd", stsd), box("stts", make([]byte, 8))))))
+	}
+	visual := make([]byte, 70)
+	binary.BigEndian.PutUint16(visual[24:], width)
+	binary.BigEndian.PutUint16(visual[26:], height)
+
+	return bytes.Join([][]byte{
+		box("ftyp", []byte("isom\x00\x00\x02\x00isomiso2avc1mp41")),
+		box("mdat", make([]byte, 4096)),
+		box("moov", box("mvhd", mvhd), track("vide", videoCodec, visual), track("soun", "mp4a", make([]byte, 28))),
+	}, nil)
+}
+
+// TestProbe проверяет чтение заголовков WebM и MP4 и отказ для неподдерживаемых файлов
+func TestProbe(t *testing.T) {
+	cluster := func(timecode uint64, blocks ...[]byte) []byte {
+		return ebml(0x1F43B675, -1, append([][]byte{ebmlUint(0xE7, timecode)}, blocks...)...)
+	}
+
+	tests := []struct {
+		name     string
+		data     []byte
+		err      error
+		codecs   string
+		width    int
+		height   int
+		duration time.Duration
+	}{
+		{
+			name: "WebM с длительностью в Info",
+			data: webm("webm",
+				ebml(0x1549A966, 0, ebmlUint(0x2AD7B1, 1000000), ebmlFloat(0x4489, 1500)),
+				webmTracks("V_VP9", "A_OPUS", 640, 360),
+				cluster(0, simpleBlock(0))),
+			codecs: "V_VP9+A_OPUS", width: 640, height: 360, duration: 1500 * time.Millisecond,
+		},
+		{
+			name: "WebM из MediaRecorder без длительности",
+			data: webm("webm",
+				ebml(0x1549A966, 0, ebmlUint(0x2AD7B1, 1000000)),
+				webmTracks("V_VP8", "", 320, 240),
+				cluster(0, simpleBlock(0), simpleBlock(1000)),
+				cluster(2000, simpleBlock(100), ebml(0xA0, 0, ebml(0xA1, 0, []byte{0x81, 0x01, 0xF4, 0x00})))),
+			codecs: "V_VP8+", width: 320, height: 240, duration: 2500 * time.Millisecond,
+		},
+		{
+			name:   "MP4 с moov в конце файла",
+			data:   mp4("avc1", 1280, 720, 1000, 3000),
+			codecs: "avc1+mp4a", width: 1280, height: 720, duration: 3 * time.Second,
+		},
+		{
+			name: "WebM с H.264",
+			data: webm("webm", webmTracks("V_MPEG4/ISO/AVC", "", 640, 360)),
+			err:  external.ErrUnsupportedVideo,
+		},
+		{
+			name: "Matroska вместо WebM",
+			data: webm("matroska", webmTracks("V_VP9", "", 640, 360)),
+			err:  external.ErrUnsupportedVideo,
+		},
+		{
+			name: "MP4 с HEVC",
+			data: mp4("hvc1", 1280, 720, 1000, 3000),
+			err:  external.ErrUnsupportedVideo,
+		},
+		{
+			name: "Кадр больше 4K",
+			data: mp4("avc1", 8000, 8000, 1000, 3000),
+			err:  external.ErrUnsupportedVideo,
+		},
+		{
+			name: "Обрезанный WebM",
+			data: webm("webm", webmTracks("V_VP9", "", 640, 360))[:60],
+			err:  external.ErrUnsupportedVideo,
+		},
+		{
+			name: "Изображение",
+			data: []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"),
+			err:  external.ErrNotVideo,
+		},
+	}
+
+	prober := video.NewProber()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := prober.Probe(bytes.NewReader(tt.data))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("Ожидалась ошибка %v, получено %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Ошибка чтения видео: %v", err)
+			}
+			if codecs := info.VideoCodec + "+" + info.AudioCodec; codecs != tt.codecs {
+				t.Errorf("Неверные кодеки: %s, ожидалось %s", codecs, tt.codecs)
+			}
+			if info.Width != tt.width || info.Height != tt.height || info.Duration != tt.duration {
+				t.Errorf("Неверные сведения о видео: %+v", info)
+			}
+		})
+	}
+}
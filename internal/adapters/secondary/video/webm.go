@@ -0,0 +1,388 @@
+package video
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ebmlMagic ID заголовка EBML, с которого начинается файл WebM
+var ebmlMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+// ID элементов Matroska, которые читает парсер
+const (
+	idEBML          = 0x1A45DFA3
+	idDocType       = 0x4282
+	idSegment       = 0x18538067
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idTracks        = 0x1654AE6B
+	idTrackEntry    = 0xAE
+	idTrackType     = 0x83
+	idCodecID       = 0x86
+	idVideo         = 0xE0
+	idPixelWidth    = 0xB0
+	idPixelHeight   = 0xBA
+	idCluster       = 0x1F43B675
+	idTimecode      = 0xE7
+	idBlockGroup    = 0xA0
+	idBlock         = 0xA1
+	idSimpleBlock   = 0xA3
+)
+
+const (
+	// Типы дорожек TrackType
+	trackVideo = 1
+	trackAudio = 2
+
+	// defaultTimecodeScale единица времени сегмента по умолчанию, 1 мс
+	defaultTimecodeScale = 1000000
+
+	// maxHeaderElement наибольший размер элементов Info и Tracks, которые читаются в память
+	maxHeaderElement = 1 << 20
+)
+
+// unknownSize размер элемента, записанного потоком без известной длины
+const unknownSize = math.MaxUint64
+
+// ebmlElement заголовок элемента EBML: ID вместе с маркером длины и размер данных
+type ebmlElement struct {
+	id   uint64
+	size uint64
+}
+
+// webmProbe состояние разбора сегмента
+type webmProbe struct {
+	info          models.VideoInfo
+	timecodeScale uint64
+	duration      float64
+	hasTracks     bool
+	// clusterTime и lastBlock используются, если в Info нет длительности
+	clusterTime uint64
+	lastBlock   int64
+}
+
+// probeWebM читает заголовок EBML, элементы Info и Tracks сегмента. Если в Info
+// нет длительности (так пишет MediaRecorder), она считается по меткам времени блоков
+func probeWebM(src io.ReadSeeker) (*models.VideoInfo, error) {
+	header, err := readElement(src)
+	if err != nil || header.id != idEBML || header.size > 1024 {
+		return nil, errMalformed
+	}
+	body, err := readBody(src, header.size)
+	if err != nil {
+		return nil, err
+	}
+	var docType string
+	err = eachChild(body, func(id uint64, data []byte) error {
+		if id == idDocType {
+			docType = string(bytes.TrimRight(data, "\x00"))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if docType != "webm" {
+		return nil, fmt.Errorf("тип документа %q вместо webm", docType)
+	}
+
+	probe := &webmProbe{
+		info:          models.VideoInfo{Container: "webm", ContentType: "video/webm", Extension: ".webm"},
+		timecodeScale: defaultTimecodeScale,
+		lastBlock:     -1,
+	}
+	if err := probe.scan(src); err != nil {
+		return nil, err
+	}
+	if !probe.hasTracks {
+		return nil, errors.New("нет описания дорожек")
+	}
+	if err := checkCodecs(&probe.info, webmVideoCodecs, webmAudioCodecs); err != nil {
+		return nil, err
+	}
+
+	scale := float64(probe.timecodeScale)
+	switch {
+	case probe.duration > 0:
+		probe.info.Duration = floatDuration(probe.duration * scale)
+	case probe.lastBlock > 0:
+		probe.info.Duration = floatDuration(float64(probe.lastBlock) * scale)
+	}
+	return &probe.info, nil
+}
+
+// scan последовательно читает элементы сегмента. Segment, Cluster и BlockGroup
+// не пропускаются, а читаются вместе с содержимым: у записанных потоком файлов
+// их размер неизвестен. ID элементов разных уровней в Matroska не совпадают,
+// поэтому уровень вложенности отслеживать не нужно
+func (p *webmProbe) scan(src io.ReadSeeker) error {
+	for {
+		element, err := readElement(src)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		switch element.id {
+		case idSegment, idBlockGroup:
+			continue
+		case idCluster:
+			// Длительность и дорожки уже известны, блоки читать не нужно
+			if p.duration > 0 && p.hasTracks {
+				return nil
+			}
+			continue
+		}
+
+		if element.size == unknownSize {
+			return errMalformed
+		}
+		switch element.id {
+		case idInfo, idTracks:
+			if element.size > maxHeaderElement {
+				return errMalformed
+			}
+			body, err := readBody(src, element.size)
+			if err != nil {
+				return err
+			}
+			if element.id == idInfo {
+				err = p.parseInfo(body)
+			} else {
+				err = p.parseTracks(body)
+			}
+			if err != nil {
+				return err
+			}
+		case idTimecode:
+			body, err := readBody(src, element.size)
+			if err != nil {
+				return err
+			}
+			p.clusterTime = readUint(body)
+		case idSimpleBlock, idBlock:
+			if err := p.readBlock(src, element.size); err != nil {
+				return err
+			}
+		default:
+			if _, err := src.Seek(int64(element.size), io.SeekCurrent); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// parseInfo читает единицу времени и длительность сегмента
+func (p *webmProbe) parseInfo(body []byte) error {
+	return eachChild(body, func(id uint64, data []byte) error {
+		switch id {
+		case idTimecodeScale:
+			if scale := readUint(data); scale > 0 {
+				p.timecodeScale = scale
+			}
+		case idDuration:
+			duration, err := readFloat(data)
+			if err != nil {
+				return err
+			}
+			p.duration = duration
+		}
+		return nil
+	})
+}
+
+// parseTracks берет кодек и размеры первой видеодорожки и кодек первой аудиодорожки
+func (p *webmProbe) parseTracks(body []byte) error {
+	p.hasTracks = true
+	return eachChild(body, func(id uint64, entry []byte) error {
+		if id != idTrackEntry {
+			return nil
+		}
+
+		var trackType uint64
+		var codec string
+		var width, height uint64
+		err := eachChild(entry, func(id uint64, data []byte) error {
+			switch id {
+			case idTrackType:
+				trackType = readUint(data)
+			case idCodecID:
+				codec = string(bytes.TrimRight(data, "\x00"))
+			case idVideo:
+				return eachChild(data, func(id uint64, data []byte) error {
+					switch id {
+					case idPixelWidth:
+						width = readUint(data)
+					case idPixelHeight:
+						height = readUint(data)
+					}
+					return nil
+				})
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case trackType == trackVideo && p.info.VideoCodec == "":
+			p.info.VideoCodec = codec
+			p.info.Width, p.info.Height = int(min(width, math.MaxInt32)), int(min(height, math.MaxInt32))
+		case trackType == trackAudio && p.info.AudioCodec == "":
+			p.info.AudioCodec = codec
+		}
+		return nil
+	})
+}
+
+// readBlock читает метку времени блока относительно кластера и пропускает кадр
+func (p *webmProbe) readBlock(src io.ReadSeeker, size uint64) error {
+	// Номер дорожки занимает от 1 до 8 байт, за ним 2 байта метки времени
+	_, _, n, err := readVint(src, 8, false)
+	if err != nil {
+		return noEOF(err)
+	}
+	var offset [2]byte
+	if uint64(n)+2 > size {
+		return errMalformed
+	}
+	if _, err := io.ReadFull(src, offset[:]); err != nil {
+		return noEOF(err)
+	}
+	timestamp := int64(p.clusterTime) + int64(int16(binary.BigEndian.Uint16(offset[:])))
+	p.lastBlock = max(p.lastBlock, timestamp)
+
+	_, err = src.Seek(int64(size)-int64(n)-2, io.SeekCurrent)
+	return err
+}
+
+// readElement читает заголовок элемента
+func readElement(r io.Reader) (ebmlElement, error) {
+	id, _, _, err := readVint(r, 4, true)
+	if err != nil {
+		return ebmlElement{}, err
+	}
+	size, unknown, _, err := readVint(r, 8, false)
+	if err != nil {
+		return ebmlElement{}, noEOF(err)
+	}
+	if unknown {
+		size = unknownSize
+	}
+	return ebmlElement{id: id, size: size}, nil
+}
+
+// readVint читает целое переменной длины EBML: число ведущих нулей первого байта
+// задает длину. ID хранится вместе с маркером длины, размер без него.
+// Значение из одних единиц означает неизвестный размер
+func readVint(r io.Reader, maxLength int, keepMarker bool) (value uint64, unknown bool, length int, err error) {
+	var buf [8]byte
+	if _, err := io.ReadFull(r, buf[:1]); err != nil {
+		return 0, false, 0, err
+	}
+	length = bits.LeadingZeros8(buf[0]) + 1
+	if length > maxLength {
+		return 0, false, 0, errMalformed
+	}
+	if _, err := io.ReadFull(r, buf[1:length]); err != nil {
+		return 0, false, 0, noEOF(err)
+	}
+
+	value = uint64(buf[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	for _, b := range buf[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	unknown = !keepMarker && value == 1<<(7*length)-1
+	return value, unknown, length, nil
+}
+
+// readBody читает данные элемента известного размера
+func readBody(r io.Reader, size uint64) ([]byte, error) {
+	if size > maxHeaderElement {
+		return nil, errMalformed
+	}
+	body := make([]byte, size)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, noEOF(err)
+	}
+	return body, nil
+}
+
+// eachChild вызывает fn для каждого дочернего элемента из данных родителя
+func eachChild(body []byte, fn func(id uint64, data []byte) error) error {
+	r := bytes.NewReader(body)
+	for r.Len() > 0 {
+		element, err := readElement(r)
+		if err != nil {
+			return noEOF(err)
+		}
+		if element.size > uint64(r.Len()) {
+			return errMalformed
+		}
+		data := body[len(body)-r.Len():][:element.size]
+		if err := fn(element.id, data); err != nil {
+			return err
+		}
+		r.Seek(int64(element.size), io.SeekCurrent)
+	}
+	return nil
+}
+
+// readUint читает беззнаковое целое длиной до 8 байт
+func readUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data[:min(len(data), 8)] {
+		value = value<<8 | uint64(b)
+	}
+	return value
+}
+
+// readFloat читает число с плавающей точкой длиной 0, 4 или 8 байт
+func readFloat(data []byte) (float64, error) {
+	var value float64
+	switch len(data) {
+	case 0:
+		return 0, nil
+	case 4:
+		value = float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		value = math.Float64frombits(binary.BigEndian.Uint64(data))
+	default:
+		return 0, errMalformed
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) || value < 0 {
+		return 0, errMalformed
+	}
+	return value, nil
+}
+
+// floatDuration переводит наносекунды в time.Duration без переполнения
+func floatDuration(nanoseconds float64) time.Duration {
+	if nanoseconds >= math.MaxInt64 {
+		return time.Duration(math.MaxInt64)
+	}
+	return time.Duration(nanoseconds)
+}
+
+// noEOF превращает конец файла посреди элемента в ошибку структуры
+func noEOF(err error) error {
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return errMalformed
+	}
+	return err
+}
@@ -0,0 +1,68 @@
+package markup
+
+import (
+	"container/list"
+	"html/template"
+	"sync"
+)
+
+// Renderer кэширует результат Render для недавно показанных сообщений.
+// Исходный текст хранится в БД без изменений, HTML строится при показе
+type Renderer struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+// cacheEntry элемент LRU-кэша
+type cacheEntry struct {
+	src  string
+	html template.HTML
+}
+
+// NewRenderer создает рендерер с кэшем на size сообщений
+func NewRenderer(size int) *Renderer {
+	return &Renderer{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// Render возвращает безопасный HTML сообщения, по возможности из кэша
+func (r *Renderer) Render(src string) template.HTML {
+	if src == "" {
+		return ""
+	}
+
+	r.mu.Lock()
+	if elem, ok := r.entries[src]; ok {
+		r.order.MoveToFront(elem)
+		r.mu.Unlock()
+		return elem.Value.(*cacheEntry).html
+	}
+	r.mu.Unlock()
+
+	// Рендеринг вне блокировки, повторная вставка того же текста безопасна
+	rendered := template.HTML(Render(src))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.entries[src]; !ok {
+		r.entries[src] = r.order.PushFront(&cacheEntry{src: src, html: rendered})
+		for r.order.Len() > r.size {
+			oldest := r.order.Back()
+			r.order.Remove(oldest)
+			delete(r.entries, oldest.Value.(*cacheEntry).src)
+		}
+	}
+	return rendered
+}
+
+// Len возвращает число сообщений в кэше
+func (r *Renderer) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.order.Len()
+}
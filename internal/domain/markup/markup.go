@@ -0,0 +1,204 @@
+package markup
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	spoilerOpen  = "[spoiler]"
+	spoilerClose = "[/spoiler]"
+	codeFence    = "```"
+)
+
+var (
+	// quotePattern находит ссылки на сообщения вида >>123
+	quotePattern = regexp.MustCompile(`^>>(\d{1,18})`)
+	// urlPattern находит ссылки http и https
+	urlPattern = regexp.MustCompile(`^https?://[^\s<>"]+`)
+)
+
+// Render преобразует исходный текст сообщения в безопасный HTML.
+// Поддерживаются:
+//   - строки >гринтекста;
+//   - ссылки на сообщения >>123;
+//   - [spoiler]спойлеры[/spoiler];
+//   - `код в строке` и блоки кода между ```;
+//   - ссылки http(s) с rel="nofollow noopener".
+//
+// Весь остальной текст экранируется, поэтому результат можно выводить без дополнительной обработки
+func Render(src string) string {
+	src = strings.ReplaceAll(src, "\r\n", "\n")
+	lines := strings.Split(src, "\n")
+
+	var b strings.Builder
+	spoilers := 0
+	lineBreak := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+
+		// Блок кода выводится как есть до закрывающей ограды или конца текста
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			end := i + 1
+			for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), codeFence) {
+				end++
+			}
+			b.WriteString(`<pre class="code"><code>`)
+			b.WriteString(html.EscapeString(strings.Join(lines[i+1:min(end, len(lines))], "\n")))
+			b.WriteString(`</code></pre>`)
+			i = end
+			lineBreak = false
+			continue
+		}
+
+		if lineBreak {
+			b.WriteString("<br>")
+		}
+		lineBreak = true
+
+		greentext := strings.HasPrefix(line, ">") && !quotePattern.MatchString(line)
+		if greentext {
+			b.WriteString(`<span class="greentext">`)
+		}
+		// Спойлеры, открытые на прошлых строках, продолжаются на этой,
+		// но каждая строка закрывает свои теги, чтобы HTML оставался корректным
+		b.WriteString(strings.Repeat(`<span class="spoiler">`, spoilers))
+		spoilers = renderInline(&b, line, spoilers)
+		b.WriteString(strings.Repeat(`</span>`, spoilers))
+		if greentext {
+			b.WriteString(`</span>`)
+		}
+	}
+	return b.String()
+}
+
+// renderInline выводит одну строку с разметкой внутри строки
+// и возвращает число незакрытых спойлеров
+func renderInline(b *strings.Builder, line string, spoilers int) int {
+	opened := 0
+	text := strings.Builder{}
+	flush := func() {
+		b.WriteString(html.EscapeString(text.String()))
+		text.Reset()
+	}
+
+	for i := 0; i < len(line); {
+		rest := line[i:]
+
+		switch {
+		case strings.HasPrefix(rest, "`"):
+			end := strings.IndexByte(rest[1:], '`')
+			if end < 0 {
+				break
+			}
+			flush()
+			b.WriteString(`<code>`)
+			b.WriteString(html.EscapeString(rest[1 : end+1]))
+			b.WriteString(`</code>`)
+			i += end + 2
+			continue
+
+		case hasPrefixFold(rest, spoilerOpen):
+			flush()
+			b.WriteString(`<span class="spoiler">`)
+			opened++
+			i += len(spoilerOpen)
+			continue
+
+		case hasPrefixFold(rest, spoilerClose) && spoilers+opened > 0:
+			flush()
+			b.WriteString(`</span>`)
+			if opened > 0 {
+				opened--
+			} else {
+				spoilers--
+			}
+			i += len(spoilerClose)
+			continue
+
+		case strings.HasPrefix(rest, ">>"):
+			// Ссылка ведет на комментарий в треде, превью подгружает скрипт страницы
+			if m := quotePattern.FindStringSubmatch(rest); m != nil {
+				flush()
+				b.WriteString(`<a href="#comment-` + m[1] + `" class="quotelink" data-id="` + m[1] + `">&gt;&gt;` + m[1] + `</a>`)
+				i += len(m[0])
+				continue
+			}
+
+		case strings.HasPrefix(rest, "http://") || strings.HasPrefix(rest, "https://"):
+			if link := trimURL(urlPattern.FindString(rest)); link != "" {
+				if u, err := url.Parse(link); err == nil && u.Host != "" {
+					flush()
+					escaped := html.EscapeString(link)
+					b.WriteString(`<a href="` + escaped + `" rel="nofollow noopener" target="_blank">` + escaped + `</a>`)
+					i += len(link)
+					continue
+				}
+			}
+		}
+
+		text.WriteByte(line[i])
+		i++
+	}
+	flush()
+
+	return spoilers + opened
+}
+
+// trimURL убирает из ссылки завершающую пунктуацию предложения
+func trimURL(link string) string {
+	link = strings.TrimRight(link, ".,;:!?'")
+	// Закрывающая скобка остается, только если в ссылке есть открывающая
+	for strings.HasSuffix(link, ")") && strings.Count(link, "(") < strings.Count(link, ")") {
+		link = strings.TrimSuffix(link, ")")
+	}
+	return link
+}
+
+// hasPrefixFold проверяет префикс без учета регистра
+func hasPrefixFold(s, prefix string) bool {
+	return len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix)
+}
+
+// QuoteIDs возвращает ID сообщений, на которые ссылается текст через >>id,
+// без повторов и в порядке появления. Ссылки внутри кода не учитываются
+func QuoteIDs(src string) []int64 {
+	var ids []int64
+	seen := make(map[int64]bool)
+	inFence := false
+
+	for _, line := range strings.Split(src, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), codeFence) {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+
+		for i := 0; i < len(line); i++ {
+			switch {
+			case line[i] == '`':
+				// Пропускаем код в строке, если он закрыт
+				if end := strings.IndexByte(line[i+1:], '`'); end >= 0 {
+					i += end + 1
+				}
+			case strings.HasPrefix(line[i:], ">>"):
+				m := quotePattern.FindStringSubmatch(line[i:])
+				if m == nil {
+					continue
+				}
+				id, err := strconv.ParseInt(m[1], 10, 64)
+				if err == nil && id > 0 && !seen[id] {
+					seen[id] = true
+					ids = append(ids, id)
+				}
+				i += len(m[0]) - 1
+			}
+		}
+	}
+	return ids
+}
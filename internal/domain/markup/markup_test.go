@@ -0,0 +1,106 @@
+package markup_test
+
+import (
+	"slices"
+	"strings"
+	"testing"
+
+	"1337b04rd/internal/domain/markup"
+)
+
+// TestRender проверяет поддерживаемую разметку
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "Экранирование",
+			input: `<script>alert("x")</script>`,
+			want:  `&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;`,
+		},
+		{
+			name:  "Гринтекст",
+			input: ">мне нравится\nобычный",
+			want:  `<span class="greentext">&gt;мне нравится</span><br>обычный`,
+		},
+		{
+			name:  "Ссылка на сообщение",
+			input: ">>42 согласен",
+			want:  `<a href="#comment-42" class="quotelink" data-id="42">&gt;&gt;42</a> согласен`,
+		},
+		{
+			name:  "Спойлер",
+			input: "концовка: [spoiler]все умерли[/spoiler]",
+			want:  `концовка: <span class="spoiler">все умерли</span>`,
+		},
+		{
+			name:  "Спойлер на несколько строк",
+			input: "[SPOILER]раз\nдва[/spoiler]",
+			want:  `<span class="spoiler">раз</span><br><span class="spoiler">два</span>`,
+		},
+		{
+			name:  "Лишний закрывающий тег",
+			input: "текст[/spoiler]",
+			want:  `текст[/spoiler]`,
+		},
+		{
+			name:  "Код в строке",
+			input: "запусти `rm -rf <dir>` и [spoiler]",
+			want:  `запусти <code>rm -rf &lt;dir&gt;</code> и <span class="spoiler"></span>`,
+		},
+		{
+			name:  "Блок кода",
+			input: "смотри:\n```\nif a < b {\n>>1 [spoiler]\n}\n```\nвсе",
+			want:  "смотри:<pre class=\"code\"><code>if a &lt; b {\n&gt;&gt;1 [spoiler]\n}</code></pre>все",
+		},
+		{
+			name:  "Ссылка",
+			input: "см. https://example.com/a?b=1&c=2.",
+			want:  `см. <a href="https://example.com/a?b=1&amp;c=2" rel="nofollow noopener" target="_blank">https://example.com/a?b=1&amp;c=2</a>.`,
+		},
+		{
+			name:  "Ссылка в скобках",
+			input: "(https://en.wikipedia.org/wiki/Go_(language))",
+			want:  `(<a href="https://en.wikipedia.org/wiki/Go_(language)" rel="nofollow noopener" target="_blank">https://en.wikipedia.org/wiki/Go_(language)</a>)`,
+		},
+		{
+			name:  "Ссылка с кавычкой",
+			input: `https://example.com/"onmouseover="alert(1)`,
+			want:  `<a href="https://example.com/" rel="nofollow noopener" target="_blank">https://example.com/</a>&#34;onmouseover=&#34;alert(1)`,
+		},
+	}
+
+	for _, tt := range tests {
+		if got := markup.Render(tt.input); got != tt.want {
+			t.Errorf("%s:\nожидалось %q\nполучено  %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestRendererCache проверяет вытеснение старых записей из кэша
+func TestRendererCache(t *testing.T) {
+	renderer := markup.NewRenderer(2)
+
+	first := renderer.Render(">раз")
+	renderer.Render("два")
+	renderer.Render(">раз")
+	renderer.Render("три")
+
+	if renderer.Len() != 2 {
+		t.Errorf("Ожидалось 2 записи в кэше, получено %d", renderer.Len())
+	}
+	if got := renderer.Render(">раз"); got != first || !strings.Contains(string(got), "greentext") {
+		t.Errorf("Недавно использованная запись должна остаться в кэше: %q", got)
+	}
+}
+
+// TestQuoteIDs проверяет извлечение ссылок на сообщения
+func TestQuoteIDs(t *testing.T) {
+	src := ">>1 >>2\n>>>3 `>>4` >>1\n```\n>>5\n```\nтекст>>6 >>0"
+	want := []int64{1, 2, 3, 6}
+	if got := markup.QuoteIDs(src); !slices.Equal(got, want) {
+		t.Errorf("Ожидалось %v, получено %v", want, got)
+	}
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// MaxAttachments наибольшее число файлов в одном посте или комментарии
+const MaxAttachments = 4
+
+// Виды записей, к которым прикрепляются файлы
+const (
+	AttachmentPost    = "post"
+	AttachmentComment = "comment"
+)
+
+// Attachment файл, прикрепленный к посту или комментарию. Объекты хранятся
+// по бакету и ключу, адреса для браузера заполняются при выводе
+type Attachment struct {
+	ID        int64  `json:"id"`
+	OwnerType string `json:"-"`
+	OwnerID   int64  `json:"-"`
+	// Position порядок файла в галерее, первый файл служит обложкой записи
+	Position    int    `json:"position"`
+	Bucket      string `json:"-"`
+	Key         string `json:"-"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	// Duration длительность видео, 0 для изображений
+	Duration     time.Duration `json:"duration,omitempty"`
+	ThumbnailKey string        `json:"-"`
+	// PosterKey первый кадр анимированного GIF в полном размере
+	PosterKey string `json:"-"`
+	// Filename имя файла у автора, только для подписи в галерее
+	Filename  string    `json:"filename"`
+	IsSpoiler bool      `json:"is_spoiler"`
+	CreatedAt time.Time `json:"created_at"`
+
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	PosterURL    string `json:"poster_url,omitempty"`
+}
+
+// IsVideo сообщает, что файл является видео WebM или MP4
+func (a *Attachment) IsVideo() bool {
+	return strings.HasPrefix(a.ContentType, "video/")
+}
+
+// DurationLabel длительность видео для подписи в галерее
+func (a *Attachment) DurationLabel() string {
+	return FormatDuration(a.Duration)
+}
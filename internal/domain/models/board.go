@@ -0,0 +1,37 @@
+package models
+
+import "strings"
+
+// DefaultBoard имя доски, используемое когда доска не указана явно
+const DefaultBoard = "b"
+
+// NormalizeBoard приводит имя доски к каноничному виду
+func NormalizeBoard(board string) string {
+	board = strings.ToLower(strings.TrimSpace(board))
+	if board == "" {
+		return DefaultBoard
+	}
+	return board
+}
+
+// BoardSet множество настроенных досок
+type BoardSet map[string]bool
+
+// NewBoardSet создает множество из досок boards. Доска по умолчанию входит в него всегда
+func NewBoardSet(boards ...string) BoardSet {
+	set := BoardSet{DefaultBoard: true}
+	for _, board := range boards {
+		set[NormalizeBoard(board)] = true
+	}
+	return set
+}
+
+// Resolve возвращает каноничное имя настроенной доски. Неизвестные имена
+// заменяются доской по умолчанию, чтобы значение от клиента не создавало новых досок
+func (s BoardSet) Resolve(board string) string {
+	board = NormalizeBoard(board)
+	if s[board] {
+		return board
+	}
+	return DefaultBoard
+}
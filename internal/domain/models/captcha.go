@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// CaptchaChallenge выданная пользователю задача капчи
+type CaptchaChallenge struct {
+	Token     string    `json:"token"`
+	ImageURL  string    `json:"image_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// CaptchaConfig определяет, когда требуется капча при создании треда
+type CaptchaConfig struct {
+	// TTL время жизни выданной задачи
+	TTL time.Duration
+	// Boards доски, на которых капча включена всегда
+	Boards map[string]bool
+	// Known настроенные доски, остальные имена считаются доской по умолчанию
+	Known BoardSet
+	// VelocityThreshold количество новых тредов за VelocityWindow,
+	// после которого капча включается автоматически (0 - отключено)
+	VelocityThreshold int
+	VelocityWindow    time.Duration
+}
+
+// DefaultCaptchaConfig возвращает настройки капчи по умолчанию
+func DefaultCaptchaConfig() CaptchaConfig {
+	return CaptchaConfig{
+		TTL:               10 * time.Minute,
+		Boards:            make(map[string]bool),
+		Known:             NewBoardSet(),
+		VelocityThreshold: 20,
+		VelocityWindow:    10 * time.Minute,
+	}
+}
+
+// Board возвращает доску, по которой решается, нужна ли капча: настроенную доску
+// или доску с постоянной капчей, иначе доску по умолчанию
+func (c CaptchaConfig) Board(board string) string {
+	board = NormalizeBoard(board)
+	if c.Boards[board] {
+		return board
+	}
+	return c.Known.Resolve(board)
+}
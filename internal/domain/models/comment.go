@@ -4,13 +4,57 @@ import "time"
 
 // Comment представляет комментарий в системе
 type Comment struct {
-	ID        int64     `json:"id"`
-	PostID    int64     `json:"post_id"`
-	UserID    int64     `json:"user_id"`
-	UserName  string    `json:"user_name"`
-	AvatarURL string    `json:"avatar_url,omitempty"`
-	Content   string    `json:"content"`
-	ImageURL  string    `json:"image_url,omitempty"`
-	CreatedAt time.Time `json:"created_at"`
-	ReplyToID int64     `json:"reply_to_id,omitempty"`
+	ID        int64  `json:"id"`
+	PostID    int64  `json:"post_id"`
+	UserID    int64  `json:"user_id"`
+	UserName  string `json:"user_name"`
+	AvatarURL string `json:"avatar_url,omitempty"`
+	Content   string `json:"content"`
+	ImageURL  string `json:"image_url,omitempty"`
+	// ImageWidth и ImageHeight размеры оригинала, ThumbnailURL адрес миниатюры для треда
+	ImageWidth   int       `json:"image_width,omitempty"`
+	ImageHeight  int       `json:"image_height,omitempty"`
+	ThumbnailURL string    `json:"thumbnail_url,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	ReplyToID    int64     `json:"reply_to_id,omitempty"`
+	// Quotes ID комментариев треда, на которые ссылается этот через reply_to_id или >>id
+	Quotes []int64 `json:"quotes"`
+	// Replies ID комментариев, которые отвечают на этот через reply_to_id или >>id
+	Replies []int64 `json:"replies"`
+	// Depth и Path заполняются только в древовидном представлении:
+	// глубина ответа и цепочка ID от корневого комментария ветки
+	Depth int     `json:"depth,omitempty"`
+	Path  []int64 `json:"path,omitempty"`
+	// MoreReplies число ответов, не показанных из-за ограничения глубины дерева
+	MoreReplies int `json:"more_replies,omitempty"`
+	// Attachments файлы галереи, первый совпадает с ImageURL
+	Attachments []*Attachment    `json:"attachments,omitempty"`
+	Status      ModerationStatus `json:"-"`
+	SpamScore   float64          `json:"-"`
+}
+
+// CommentLinks цитаты и ответы для набора комментариев по их ID
+type CommentLinks struct {
+	Quotes  map[int64][]int64
+	Replies map[int64][]int64
+}
+
+// CommentTree страница веток комментариев в древовидном представлении.
+// Comments упорядочены в обходе в глубину. Ответы глубже MaxDepth не выводятся,
+// у комментариев на глубине MaxDepth их число указано в MoreReplies
+type CommentTree struct {
+	Comments []*Comment `json:"comments"`
+	MaxDepth int        `json:"max_depth"`
+	Limit    int        `json:"limit"`
+	Offset   int        `json:"offset"`
+	HasMore  bool       `json:"has_more"`
+}
+
+// CommentPage страница комментариев треда в хронологическом порядке с курсором (created_at, id).
+// NextAfter ID последнего комментария страницы, с него начинается следующая страница
+type CommentPage struct {
+	Comments  []*Comment `json:"comments"`
+	After     int64      `json:"after"`
+	NextAfter int64      `json:"next_after"`
+	HasMore   bool       `json:"has_more"`
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// FilterAction действие, выполняемое при срабатывании правила фильтра
+type FilterAction string
+
+const (
+	// FilterReject отклонить отправку
+	FilterReject FilterAction = "reject"
+	// FilterReplace заменить совпадение на Replacement
+	FilterReplace FilterAction = "replace"
+	// FilterShadowHide опубликовать, но показывать только автору
+	FilterShadowHide FilterAction = "shadow_hide"
+	// FilterFlag опубликовать и отправить на проверку модератору
+	FilterFlag FilterAction = "flag"
+)
+
+// FilterRule правило фильтра содержимого.
+// Pattern - регулярное выражение RE2, для регистронезависимого поиска используйте (?i)
+type FilterRule struct {
+	ID          int64        `json:"id"`
+	Pattern     string       `json:"pattern"`
+	Action      FilterAction `json:"action"`
+	Replacement string       `json:"replacement,omitempty"`
+	Note        string       `json:"note,omitempty"`
+	Enabled     bool         `json:"enabled"`
+	CreatedAt   time.Time    `json:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at"`
+}
+
+// Compile проверяет правило и компилирует его регулярное выражение
+func (r *FilterRule) Compile() (*regexp.Regexp, error) {
+	switch r.Action {
+	case FilterReject, FilterReplace, FilterShadowHide, FilterFlag:
+	default:
+		return nil, fmt.Errorf("неизвестное действие фильтра %q", r.Action)
+	}
+
+	if r.Pattern == "" {
+		return nil, fmt.Errorf("пустой шаблон правила")
+	}
+
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return nil, fmt.Errorf("некорректное регулярное выражение: %w", err)
+	}
+	return re, nil
+}
+
+// FilterResult результат проверки текста фильтром
+type FilterResult struct {
+	// Texts проверенные тексты после замен, в порядке передачи
+	Texts []string
+	// Status статус модерации, который нужно присвоить записи
+	Status ModerationStatus
+	// Matched идентификаторы сработавших правил
+	Matched []int64
+}
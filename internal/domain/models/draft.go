@@ -0,0 +1,37 @@
+package models
+
+// PostDraft данные нового треда до проверки и сохранения
+type PostDraft struct {
+	// Name имя автора из формы, пустое - имя сессии
+	Name     string
+	Title    string
+	Content  string
+	ImageURL string
+	// ImageHash SHA-256 загруженного изображения в hex, пустой без изображения
+	ImageHash string
+	// Размеры и миниатюры загруженного изображения, см. StoredImage
+	ImageWidth          int
+	ImageHeight         int
+	ThumbnailURL        string
+	CatalogThumbnailURL string
+	// Attachments загруженные файлы, поля изображения выше описывают первый из них
+	Attachments []*Attachment
+	UserID      int64
+	// Poll опрос треда, nil - тред без опроса
+	Poll *PollDraft
+}
+
+// CommentDraft данные нового комментария до проверки и сохранения
+type CommentDraft struct {
+	PostID    int64
+	UserID    int64
+	Content   string
+	ImageURL  string
+	ImageHash string
+	// Размеры и миниатюра загруженного изображения, см. StoredImage
+	ImageWidth   int
+	ImageHeight  int
+	ThumbnailURL string
+	Attachments  []*Attachment
+	ReplyToID    int64
+}
@@ -0,0 +1,159 @@
+package models
+
+import (
+	"fmt"
+	"math/bits"
+	"time"
+)
+
+// ThumbnailSize размер уменьшенной копии изображения. Копия вписывается
+// в прямоугольник Width x Height с сохранением пропорций и не увеличивается
+type ThumbnailSize struct {
+	Name   string
+	Width  int
+	Height int
+}
+
+// ImageVariant закодированная уменьшенная копия изображения
+type ImageVariant struct {
+	Name        string
+	Width       int
+	Height      int
+	ContentType string
+	// Extension расширение файла копии с точкой
+	Extension string
+	Data      []byte
+}
+
+// ProcessedImage результат обработки загруженного изображения
+type ProcessedImage struct {
+	// Format имя формата исходного изображения: jpeg, png, gif, webp или svg
+	Format string
+	// Width и Height размеры оригинала с учетом ориентации из EXIF
+	Width  int
+	Height int
+	// Original перекодированный оригинал без EXIF, XMP, ICC и комментариев
+	Original *ImageVariant
+	Variants []*ImageVariant
+	// PerceptualHash перцептивный хэш оригинала, nil для SVG
+	PerceptualHash *PerceptualHash
+	// Poster первый кадр анимированного GIF в полном размере, nil для остальных изображений
+	Poster *ImageVariant
+}
+
+// Variant возвращает копию с именем name или nil
+func (p *ProcessedImage) Variant(name string) *ImageVariant {
+	for _, variant := range p.Variants {
+		if variant.Name == name {
+			return variant
+		}
+	}
+	return nil
+}
+
+// StoredImage загруженный файл: адрес оригинала, его размеры и адреса миниатюр.
+// Для SVG размеры и миниатюры пустые, у видео нет миниатюр
+type StoredImage struct {
+	URL                 string
+	Width               int
+	Height              int
+	ThumbnailURL        string
+	CatalogThumbnailURL string
+
+	// Bucket, Key и ThumbnailKey расположение оригинала и миниатюры для треда в хранилище
+	Bucket       string
+	Key          string
+	ThumbnailKey string
+	ContentType  string
+	Size         int64
+
+	// Duration длительность видео, 0 для изображений
+	Duration time.Duration
+	// PosterURL и PosterKey первый кадр анимированного GIF в полном размере
+	PosterURL string
+	PosterKey string
+}
+
+// Attachment описывает изображение как вложение записи
+func (i *StoredImage) Attachment(filename string, spoiler bool) *Attachment {
+	return &Attachment{
+		Bucket:       i.Bucket,
+		Key:          i.Key,
+		ContentType:  i.ContentType,
+		Size:         i.Size,
+		Width:        i.Width,
+		Height:       i.Height,
+		ThumbnailKey: i.ThumbnailKey,
+		Duration:     i.Duration,
+		PosterKey:    i.PosterKey,
+		Filename:     filename,
+		IsSpoiler:    spoiler,
+	}
+}
+
+// URLs возвращает непустые адреса оригинала и миниатюр
+func (i *StoredImage) URLs() []string {
+	var urls []string
+	for _, url := range []string{i.URL, i.ThumbnailURL, i.CatalogThumbnailURL, i.PosterURL} {
+		if url != "" {
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// PerceptualHash 64-битный перцептивный хэш изображения (dHash). У уменьшенных
+// и перекодированных копий одного изображения хэши отличаются на несколько бит
+type PerceptualHash uint64
+
+// Distance возвращает расстояние Хэмминга между хэшами
+func (h PerceptualHash) Distance(other PerceptualHash) int {
+	return bits.OnesCount64(uint64(h ^ other))
+}
+
+// String возвращает хэш в виде 16 шестнадцатеричных цифр
+func (h PerceptualHash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// MarshalText записывает хэш строкой, потому что uint64 теряет точность в JavaScript
+func (h PerceptualHash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// ImageObject объект хранилища изображений с числом ссылок на него
+type ImageObject struct {
+	Bucket    string
+	Key       string
+	Size      int64
+	RefCount  int
+	CreatedAt time.Time
+	// Uploaded объект записан в хранилище
+	Uploaded bool
+	// PerceptualHash хэш изображения, nil для миниатюр и SVG
+	PerceptualHash *PerceptualHash
+}
+
+// ImageBan запрет на загрузку изображения. Запрещены все изображения,
+// хэш которых отличается от Hash не больше чем на Threshold бит
+type ImageBan struct {
+	ID        int64          `json:"id"`
+	Hash      PerceptualHash `json:"hash"`
+	Threshold int            `json:"threshold"`
+	Reason    string         `json:"reason"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Matches сообщает, что изображение с хэшем hash попадает под запрет
+func (b *ImageBan) Matches(hash PerceptualHash) bool {
+	return b.Hash.Distance(hash) <= b.Threshold
+}
+
+// StoredObject объект из списка объектов бакета хранилища
+type StoredObject struct {
+	Bucket string
+	Key    string
+	Size   int64
+	// LastModified время последней записи объекта, нулевое, если хранилище его не сообщило
+	LastModified time.Time
+}
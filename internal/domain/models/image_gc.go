@@ -0,0 +1,46 @@
+package models
+
+import "time"
+
+// ImageGCConfig настройки сборки объектов хранилища, на которые не ссылаются посты и комментарии
+type ImageGCConfig struct {
+	// Interval период между проходами сборщика
+	Interval time.Duration
+	// GracePeriod объекты моложе этого не удаляются: загрузка могла еще не дойти
+	// до сохранения поста или комментария
+	GracePeriod time.Duration
+	// DryRun только находит и считает объекты без ссылок, ничего не удаляя
+	DryRun bool
+	// Buckets бакеты, которые проверяет сборщик
+	Buckets []string
+}
+
+// DefaultImageGCConfig возвращает настройки сборщика по умолчанию
+func DefaultImageGCConfig() ImageGCConfig {
+	return ImageGCConfig{
+		Interval:    time.Hour,
+		GracePeriod: 24 * time.Hour,
+		Buckets:     []string{"posts", "comments"},
+	}
+}
+
+// ImageGCReport результат одного прохода сборщика
+type ImageGCReport struct {
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+	DryRun    bool          `json:"dry_run"`
+	// Scanned число объектов в проверенных бакетах
+	Scanned int `json:"scanned"`
+	// Referenced число объектов, на которые ссылаются записи БД
+	Referenced int `json:"referenced"`
+	// Recent число объектов без ссылок, которые моложе GracePeriod или недавно получили ссылку
+	Recent int `json:"recent"`
+	// Orphaned число объектов без ссылок старше GracePeriod
+	Orphaned int `json:"orphaned"`
+	// Deleted и DeletedBytes число и размер удаленных объектов, в режиме DryRun нули
+	Deleted      int   `json:"deleted"`
+	DeletedBytes int64 `json:"deleted_bytes"`
+	Errors       int   `json:"errors"`
+	// OrphanKeys первые найденные объекты без ссылок в виде bucket/key
+	OrphanKeys []string `json:"orphan_keys,omitempty"`
+}
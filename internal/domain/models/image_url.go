@@ -0,0 +1,77 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// ImageURLStrategy способ построения адресов объектов хранилища для браузера
+type ImageURLStrategy string
+
+const (
+	// ImageURLProxy адреса прокси приложения /s3-proxy/bucket/key
+	ImageURLProxy ImageURLStrategy = "proxy"
+	// ImageURLDirect адреса от публичного адреса хранилища или CDN
+	ImageURLDirect ImageURLStrategy = "direct"
+	// ImageURLSigned адреса прокси приложения с подписью и сроком действия
+	ImageURLSigned ImageURLStrategy = "signed"
+)
+
+// ImageURLConfig настройки адресов загруженных файлов
+type ImageURLConfig struct {
+	Strategy ImageURLStrategy
+	// ProxyPrefix путь прокси приложения, используется стратегиями proxy и signed
+	ProxyPrefix string
+	// BaseURL публичный адрес хранилища для стратегии direct, например https://cdn.example.com
+	BaseURL string
+	// Secret ключ подписи адресов для стратегии signed
+	Secret []byte
+	// TTL наименьший срок действия подписанного адреса
+	TTL time.Duration
+}
+
+// DefaultImageURLConfig возвращает настройки адресов по умолчанию: файлы отдаются через прокси
+func DefaultImageURLConfig() ImageURLConfig {
+	return ImageURLConfig{
+		Strategy:    ImageURLProxy,
+		ProxyPrefix: "/s3-proxy/",
+		TTL:         time.Hour,
+	}
+}
+
+// ProxyCacheConfig настройки дискового кэша прокси хранилища
+type ProxyCacheConfig struct {
+	// Dir каталог кэша, пустой отключает кэш
+	Dir string
+	// MaxBytes наибольший общий размер кэша
+	MaxBytes int64
+	// MaxObjectBytes наибольший размер одного объекта в кэше
+	MaxObjectBytes int64
+}
+
+// DefaultProxyCacheConfig возвращает настройки кэша по умолчанию: кэш выключен
+func DefaultProxyCacheConfig() ProxyCacheConfig {
+	return ProxyCacheConfig{
+		MaxBytes:       512 << 20,
+		MaxObjectBytes: 20 << 20,
+	}
+}
+
+// ObjectPath возвращает ссылку на объект хранилища в том виде, в котором она
+// хранится в БД: bucket/key. Адрес для браузера строит external.URLBuilder
+func ObjectPath(bucket, key string) string {
+	return bucket + "/" + key
+}
+
+// ParseObjectPath разбирает ссылку вида bucket/key. Абсолютные адреса,
+// например изображения сторонних сайтов, и пути с вложенными каталогами не разбираются
+func ParseObjectPath(ref string) (string, string, bool) {
+	if strings.Contains(ref, "://") {
+		return "", "", false
+	}
+	bucket, key, ok := strings.Cut(ref, "/")
+	if !ok || bucket == "" || key == "" || strings.Contains(key, "/") || key == ".." || key == "." {
+		return "", "", false
+	}
+	return bucket, key, true
+}
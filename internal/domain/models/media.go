@@ -0,0 +1,78 @@
+package models
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+)
+
+// VideoInfo сведения о видео из заголовков контейнера WebM или MP4
+type VideoInfo struct {
+	// Container имя контейнера: webm или mp4
+	Container   string
+	ContentType string
+	// Extension расширение файла с точкой
+	Extension string
+	Duration  time.Duration
+	Width     int
+	Height    int
+	// VideoCodec и AudioCodec коды кодеков из контейнера, например V_VP9 или avc1.
+	// AudioCodec пустой для видео без звука
+	VideoCodec string
+	AudioCodec string
+}
+
+// MediaLimits ограничения загружаемых файлов на доске
+type MediaLimits struct {
+	// MaxImageSize наибольший размер загружаемого изображения в байтах
+	MaxImageSize int64
+	// MaxVideoSize наибольший размер видео в байтах, 0 запрещает видео на доске
+	MaxVideoSize     int64
+	MaxVideoDuration time.Duration
+}
+
+// MediaConfig содержит ограничения по умолчанию и переопределения для отдельных досок
+type MediaConfig struct {
+	Default MediaLimits
+	Boards  map[string]MediaLimits
+}
+
+// DefaultMediaConfig возвращает ограничения файлов по умолчанию
+func DefaultMediaConfig() MediaConfig {
+	return MediaConfig{
+		Default: MediaLimits{
+			MaxImageSize:     5 << 20,
+			MaxVideoSize:     10 << 20,
+			MaxVideoDuration: 2 * time.Minute,
+		},
+		Boards: make(map[string]MediaLimits),
+	}
+}
+
+// Limits возвращает ограничения доски с учетом переопределений
+func (c MediaConfig) Limits(board string) MediaLimits {
+	if limits, ok := c.Boards[NormalizeBoard(board)]; ok {
+		return limits
+	}
+	return c.Default
+}
+
+// videoExtensions расширения объектов с видео
+var videoExtensions = map[string]bool{".webm": true, ".mp4": true}
+
+// IsVideoURL сообщает, что адрес или ключ объекта указывает на видео.
+// Параметры запроса, например подпись адреса, не учитываются
+func IsVideoURL(url string) bool {
+	url, _, _ = strings.Cut(url, "?")
+	return videoExtensions[strings.ToLower(path.Ext(url))]
+}
+
+// FormatDuration выводит длительность как м:сс, для длинных видео как ч:мм:сс
+func FormatDuration(d time.Duration) string {
+	seconds := int(d.Round(time.Second).Seconds())
+	if seconds >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+	}
+	return fmt.Sprintf("%d:%02d", seconds/60, seconds%60)
+}
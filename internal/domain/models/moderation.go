@@ -0,0 +1,58 @@
+package models
+
+// ModerationStatus состояние поста или комментария с точки зрения модерации
+type ModerationStatus string
+
+const (
+	// ModerationVisible виден всем
+	ModerationVisible ModerationStatus = "visible"
+	// ModerationFlagged виден всем, но ожидает проверки модератором
+	ModerationFlagged ModerationStatus = "flagged"
+	// ModerationPending виден только автору до одобрения модератором
+	ModerationPending ModerationStatus = "pending"
+	// ModerationShadowHidden виден только автору
+	ModerationShadowHidden ModerationStatus = "shadow_hidden"
+)
+
+// moderationSeverity порядок строгости статусов для выбора более строгого
+var moderationSeverity = map[ModerationStatus]int{
+	ModerationVisible:      0,
+	ModerationFlagged:      1,
+	ModerationPending:      2,
+	ModerationShadowHidden: 3,
+}
+
+// Stricter возвращает более строгий из двух статусов
+func (s ModerationStatus) Stricter(other ModerationStatus) ModerationStatus {
+	if moderationSeverity[other] > moderationSeverity[s] {
+		return other
+	}
+	return s
+}
+
+// Public сообщает, видна ли запись всем пользователям
+func (s ModerationStatus) Public() bool {
+	return s == "" || s == ModerationVisible || s == ModerationFlagged
+}
+
+// VisibleTo сообщает, может ли пользователь viewerID видеть запись автора authorID
+func (s ModerationStatus) VisibleTo(authorID, viewerID int64) bool {
+	return s.Public() || authorID == viewerID
+}
+
+// VisibleComments отбирает комментарии, которые может видеть пользователь viewerID
+func VisibleComments(comments []*Comment, viewerID int64) []*Comment {
+	visible := make([]*Comment, 0, len(comments))
+	for _, comment := range comments {
+		if comment.Status.VisibleTo(comment.UserID, viewerID) {
+			visible = append(visible, comment)
+		}
+	}
+	return visible
+}
+
+// ModerationQueue записи, ожидающие решения модератора
+type ModerationQueue struct {
+	Posts    []*Post    `json:"posts"`
+	Comments []*Comment `json:"comments"`
+}
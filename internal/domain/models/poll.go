@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// Poll опрос, прикрепленный к треду. У треда не больше одного опроса
+type Poll struct {
+	ID       int64 `json:"id"`
+	PostID   int64 `json:"post_id"`
+	Multiple bool  `json:"multiple"`
+	// ClosesAt время закрытия опроса, nil - опрос открыт до архивации треда
+	ClosesAt *time.Time `json:"closes_at,omitempty"`
+	// Closed опрос закрыт при архивации треда или по истечении срока
+	Closed  bool          `json:"closed"`
+	Options []*PollOption `json:"options"`
+	// Voters число проголосовавших сессий, при выборе нескольких вариантов меньше суммы голосов
+	Voters int `json:"voters"`
+	// Voted варианты, выбранные текущей сессией
+	Voted     []int64   `json:"voted"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// PollOption вариант ответа с числом голосов
+type PollOption struct {
+	ID    int64  `json:"id"`
+	Text  string `json:"text"`
+	Votes int    `json:"votes"`
+}
+
+// IsClosed сообщает, что опрос больше не принимает голоса
+func (p *Poll) IsClosed(now time.Time) bool {
+	return p.Closed || (p.ClosesAt != nil && !now.Before(*p.ClosesAt))
+}
+
+// HasVoted сообщает, что текущая сессия уже голосовала
+func (p *Poll) HasVoted() bool {
+	return len(p.Voted) > 0
+}
+
+// VotedFor сообщает, что текущая сессия выбрала вариант optionID
+func (p *Poll) VotedFor(optionID int64) bool {
+	for _, id := range p.Voted {
+		if id == optionID {
+			return true
+		}
+	}
+	return false
+}
+
+// Percent возвращает долю проголосовавших за вариант в процентах
+func (p *Poll) Percent(votes int) int {
+	if p.Voters == 0 {
+		return 0
+	}
+	return votes * 100 / p.Voters
+}
+
+// PollDraft данные нового опроса из формы создания треда
+type PollDraft struct {
+	Options  []string
+	Multiple bool
+	// ClosesAt время закрытия, nil - без срока
+	ClosesAt *time.Time
+}
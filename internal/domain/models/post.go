@@ -4,13 +4,45 @@ import "time"
 
 // Post представляет пост в системе
 type Post struct {
-	ID         int64     `json:"id"`
-	Title      string    `json:"title"`
-	Content    string    `json:"content"`
-	ImageURL   string    `json:"image_url,omitempty"`
-	UserID     int64     `json:"user_id"`
-	UserName   string    `json:"user_name"`
-	AvatarURL  string    `json:"avatar_url,omitempty"`
-	CreatedAt  time.Time `json:"created_at"`
-	IsArchived bool      `json:"is_archived"`
+	ID       int64  `json:"id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	ImageURL string `json:"image_url,omitempty"`
+	// ImageWidth и ImageHeight размеры оригинала, ThumbnailURL и CatalogThumbnailURL
+	// адреса миниатюр для треда и каталога. Пустые, если миниатюры не построены
+	ImageWidth          int       `json:"image_width,omitempty"`
+	ImageHeight         int       `json:"image_height,omitempty"`
+	ThumbnailURL        string    `json:"thumbnail_url,omitempty"`
+	CatalogThumbnailURL string    `json:"catalog_thumbnail_url,omitempty"`
+	UserID              int64     `json:"user_id"`
+	UserName            string    `json:"user_name"`
+	AvatarURL           string    `json:"avatar_url,omitempty"`
+	CreatedAt           time.Time `json:"created_at"`
+	IsArchived          bool      `json:"is_archived"`
+	// IsSticky закрепляет тред вверху каталога и защищает его от архивации
+	IsSticky bool `json:"is_sticky"`
+	// IsLocked закрывает тред для новых ответов
+	IsLocked bool `json:"is_locked"`
+	// ReplyCount число опубликованных комментариев, заполняется при чтении поста и каталога
+	ReplyCount int `json:"reply_count"`
+	// Attachments файлы галереи, первый совпадает с ImageURL.
+	// Заполняются только при чтении отдельного поста
+	Attachments []*Attachment    `json:"attachments,omitempty"`
+	Status      ModerationStatus `json:"-"`
+	SpamScore   float64          `json:"-"`
+}
+
+// HasVideo сообщает, что обложкой поста служит видео. Для видео нет миниатюр,
+// поэтому каталог и архив показывают его элементом video
+func (p *Post) HasVideo() bool {
+	return IsVideoURL(p.ImageURL)
+}
+
+// CatalogEntry карточка треда в каталоге: пост и сводка по его опубликованным ответам.
+// ReplyCount берется из поста, LastReplies идут в хронологическом порядке
+type CatalogEntry struct {
+	*Post
+	ImageCount  int        `json:"image_count"`
+	LastReplyAt *time.Time `json:"last_reply_at"`
+	LastReplies []*Comment `json:"last_replies"`
 }
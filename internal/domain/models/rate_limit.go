@@ -0,0 +1,157 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RateLimitAction тип действия, на которое распространяется ограничение частоты
+type RateLimitAction string
+
+const (
+	// RateLimitThread создание нового треда
+	RateLimitThread RateLimitAction = "thread"
+	// RateLimitReply создание ответа в треде
+	RateLimitReply RateLimitAction = "reply"
+	// RateLimitImage загрузка изображения
+	RateLimitImage RateLimitAction = "image"
+)
+
+// RateLimitRule описывает корзину токенов: не более Burst действий подряд,
+// далее один токен восстанавливается каждые Interval
+type RateLimitRule struct {
+	Burst    int
+	Interval time.Duration
+}
+
+// Disabled сообщает, что правило не ограничивает действие
+func (r RateLimitRule) Disabled() bool {
+	return r.Burst <= 0 || r.Interval <= 0
+}
+
+// String возвращает правило в формате "burst/interval", например "3/10m"
+func (r RateLimitRule) String() string {
+	return fmt.Sprintf("%d/%s", r.Burst, r.Interval)
+}
+
+// ParseRateLimitRule разбирает правило из строки вида "3/10m"
+func ParseRateLimitRule(value string) (RateLimitRule, error) {
+	parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+	if len(parts) != 2 {
+		return RateLimitRule{}, fmt.Errorf("неверный формат правила %q, ожидается burst/interval", value)
+	}
+
+	burst, err := strconv.Atoi(parts[0])
+	if err != nil || burst < 0 {
+		return RateLimitRule{}, fmt.Errorf("неверное значение burst в правиле %q", value)
+	}
+
+	interval, err := time.ParseDuration(parts[1])
+	if err != nil || interval < 0 {
+		return RateLimitRule{}, fmt.Errorf("неверный интервал в правиле %q", value)
+	}
+
+	return RateLimitRule{Burst: burst, Interval: interval}, nil
+}
+
+// RateLimitPolicy набор правил для каждого типа действия
+type RateLimitPolicy map[RateLimitAction]RateLimitRule
+
+// RateLimitConfig содержит политику по умолчанию и переопределения для отдельных досок
+type RateLimitConfig struct {
+	Default RateLimitPolicy
+	Boards  map[string]RateLimitPolicy
+	// Known настроенные доски. Корзины остальных имен считаются корзинами доски по умолчанию
+	Known BoardSet
+}
+
+// DefaultRateLimitConfig возвращает настройки ограничений по умолчанию
+func DefaultRateLimitConfig() RateLimitConfig {
+	return RateLimitConfig{
+		Default: RateLimitPolicy{
+			RateLimitThread: {Burst: 3, Interval: 5 * time.Minute},
+			RateLimitReply:  {Burst: 10, Interval: 15 * time.Second},
+			RateLimitImage:  {Burst: 5, Interval: time.Minute},
+		},
+		Boards: make(map[string]RateLimitPolicy),
+		Known:  NewBoardSet(),
+	}
+}
+
+// Board возвращает доску, по которой считаются корзины: настроенную доску
+// или доску с переопределениями, иначе доску по умолчанию
+func (c RateLimitConfig) Board(board string) string {
+	board = NormalizeBoard(board)
+	if _, ok := c.Boards[board]; ok {
+		return board
+	}
+	return c.Known.Resolve(board)
+}
+
+// Rule возвращает правило для доски и действия с учетом переопределений
+func (c RateLimitConfig) Rule(board string, action RateLimitAction) RateLimitRule {
+	if policy, ok := c.Boards[c.Board(board)]; ok {
+		if rule, ok := policy[action]; ok {
+			return rule
+		}
+	}
+	return c.Default[action]
+}
+
+// RateLimitDecision результат проверки ограничения
+type RateLimitDecision struct {
+	Allowed    bool
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// TokenBucket состояние корзины токенов для одного ключа
+type TokenBucket struct {
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// NewTokenBucket создает полную корзину для правила
+func NewTokenBucket(rule RateLimitRule, now time.Time) TokenBucket {
+	return TokenBucket{Tokens: float64(rule.Burst), UpdatedAt: now}
+}
+
+// Take пополняет корзину за прошедшее время и пытается забрать один токен
+func (b *TokenBucket) Take(rule RateLimitRule, now time.Time) RateLimitDecision {
+	if rule.Disabled() {
+		return RateLimitDecision{Allowed: true, Remaining: math.MaxInt32}
+	}
+
+	elapsed := now.Sub(b.UpdatedAt)
+	if elapsed > 0 {
+		b.Tokens = math.Min(float64(rule.Burst), b.Tokens+elapsed.Seconds()/rule.Interval.Seconds())
+		b.UpdatedAt = now
+	}
+
+	if b.Tokens >= 1 {
+		b.Tokens--
+		return RateLimitDecision{Allowed: true, Remaining: int(b.Tokens)}
+	}
+
+	// Время до появления следующего целого токена
+	missing := 1 - b.Tokens
+	retryAfter := time.Duration(missing * float64(rule.Interval))
+	return RateLimitDecision{Allowed: false, RetryAfter: retryAfter}
+}
+
+// Refund возвращает в корзину один токен, не больше емкости корзины
+func (b *TokenBucket) Refund(rule RateLimitRule) {
+	b.Tokens = math.Min(float64(rule.Burst), b.Tokens+1)
+}
+
+// Idle сообщает, что корзина полностью восстановилась и ее можно забыть
+func (b *TokenBucket) Idle(rule RateLimitRule, now time.Time) bool {
+	if rule.Disabled() {
+		return true
+	}
+	refill := time.Duration((float64(rule.Burst) - b.Tokens) * float64(rule.Interval))
+	return now.Sub(b.UpdatedAt) >= refill
+}
@@ -0,0 +1,102 @@
+package models
+
+import "time"
+
+// SpamDecision решение по отправке на основе спам-оценки
+type SpamDecision string
+
+const (
+	// SpamAllow опубликовать
+	SpamAllow SpamDecision = "allow"
+	// SpamQueue опубликовать после проверки модератором
+	SpamQueue SpamDecision = "queue"
+	// SpamReject отклонить
+	SpamReject SpamDecision = "reject"
+)
+
+// Виды записей, для которых сохраняются отпечатки
+const (
+	FingerprintPost    = "post"
+	FingerprintComment = "comment"
+)
+
+// SpamConfig веса признаков спама и пороги решений
+type SpamConfig struct {
+	// HistorySize сколько последних отправок сравнивать с новой
+	HistorySize int
+	// NearDuplicateSimilarity минимальное сходство шинглов (0..1), считающееся дубликатом
+	NearDuplicateSimilarity float64
+	// MinDuplicateLength тексты короче этого (после нормализации) не проверяются на дубли
+	MinDuplicateLength int
+	// NewSessionAge сессии моложе этого считаются новыми
+	NewSessionAge time.Duration
+
+	DuplicateWeight   float64
+	ImageRepostWeight float64
+	LinkWeight        float64
+	NewSessionWeight  float64
+
+	// QueueThreshold и RejectThreshold пороги оценки для модерации и отклонения
+	QueueThreshold  float64
+	RejectThreshold float64
+}
+
+// DefaultSpamConfig возвращает настройки спам-фильтра по умолчанию
+func DefaultSpamConfig() SpamConfig {
+	return SpamConfig{
+		HistorySize:             200,
+		NearDuplicateSimilarity: 0.7,
+		MinDuplicateLength:      20,
+		NewSessionAge:           10 * time.Minute,
+		DuplicateWeight:         0.6,
+		ImageRepostWeight:       0.4,
+		LinkWeight:              0.4,
+		NewSessionWeight:        0.2,
+		QueueThreshold:          0.6,
+		RejectThreshold:         1.0,
+	}
+}
+
+// Decide возвращает решение для оценки
+func (c SpamConfig) Decide(score float64) SpamDecision {
+	switch {
+	case c.RejectThreshold > 0 && score >= c.RejectThreshold:
+		return SpamReject
+	case c.QueueThreshold > 0 && score >= c.QueueThreshold:
+		return SpamQueue
+	default:
+		return SpamAllow
+	}
+}
+
+// SpamInput данные отправки, по которым считается спам-оценка
+type SpamInput struct {
+	Text          string
+	ImageHash     string
+	UserCreatedAt time.Time
+}
+
+// SpamVerdict результат спам-оценки
+type SpamVerdict struct {
+	Score    float64
+	Decision SpamDecision
+	Reasons  []string
+}
+
+// ContentFingerprint отпечаток отправки для поиска повторов
+type ContentFingerprint struct {
+	Kind      string
+	RefID     int64
+	UserID    int64
+	Text      string
+	ImageHash string
+	CreatedAt time.Time
+}
+
+// Status возвращает статус модерации, соответствующий решению
+func (v *SpamVerdict) Status() ModerationStatus {
+	if v.Decision == SpamQueue {
+		return ModerationPending
+	}
+	return ModerationVisible
+}
@@ -14,6 +14,7 @@ import (
 type ArchiverService struct {
 	postRepo      repositories.PostRepository
 	commentRepo   repositories.CommentRepository
+	pollService   *PollService
 	interval      time.Duration
 	lastRun       time.Time
 	statsLock     sync.Mutex
@@ -44,6 +45,22 @@ func (s *ArchiverService) SetInterval(interval time.Duration) {
 	s.interval = interval
 }
 
+// SetPollService включает закрытие опросов в архивируемых тредах
+func (s *ArchiverService) SetPollService(pollService *PollService) {
+	s.pollService = pollService
+}
+
+// closePoll закрывает опрос архивированного треда. Ошибка не отменяет архивацию:
+// голоса в архивном треде сервис опросов не принимает и без флага closed
+func (s *ArchiverService) closePoll(ctx context.Context, postID int64) {
+	if s.pollService == nil {
+		return
+	}
+	if err := s.pollService.ClosePoll(ctx, postID); err != nil {
+		slog.Error("Ошибка закрытия опроса архивированного треда", "post_id", postID, "error", err)
+	}
+}
+
 // StartArchiveJob запускает фоновую задачу архивирования
 func (s *ArchiverService) StartArchiveJob(ctx context.Context) {
 	slog.Info("Запуск фоновой задачи архивирования постов", "interval", s.interval)
@@ -122,6 +139,11 @@ func (s *ArchiverService) ProcessArchiving(ctx context.Context) {
 	archiveCount := 0
 
 	for _, post := range posts {
+		// Закрепленные треды остаются в каталоге, пока модератор не снимет закрепление
+		if post.IsSticky {
+			continue
+		}
+
 		// Получаем последний комментарий к посту
 		lastComment, err := s.commentRepo.GetLastCommentByPostID(ctx, post.ID)
 
@@ -147,6 +169,7 @@ func (s *ArchiverService) ProcessArchiving(ctx context.Context) {
 					continue
 				}
 				slog.Info("Пост архивирован (без комментариев)", "post_id", post.ID, "created_at", post.CreatedAt)
+				s.closePoll(ctx, post.ID)
 				archiveCount++
 			}
 		} else {
@@ -164,6 +187,7 @@ func (s *ArchiverService) ProcessArchiving(ctx context.Context) {
 				slog.Info("Пост архивирован (15 минут после последнего комментария)",
 					"post_id", post.ID,
 					"last_comment_at", lastComment.CreatedAt)
+				s.closePoll(ctx, post.ID)
 				archiveCount++
 			}
 		}
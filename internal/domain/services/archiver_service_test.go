@@ -1,11 +1,13 @@
 package services_test
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -50,6 +52,25 @@ func (m *MockArchivePostRepository) GetAll(ctx context.Context, limit, offset in
 	return result, nil
 }
 
+// GetCatalog возвращает карточки каталога без сводки по ответам
+func (m *MockArchivePostRepository) GetCatalog(ctx context.Context, limit, offset int, archived bool, previews int) ([]*models.CatalogEntry, int, error) {
+	posts, err := m.GetAll(ctx, limit, offset, archived)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := make([]*models.CatalogEntry, len(posts))
+	for i, post := range posts {
+		entries[i] = &models.CatalogEntry{Post: post}
+	}
+	total := 0
+	for _, post := range m.posts {
+		if post.IsArchived == archived {
+			total++
+		}
+	}
+	return entries, total, nil
+}
+
 // GetAllForArchiving возвращает все неархивированные посты
 func (m *MockArchivePostRepository) GetAllForArchiving(ctx context.Context) ([]*models.Post, error) {
 	var result []*models.Post
@@ -61,6 +82,17 @@ func (m *MockArchivePostRepository) GetAllForArchiving(ctx context.Context) ([]*
 	return result, nil
 }
 
+// CountCreatedSince возвращает количество постов, созданных после момента since
+func (m *MockArchivePostRepository) CountCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	count := 0
+	for _, post := range m.posts {
+		if post.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 // Create создает новый пост
 func (m *MockArchivePostRepository) Create(ctx context.Context, post *models.Post) (int64, error) {
 	id := int64(len(m.posts) + 1)
@@ -81,6 +113,56 @@ func (m *MockArchivePostRepository) Archive(ctx context.Context, id int64) error
 	return nil
 }
 
+// Delete удаляет пост
+func (m *MockArchivePostRepository) Delete(ctx context.Context, id int64) ([]string, error) {
+	delete(m.posts, id)
+	return nil, nil
+}
+
+// GetByStatus возвращает посты с указанными статусами модерации
+func (m *MockArchivePostRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Post, error) {
+	var result []*models.Post
+	for _, item := range m.posts {
+		for _, status := range statuses {
+			if item.Status == status {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetStatus меняет статус модерации
+func (m *MockArchivePostRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.Status = status
+	return nil
+}
+
+// SetSticky меняет флаг закрепления поста
+func (m *MockArchivePostRepository) SetSticky(ctx context.Context, id int64, sticky bool) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.IsSticky = sticky
+	return nil
+}
+
+// SetLocked меняет флаг закрытия поста
+func (m *MockArchivePostRepository) SetLocked(ctx context.Context, id int64, locked bool) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.IsLocked = locked
+	return nil
+}
+
 // AddPost добавляет пост в репозиторий (вспомогательный метод для тестов)
 func (m *MockArchivePostRepository) AddPost(post *models.Post) {
 	m.posts[post.ID] = post
@@ -118,6 +200,32 @@ func (m *MockArchiveCommentRepository) GetByPostID(ctx context.Context, postID i
 	return comments, nil
 }
 
+// GetPageAfter возвращает комментарии поста
+func (m *MockArchiveCommentRepository) GetPageAfter(ctx context.Context, postID, viewerID, afterID int64, limit int) ([]*models.Comment, error) {
+	return m.postComments[postID], nil
+}
+
+// GetTreeByPostID возвращает дерево комментариев поста
+func (m *MockArchiveCommentRepository) GetTreeByPostID(ctx context.Context, postID, viewerID int64, maxDepth, limit, offset int) ([]*models.Comment, error) {
+	return m.postComments[postID], nil
+}
+
+// GetLinks возвращает цитаты и ответы комментариев
+func (m *MockArchiveCommentRepository) GetLinks(ctx context.Context, ids []int64) (*models.CommentLinks, error) {
+	return &models.CommentLinks{}, nil
+}
+
+// FindInPost возвращает ID комментариев поста
+func (m *MockArchiveCommentRepository) FindInPost(ctx context.Context, postID int64, ids []int64) ([]int64, error) {
+	var found []int64
+	for _, comment := range m.postComments[postID] {
+		if slices.Contains(ids, comment.ID) {
+			found = append(found, comment.ID)
+		}
+	}
+	return found, nil
+}
+
 // GetLastCommentByPostID возвращает последний комментарий к посту
 func (m *MockArchiveCommentRepository) GetLastCommentByPostID(ctx context.Context, postID int64) (*models.Comment, error) {
 	comments, exists := m.postComments[postID]
@@ -142,8 +250,32 @@ func (m *MockArchiveCommentRepository) Create(ctx context.Context, comment *mode
 }
 
 // Delete удаляет комментарий
-func (m *MockArchiveCommentRepository) Delete(ctx context.Context, id int64) error {
+func (m *MockArchiveCommentRepository) Delete(ctx context.Context, id int64) ([]string, error) {
 	delete(m.comments, id)
+	return nil, nil
+}
+
+// GetByStatus возвращает комментарии с указанными статусами модерации
+func (m *MockArchiveCommentRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Comment, error) {
+	var result []*models.Comment
+	for _, item := range m.comments {
+		for _, status := range statuses {
+			if item.Status == status {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetStatus меняет статус модерации
+func (m *MockArchiveCommentRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	item, exists := m.comments[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.Status = status
 	return nil
 }
 
@@ -229,6 +361,17 @@ func TestProcessArchiving(t *testing.T) {
 	}
 	mockCommentRepo.AddComment(newComment)
 
+	// 5. Закрепленный пост без комментариев, созданный давно - не должен быть архивирован
+	stickyPost := &models.Post{
+		ID:        5,
+		Title:     "Sticky Rules Post",
+		Content:   "This is a sticky post",
+		UserID:    1,
+		CreatedAt: now.Add(-time.Hour), // час назад
+		IsSticky:  true,
+	}
+	mockPostRepo.AddPost(stickyPost)
+
 	// Запускаем процесс архивирования напрямую с помощью экспортированного метода
 	ctx := context.Background()
 	archiverService.ProcessArchiving(ctx)
@@ -254,6 +397,11 @@ func TestProcessArchiving(t *testing.T) {
 	if mockPostRepo.archivedPostIDs[4] {
 		t.Errorf("Ожидалось, что пост 4 не будет архивирован")
 	}
+
+	// 5. Закрепленный пост - не должен быть архивирован
+	if mockPostRepo.archivedPostIDs[5] {
+		t.Errorf("Ожидалось, что закрепленный пост 5 не будет архивирован")
+	}
 }
 
 // TestStartArchiveJob тестирует запуск и остановку фоновой задачи архивирования
@@ -332,7 +480,7 @@ func TestImageStorageMock(t *testing.T) {
 
 	// Тестируем загрузку изображения
 	imageData := []byte("test image data")
-	imageURL, err := storage.UploadImage(ctx, "test-bucket", "test-object.jpg", imageData)
+	imageURL, err := storage.UploadImage(ctx, "test-bucket", "test-object.jpg", bytes.NewReader(imageData), int64(len(imageData)))
 	if err != nil {
 		t.Fatalf("Ошибка при загрузке изображения: %v", err)
 	}
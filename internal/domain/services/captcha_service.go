@@ -0,0 +1,342 @@
+package services
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// Ошибки проверки капчи
+var (
+	ErrCaptchaRequired = errors.New("необходимо решить капчу")
+	ErrCaptchaInvalid  = errors.New("неверный ответ на капчу")
+	ErrCaptchaExpired  = errors.New("срок действия капчи истек")
+	ErrCaptchaReused   = errors.New("капча уже использована")
+)
+
+// velocityCacheTTL как долго кэшировать подсчет новых тредов
+const velocityCacheTTL = 30 * time.Second
+
+// captchaPayload содержимое токена капчи.
+// Вопрос и ответ зашифрованы, чтобы бот не мог прочитать их из токена
+type captchaPayload struct {
+	ID      string `json:"id"`
+	Expires int64  `json:"exp"`
+	Sealed  string `json:"q"`
+}
+
+// CaptchaService выдает и проверяет капчи без хранения состояния задачи на сервере.
+// Токен подписан HMAC, повторное использование отслеживается по ID задачи
+type CaptchaService struct {
+	signKey    []byte
+	sealKey    []byte
+	renderer   external.CaptchaRenderer
+	replayRepo repositories.CaptchaReplayRepository
+	postRepo   repositories.PostRepository
+	config     models.CaptchaConfig
+
+	velocityLock       sync.Mutex
+	velocityCount      int
+	velocityChecked    time.Time
+	velocityRefreshing bool
+}
+
+// NewCaptchaService создает новый экземпляр сервиса капчи
+func NewCaptchaService(
+	secret []byte,
+	renderer external.CaptchaRenderer,
+	replayRepo repositories.CaptchaReplayRepository,
+	postRepo repositories.PostRepository,
+	config models.CaptchaConfig,
+) *CaptchaService {
+	// Разводим ключи подписи и шифрования из общего секрета
+	signKey := sha256.Sum256(append([]byte("captcha-sign:"), secret...))
+	sealKey := sha256.Sum256(append([]byte("captcha-seal:"), secret...))
+
+	return &CaptchaService{
+		signKey:    signKey[:],
+		sealKey:    sealKey[:],
+		renderer:   renderer,
+		replayRepo: replayRepo,
+		postRepo:   postRepo,
+		config:     config,
+	}
+}
+
+// Required сообщает, нужна ли капча для создания треда на доске. Доска, которой
+// нет в настройках, считается доской по умолчанию, поэтому выдуманное имя
+// доски в запросе не отключает капчу
+func (s *CaptchaService) Required(ctx context.Context, board string) bool {
+	if s.config.Boards[s.config.Board(board)] {
+		return true
+	}
+
+	if s.config.VelocityThreshold <= 0 || s.postRepo == nil {
+		return false
+	}
+
+	// Подсчет выполняется без блокировки: медленный запрос к БД не задерживает
+	// другие проверки, они используют прошлое значение до его завершения
+	s.velocityLock.Lock()
+	count := s.velocityCount
+	stale := time.Since(s.velocityChecked) > velocityCacheTTL && !s.velocityRefreshing
+	if stale {
+		s.velocityRefreshing = true
+	}
+	s.velocityLock.Unlock()
+
+	if stale {
+		count = s.refreshVelocity(ctx)
+	}
+	return count >= s.config.VelocityThreshold
+}
+
+// refreshVelocity пересчитывает новые треды за окно и сохраняет результат.
+// При ошибке сохраняется прошлое значение
+func (s *CaptchaService) refreshVelocity(ctx context.Context) int {
+	count, err := s.postRepo.CountCreatedSince(ctx, time.Now().Add(-s.config.VelocityWindow))
+
+	s.velocityLock.Lock()
+	defer s.velocityLock.Unlock()
+	s.velocityRefreshing = false
+
+	if err != nil {
+		slog.Error("Ошибка подсчета скорости постинга", "error", err)
+		return s.velocityCount
+	}
+	s.velocityCount = count
+	s.velocityChecked = time.Now()
+
+	if count >= s.config.VelocityThreshold {
+		slog.Warn("Скорость постинга превысила порог, капча включена",
+			"count", count,
+			"threshold", s.config.VelocityThreshold,
+			"window", s.config.VelocityWindow)
+	}
+	return count
+}
+
+// NewChallenge создает новую арифметическую задачу
+func (s *CaptchaService) NewChallenge() (*models.CaptchaChallenge, error) {
+	a, err := randomInt(10, 50)
+	if err != nil {
+		return nil, err
+	}
+	b, err := randomInt(1, 10)
+	if err != nil {
+		return nil, err
+	}
+	op, err := randomInt(0, 2)
+	if err != nil {
+		return nil, err
+	}
+
+	question := fmt.Sprintf("%d+%d=?", a, b)
+	answer := a + b
+	if op == 1 {
+		question = fmt.Sprintf("%d-%d=?", a, b)
+		answer = a - b
+	}
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return nil, fmt.Errorf("ошибка генерации ID капчи: %w", err)
+	}
+
+	expiresAt := time.Now().Add(s.config.TTL)
+	sealed, err := s.seal(question + "|" + strconv.Itoa(answer))
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := s.sign(captchaPayload{
+		ID:      hex.EncodeToString(idBytes),
+		Expires: expiresAt.Unix(),
+		Sealed:  sealed,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.CaptchaChallenge{
+		Token:     token,
+		ImageURL:  "/captcha/image?token=" + url.QueryEscape(token),
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// Image возвращает PNG с вопросом задачи
+func (s *CaptchaService) Image(token string) ([]byte, error) {
+	payload, err := s.open(token)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Unix() > payload.Expires {
+		return nil, ErrCaptchaExpired
+	}
+
+	question, _, err := s.unseal(payload.Sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.renderer.Render(question)
+}
+
+// Verify проверяет ответ на задачу. Задача может быть решена только один раз
+func (s *CaptchaService) Verify(ctx context.Context, token, answer string) error {
+	if token == "" {
+		return ErrCaptchaRequired
+	}
+
+	payload, err := s.open(token)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Unix(payload.Expires, 0)
+	if time.Now().After(expiresAt) {
+		return ErrCaptchaExpired
+	}
+
+	_, expected, err := s.unseal(payload.Sealed)
+	if err != nil {
+		return err
+	}
+
+	// Отмечаем задачу использованной до сравнения ответа,
+	// чтобы нельзя было перебирать ответы на одну задачу
+	fresh, err := s.replayRepo.MarkUsed(ctx, payload.ID, expiresAt)
+	if err != nil {
+		slog.Error("Ошибка проверки повторного использования капчи", "error", err)
+		return err
+	}
+	if !fresh {
+		slog.Warn("Попытка повторного использования капчи", "captcha_id", payload.ID)
+		return ErrCaptchaReused
+	}
+
+	if !hmac.Equal([]byte(strings.TrimSpace(answer)), []byte(expected)) {
+		return ErrCaptchaInvalid
+	}
+
+	return nil
+}
+
+// sign сериализует полезную нагрузку и добавляет к ней подпись HMAC-SHA256
+func (s *CaptchaService) sign(payload captchaPayload) (string, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return "", fmt.Errorf("ошибка сериализации токена капчи: %w", err)
+	}
+
+	body := base64.RawURLEncoding.EncodeToString(data)
+	mac := hmac.New(sha256.New, s.signKey)
+	mac.Write([]byte(body))
+
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// open проверяет подпись токена и возвращает полезную нагрузку
+func (s *CaptchaService) open(token string) (*captchaPayload, error) {
+	body, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return nil, ErrCaptchaInvalid
+	}
+
+	expected := hmac.New(sha256.New, s.signKey)
+	expected.Write([]byte(body))
+
+	actual, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(actual, expected.Sum(nil)) {
+		return nil, ErrCaptchaInvalid
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil {
+		return nil, ErrCaptchaInvalid
+	}
+
+	var payload captchaPayload
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, ErrCaptchaInvalid
+	}
+	return &payload, nil
+}
+
+// seal шифрует строку AES-GCM
+func (s *CaptchaService) seal(plaintext string) (string, error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("ошибка генерации nonce: %w", err)
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(plaintext), nil)
+	return base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// unseal расшифровывает вопрос и ответ задачи
+func (s *CaptchaService) unseal(sealed string) (question, answer string, err error) {
+	gcm, err := s.gcm()
+	if err != nil {
+		return "", "", err
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(sealed)
+	if err != nil || len(data) < gcm.NonceSize() {
+		return "", "", ErrCaptchaInvalid
+	}
+
+	plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", "", ErrCaptchaInvalid
+	}
+
+	question, answer, ok := strings.Cut(string(plaintext), "|")
+	if !ok {
+		return "", "", ErrCaptchaInvalid
+	}
+	return question, answer, nil
+}
+
+// gcm создает шифр AES-GCM на ключе шифрования
+func (s *CaptchaService) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(s.sealKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка создания шифра: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// randomInt возвращает криптографически случайное число в [min, max)
+func randomInt(min, max int) (int, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(int64(max-min)))
+	if err != nil {
+		return 0, fmt.Errorf("ошибка генерации случайного числа: %w", err)
+	}
+	return min + int(n.Int64()), nil
+}
@@ -0,0 +1,188 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/memory"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// recordingRenderer запоминает последний отрисованный вопрос
+type recordingRenderer struct {
+	question string
+}
+
+func (r *recordingRenderer) Render(text string) ([]byte, error) {
+	r.question = text
+	return []byte("png"), nil
+}
+
+// solve вычисляет ответ на вопрос вида "a+b=?" или "a-b=?"
+func solve(t *testing.T, question string) string {
+	t.Helper()
+
+	expr := strings.TrimSuffix(question, "=?")
+	op := "+"
+	if strings.Contains(expr, "-") {
+		op = "-"
+	}
+	left, right, _ := strings.Cut(expr, op)
+	a, errA := strconv.Atoi(left)
+	b, errB := strconv.Atoi(right)
+	if errA != nil || errB != nil {
+		t.Fatalf("Не удалось разобрать вопрос %q", question)
+	}
+
+	if op == "-" {
+		return strconv.Itoa(a - b)
+	}
+	return strconv.Itoa(a + b)
+}
+
+// newChallenge выдает задачу и возвращает ее токен и правильный ответ
+func newChallenge(t *testing.T, service *services.CaptchaService, renderer *recordingRenderer) (string, string) {
+	t.Helper()
+
+	challenge, err := service.NewChallenge()
+	if err != nil {
+		t.Fatalf("Ошибка создания капчи: %v", err)
+	}
+	if _, err := service.Image(challenge.Token); err != nil {
+		t.Fatalf("Ошибка получения изображения: %v", err)
+	}
+	return challenge.Token, solve(t, renderer.question)
+}
+
+// TestCaptchaVerify проверяет правильный ответ, повторное использование и подделку токена
+func TestCaptchaVerify(t *testing.T) {
+	renderer := &recordingRenderer{}
+	service := services.NewCaptchaService([]byte("secret"), renderer,
+		memory.NewCaptchaReplayRepository(), nil, models.DefaultCaptchaConfig())
+	ctx := context.Background()
+
+	token, answer := newChallenge(t, service, renderer)
+	if err := service.Verify(ctx, token, answer); err != nil {
+		t.Fatalf("Правильный ответ отклонен: %v", err)
+	}
+	if err := service.Verify(ctx, token, answer); !errors.Is(err, services.ErrCaptchaReused) {
+		t.Errorf("Ожидалась ошибка повторного использования, получено: %v", err)
+	}
+
+	token, answer = newChallenge(t, service, renderer)
+	if err := service.Verify(ctx, token, answer+"1"); !errors.Is(err, services.ErrCaptchaInvalid) {
+		t.Errorf("Ожидалась ошибка неверного ответа, получено: %v", err)
+	}
+
+	token, answer = newChallenge(t, service, renderer)
+	if err := service.Verify(ctx, "x"+token, answer); !errors.Is(err, services.ErrCaptchaInvalid) {
+		t.Errorf("Ожидалась ошибка подделанного токена, получено: %v", err)
+	}
+
+	if err := service.Verify(ctx, "", ""); !errors.Is(err, services.ErrCaptchaRequired) {
+		t.Errorf("Ожидалась ошибка отсутствия капчи, получено: %v", err)
+	}
+}
+
+// TestCaptchaExpired проверяет, что просроченная задача не принимается
+func TestCaptchaExpired(t *testing.T) {
+	config := models.DefaultCaptchaConfig()
+	config.TTL = -time.Minute
+
+	renderer := &recordingRenderer{}
+	service := services.NewCaptchaService([]byte("secret"), renderer,
+		memory.NewCaptchaReplayRepository(), nil, config)
+
+	challenge, err := service.NewChallenge()
+	if err != nil {
+		t.Fatalf("Ошибка создания капчи: %v", err)
+	}
+	if err := service.Verify(context.Background(), challenge.Token, "0"); !errors.Is(err, services.ErrCaptchaExpired) {
+		t.Errorf("Ожидалась ошибка истекшей капчи, получено: %v", err)
+	}
+}
+
+// TestCaptchaRequired проверяет включение капчи по доске и по скорости постинга
+func TestCaptchaRequired(t *testing.T) {
+	config := models.DefaultCaptchaConfig()
+	config.Boards["g"] = true
+	config.VelocityThreshold = 1
+
+	postRepo := NewMockPostRepository()
+	service := services.NewCaptchaService([]byte("secret"), &recordingRenderer{},
+		memory.NewCaptchaReplayRepository(), postRepo, config)
+	ctx := context.Background()
+
+	if !service.Required(ctx, "g") {
+		t.Errorf("Капча должна требоваться на доске g")
+	}
+
+	// Неизвестное имя доски не отключает капчу доски по умолчанию
+	config.Boards = map[string]bool{models.DefaultBoard: true}
+	strict := services.NewCaptchaService([]byte("secret"), &recordingRenderer{},
+		memory.NewCaptchaReplayRepository(), nil, config)
+	if !strict.Required(ctx, "anything") {
+		t.Errorf("Капча доски по умолчанию должна требоваться для неизвестной доски")
+	}
+
+	postRepo.Create(ctx, &models.Post{Title: "Тест", Content: "Тест", CreatedAt: time.Now()})
+	if !service.Required(ctx, "b") {
+		t.Errorf("Капча должна включаться при превышении порога")
+	}
+}
+
+// blockingPostRepository задерживает подсчет новых тредов до закрытия release
+type blockingPostRepository struct {
+	*MockPostRepository
+	started chan struct{}
+	release chan struct{}
+}
+
+func (r *blockingPostRepository) CountCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	close(r.started)
+	<-r.release
+	return 5, nil
+}
+
+// TestCaptchaRequiredSlowCount проверяет, что медленный подсчет не задерживает другие проверки
+func TestCaptchaRequiredSlowCount(t *testing.T) {
+	config := models.DefaultCaptchaConfig()
+	config.VelocityThreshold = 1
+
+	postRepo := &blockingPostRepository{
+		MockPostRepository: NewMockPostRepository(),
+		started:            make(chan struct{}),
+		release:            make(chan struct{}),
+	}
+	service := services.NewCaptchaService([]byte("secret"), &recordingRenderer{},
+		memory.NewCaptchaReplayRepository(), postRepo, config)
+	ctx := context.Background()
+
+	first := make(chan bool)
+	go func() { first <- service.Required(ctx, "b") }()
+	<-postRepo.started
+
+	done := make(chan bool)
+	go func() { done <- service.Required(ctx, "b") }()
+	select {
+	case required := <-done:
+		if required {
+			t.Errorf("До завершения подсчета используется прошлое значение")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Проверка ждет завершения чужого подсчета")
+	}
+
+	close(postRepo.release)
+	if !<-first {
+		t.Errorf("Капча должна включаться по результату подсчета")
+	}
+	if !service.Required(ctx, "b") {
+		t.Errorf("Результат подсчета должен сохраняться")
+	}
+}
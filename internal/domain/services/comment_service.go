@@ -2,19 +2,43 @@ package services
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"slices"
+	"strings"
 	"time"
 
+	"1337b04rd/internal/domain/markup"
 	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/validation"
 	"1337b04rd/internal/ports/repositories"
 )
 
+const (
+	// MaxTreeDepth наибольшая глубина вложенности в древовидном представлении
+	MaxTreeDepth = 6
+	// DefaultTreeBranches число корневых веток на странице древовидного представления
+	DefaultTreeBranches = 20
+	// DefaultCommentPage число комментариев на странице хронологического представления
+	DefaultCommentPage = 50
+	// MaxCommentPage наибольший размер страницы комментариев, который можно запросить
+	MaxCommentPage = 200
+)
+
+// ErrThreadLocked возвращается при попытке ответить в закрытый тред
+var ErrThreadLocked = errors.New("тред закрыт, новые ответы не принимаются")
+
 // CommentService предоставляет бизнес-логику для работы с комментариями
 type CommentService struct {
-	commentRepo repositories.CommentRepository
-	userRepo    repositories.UserRepository
-	postRepo    repositories.PostRepository
+	commentRepo   repositories.CommentRepository
+	userRepo      repositories.UserRepository
+	postRepo      repositories.PostRepository
+	contentFilter *ContentFilter
+	spamScorer    *SpamScorer
+	imageService  *ImageService
+	attachRepo    repositories.AttachmentRepository
+	validator     *validation.Validator
 }
 
 // NewCommentService создает новый экземпляр сервиса комментариев
@@ -27,19 +51,228 @@ func NewCommentService(
 		commentRepo: commentRepo,
 		userRepo:    userRepo,
 		postRepo:    postRepo,
+		validator:   validation.NewValidator(validation.DefaultLimits()),
 	}
 }
 
-// GetCommentByID возвращает комментарий по ID
+// SetContentFilter включает проверку новых комментариев фильтром содержимого
+func (s *CommentService) SetContentFilter(contentFilter *ContentFilter) {
+	s.contentFilter = contentFilter
+}
+
+// SetSpamScorer включает спам-оценку новых комментариев
+func (s *CommentService) SetSpamScorer(spamScorer *SpamScorer) {
+	s.spamScorer = spamScorer
+}
+
+// SetImageService включает освобождение изображений удаленных комментариев
+func (s *CommentService) SetImageService(imageService *ImageService) {
+	s.imageService = imageService
+}
+
+// SetAttachmentRepository включает чтение галерей комментариев
+func (s *CommentService) SetAttachmentRepository(attachRepo repositories.AttachmentRepository) {
+	s.attachRepo = attachRepo
+}
+
+// GetCommentByID возвращает комментарий по ID вместе с цитатами и ответами
 func (s *CommentService) GetCommentByID(ctx context.Context, id int64) (*models.Comment, error) {
 	slog.Info("Получение комментария по ID", "id", id)
-	return s.commentRepo.GetByID(ctx, id)
+	comment, err := s.commentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	s.attachLinks(ctx, []*models.Comment{comment})
+	s.attachFiles(ctx, []*models.Comment{comment})
+	return comment, nil
 }
 
-// GetCommentsByPostID возвращает комментарии к посту
+// GetCommentsByPostID возвращает комментарии к посту вместе с цитатами и ответами
 func (s *CommentService) GetCommentsByPostID(ctx context.Context, postID int64, limit, offset int) ([]*models.Comment, error) {
 	slog.Info("Получение комментариев к посту", "post_id", postID, "limit", limit, "offset", offset)
-	return s.commentRepo.GetByPostID(ctx, postID, limit, offset)
+	comments, err := s.commentRepo.GetByPostID(ctx, postID, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	s.attachLinks(ctx, comments)
+	s.attachFiles(ctx, comments)
+	return comments, nil
+}
+
+// GetCommentPage возвращает комментарии поста, созданные после комментария afterID.
+// Используется для кнопки "Загрузить еще" и для опроса новых ответов через ?since=.
+// Лишний комментарий запрашивается, чтобы узнать, есть ли следующая страница
+func (s *CommentService) GetCommentPage(ctx context.Context, postID, viewerID, afterID int64, limit int) (*models.CommentPage, error) {
+	if limit <= 0 {
+		limit = DefaultCommentPage
+	}
+	limit = min(limit, MaxCommentPage)
+	afterID = max(afterID, 0)
+	slog.Info("Получение страницы комментариев", "post_id", postID, "after", afterID, "limit", limit)
+
+	comments, err := s.commentRepo.GetPageAfter(ctx, postID, viewerID, afterID, limit+1)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &models.CommentPage{
+		Comments:  comments,
+		After:     afterID,
+		NextAfter: afterID,
+	}
+	if len(comments) > limit {
+		page.Comments = comments[:limit]
+		page.HasMore = true
+	}
+	if page.Comments == nil {
+		page.Comments = []*models.Comment{}
+	}
+	// Пустая страница сохраняет курсор, чтобы опрос новых ответов продолжался с того же места
+	if n := len(page.Comments); n > 0 {
+		page.NextAfter = page.Comments[n-1].ID
+	}
+
+	s.attachLinks(ctx, page.Comments)
+	s.attachFiles(ctx, page.Comments)
+	return page, nil
+}
+
+// GetCommentTree возвращает страницу веток комментариев поста в древовидном представлении.
+// Лишний корень запрашивается, чтобы узнать, есть ли следующая страница
+func (s *CommentService) GetCommentTree(ctx context.Context, postID, viewerID int64, limit, offset int) (*models.CommentTree, error) {
+	if limit <= 0 {
+		limit = DefaultTreeBranches
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	slog.Info("Получение дерева комментариев", "post_id", postID, "limit", limit, "offset", offset)
+
+	comments, err := s.commentRepo.GetTreeByPostID(ctx, postID, viewerID, MaxTreeDepth, limit+1, offset)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := &models.CommentTree{
+		Comments: make([]*models.Comment, 0, len(comments)),
+		MaxDepth: MaxTreeDepth,
+		Limit:    limit,
+		Offset:   offset,
+	}
+	roots := 0
+	for _, comment := range comments {
+		if comment.Depth == 0 {
+			roots++
+		}
+		if roots > limit {
+			tree.HasMore = true
+			break
+		}
+		tree.Comments = append(tree.Comments, comment)
+	}
+
+	s.attachLinks(ctx, tree.Comments)
+	s.attachFiles(ctx, tree.Comments)
+	return tree, nil
+}
+
+// attachLinks заполняет цитаты и обратные ссылки комментариев одним запросом.
+// Ошибка не мешает показать тред, он просто выводится без ссылок
+func (s *CommentService) attachLinks(ctx context.Context, comments []*models.Comment) {
+	ids := make([]int64, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+		comment.Quotes = []int64{}
+		comment.Replies = []int64{}
+	}
+	if len(ids) == 0 {
+		return
+	}
+
+	links, err := s.commentRepo.GetLinks(ctx, ids)
+	if err != nil {
+		slog.Error("Ошибка получения цитат и ответов", "error", err)
+		return
+	}
+	for _, comment := range comments {
+		if quotes, ok := links.Quotes[comment.ID]; ok {
+			comment.Quotes = quotes
+		}
+		if replies, ok := links.Replies[comment.ID]; ok {
+			comment.Replies = replies
+		}
+	}
+}
+
+// attachFiles заполняет файлы комментариев одним запросом.
+// При ошибке комментарии выводятся с одним изображением из ImageURL
+func (s *CommentService) attachFiles(ctx context.Context, comments []*models.Comment) {
+	if s.attachRepo == nil || len(comments) == 0 {
+		return
+	}
+
+	ids := make([]int64, len(comments))
+	for i, comment := range comments {
+		ids[i] = comment.ID
+	}
+	attachments, err := s.attachRepo.GetByOwners(ctx, models.AttachmentComment, ids)
+	if err != nil {
+		slog.Error("Ошибка получения файлов комментариев", "error", err)
+		return
+	}
+	for _, comment := range comments {
+		comment.Attachments = attachments[comment.ID]
+	}
+}
+
+// resolveQuotes собирает цитаты комментария из reply_to_id и ссылок >>id и проверяет,
+// что все они относятся к этому треду. Ссылка на ID самого поста считается ссылкой на OP
+// и в цитаты не попадает
+func (s *CommentService) resolveQuotes(ctx context.Context, post *models.Post, draft *models.CommentDraft) ([]int64, error) {
+	candidates := markup.QuoteIDs(draft.Content)
+	if draft.ReplyToID > 0 && !slices.Contains(candidates, draft.ReplyToID) {
+		candidates = append([]int64{draft.ReplyToID}, candidates...)
+	}
+	if len(candidates) == 0 {
+		return []int64{}, nil
+	}
+
+	found, err := s.commentRepo.FindInPost(ctx, post.ID, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("не удалось проверить цитаты: %w", err)
+	}
+
+	var errs validation.Errors
+	var missing []string
+	quotes := make([]int64, 0, len(candidates))
+	for _, id := range candidates {
+		switch {
+		case slices.Contains(found, id):
+			quotes = append(quotes, id)
+		case id == draft.ReplyToID:
+			errs = append(errs, validation.FieldError{
+				Field:   validation.FieldReplyTo,
+				Message: fmt.Sprintf("Комментарий #%d не найден в этом треде", id),
+			})
+		case id != post.ID:
+			missing = append(missing, fmt.Sprintf(">>%d", id))
+		}
+	}
+	if len(missing) > 0 {
+		errs = append(errs, validation.FieldError{
+			Field:   validation.FieldContent,
+			Message: "Сообщения не найдены в этом треде: " + strings.Join(missing, ", "),
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	// Порядок совпадает с выборкой из БД
+	slices.Sort(quotes)
+	return quotes, nil
 }
 
 // CreateComment создает новый комментарий
@@ -51,6 +284,25 @@ func (s *CommentService) CreateComment(
 	imageURL string,
 	replyToID int64,
 ) (*models.Comment, error) {
+	return s.SubmitComment(ctx, &models.CommentDraft{
+		PostID:    postID,
+		UserID:    userID,
+		Content:   content,
+		ImageURL:  imageURL,
+		ReplyToID: replyToID,
+	})
+}
+
+// SubmitComment нормализует и проверяет черновик, пропускает его через фильтр
+// и спам-оценщик и сохраняет комментарий. Ошибки полей возвращаются как validation.Errors
+func (s *CommentService) SubmitComment(ctx context.Context, draft *models.CommentDraft) (*models.Comment, error) {
+	if err := s.validator.Comment(draft); err != nil {
+		slog.Warn("Комментарий не прошел проверку", "post_id", draft.PostID, "user_id", draft.UserID, "error", err)
+		return nil, err
+	}
+
+	postID, userID, replyToID := draft.PostID, draft.UserID, draft.ReplyToID
+
 	// Проверяем существование поста
 	post, err := s.postRepo.GetByID(ctx, postID)
 	if err != nil {
@@ -63,6 +315,18 @@ func (s *CommentService) CreateComment(
 		return nil, fmt.Errorf("нельзя комментировать архивные посты")
 	}
 
+	if post.IsLocked {
+		slog.Warn("Попытка создать комментарий в закрытом треде", "post_id", postID, "user_id", userID)
+		return nil, ErrThreadLocked
+	}
+
+	// Цитаты на чужие треды и несуществующие комментарии отклоняются как ошибки полей
+	quotes, err := s.resolveQuotes(ctx, post, draft)
+	if err != nil {
+		slog.Warn("Неверные цитаты комментария", "post_id", postID, "user_id", userID, "error", err)
+		return nil, err
+	}
+
 	// Получаем информацию о пользователе
 	user, err := s.userRepo.GetByID(ctx, userID)
 	if err != nil {
@@ -75,14 +339,15 @@ func (s *CommentService) CreateComment(
 		}
 	}
 
-	// Проверяем существование родительского комментария, если указан
-	if replyToID > 0 {
-		_, err := s.commentRepo.GetByID(ctx, replyToID)
-		if err != nil {
-			slog.Error("Ошибка при получении родительского комментария", "reply_to_id", replyToID, "error", err)
-			// Если родительский комментарий не найден, сбрасываем replyToID
-			replyToID = 0
-		}
+	// Проверяем текст фильтром содержимого и спам-оценщиком
+	spamInput := models.SpamInput{
+		Text:          draft.Content,
+		ImageHash:     draft.ImageHash,
+		UserCreatedAt: user.CreatedAt,
+	}
+	checked, err := screenSubmission(ctx, s.contentFilter, s.spamScorer, spamInput, draft.Content)
+	if err != nil {
+		return nil, err
 	}
 
 	// Создаем объект комментария
@@ -91,10 +356,19 @@ func (s *CommentService) CreateComment(
 		UserID:    userID,
 		UserName:  user.Username,
 		AvatarURL: user.AvatarURL,
-		Content:   content,
-		ImageURL:  imageURL,
+		Content:   checked.texts[0],
+		ImageURL:  draft.ImageURL,
 		CreatedAt: time.Now(),
 		ReplyToID: replyToID,
+		Quotes:    quotes,
+		Replies:   []int64{},
+		Status:    checked.status,
+		SpamScore: checked.spamScore,
+
+		ImageWidth:   draft.ImageWidth,
+		ImageHeight:  draft.ImageHeight,
+		ThumbnailURL: draft.ThumbnailURL,
+		Attachments:  draft.Attachments,
 	}
 
 	// Сохраняем комментарий в БД
@@ -107,6 +381,10 @@ func (s *CommentService) CreateComment(
 	// Устанавливаем ID созданного комментария
 	comment.ID = commentID
 
+	if s.spamScorer != nil {
+		s.spamScorer.Remember(ctx, models.FingerprintComment, comment.ID, userID, spamInput)
+	}
+
 	slog.Info("Комментарий успешно создан",
 		"comment_id", comment.ID,
 		"post_id", postID,
@@ -116,8 +394,16 @@ func (s *CommentService) CreateComment(
 	return comment, nil
 }
 
-// DeleteComment удаляет комментарий
+// DeleteComment удаляет комментарий вместе с ответами и освобождает их изображения
 func (s *CommentService) DeleteComment(ctx context.Context, id int64) error {
 	slog.Info("Удаление комментария", "id", id)
-	return s.commentRepo.Delete(ctx, id)
+	imageURLs, err := s.commentRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if s.imageService != nil {
+		s.imageService.Release(ctx, imageURLs)
+	}
+	return nil
 }
@@ -2,18 +2,22 @@ package services_test
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"testing"
 	"time"
 
 	"1337b04rd/internal/domain/models"
 	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/domain/validation"
 )
 
 // MockCommentRepository имитирует репозиторий комментариев для тестирования
 type MockCommentRepository struct {
 	comments      map[int64]*models.Comment
 	postComments  map[int64][]*models.Comment
+	quotes        map[int64][]int64
 	currentID     int64
 	lastCommentID int64
 }
@@ -23,6 +27,7 @@ func NewMockCommentRepository() *MockCommentRepository {
 	return &MockCommentRepository{
 		comments:     make(map[int64]*models.Comment),
 		postComments: make(map[int64][]*models.Comment),
+		quotes:       make(map[int64][]int64),
 		currentID:    1,
 	}
 }
@@ -54,6 +59,102 @@ func (m *MockCommentRepository) GetByPostID(ctx context.Context, postID int64, l
 	return comments[offset:end], nil
 }
 
+// GetPageAfter возвращает видимые комментарии поста после комментария afterID
+func (m *MockCommentRepository) GetPageAfter(ctx context.Context, postID, viewerID, afterID int64, limit int) ([]*models.Comment, error) {
+	comments := m.postComments[postID]
+	start := 0
+	if afterID > 0 {
+		start = slices.IndexFunc(comments, func(c *models.Comment) bool { return c.ID == afterID }) + 1
+		if start == 0 {
+			return nil, nil
+		}
+	}
+
+	var page []*models.Comment
+	for _, comment := range comments[start:] {
+		if len(page) == limit {
+			break
+		}
+		if comment.Status.VisibleTo(comment.UserID, viewerID) {
+			page = append(page, comment)
+		}
+	}
+	return page, nil
+}
+
+// GetTreeByPostID строит дерево по reply_to_id обходом в глубину не глубже maxDepth
+func (m *MockCommentRepository) GetTreeByPostID(ctx context.Context, postID, viewerID int64, maxDepth, limit, offset int) ([]*models.Comment, error) {
+	children := make(map[int64][]*models.Comment)
+	var roots []*models.Comment
+	for _, comment := range m.postComments[postID] {
+		if !comment.Status.VisibleTo(comment.UserID, viewerID) {
+			continue
+		}
+		if comment.ReplyToID == 0 {
+			roots = append(roots, comment)
+		} else {
+			children[comment.ReplyToID] = append(children[comment.ReplyToID], comment)
+		}
+	}
+
+	var result []*models.Comment
+	var walk func(comment *models.Comment, depth int, path []int64)
+	walk = func(comment *models.Comment, depth int, path []int64) {
+		node := *comment
+		node.Depth = depth
+		node.Path = append(slices.Clone(path), comment.ID)
+		result = append(result, &node)
+		if depth == maxDepth {
+			node.MoreReplies = len(children[comment.ID])
+			return
+		}
+		for _, child := range children[comment.ID] {
+			walk(child, depth+1, node.Path)
+		}
+	}
+
+	for i, root := range roots {
+		if i >= offset && i < offset+limit {
+			walk(root, 0, nil)
+		}
+	}
+	return result, nil
+}
+
+// GetLinks собирает цитаты и ответы из сохраненных комментариев
+func (m *MockCommentRepository) GetLinks(ctx context.Context, ids []int64) (*models.CommentLinks, error) {
+	links := &models.CommentLinks{
+		Quotes:  make(map[int64][]int64),
+		Replies: make(map[int64][]int64),
+	}
+	for id := int64(1); id < m.currentID; id++ {
+		comment, exists := m.comments[id]
+		if !exists {
+			continue
+		}
+		for _, quoted := range m.quotes[id] {
+			if slices.Contains(ids, comment.ID) {
+				links.Quotes[comment.ID] = append(links.Quotes[comment.ID], quoted)
+			}
+			if slices.Contains(ids, quoted) && comment.Status.Public() {
+				links.Replies[quoted] = append(links.Replies[quoted], comment.ID)
+			}
+		}
+	}
+	return links, nil
+}
+
+// FindInPost возвращает ID комментариев поста
+func (m *MockCommentRepository) FindInPost(ctx context.Context, postID int64, ids []int64) ([]int64, error) {
+	var found []int64
+	for _, comment := range m.postComments[postID] {
+		if slices.Contains(ids, comment.ID) {
+			found = append(found, comment.ID)
+		}
+	}
+	return found, nil
+}
+
 // GetLastCommentByPostID возвращает последний комментарий к посту
 func (m *MockCommentRepository) GetLastCommentByPostID(ctx context.Context, postID int64) (*models.Comment, error) {
 	comments, exists := m.postComments[postID]
@@ -68,6 +169,7 @@ func (m *MockCommentRepository) Create(ctx context.Context, comment *models.Comm
 	id := m.currentID
 	comment.ID = id
 	m.comments[id] = comment
+	m.quotes[id] = slices.Clone(comment.Quotes)
 
 	// Добавляем комментарий в список комментариев к посту
 	if _, exists := m.postComments[comment.PostID]; !exists {
@@ -80,11 +182,11 @@ func (m *MockCommentRepository) Create(ctx context.Context, comment *models.Comm
 	return id, nil
 }
 
-// Delete удаляет комментарий
-func (m *MockCommentRepository) Delete(ctx context.Context, id int64) error {
+// Delete удаляет комментарий и возвращает адреса его изображений
+func (m *MockCommentRepository) Delete(ctx context.Context, id int64) ([]string, error) {
 	comment, exists := m.comments[id]
 	if !exists {
-		return fmt.Errorf("комментарий с ID %d не найден", id)
+		return nil, fmt.Errorf("комментарий с ID %d не найден", id)
 	}
 
 	// Удаляем комментарий из списка комментариев к посту
@@ -98,6 +200,36 @@ func (m *MockCommentRepository) Delete(ctx context.Context, id int64) error {
 	}
 
 	delete(m.comments, id)
+	var imageURLs []string
+	for _, url := range []string{comment.ImageURL, comment.ThumbnailURL} {
+		if url != "" {
+			imageURLs = append(imageURLs, url)
+		}
+	}
+	return imageURLs, nil
+}
+
+// GetByStatus возвращает комментарии с указанными статусами модерации
+func (m *MockCommentRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Comment, error) {
+	var result []*models.Comment
+	for _, item := range m.comments {
+		for _, status := range statuses {
+			if item.Status == status {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetStatus меняет статус модерации
+func (m *MockCommentRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	item, exists := m.comments[id]
+	if !exists {
+		return fmt.Errorf("комментарий с ID %d не найден", id)
+	}
+	item.Status = status
 	return nil
 }
 
@@ -163,6 +295,31 @@ func TestCreateComment(t *testing.T) {
 	}
 }
 
+// TestCreateCommentLockedThread проверяет, что в закрытый тред нельзя ответить
+func TestCreateCommentLockedThread(t *testing.T) {
+	mockCommentRepo := NewMockCommentRepository()
+	mockUserRepo := NewMockUserRepository()
+	mockPostRepo := NewMockPostRepository()
+
+	mockUserRepo.users[1] = &models.User{ID: 1, Username: "user1", CreatedAt: time.Now()}
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Тред", UserID: 1, CreatedAt: time.Now(), IsLocked: true}
+
+	commentService := services.NewCommentService(mockCommentRepo, mockUserRepo, mockPostRepo)
+
+	_, err := commentService.CreateComment(context.Background(), 1, 1, "Ответ", "", 0)
+	if !errors.Is(err, services.ErrThreadLocked) {
+		t.Fatalf("Ожидалась ошибка закрытого треда, получено: %v", err)
+	}
+	if len(mockCommentRepo.comments) != 0 {
+		t.Error("Комментарий не должен сохраняться в закрытом треде")
+	}
+
+	mockPostRepo.SetLocked(context.Background(), 1, false)
+	if _, err := commentService.CreateComment(context.Background(), 1, 1, "Ответ", "", 0); err != nil {
+		t.Errorf("После открытия треда ответ должен приниматься: %v", err)
+	}
+}
+
 func TestCreateReplyComment(t *testing.T) {
 	// Инициализация мок-репозиториев
 	mockCommentRepo := NewMockCommentRepository()
@@ -310,3 +467,176 @@ func TestGetCommentsByPostID(t *testing.T) {
 		t.Errorf("Неверное содержимое комментария: ожидалось 'Comment 2', получено '%s'", comments[0].Content)
 	}
 }
+
+func TestGetCommentsReplies(t *testing.T) {
+	ctx := context.Background()
+	mockCommentRepo := NewMockCommentRepository()
+	mockUserRepo := NewMockUserRepository()
+	mockPostRepo := NewMockPostRepository()
+
+	mockUserRepo.users[1] = &models.User{ID: 1, Username: "user1", CreatedAt: time.Now()}
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Test Post", UserID: 1, CreatedAt: time.Now()}
+
+	commentService := services.NewCommentService(mockCommentRepo, mockUserRepo, mockPostRepo)
+
+	first, _ := commentService.CreateComment(ctx, 1, 1, "Первый", "", 0)
+	second, _ := commentService.CreateComment(ctx, 1, 1, "Второй", "", first.ID)
+	third, _ := commentService.CreateComment(ctx, 1, 1, fmt.Sprintf(">>%d >>%d и снова >>%d", first.ID, second.ID, first.ID), "", 0)
+
+	comments, err := commentService.GetCommentsByPostID(ctx, 1, 10, 0)
+	if err != nil {
+		t.Fatalf("Ошибка при получении комментариев к посту: %v", err)
+	}
+
+	want := map[int64][]int64{
+		first.ID:  {second.ID, third.ID},
+		second.ID: {third.ID},
+		third.ID:  {},
+	}
+	for _, comment := range comments {
+		if !slices.Equal(comment.Replies, want[comment.ID]) {
+			t.Errorf("Неверные ответы на комментарий %d: ожидалось %v, получено %v", comment.ID, want[comment.ID], comment.Replies)
+		}
+	}
+
+	single, err := commentService.GetCommentByID(ctx, second.ID)
+	if err != nil {
+		t.Fatalf("Ошибка при получении комментария: %v", err)
+	}
+	if !slices.Equal(single.Replies, []int64{third.ID}) {
+		t.Errorf("Неверные ответы на комментарий %d: %v", second.ID, single.Replies)
+	}
+}
+
+func TestCreateCommentQuotes(t *testing.T) {
+	ctx := context.Background()
+	mockCommentRepo := NewMockCommentRepository()
+	mockUserRepo := NewMockUserRepository()
+	mockPostRepo := NewMockPostRepository()
+
+	mockUserRepo.users[1] = &models.User{ID: 1, Username: "user1", CreatedAt: time.Now()}
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Тред", UserID: 1, CreatedAt: time.Now()}
+	mockPostRepo.posts[100] = &models.Post{ID: 100, Title: "Другой тред", UserID: 1, CreatedAt: time.Now()}
+
+	commentService := services.NewCommentService(mockCommentRepo, mockUserRepo, mockPostRepo)
+
+	first, _ := commentService.CreateComment(ctx, 1, 1, "Первый", "", 0)
+	second, _ := commentService.CreateComment(ctx, 1, 1, "Второй", "", 0)
+	foreign, _ := commentService.CreateComment(ctx, 100, 1, "Из другого треда", "", 0)
+
+	// Ответ сразу на несколько комментариев и на OP
+	multi, err := commentService.CreateComment(ctx, 1, 1, fmt.Sprintf(">>%d\n>>%d\n>>1 OP", second.ID, first.ID), "", first.ID)
+	if err != nil {
+		t.Fatalf("Ошибка при создании комментария с цитатами: %v", err)
+	}
+	if !slices.Equal(multi.Quotes, []int64{first.ID, second.ID}) {
+		t.Errorf("Неверные цитаты: ожидалось %v, получено %v", []int64{first.ID, second.ID}, multi.Quotes)
+	}
+
+	// Цитата из чужого треда
+	_, err = commentService.CreateComment(ctx, 1, 1, fmt.Sprintf(">>%d", foreign.ID), "", 0)
+	var errs validation.Errors
+	if !errors.As(err, &errs) || errs.Fields()[validation.FieldContent] == "" {
+		t.Errorf("Ожидалась ошибка поля comment, получено: %v", err)
+	}
+
+	// Ответ на несуществующий комментарий больше не сбрасывается молча
+	_, err = commentService.CreateComment(ctx, 1, 1, "Ответ", "", 999)
+	if !errors.As(err, &errs) || errs.Fields()[validation.FieldReplyTo] == "" {
+		t.Errorf("Ожидалась ошибка поля reply_to_id, получено: %v", err)
+	}
+}
+
+func TestGetCommentTree(t *testing.T) {
+	ctx := context.Background()
+	mockCommentRepo := NewMockCommentRepository()
+	mockUserRepo := NewMockUserRepository()
+	mockPostRepo := NewMockPostRepository()
+
+	mockUserRepo.users[1] = &models.User{ID: 1, Username: "user1", CreatedAt: time.Now()}
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Тред", UserID: 1, CreatedAt: time.Now()}
+
+	commentService := services.NewCommentService(mockCommentRepo, mockUserRepo, mockPostRepo)
+
+	// Первая ветка глубже предела, вторая и третья из одного комментария
+	parent, _ := commentService.CreateComment(ctx, 1, 1, "Корень", "", 0)
+	for i := 0; i < services.MaxTreeDepth+1; i++ {
+		parent, _ = commentService.CreateComment(ctx, 1, 1, fmt.Sprintf("Уровень %d", i+1), "", parent.ID)
+	}
+	second, _ := commentService.CreateComment(ctx, 1, 1, "Вторая ветка", "", 0)
+	commentService.CreateComment(ctx, 1, 1, "Третья ветка", "", 0)
+
+	tree, err := commentService.GetCommentTree(ctx, 1, 1, 2, 0)
+	if err != nil {
+		t.Fatalf("Ошибка при получении дерева комментариев: %v", err)
+	}
+	if !tree.HasMore {
+		t.Error("Ожидалась следующая страница веток")
+	}
+	// Ответ глубже предела не выводится, у последнего показанного отмечен скрытый ответ
+	if len(tree.Comments) != services.MaxTreeDepth+2 {
+		t.Fatalf("Неверное количество комментариев: ожидалось %d, получено %d", services.MaxTreeDepth+2, len(tree.Comments))
+	}
+
+	deepest := tree.Comments[services.MaxTreeDepth]
+	if deepest.Depth != services.MaxTreeDepth || len(deepest.Path) != services.MaxTreeDepth+1 || deepest.MoreReplies != 1 {
+		t.Errorf("Глубина должна ограничиваться %d: depth=%d, path=%v, more=%d", services.MaxTreeDepth, deepest.Depth, deepest.Path, deepest.MoreReplies)
+	}
+	if last := tree.Comments[len(tree.Comments)-1]; last.ID != second.ID || last.Depth != 0 {
+		t.Errorf("Последней должна быть вторая ветка, получено: %+v", last)
+	}
+
+	tree, _ = commentService.GetCommentTree(ctx, 1, 1, 2, 2)
+	if tree.HasMore || len(tree.Comments) != 1 {
+		t.Errorf("На второй странице ожидалась одна ветка: %d, has_more=%v", len(tree.Comments), tree.HasMore)
+	}
+}
+
+// TestGetCommentPage проверяет загрузку комментариев по курсору и опрос новых ответов
+func TestGetCommentPage(t *testing.T) {
+	ctx := context.Background()
+	mockCommentRepo := NewMockCommentRepository()
+	mockUserRepo := NewMockUserRepository()
+	mockPostRepo := NewMockPostRepository()
+
+	mockUserRepo.users[1] = &models.User{ID: 1, Username: "user1", CreatedAt: time.Now()}
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Тред", UserID: 1, CreatedAt: time.Now()}
+
+	commentService := services.NewCommentService(mockCommentRepo, mockUserRepo, mockPostRepo)
+
+	var ids []int64
+	for i := 0; i < 5; i++ {
+		comment, err := commentService.CreateComment(ctx, 1, 1, fmt.Sprintf("Комментарий %d", i+1), "", 0)
+		if err != nil {
+			t.Fatalf("Ошибка при создании комментария: %v", err)
+		}
+		ids = append(ids, comment.ID)
+	}
+	// Скрытый комментарий не попадает на страницу постороннего читателя
+	mockCommentRepo.comments[ids[1]].Status = models.ModerationShadowHidden
+
+	page, err := commentService.GetCommentPage(ctx, 1, 2, 0, 2)
+	if err != nil {
+		t.Fatalf("Ошибка при получении страницы комментариев: %v", err)
+	}
+	if !page.HasMore || len(page.Comments) != 2 || page.Comments[1].ID != ids[2] {
+		t.Fatalf("Неверная первая страница: %d комментариев, has_more=%v", len(page.Comments), page.HasMore)
+	}
+
+	page, _ = commentService.GetCommentPage(ctx, 1, 2, page.NextAfter, 2)
+	if page.HasMore || len(page.Comments) != 2 || page.NextAfter != ids[4] {
+		t.Errorf("Неверная последняя страница: %d комментариев, next_after=%d", len(page.Comments), page.NextAfter)
+	}
+
+	// Опрос без новых ответов сохраняет курсор
+	page, _ = commentService.GetCommentPage(ctx, 1, 2, ids[4], 0)
+	if len(page.Comments) != 0 || page.NextAfter != ids[4] {
+		t.Errorf("Ожидалась пустая страница с прежним курсором: %d, next_after=%d", len(page.Comments), page.NextAfter)
+	}
+
+	commentService.CreateComment(ctx, 1, 1, "Новый ответ", "", 0)
+	page, _ = commentService.GetCommentPage(ctx, 1, 2, ids[4], 0)
+	if len(page.Comments) != 1 || page.Comments[0].Content != "Новый ответ" {
+		t.Errorf("Ожидался один новый ответ, получено %d", len(page.Comments))
+	}
+}
@@ -0,0 +1,197 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sync"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// ErrContentRejected возвращается, когда отправка отклонена фильтром содержимого
+var ErrContentRejected = errors.New("сообщение отклонено фильтром")
+
+// compiledRule правило фильтра с готовым регулярным выражением
+type compiledRule struct {
+	rule *models.FilterRule
+	re   *regexp.Regexp
+}
+
+// ContentFilter проверяет текст постов и комментариев по правилам из БД.
+// Правила кэшируются и перечитываются раз в reloadInterval или сразу после изменения
+type ContentFilter struct {
+	ruleRepo       repositories.FilterRuleRepository
+	reloadInterval time.Duration
+
+	mu       sync.RWMutex
+	rules    []compiledRule
+	loadedAt time.Time
+}
+
+// NewContentFilter создает новый экземпляр фильтра содержимого
+func NewContentFilter(ruleRepo repositories.FilterRuleRepository, reloadInterval time.Duration) *ContentFilter {
+	return &ContentFilter{
+		ruleRepo:       ruleRepo,
+		reloadInterval: reloadInterval,
+	}
+}
+
+// Apply проверяет тексты по всем включенным правилам.
+// Замены применяются ко всем текстам, статус модерации берется самый строгий
+// из сработавших правил. При срабатывании правила reject возвращается ErrContentRejected
+func (f *ContentFilter) Apply(ctx context.Context, texts ...string) (*models.FilterResult, error) {
+	result := &models.FilterResult{
+		Texts:  append([]string(nil), texts...),
+		Status: models.ModerationVisible,
+	}
+
+	for _, compiled := range f.activeRules(ctx) {
+		matched := false
+		for i, text := range result.Texts {
+			if !compiled.re.MatchString(text) {
+				continue
+			}
+			matched = true
+			if compiled.rule.Action == models.FilterReplace {
+				result.Texts[i] = compiled.re.ReplaceAllString(text, compiled.rule.Replacement)
+			}
+		}
+		if !matched {
+			continue
+		}
+
+		result.Matched = append(result.Matched, compiled.rule.ID)
+
+		switch compiled.rule.Action {
+		case models.FilterReject:
+			slog.Warn("Сообщение отклонено фильтром", "rule_id", compiled.rule.ID)
+			if compiled.rule.Note != "" {
+				return nil, fmt.Errorf("%w: %s", ErrContentRejected, compiled.rule.Note)
+			}
+			return nil, ErrContentRejected
+		case models.FilterShadowHide:
+			result.Status = result.Status.Stricter(models.ModerationShadowHidden)
+		case models.FilterFlag:
+			result.Status = result.Status.Stricter(models.ModerationFlagged)
+		}
+	}
+
+	if len(result.Matched) > 0 {
+		slog.Info("Сработали правила фильтра", "rules", result.Matched, "status", result.Status)
+	}
+	return result, nil
+}
+
+// Rules возвращает все правила, включая отключенные
+func (f *ContentFilter) Rules(ctx context.Context) ([]*models.FilterRule, error) {
+	return f.ruleRepo.GetAll(ctx)
+}
+
+// CreateRule проверяет и сохраняет новое правило
+func (f *ContentFilter) CreateRule(ctx context.Context, rule *models.FilterRule) error {
+	if _, err := rule.Compile(); err != nil {
+		return err
+	}
+
+	id, err := f.ruleRepo.Create(ctx, rule)
+	if err != nil {
+		return err
+	}
+
+	rule.ID = id
+	f.Invalidate()
+	return nil
+}
+
+// UpdateRule проверяет и обновляет существующее правило
+func (f *ContentFilter) UpdateRule(ctx context.Context, rule *models.FilterRule) error {
+	if _, err := rule.Compile(); err != nil {
+		return err
+	}
+
+	if err := f.ruleRepo.Update(ctx, rule); err != nil {
+		return err
+	}
+
+	f.Invalidate()
+	return nil
+}
+
+// SetRuleEnabled включает или отключает правило
+func (f *ContentFilter) SetRuleEnabled(ctx context.Context, id int64, enabled bool) error {
+	rule, err := f.ruleRepo.GetByID(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	rule.Enabled = enabled
+	return f.UpdateRule(ctx, rule)
+}
+
+// DeleteRule удаляет правило
+func (f *ContentFilter) DeleteRule(ctx context.Context, id int64) error {
+	if err := f.ruleRepo.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	f.Invalidate()
+	return nil
+}
+
+// Invalidate сбрасывает кэш, правила будут перечитаны при следующей проверке
+func (f *ContentFilter) Invalidate() {
+	f.mu.Lock()
+	f.loadedAt = time.Time{}
+	f.mu.Unlock()
+}
+
+// activeRules возвращает включенные правила, перечитывая их из БД при устаревании кэша
+func (f *ContentFilter) activeRules(ctx context.Context) []compiledRule {
+	f.mu.RLock()
+	if !f.loadedAt.IsZero() && time.Since(f.loadedAt) < f.reloadInterval {
+		rules := f.rules
+		f.mu.RUnlock()
+		return rules
+	}
+	f.mu.RUnlock()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Другой запрос мог уже перечитать правила, пока мы ждали блокировку
+	if !f.loadedAt.IsZero() && time.Since(f.loadedAt) < f.reloadInterval {
+		return f.rules
+	}
+
+	rules, err := f.ruleRepo.GetAll(ctx)
+	if err != nil {
+		// Оставляем прежние правила, чтобы сбой БД не отключал фильтр полностью,
+		// и не повторяем запрос до следующего интервала
+		slog.Error("Ошибка загрузки правил фильтра, используются прежние", "error", err)
+		f.loadedAt = time.Now()
+		return f.rules
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		re, err := rule.Compile()
+		if err != nil {
+			slog.Error("Пропущено некорректное правило фильтра", "rule_id", rule.ID, "error", err)
+			continue
+		}
+		compiled = append(compiled, compiledRule{rule: rule, re: re})
+	}
+
+	f.rules = compiled
+	f.loadedAt = time.Now()
+	slog.Info("Правила фильтра загружены", "count", len(compiled))
+	return f.rules
+}
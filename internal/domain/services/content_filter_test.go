@@ -0,0 +1,150 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// MockFilterRuleRepository реализует интерфейс репозитория правил фильтра для тестов
+type MockFilterRuleRepository struct {
+	rules  []*models.FilterRule
+	nextID int64
+	loads  int
+}
+
+// GetAll возвращает все правила
+func (m *MockFilterRuleRepository) GetAll(ctx context.Context) ([]*models.FilterRule, error) {
+	m.loads++
+	return m.rules, nil
+}
+
+// GetByID возвращает правило по ID
+func (m *MockFilterRuleRepository) GetByID(ctx context.Context, id int64) (*models.FilterRule, error) {
+	for _, rule := range m.rules {
+		if rule.ID == id {
+			copied := *rule
+			return &copied, nil
+		}
+	}
+	return nil, errors.New("правило не найдено")
+}
+
+// Create создает правило
+func (m *MockFilterRuleRepository) Create(ctx context.Context, rule *models.FilterRule) (int64, error) {
+	m.nextID++
+	rule.ID = m.nextID
+	m.rules = append(m.rules, rule)
+	return rule.ID, nil
+}
+
+// Update обновляет правило
+func (m *MockFilterRuleRepository) Update(ctx context.Context, rule *models.FilterRule) error {
+	for i := range m.rules {
+		if m.rules[i].ID == rule.ID {
+			m.rules[i] = rule
+			return nil
+		}
+	}
+	return errors.New("правило не найдено")
+}
+
+// Delete удаляет правило
+func (m *MockFilterRuleRepository) Delete(ctx context.Context, id int64) error {
+	for i := range m.rules {
+		if m.rules[i].ID == id {
+			m.rules = append(m.rules[:i], m.rules[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("правило не найдено")
+}
+
+// TestContentFilterActions проверяет действия правил фильтра
+func TestContentFilterActions(t *testing.T) {
+	ctx := context.Background()
+	filter := services.NewContentFilter(&MockFilterRuleRepository{}, time.Hour)
+
+	rules := []*models.FilterRule{
+		{Pattern: `(?i)badword`, Action: models.FilterReplace, Replacement: "***", Enabled: true},
+		{Pattern: `spam\.example`, Action: models.FilterReject, Note: "спам-домен", Enabled: true},
+		{Pattern: `ref=\d+`, Action: models.FilterShadowHide, Enabled: true},
+		{Pattern: `casino`, Action: models.FilterFlag, Enabled: true},
+	}
+	for _, rule := range rules {
+		if err := filter.CreateRule(ctx, rule); err != nil {
+			t.Fatalf("Ошибка создания правила: %v", err)
+		}
+	}
+
+	result, err := filter.Apply(ctx, "Заголовок BadWord", "обычный текст")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if result.Texts[0] != "Заголовок ***" || result.Texts[1] != "обычный текст" {
+		t.Errorf("Замена не применена: %q", result.Texts)
+	}
+	if result.Status != models.ModerationVisible {
+		t.Errorf("Ожидался статус visible, получено: %s", result.Status)
+	}
+
+	_, err = filter.Apply(ctx, "заходите на spam.example")
+	if !errors.Is(err, services.ErrContentRejected) {
+		t.Errorf("Ожидалась ошибка отклонения, получено: %v", err)
+	}
+
+	result, err = filter.Apply(ctx, "casino по ссылке ?ref=123")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if result.Status != models.ModerationShadowHidden {
+		t.Errorf("Ожидался статус shadow_hidden, получено: %s", result.Status)
+	}
+	if len(result.Matched) != 2 {
+		t.Errorf("Ожидалось 2 сработавших правила, получено: %v", result.Matched)
+	}
+
+	result, err = filter.Apply(ctx, "casino")
+	if err != nil {
+		t.Fatalf("Неожиданная ошибка: %v", err)
+	}
+	if result.Status != models.ModerationFlagged {
+		t.Errorf("Ожидался статус flagged, получено: %s", result.Status)
+	}
+}
+
+// TestContentFilterReload проверяет кэширование правил и сброс кэша при изменении
+func TestContentFilterReload(t *testing.T) {
+	ctx := context.Background()
+	repo := &MockFilterRuleRepository{}
+	filter := services.NewContentFilter(repo, time.Hour)
+
+	rule := &models.FilterRule{Pattern: `spam`, Action: models.FilterReject, Enabled: true}
+	if err := filter.CreateRule(ctx, rule); err != nil {
+		t.Fatalf("Ошибка создания правила: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := filter.Apply(ctx, "spam"); !errors.Is(err, services.ErrContentRejected) {
+			t.Fatalf("Ожидалась ошибка отклонения, получено: %v", err)
+		}
+	}
+	if repo.loads != 1 {
+		t.Errorf("Правила должны загружаться один раз, загружено: %d", repo.loads)
+	}
+
+	if err := filter.SetRuleEnabled(ctx, rule.ID, false); err != nil {
+		t.Fatalf("Ошибка отключения правила: %v", err)
+	}
+	if _, err := filter.Apply(ctx, "spam"); err != nil {
+		t.Errorf("Отключенное правило не должно срабатывать: %v", err)
+	}
+
+	if err := filter.CreateRule(ctx, &models.FilterRule{Pattern: `(`, Action: models.FilterReject}); err == nil {
+		t.Errorf("Некорректное регулярное выражение должно быть отклонено")
+	}
+}
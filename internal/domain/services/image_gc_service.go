@@ -0,0 +1,242 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// maxReportedOrphans сколько объектов без ссылок перечисляется в отчете прохода
+const maxReportedOrphans = 100
+
+// ImageGCService удаляет из хранилища объекты, на которые не ссылаются посты и комментарии.
+// Такие объекты остаются, например, после ошибки сохранения поста или удаления
+// записи до появления учета ссылок
+type ImageGCService struct {
+	storage    external.ImageStorage
+	objectRepo repositories.ImageObjectRepository
+	config     models.ImageGCConfig
+
+	statsLock    sync.Mutex
+	lastReport   *models.ImageGCReport
+	runs         int
+	deletedCount int
+	deletedBytes int64
+	errorCount   int
+	isRunning    bool
+}
+
+// ImageGCStats содержит статистику работы сборщика изображений
+type ImageGCStats struct {
+	Runs         int
+	DeletedCount int
+	DeletedBytes int64
+	ErrorCount   int
+	IsRunning    bool
+	DryRun       bool
+	GracePeriod  time.Duration
+	// LastReport отчет последнего прохода, nil до первого прохода
+	LastReport *models.ImageGCReport
+}
+
+// NewImageGCService создает новый экземпляр сборщика изображений
+func NewImageGCService(storage external.ImageStorage, objectRepo repositories.ImageObjectRepository, config models.ImageGCConfig) *ImageGCService {
+	return &ImageGCService{
+		storage:    storage,
+		objectRepo: objectRepo,
+		config:     config,
+	}
+}
+
+// StartGCJob запускает фоновую сборку изображений
+func (s *ImageGCService) StartGCJob(ctx context.Context) {
+	slog.Info("Запуск фоновой сборки изображений",
+		"interval", s.config.Interval,
+		"grace_period", s.config.GracePeriod,
+		"dry_run", s.config.DryRun)
+
+	s.statsLock.Lock()
+	s.isRunning = true
+	s.statsLock.Unlock()
+	go s.gcJob(ctx)
+}
+
+// GetStats возвращает статистику работы сборщика
+func (s *ImageGCService) GetStats() ImageGCStats {
+	s.statsLock.Lock()
+	defer s.statsLock.Unlock()
+
+	return ImageGCStats{
+		Runs:         s.runs,
+		DeletedCount: s.deletedCount,
+		DeletedBytes: s.deletedBytes,
+		ErrorCount:   s.errorCount,
+		IsRunning:    s.isRunning,
+		DryRun:       s.config.DryRun,
+		GracePeriod:  s.config.GracePeriod,
+		LastReport:   s.lastReport,
+	}
+}
+
+// gcJob периодически запускает проход сборщика
+func (s *ImageGCService) gcJob(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Паника в одном проходе не останавливает сборщик
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						slog.Error("Паника в сборке изображений", "panic", r, "stack", string(debug.Stack()))
+						s.statsLock.Lock()
+						s.errorCount++
+						s.statsLock.Unlock()
+					}
+				}()
+
+				s.Collect(ctx)
+			}()
+		case <-ctx.Done():
+			s.statsLock.Lock()
+			s.isRunning = false
+			s.statsLock.Unlock()
+			slog.Info("Сборка изображений остановлена")
+			return
+		}
+	}
+}
+
+// Collect выполняет один проход: сравнивает объекты бакетов с адресами в БД
+// и удаляет объекты без ссылок старше GracePeriod. В режиме DryRun объекты
+// только перечисляются в отчете и журнале
+func (s *ImageGCService) Collect(ctx context.Context) *models.ImageGCReport {
+	report := &models.ImageGCReport{StartedAt: time.Now(), DryRun: s.config.DryRun}
+	defer s.finish(report)
+
+	// Без полного списка ссылок удалять нельзя ничего
+	referenced, err := s.referencedObjects(ctx)
+	if err != nil {
+		slog.Error("Ошибка получения ссылок на изображения, сборка пропущена", "error", err)
+		report.Errors++
+		return report
+	}
+
+	cutoff := report.StartedAt.Add(-s.config.GracePeriod)
+	for _, bucket := range s.config.Buckets {
+		objects, err := s.storage.ListObjects(ctx, bucket)
+		if err != nil {
+			slog.Error("Ошибка получения списка объектов", "bucket", bucket, "error", err)
+			report.Errors++
+			continue
+		}
+
+		for _, object := range objects {
+			report.Scanned++
+			if referenced[object.Bucket+"/"+object.Key] {
+				report.Referenced++
+				continue
+			}
+			// Объекты без времени изменения считаются новыми
+			if object.LastModified.IsZero() || object.LastModified.After(cutoff) {
+				report.Recent++
+				continue
+			}
+			s.collectObject(ctx, object, cutoff, report)
+		}
+	}
+	return report
+}
+
+// collectObject удаляет учет объекта без ссылок и сам объект
+func (s *ImageGCService) collectObject(ctx context.Context, object models.StoredObject, cutoff time.Time, report *models.ImageGCReport) {
+	name := object.Bucket + "/" + object.Key
+
+	if s.config.DryRun {
+		report.Orphaned++
+		s.reportOrphan(report, name)
+		slog.Info("Найдено изображение без ссылок", "bucket", object.Bucket, "key", object.Key, "last_modified", object.LastModified)
+		return
+	}
+
+	// Учет удаляется до объекта: запись без объекта заставила бы повторную
+	// загрузку того же файла пропустить PUT
+	forgotten, err := s.objectRepo.Forget(ctx, object.Bucket, object.Key, cutoff)
+	if err != nil {
+		report.Errors++
+		return
+	}
+	if !forgotten {
+		// Ссылку добавила недавняя загрузка, пост с ней еще может быть сохранен
+		report.Recent++
+		return
+	}
+
+	report.Orphaned++
+	s.reportOrphan(report, name)
+	if err := s.storage.DeleteImage(ctx, object.Bucket, object.Key); err != nil {
+		slog.Error("Ошибка удаления изображения без ссылок", "bucket", object.Bucket, "key", object.Key, "error", err)
+		report.Errors++
+		return
+	}
+	report.Deleted++
+	report.DeletedBytes += object.Size
+	slog.Info("Удалено изображение без ссылок", "bucket", object.Bucket, "key", object.Key, "last_modified", object.LastModified)
+}
+
+// reportOrphan добавляет объект в отчет, пока список не заполнен
+func (s *ImageGCService) reportOrphan(report *models.ImageGCReport, name string) {
+	if len(report.OrphanKeys) < maxReportedOrphans {
+		report.OrphanKeys = append(report.OrphanKeys, name)
+	}
+}
+
+// referencedObjects возвращает множество объектов bucket/key, на которые ссылаются записи БД.
+// Адреса сторонних сайтов в множество не попадают
+func (s *ImageGCService) referencedObjects(ctx context.Context) (map[string]bool, error) {
+	urls, err := s.objectRepo.ReferencedURLs(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения адресов изображений: %w", err)
+	}
+
+	referenced := make(map[string]bool, len(urls))
+	for _, url := range urls {
+		if bucket, objectKey, ok := objectFromURL(url); ok {
+			referenced[bucket+"/"+objectKey] = true
+		}
+	}
+	return referenced, nil
+}
+
+// finish сохраняет отчет прохода в статистике
+func (s *ImageGCService) finish(report *models.ImageGCReport) {
+	report.Duration = time.Since(report.StartedAt)
+
+	s.statsLock.Lock()
+	s.lastReport = report
+	s.runs++
+	s.deletedCount += report.Deleted
+	s.deletedBytes += report.DeletedBytes
+	s.errorCount += report.Errors
+	s.statsLock.Unlock()
+
+	slog.Info("Завершена сборка изображений",
+		"dry_run", report.DryRun,
+		"scanned", report.Scanned,
+		"referenced", report.Referenced,
+		"recent", report.Recent,
+		"orphaned", report.Orphaned,
+		"deleted", report.Deleted,
+		"deleted_bytes", report.DeletedBytes,
+		"errors", report.Errors,
+		"duration", report.Duration)
+}
@@ -0,0 +1,76 @@
+package services_test
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// TestImageGCCollect проверяет, что сборщик удаляет только старые объекты без ссылок
+func TestImageGCCollect(t *testing.T) {
+	ctx := context.Background()
+	old := time.Now().Add(-48 * time.Hour)
+
+	storage := NewMemoryImageStorage()
+	objectRepo := NewMockImageObjectRepository()
+	put := func(name string, modified time.Time) {
+		storage.objects[name] = []byte(name)
+		storage.modified[name] = modified
+	}
+	put("posts/referenced.jpg", old)
+	put("posts/orphan.jpg", old)
+	put("posts/fresh.jpg", time.Now())
+	put("comments/reacquired.png", old)
+	put("comments/stale.png", old)
+
+	// Ссылку на reacquired.png только что добавила новая загрузка того же файла
+	objectRepo.Acquire(ctx, &models.ImageObject{Bucket: "comments", Key: "reacquired.png"})
+	// Учет stale.png остался после несохраненного комментария
+	objectRepo.Acquire(ctx, &models.ImageObject{Bucket: "comments", Key: "stale.png"})
+	objectRepo.acquired["comments/stale.png"] = old
+
+	objectRepo.referenced = []string{
+		"posts/referenced.jpg",
+		"https://images.unsplash.com/photo-1511707171634-5f897ff02aa9",
+	}
+
+	config := models.DefaultImageGCConfig()
+	config.DryRun = true
+	report := services.NewImageGCService(storage, objectRepo, config).Collect(ctx)
+
+	if report.Scanned != 5 || report.Referenced != 1 || report.Recent != 1 || report.Orphaned != 3 {
+		t.Errorf("Неверный отчет пробного прохода: %+v", report)
+	}
+	if report.Deleted != 0 || len(storage.objects) != 5 {
+		t.Errorf("Пробный проход не должен удалять объекты: удалено %d, осталось %d", report.Deleted, len(storage.objects))
+	}
+
+	config.DryRun = false
+	gc := services.NewImageGCService(storage, objectRepo, config)
+	report = gc.Collect(ctx)
+
+	if report.Orphaned != 2 || report.Deleted != 2 || report.Recent != 2 || report.Errors != 0 {
+		t.Errorf("Неверный отчет прохода: %+v", report)
+	}
+	slices.Sort(report.OrphanKeys)
+	if !slices.Equal(report.OrphanKeys, []string{"comments/stale.png", "posts/orphan.jpg"}) {
+		t.Errorf("Неверный список объектов без ссылок: %v", report.OrphanKeys)
+	}
+	for _, name := range []string{"posts/referenced.jpg", "posts/fresh.jpg", "comments/reacquired.png"} {
+		if _, exists := storage.objects[name]; !exists {
+			t.Errorf("Объект %s не должен быть удален", name)
+		}
+	}
+	if _, exists := objectRepo.objects["comments/stale.png"]; exists {
+		t.Error("Учет удаленного объекта должен быть удален")
+	}
+
+	stats := gc.GetStats()
+	if stats.Runs != 1 || stats.DeletedCount != 2 || stats.LastReport != report {
+		t.Errorf("Неверная статистика: %+v", stats)
+	}
+}
@@ -0,0 +1,436 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/external"
+	"1337b04rd/internal/ports/repositories"
+)
+
+const (
+	// DefaultBanThreshold расстояние Хэмминга по умолчанию, в пределах которого
+	// изображение считается копией запрещенного
+	DefaultBanThreshold = 8
+	// MaxBanThreshold наибольшее допустимое расстояние. При больших значениях
+	// под запрет попадают непохожие изображения
+	MaxBanThreshold = 20
+)
+
+var (
+	// ErrImageRejected возвращается для поврежденных изображений, изображений
+	// с недопустимым разрешением, файлов неподдерживаемых форматов и запрещенных изображений
+	ErrImageRejected = errors.New("изображение отклонено")
+	// ErrImageBanned возвращается вместе с ErrImageRejected для запрещенных модератором изображений
+	ErrImageBanned = errors.New("изображение запрещено модератором")
+	// ErrInvalidImageBan возвращается для запретов, которые нельзя создать
+	ErrInvalidImageBan = errors.New("недопустимый запрет изображения")
+)
+
+var (
+	// ThreadThumbnail миниатюра изображения на странице треда
+	ThreadThumbnail = models.ThumbnailSize{Name: "thread", Width: 350, Height: 350}
+	// CatalogThumbnail миниатюра изображения на карточке каталога
+	CatalogThumbnail = models.ThumbnailSize{Name: "catalog", Width: 250, Height: 250}
+)
+
+// ImageService сохраняет загруженные изображения вместе с уменьшенными копиями,
+// а с подключенным VideoProber и видео WebM и MP4.
+// Ключи объектов вычисляются по содержимому, поэтому одинаковые файлы хранятся один раз
+type ImageService struct {
+	storage     external.ImageStorage
+	processor   external.ImageProcessor
+	videoProber external.VideoProber
+	objectRepo  repositories.ImageObjectRepository
+	banRepo     repositories.ImageBanRepository
+	mediaConfig models.MediaConfig
+}
+
+// NewImageService создает новый экземпляр сервиса изображений
+func NewImageService(storage external.ImageStorage, processor external.ImageProcessor) *ImageService {
+	return &ImageService{
+		storage:     storage,
+		processor:   processor,
+		mediaConfig: models.DefaultMediaConfig(),
+	}
+}
+
+// SetVideoProber включает загрузку видео. Без него видео отклоняются как
+// изображения неподдерживаемого формата
+func (s *ImageService) SetVideoProber(videoProber external.VideoProber) {
+	s.videoProber = videoProber
+}
+
+// SetMediaConfig задает ограничения размера и длительности загрузок по доскам
+func (s *ImageService) SetMediaConfig(config models.MediaConfig) {
+	s.mediaConfig = config
+}
+
+// SetObjectRepository включает учет ссылок на объекты хранилища. С ним повторная
+// загрузка файла не отправляется в хранилище, а удаление постов и комментариев
+// удаляет объекты, на которые больше никто не ссылается
+func (s *ImageService) SetObjectRepository(objectRepo repositories.ImageObjectRepository) {
+	s.objectRepo = objectRepo
+}
+
+// SetBanRepository включает проверку загрузок по запрещенным изображениям
+func (s *ImageService) SetBanRepository(banRepo repositories.ImageBanRepository) {
+	s.banRepo = banRepo
+}
+
+// UploadPostImage сохраняет изображение треда с миниатюрами для треда и каталога
+func (s *ImageService) UploadPostImage(ctx context.Context, board, filename string, file io.ReadSeeker) (*models.StoredImage, error) {
+	return s.upload(ctx, board, "posts", filename, file, ThreadThumbnail, CatalogThumbnail)
+}
+
+// UploadPostAttachment сохраняет дополнительное изображение галереи треда.
+// В каталоге показывается только первое изображение, поэтому миниатюра одна
+func (s *ImageService) UploadPostAttachment(ctx context.Context, board, filename string, file io.ReadSeeker) (*models.StoredImage, error) {
+	return s.upload(ctx, board, "posts", filename, file, ThreadThumbnail)
+}
+
+// UploadCommentImage сохраняет изображение комментария с миниатюрой для треда
+func (s *ImageService) UploadCommentImage(ctx context.Context, board, filename string, file io.ReadSeeker) (*models.StoredImage, error) {
+	return s.upload(ctx, board, "comments", filename, file, ThreadThumbnail)
+}
+
+// upload сохраняет перекодированный оригинал и его уменьшенные копии рядом с ним
+// в том же бакете. Файлы сохраняются только после обработки: неподдерживаемые форматы,
+// поврежденные и слишком большие изображения отклоняются с ErrImageRejected.
+// Видео не перекодируются и сохраняются как есть после проверки контейнера.
+// Загруженный файл читается обработчиком потоком, в память попадают только перекодированные копии
+func (s *ImageService) upload(ctx context.Context, board, bucket, filename string, file io.ReadSeeker, sizes ...models.ThumbnailSize) (*models.StoredImage, error) {
+	limits := s.mediaConfig.Limits(board)
+	size, err := fileSize(file)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка чтения файла: %w", err)
+	}
+
+	if s.videoProber != nil {
+		info, err := s.videoProber.Probe(file)
+		switch {
+		case err == nil:
+			return s.uploadVideo(ctx, bucket, filename, file, size, info, limits)
+		case !errors.Is(err, external.ErrNotVideo):
+			slog.Warn("Видео отклонено", "filename", filename, "error", err)
+			return nil, fmt.Errorf("%w: %v", ErrImageRejected, err)
+		}
+	}
+
+	if limits.MaxImageSize > 0 && size > limits.MaxImageSize {
+		return nil, fmt.Errorf("%w: размер изображения больше %d МБ", ErrImageRejected, limits.MaxImageSize>>20)
+	}
+
+	processed, err := s.processor.Process(file, sizes)
+	if err != nil {
+		// Необработанный файл может содержать активное содержимое, поэтому он не сохраняется
+		slog.Warn("Изображение отклонено", "filename", filename, "error", err)
+		return nil, fmt.Errorf("%w: %v", ErrImageRejected, err)
+	}
+
+	// Запрещенное изображение не попадает в хранилище
+	if err := s.checkBanned(ctx, processed.PerceptualHash); err != nil {
+		slog.Warn("Изображение отклонено", "filename", filename, "error", err)
+		return nil, err
+	}
+
+	// Оригинал сохраняется без метаданных, ключ считается по перекодированным данным
+	objectKey := s.storage.GenerateObjectKey(processed.Original.Data, processed.Original.Extension)
+	url, err := s.putData(ctx, &models.ImageObject{Bucket: bucket, Key: objectKey, PerceptualHash: processed.PerceptualHash}, processed.Original.Data)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки изображения: %w", err)
+	}
+
+	image := &models.StoredImage{
+		URL:         url,
+		Width:       processed.Width,
+		Height:      processed.Height,
+		Bucket:      bucket,
+		Key:         objectKey,
+		ContentType: processed.Original.ContentType,
+		Size:        int64(len(processed.Original.Data)),
+	}
+
+	// Копии получают ключ оригинала с суффиксом размера: abc.png -> abc_thread.jpg
+	base := strings.TrimSuffix(objectKey, path.Ext(objectKey))
+	for _, variant := range processed.Variants {
+		variantKey := base + "_" + variant.Name + variant.Extension
+		variantURL, err := s.putData(ctx, &models.ImageObject{Bucket: bucket, Key: variantKey}, variant.Data)
+		if err != nil {
+			// Без миниатюры страницы показывают оригинал
+			slog.Error("Ошибка загрузки миниатюры", "key", objectKey, "variant", variant.Name, "error", err)
+			continue
+		}
+		switch variant.Name {
+		case ThreadThumbnail.Name:
+			image.ThumbnailURL, image.ThumbnailKey = variantURL, variantKey
+		case CatalogThumbnail.Name:
+			image.CatalogThumbnailURL = variantURL
+		}
+	}
+
+	// Постер анимации показывается вместо нее, если пользователь просит меньше движения
+	if poster := processed.Poster; poster != nil {
+		posterKey := base + "_" + poster.Name + poster.Extension
+		posterURL, err := s.putData(ctx, &models.ImageObject{Bucket: bucket, Key: posterKey}, poster.Data)
+		if err != nil {
+			slog.Error("Ошибка загрузки постера", "key", objectKey, "error", err)
+		} else {
+			image.PosterURL, image.PosterKey = posterURL, posterKey
+		}
+	}
+
+	slog.Info("Изображение сохранено", "url", url, "width", image.Width, "height", image.Height, "variants", len(processed.Variants))
+	return image, nil
+}
+
+// uploadVideo сохраняет проверенное видео без изменений. Ключ считается потоком
+// по содержимому файла, как и ключи изображений
+func (s *ImageService) uploadVideo(ctx context.Context, bucket, filename string, file io.ReadSeeker, size int64, info *models.VideoInfo, limits models.MediaLimits) (*models.StoredImage, error) {
+	switch {
+	case limits.MaxVideoSize <= 0:
+		return nil, fmt.Errorf("%w: видео на этой доске не принимаются", ErrImageRejected)
+	case size > limits.MaxVideoSize:
+		return nil, fmt.Errorf("%w: размер видео больше %d МБ", ErrImageRejected, limits.MaxVideoSize>>20)
+	case limits.MaxVideoDuration > 0 && info.Duration > limits.MaxVideoDuration:
+		return nil, fmt.Errorf("%w: видео длиннее %s", ErrImageRejected, models.FormatDuration(limits.MaxVideoDuration))
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return nil, fmt.Errorf("ошибка чтения видео: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("ошибка чтения видео: %w", err)
+	}
+	objectKey := hex.EncodeToString(hash.Sum(nil)) + info.Extension
+
+	url, err := s.put(ctx, &models.ImageObject{Bucket: bucket, Key: objectKey}, file, size)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка загрузки видео: %w", err)
+	}
+
+	slog.Info("Видео сохранено", "url", url, "filename", filename, "duration", info.Duration,
+		"width", info.Width, "height", info.Height, "video_codec", info.VideoCodec, "audio_codec", info.AudioCodec)
+	return &models.StoredImage{
+		URL:         url,
+		Width:       info.Width,
+		Height:      info.Height,
+		Bucket:      bucket,
+		Key:         objectKey,
+		ContentType: info.ContentType,
+		Size:        size,
+		Duration:    info.Duration,
+	}, nil
+}
+
+// fileSize возвращает размер файла и перематывает его в начало
+func fileSize(file io.ReadSeeker) (int64, error) {
+	size, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return size, nil
+}
+
+// putData сохраняет объект из памяти
+func (s *ImageService) putData(ctx context.Context, object *models.ImageObject, data []byte) (string, error) {
+	return s.put(ctx, object, bytes.NewReader(data), int64(len(data)))
+}
+
+// put сохраняет объект, если его еще нет в хранилище, и добавляет ссылку на него.
+// Без учета ссылок объект загружается всегда, одинаковый ключ перезаписывает те же байты.
+// Пока объект не отмечен загруженным, его загружает каждый запрос: параллельная загрузка
+// того же файла может не завершиться, и тогда запись ссылалась бы на отсутствующий объект.
+// Ключ по содержимому делает повторный PUT безопасным.
+// Возвращает ссылку bucket/key, которая сохраняется в записях
+func (s *ImageService) put(ctx context.Context, object *models.ImageObject, body io.Reader, size int64) (string, error) {
+	ref := models.ObjectPath(object.Bucket, object.Key)
+	if s.objectRepo == nil {
+		if _, err := s.storage.UploadImage(ctx, object.Bucket, object.Key, body, size); err != nil {
+			return "", err
+		}
+		return ref, nil
+	}
+
+	object.Size = size
+	pending, err := s.objectRepo.Acquire(ctx, object)
+	if err != nil {
+		return "", err
+	}
+	if !pending {
+		slog.Info("Изображение уже есть в хранилище", "bucket", object.Bucket, "key", object.Key)
+		return ref, nil
+	}
+
+	if _, err := s.storage.UploadImage(ctx, object.Bucket, object.Key, body, size); err != nil {
+		// Ссылка на незагруженный объект не нужна ни этой записи, ни следующим загрузкам
+		if _, releaseErr := s.objectRepo.Release(ctx, object.Bucket, object.Key); releaseErr != nil {
+			slog.Error("Ошибка отката ссылки на изображение", "key", object.Key, "error", releaseErr)
+		}
+		return "", err
+	}
+	// Без отметки следующая загрузка того же файла просто повторит PUT
+	if err := s.objectRepo.MarkUploaded(ctx, object.Bucket, object.Key); err != nil {
+		slog.Error("Ошибка отметки загрузки изображения", "key", object.Key, "error", err)
+	}
+	return ref, nil
+}
+
+// checkBanned отклоняет изображение, хэш которого близок к запрещенному.
+// Изображения без хэша, например SVG, не проверяются
+func (s *ImageService) checkBanned(ctx context.Context, hash *models.PerceptualHash) error {
+	if s.banRepo == nil || hash == nil {
+		return nil
+	}
+
+	bans, err := s.banRepo.GetAll(ctx)
+	if err != nil {
+		return fmt.Errorf("ошибка проверки запрещенных изображений: %w", err)
+	}
+	for _, ban := range bans {
+		if ban.Matches(*hash) {
+			return fmt.Errorf("%w: %w", ErrImageRejected, ErrImageBanned)
+		}
+	}
+	return nil
+}
+
+// BanImage запрещает изображение по адресу его оригинала. Хэш берется из учета объектов,
+// для изображений без учтенного хэша он вычисляется по байтам из хранилища.
+// threshold задает допустимое расстояние Хэмминга, 0 запрещает только точные копии
+func (s *ImageService) BanImage(ctx context.Context, imageURL, reason string, threshold int) (*models.ImageBan, error) {
+	if s.banRepo == nil {
+		return nil, fmt.Errorf("%w: запреты изображений не настроены", ErrInvalidImageBan)
+	}
+	if threshold < 0 || threshold > MaxBanThreshold {
+		return nil, fmt.Errorf("%w: порог должен быть от 0 до %d", ErrInvalidImageBan, MaxBanThreshold)
+	}
+
+	hash, err := s.perceptualHash(ctx, imageURL)
+	if err != nil {
+		return nil, err
+	}
+
+	ban := &models.ImageBan{
+		Hash:      *hash,
+		Threshold: threshold,
+		Reason:    strings.TrimSpace(reason),
+		CreatedAt: time.Now(),
+	}
+	if ban.ID, err = s.banRepo.Create(ctx, ban); err != nil {
+		return nil, fmt.Errorf("ошибка сохранения запрета: %w", err)
+	}
+
+	slog.Info("Изображение запрещено", "id", ban.ID, "hash", ban.Hash, "threshold", ban.Threshold, "url", imageURL)
+	return ban, nil
+}
+
+// ImageBans возвращает все запреты изображений
+func (s *ImageService) ImageBans(ctx context.Context) ([]*models.ImageBan, error) {
+	if s.banRepo == nil {
+		return nil, nil
+	}
+	return s.banRepo.GetAll(ctx)
+}
+
+// DeleteImageBan снимает запрет изображения
+func (s *ImageService) DeleteImageBan(ctx context.Context, id int64) error {
+	if s.banRepo == nil {
+		return fmt.Errorf("%w: запреты изображений не настроены", ErrInvalidImageBan)
+	}
+	slog.Info("Запрет изображения снят", "id", id)
+	return s.banRepo.Delete(ctx, id)
+}
+
+// perceptualHash возвращает перцептивный хэш изображения по адресу оригинала
+func (s *ImageService) perceptualHash(ctx context.Context, imageURL string) (*models.PerceptualHash, error) {
+	bucket, objectKey, ok := objectFromURL(imageURL)
+	if !ok {
+		return nil, fmt.Errorf("%w: у записи нет изображения", ErrInvalidImageBan)
+	}
+
+	if s.objectRepo != nil {
+		object, err := s.objectRepo.Get(ctx, bucket, objectKey)
+		if err != nil {
+			return nil, fmt.Errorf("ошибка получения объекта изображения: %w", err)
+		}
+		if object != nil && object.PerceptualHash != nil {
+			return object.PerceptualHash, nil
+		}
+	}
+
+	// Изображения, загруженные до учета хэшей, обрабатываются заново
+	data, err := s.storage.GetImage(ctx, bucket, objectKey)
+	if err != nil {
+		return nil, fmt.Errorf("ошибка получения изображения: %w", err)
+	}
+	processed, err := s.processor.Process(bytes.NewReader(data), nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImageBan, err)
+	}
+	if processed.PerceptualHash == nil {
+		return nil, fmt.Errorf("%w: для %s перцептивный хэш не вычисляется", ErrInvalidImageBan, processed.Format)
+	}
+	return processed.PerceptualHash, nil
+}
+
+// Release убирает ссылки удаленных записей на изображения и удаляет из хранилища
+// объекты, на которые больше никто не ссылается. Без учета ссылок объекты не удаляются,
+// потому что их могут использовать другие записи
+func (s *ImageService) Release(ctx context.Context, urls []string) {
+	if s.objectRepo == nil {
+		return
+	}
+
+	for _, url := range urls {
+		bucket, objectKey, ok := objectFromURL(url)
+		if !ok {
+			continue
+		}
+		unused, err := s.objectRepo.Release(ctx, bucket, objectKey)
+		if err != nil {
+			slog.Error("Ошибка освобождения изображения", "url", url, "error", err)
+			continue
+		}
+		if !unused {
+			continue
+		}
+		if err := s.storage.DeleteImage(ctx, bucket, objectKey); err != nil {
+			slog.Error("Ошибка удаления изображения из хранилища", "bucket", bucket, "key", objectKey, "error", err)
+			continue
+		}
+		slog.Info("Изображение удалено из хранилища", "bucket", bucket, "key", objectKey)
+	}
+}
+
+// objectFromURL извлекает бакет и ключ объекта из адреса вида http://host/bucket/key
+// или пути bucket/key
+func objectFromURL(rawURL string) (string, string, bool) {
+	if rawURL == "" {
+		return "", "", false
+	}
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", false
+	}
+	bucket, objectKey, ok := strings.Cut(strings.TrimPrefix(parsed.Path, "/"), "/")
+	if !ok || bucket == "" || objectKey == "" {
+		return "", "", false
+	}
+	return bucket, objectKey, true
+}
@@ -0,0 +1,512 @@
+package services_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/imaging"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+	"1337b04rd/internal/ports/external"
+)
+
+// MemoryImageStorage хранит загруженные объекты в памяти и считает загрузки
+type MemoryImageStorage struct {
+	objects  map[string][]byte
+	modified map[string]time.Time
+	puts     int
+}
+
+// NewMemoryImageStorage создает пустое хранилище в памяти
+func NewMemoryImageStorage() *MemoryImageStorage {
+	return &MemoryImageStorage{objects: make(map[string][]byte), modified: make(map[string]time.Time)}
+}
+
+// UploadImage сохраняет объект и возвращает его адрес
+func (m *MemoryImageStorage) UploadImage(ctx context.Context, bucketName, objectKey string, body io.Reader, size int64) (string, error) {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	m.objects[bucketName+"/"+objectKey] = data
+	m.modified[bucketName+"/"+objectKey] = time.Now()
+	m.puts++
+	return m.ObjectURL(bucketName, objectKey), nil
+}
+
+// GetImage возвращает сохраненный объект
+func (m *MemoryImageStorage) GetImage(ctx context.Context, bucketName, objectKey string) ([]byte, error) {
+	return m.objects[bucketName+"/"+objectKey], nil
+}
+
+// DeleteImage удаляет объект
+func (m *MemoryImageStorage) DeleteImage(ctx context.Context, bucketName, objectKey string) error {
+	delete(m.objects, bucketName+"/"+objectKey)
+	return nil
+}
+
+// ListObjects возвращает объекты бакета
+func (m *MemoryImageStorage) ListObjects(ctx context.Context, bucketName string) ([]models.StoredObject, error) {
+	var objects []models.StoredObject
+	for key, data := range m.objects {
+		if objectKey, ok := strings.CutPrefix(key, bucketName+"/"); ok {
+			objects = append(objects, models.StoredObject{
+				Bucket:       bucketName,
+				Key:          objectKey,
+				Size:         int64(len(data)),
+				LastModified: m.modified[key],
+			})
+		}
+	}
+	return objects, nil
+}
+
+// GenerateObjectKey возвращает короткий ключ по содержимому
+func (m *MemoryImageStorage) GenerateObjectKey(data []byte, extension string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:4]) + extension
+}
+
+// ObjectURL возвращает адрес объекта
+func (m *MemoryImageStorage) ObjectURL(bucketName, objectKey string) string {
+	return "http://s3:9000/" + bucketName + "/" + objectKey
+}
+
+// MockImageObjectRepository считает ссылки на объекты в памяти
+type MockImageObjectRepository struct {
+	objects  map[string]*models.ImageObject
+	acquired map[string]time.Time
+	// referenced адреса изображений, на которые ссылаются записи БД
+	referenced []string
+}
+
+// NewMockImageObjectRepository создает пустой учет ссылок
+func NewMockImageObjectRepository() *MockImageObjectRepository {
+	return &MockImageObjectRepository{
+		objects:  make(map[string]*models.ImageObject),
+		acquired: make(map[string]time.Time),
+	}
+}
+
+// Acquire добавляет ссылку и сообщает, что объекта еще не было
+func (m *MockImageObjectRepository) Acquire(ctx context.Context, object *models.ImageObject) (bool, error) {
+	key := object.Bucket + "/" + object.Key
+	m.acquired[key] = time.Now()
+	if stored, exists := m.objects[key]; exists {
+		stored.RefCount++
+		return !stored.Uploaded, nil
+	}
+	stored := *object
+	stored.RefCount = 1
+	m.objects[key] = &stored
+	return true, nil
+}
+
+// MarkUploaded отмечает объект загруженным
+func (m *MockImageObjectRepository) MarkUploaded(ctx context.Context, bucket, objectKey string) error {
+	if stored, exists := m.objects[bucket+"/"+objectKey]; exists {
+		stored.Uploaded = true
+	}
+	return nil
+}
+
+// Get возвращает учтенный объект
+func (m *MockImageObjectRepository) Get(ctx context.Context, bucket, objectKey string) (*models.ImageObject, error) {
+	return m.objects[bucket+"/"+objectKey], nil
+}
+
+// Release убирает ссылку и сообщает, что ссылок не осталось
+func (m *MockImageObjectRepository) Release(ctx context.Context, bucket, objectKey string) (bool, error) {
+	key := bucket + "/" + objectKey
+	stored, exists := m.objects[key]
+	if !exists {
+		return false, nil
+	}
+	stored.RefCount--
+	if stored.RefCount > 0 {
+		return false, nil
+	}
+	delete(m.objects, key)
+	return true, nil
+}
+
+// ReferencedURLs возвращает адреса изображений записей
+func (m *MockImageObjectRepository) ReferencedURLs(ctx context.Context) ([]string, error) {
+	return m.referenced, nil
+}
+
+// Forget удаляет учет объекта, ссылка на который добавлена до before
+func (m *MockImageObjectRepository) Forget(ctx context.Context, bucket, objectKey string, before time.Time) (bool, error) {
+	key := bucket + "/" + objectKey
+	if _, exists := m.objects[key]; exists && !m.acquired[key].Before(before) {
+		return false, nil
+	}
+	delete(m.objects, key)
+	return true, nil
+}
+
+// MockImageBanRepository хранит запреты изображений в памяти
+type MockImageBanRepository struct {
+	bans []*models.ImageBan
+}
+
+// GetAll возвращает все запреты
+func (m *MockImageBanRepository) GetAll(ctx context.Context) ([]*models.ImageBan, error) {
+	return m.bans, nil
+}
+
+// Create сохраняет запрет
+func (m *MockImageBanRepository) Create(ctx context.Context, ban *models.ImageBan) (int64, error) {
+	ban.ID = int64(len(m.bans) + 1)
+	m.bans = append(m.bans, ban)
+	return ban.ID, nil
+}
+
+// Delete снимает запрет
+func (m *MockImageBanRepository) Delete(ctx context.Context, id int64) error {
+	m.bans = slices.DeleteFunc(m.bans, func(ban *models.ImageBan) bool { return ban.ID == id })
+	return nil
+}
+
+// MockVideoProber считает видео файлы, которые начинаются с "VIDEO"
+type MockVideoProber struct {
+	info models.VideoInfo
+}
+
+// Probe возвращает заданные сведения о видео и перематывает файл в начало
+func (m *MockVideoProber) Probe(src io.ReadSeeker) (*models.VideoInfo, error) {
+	magic := make([]byte, 5)
+	_, err := io.ReadFull(src, magic)
+	if _, seekErr := src.Seek(0, io.SeekStart); seekErr != nil {
+		return nil, seekErr
+	}
+	if err != nil || string(magic) != "VIDEO" {
+		return nil, external.ErrNotVideo
+	}
+	info := m.info
+	return &info, nil
+}
+
+// encodeTestJPEG рисует диагональный узор заданного размера и кодирует его в JPEG.
+// Узор зависит от относительных координат, поэтому копии разного размера похожи
+func encodeTestJPEG(t *testing.T, width, height, quality int, invert bool) []byte {
+	t.Helper()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			v := uint8((x*255/width + y*128/height) % 256)
+			if x*4/width%2 == 1 {
+				v = 255 - v
+			}
+			if invert {
+				v = 255 - v
+			}
+			src.Set(x, y, color.RGBA{v, v, v, 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, src, &jpeg.Options{Quality: quality}); err != nil {
+		t.Fatalf("Ошибка кодирования JPEG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// encodeTestPNG кодирует непрозрачное изображение заданного размера в PNG
+func encodeTestPNG(t *testing.T, width, height int) []byte {
+	t.Helper()
+	src := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range src.Pix {
+		src.Pix[i] = 255
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, src); err != nil {
+		t.Fatalf("Ошибка кодирования PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// TestUploadPostImage проверяет сохранение оригинала и миниатюр рядом с ним
+func TestUploadPostImage(t *testing.T) {
+	data := encodeTestPNG(t, 1000, 500)
+	storage := NewMemoryImageStorage()
+	service := services.NewImageService(storage, imaging.NewProcessor())
+
+	stored, err := service.UploadPostImage(context.Background(), "b", "cat.png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки изображения: %v", err)
+	}
+	base := strings.TrimSuffix(stored.URL, ".png")
+	if !strings.HasPrefix(stored.URL, "posts/") || !strings.HasSuffix(stored.URL, ".png") || stored.Width != 1000 || stored.Height != 500 {
+		t.Errorf("Неверные данные оригинала: %+v", stored)
+	}
+	if stored.ThumbnailURL != base+"_thread.jpg" {
+		t.Errorf("Неверный адрес миниатюры треда: %s", stored.ThumbnailURL)
+	}
+	if stored.CatalogThumbnailURL != base+"_catalog.jpg" {
+		t.Errorf("Неверный адрес миниатюры каталога: %s", stored.CatalogThumbnailURL)
+	}
+	if len(storage.objects) != 3 {
+		t.Errorf("Ожидалось 3 объекта в хранилище, получено %d", len(storage.objects))
+	}
+
+	// Вложение хранит расположение объектов для таблицы attachments
+	attachment := stored.Attachment("cat.png", true)
+	if attachment.Bucket != "posts" || storage.objects["posts/"+attachment.Key] == nil || attachment.ContentType != "image/png" ||
+		attachment.Size != int64(len(storage.objects["posts/"+attachment.Key])) || stored.ThumbnailURL != "posts/"+attachment.ThumbnailKey ||
+		attachment.Width != 1000 || !attachment.IsSpoiler {
+		t.Errorf("Неверное вложение: %+v", attachment)
+	}
+
+	// Дополнительный файл галереи получает только миниатюру треда
+	extra, err := service.UploadPostAttachment(context.Background(), "b", "dog.png", bytes.NewReader(encodeTestPNG(t, 600, 600)))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки файла галереи: %v", err)
+	}
+	if extra.ThumbnailURL == "" || extra.CatalogThumbnailURL != "" || len(storage.objects) != 5 {
+		t.Errorf("Неверные миниатюры файла галереи: %+v, объектов %d", extra, len(storage.objects))
+	}
+
+	// SVG сохраняется очищенным и без миниатюр
+	stored, err = service.UploadCommentImage(context.Background(), "b", "x.svg", bytes.NewReader([]byte(`<svg onload="alert(1)"></svg>`)))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки SVG: %v", err)
+	}
+	svgKey := stored.URL
+	if !strings.HasPrefix(svgKey, "comments/") || !strings.HasSuffix(svgKey, ".svg") || stored.ThumbnailURL != "" {
+		t.Errorf("SVG сохранен неверно: %+v", stored)
+	}
+	if svg := storage.objects[svgKey]; string(svg) != "<svg></svg>" {
+		t.Errorf("SVG сохранен без очистки: %s", svg)
+	}
+
+	// Поврежденное изображение не сохраняется
+	before := len(storage.objects)
+	_, err = service.UploadPostImage(context.Background(), "b", "broken.png", bytes.NewReader(data[:64]))
+	if !errors.Is(err, services.ErrImageRejected) {
+		t.Errorf("Ожидался отказ для поврежденного изображения, получено %v", err)
+	}
+	// Файл неизвестного формата не сохраняется как есть
+	_, err = service.UploadPostImage(context.Background(), "b", "page.png", bytes.NewReader([]byte("<html><script>alert(1)</script></html>")))
+	if !errors.Is(err, services.ErrImageRejected) {
+		t.Errorf("Ожидался отказ для файла неизвестного формата, получено %v", err)
+	}
+	if len(storage.objects) != before {
+		t.Errorf("Отклоненный файл попал в хранилище")
+	}
+}
+
+// TestUploadDeduplicates проверяет, что повторная загрузка не отправляет байты в хранилище,
+// а объекты удаляются только после освобождения последней ссылки
+func TestUploadDeduplicates(t *testing.T) {
+	ctx := context.Background()
+	data := encodeTestPNG(t, 600, 400)
+
+	storage := NewMemoryImageStorage()
+	service := services.NewImageService(storage, imaging.NewProcessor())
+	service.SetObjectRepository(NewMockImageObjectRepository())
+
+	// Комментарий сохраняет только миниатюру треда
+	comment, err := service.UploadCommentImage(ctx, "b", "a.png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки изображения: %v", err)
+	}
+	if storage.puts != 2 {
+		t.Fatalf("Ожидалось 2 загрузки, получено %d", storage.puts)
+	}
+
+	// Тот же файл в другом комментарии не загружается повторно
+	again, err := service.UploadCommentImage(ctx, "b", "b.png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка повторной загрузки: %v", err)
+	}
+	if storage.puts != 2 || again.URL != comment.URL || again.ThumbnailURL != comment.ThumbnailURL {
+		t.Errorf("Повторная загрузка отправила данные: загрузок %d, %+v", storage.puts, again)
+	}
+
+	// Первое удаление оставляет объекты, второе удаляет их из хранилища
+	service.Release(ctx, comment.URLs())
+	if len(storage.objects) != 2 {
+		t.Errorf("Объекты удалены при оставшейся ссылке: %d", len(storage.objects))
+	}
+	service.Release(ctx, again.URLs())
+	if len(storage.objects) != 0 {
+		t.Errorf("Объекты без ссылок остались в хранилище: %d", len(storage.objects))
+	}
+
+	// Неучтенные адреса и адреса без ключа не удаляют объекты
+	if _, err := service.UploadPostImage(ctx, "b", "c.png", bytes.NewReader(data)); err != nil {
+		t.Fatalf("Ошибка загрузки изображения: %v", err)
+	}
+	before := len(storage.objects)
+	service.Release(ctx, []string{"http://s3:9000/posts/1700000000.png", "http://s3:9000/posts", ""})
+	if len(storage.objects) != before {
+		t.Errorf("Удалены объекты без учтенных ссылок")
+	}
+}
+
+// TestUploadPendingObject проверяет, что загрузка файла, параллельная загрузка которого
+// не завершилась, сама отправляет объект в хранилище
+func TestUploadPendingObject(t *testing.T) {
+	ctx := context.Background()
+	data := encodeTestPNG(t, 600, 400)
+
+	storage := NewMemoryImageStorage()
+	objectRepo := NewMockImageObjectRepository()
+	service := services.NewImageService(storage, imaging.NewProcessor())
+	service.SetObjectRepository(objectRepo)
+
+	first, err := service.UploadCommentImage(ctx, "b", "a.png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки изображения: %v", err)
+	}
+
+	// Первая загрузка учтена, но ее PUT еще не дошел до хранилища
+	for _, ref := range first.URLs() {
+		objectRepo.objects[ref].Uploaded = false
+		delete(storage.objects, ref)
+	}
+
+	second, err := service.UploadCommentImage(ctx, "b", "b.png", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка повторной загрузки: %v", err)
+	}
+	// Неудачная первая загрузка освобождает свою ссылку
+	service.Release(ctx, first.URLs())
+
+	for _, ref := range second.URLs() {
+		if _, exists := storage.objects[ref]; !exists {
+			t.Errorf("Объект %s второй загрузки отсутствует в хранилище", ref)
+		}
+		if object := objectRepo.objects[ref]; object == nil || !object.Uploaded || object.RefCount != 1 {
+			t.Errorf("Неверный учет объекта %s: %+v", ref, object)
+		}
+	}
+}
+
+// TestImageBan проверяет, что запрещенное изображение отклоняется и после
+// уменьшения и перекодирования, а непохожие изображения загружаются
+func TestImageBan(t *testing.T) {
+	ctx := context.Background()
+	storage := NewMemoryImageStorage()
+	service := services.NewImageService(storage, imaging.NewProcessor())
+	service.SetObjectRepository(NewMockImageObjectRepository())
+	banRepo := &MockImageBanRepository{}
+	service.SetBanRepository(banRepo)
+
+	original, err := service.UploadPostImage(ctx, "b", "meme.jpg", bytes.NewReader(encodeTestJPEG(t, 800, 600, 90, false)))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки изображения: %v", err)
+	}
+
+	if _, err := service.BanImage(ctx, original.URL, "спам", services.MaxBanThreshold+1); !errors.Is(err, services.ErrInvalidImageBan) {
+		t.Errorf("Ожидалась ошибка порога, получено %v", err)
+	}
+	ban, err := service.BanImage(ctx, original.URL, " спам ", services.DefaultBanThreshold)
+	if err != nil {
+		t.Fatalf("Ошибка запрета изображения: %v", err)
+	}
+	if ban.Reason != "спам" || len(banRepo.bans) != 1 {
+		t.Errorf("Неверный запрет: %+v", ban)
+	}
+
+	puts := storage.puts
+	resized := encodeTestJPEG(t, 400, 300, 60, false)
+	if _, err := service.UploadCommentImage(ctx, "b", "copy.jpg", bytes.NewReader(resized)); !errors.Is(err, services.ErrImageBanned) || !errors.Is(err, services.ErrImageRejected) {
+		t.Errorf("Ожидался отказ для уменьшенной копии, получено %v", err)
+	}
+	if storage.puts != puts {
+		t.Errorf("Запрещенное изображение попало в хранилище")
+	}
+
+	if _, err := service.UploadCommentImage(ctx, "b", "other.jpg", bytes.NewReader(encodeTestJPEG(t, 400, 300, 60, true))); err != nil {
+		t.Errorf("Непохожее изображение отклонено: %v", err)
+	}
+
+	// Запрет по изображению без учтенного хэша вычисляет хэш по байтам из хранилища
+	legacy := encodeTestPNG(t, 10, 10)
+	storage.objects["posts/legacy.png"] = legacy
+	if _, err := service.BanImage(ctx, "http://s3:9000/posts/legacy.png", "", 0); err != nil {
+		t.Errorf("Ошибка запрета неучтенного изображения: %v", err)
+	}
+
+	if err := service.DeleteImageBan(ctx, ban.ID); err != nil {
+		t.Fatalf("Ошибка снятия запрета: %v", err)
+	}
+	if _, err := service.UploadCommentImage(ctx, "b", "copy.jpg", bytes.NewReader(resized)); err != nil {
+		t.Errorf("Изображение отклонено после снятия запрета: %v", err)
+	}
+}
+
+// TestUploadVideo проверяет сохранение видео без перекодирования и ограничения доски
+func TestUploadVideo(t *testing.T) {
+	ctx := context.Background()
+	data := []byte("VIDEO" + strings.Repeat("x", 1000))
+
+	storage := NewMemoryImageStorage()
+	service := services.NewImageService(storage, imaging.NewProcessor())
+
+	// Без VideoProber видео отклоняется как неизвестный формат
+	if _, err := service.UploadPostImage(ctx, "b", "clip.webm", bytes.NewReader(data)); !errors.Is(err, services.ErrImageRejected) {
+		t.Errorf("Ожидался отказ без проверки видео, получено %v", err)
+	}
+
+	service.SetVideoProber(&MockVideoProber{info: models.VideoInfo{
+		Container:   "webm",
+		ContentType: "video/webm",
+		Extension:   ".webm",
+		Duration:    90 * time.Second,
+		Width:       640,
+		Height:      360,
+	}})
+	config := models.DefaultMediaConfig()
+	config.Boards["a"] = models.MediaLimits{MaxImageSize: 1 << 20}
+	config.Boards["s"] = models.MediaLimits{MaxImageSize: 1 << 20, MaxVideoSize: 1 << 20, MaxVideoDuration: time.Minute}
+	config.Boards["g"] = models.MediaLimits{MaxImageSize: 100, MaxVideoSize: 100}
+	service.SetMediaConfig(config)
+
+	stored, err := service.UploadPostImage(ctx, "b", "clip.webm", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Ошибка загрузки видео: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	if stored.Key != hex.EncodeToString(sum[:])+".webm" || !bytes.Equal(storage.objects["posts/"+stored.Key], data) {
+		t.Errorf("Видео сохранено неверно: %+v", stored)
+	}
+	if stored.ContentType != "video/webm" || stored.Duration != 90*time.Second || stored.Width != 640 || stored.ThumbnailURL != "" || len(storage.objects) != 1 {
+		t.Errorf("Неверные данные видео: %+v", stored)
+	}
+	if attachment := stored.Attachment("clip.webm", false); !attachment.IsVideo() || attachment.DurationLabel() != "1:30" {
+		t.Errorf("Неверное вложение видео: %+v", attachment)
+	}
+
+	// Ограничения доски: видео запрещено, слишком длинное, слишком большое
+	for _, board := range []string{"a", "s", "g"} {
+		if _, err := service.UploadCommentImage(ctx, board, "clip.webm", bytes.NewReader(data)); !errors.Is(err, services.ErrImageRejected) {
+			t.Errorf("Ожидался отказ для видео на доске %s, получено %v", board, err)
+		}
+	}
+	// Размер изображения проверяется до обработки
+	if _, err := service.UploadCommentImage(ctx, "g", "cat.png", bytes.NewReader(encodeTestPNG(t, 100, 100))); !errors.Is(err, services.ErrImageRejected) {
+		t.Errorf("Ожидался отказ для большого изображения, получено %v", err)
+	}
+	if len(storage.objects) != 1 {
+		t.Errorf("Отклоненные файлы попали в хранилище: %d объектов", len(storage.objects))
+	}
+
+	// Изображения по-прежнему обрабатываются
+	if _, err := service.UploadCommentImage(ctx, "b", "cat.png", bytes.NewReader(encodeTestPNG(t, 100, 100))); err != nil {
+		t.Errorf("Ошибка загрузки изображения: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// queueStatuses статусы записей, попадающих в очередь модерации
+var queueStatuses = []models.ModerationStatus{models.ModerationPending, models.ModerationFlagged}
+
+// ModerationService предоставляет очередь модерации и решения по записям
+type ModerationService struct {
+	postRepo     repositories.PostRepository
+	commentRepo  repositories.CommentRepository
+	imageService *ImageService
+}
+
+// NewModerationService создает новый экземпляр сервиса модерации
+func NewModerationService(postRepo repositories.PostRepository, commentRepo repositories.CommentRepository) *ModerationService {
+	return &ModerationService{
+		postRepo:    postRepo,
+		commentRepo: commentRepo,
+	}
+}
+
+// SetImageService включает освобождение изображений удаленных тредов и запреты изображений
+func (s *ModerationService) SetImageService(imageService *ImageService) {
+	s.imageService = imageService
+}
+
+// Queue возвращает посты и комментарии, ожидающие проверки
+func (s *ModerationService) Queue(ctx context.Context, limit int) (*models.ModerationQueue, error) {
+	posts, err := s.postRepo.GetByStatus(ctx, queueStatuses, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := s.commentRepo.GetByStatus(ctx, queueStatuses, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.ModerationQueue{Posts: posts, Comments: comments}, nil
+}
+
+// SetPostStatus выносит решение модератора по посту
+func (s *ModerationService) SetPostStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	if err := validateModerationStatus(status); err != nil {
+		return err
+	}
+
+	slog.Info("Решение модератора по посту", "id", id, "status", status)
+	return s.postRepo.SetStatus(ctx, id, status)
+}
+
+// SetCommentStatus выносит решение модератора по комментарию
+func (s *ModerationService) SetCommentStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	if err := validateModerationStatus(status); err != nil {
+		return err
+	}
+
+	slog.Info("Решение модератора по комментарию", "id", id, "status", status)
+	return s.commentRepo.SetStatus(ctx, id, status)
+}
+
+// Threads возвращает активные треды, закрепленные первыми, для управления флагами
+func (s *ModerationService) Threads(ctx context.Context, limit int) ([]*models.Post, error) {
+	return s.postRepo.GetAll(ctx, limit, 0, false)
+}
+
+// SetPostSticky закрепляет тред вверху каталога или снимает закрепление
+func (s *ModerationService) SetPostSticky(ctx context.Context, id int64, sticky bool) error {
+	slog.Info("Закрепление треда", "id", id, "sticky", sticky)
+	return s.postRepo.SetSticky(ctx, id, sticky)
+}
+
+// SetPostLocked закрывает тред для новых ответов или открывает его
+func (s *ModerationService) SetPostLocked(ctx context.Context, id int64, locked bool) error {
+	slog.Info("Закрытие треда", "id", id, "locked", locked)
+	return s.postRepo.SetLocked(ctx, id, locked)
+}
+
+// DeletePost удаляет тред вместе с ответами и освобождает их изображения.
+// Объекты хранилища удаляются, только если на них не ссылаются другие записи
+func (s *ModerationService) DeletePost(ctx context.Context, id int64) error {
+	slog.Info("Удаление треда", "id", id)
+	imageURLs, err := s.postRepo.Delete(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if s.imageService != nil {
+		s.imageService.Release(ctx, imageURLs)
+	}
+	return nil
+}
+
+// BanPostImage запрещает изображение треда для всех новых загрузок
+func (s *ModerationService) BanPostImage(ctx context.Context, id int64, reason string, threshold int) (*models.ImageBan, error) {
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.banImage(ctx, post.ImageURL, reason, threshold)
+}
+
+// BanCommentImage запрещает изображение комментария для всех новых загрузок
+func (s *ModerationService) BanCommentImage(ctx context.Context, id int64, reason string, threshold int) (*models.ImageBan, error) {
+	comment, err := s.commentRepo.GetByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return s.banImage(ctx, comment.ImageURL, reason, threshold)
+}
+
+// ImageBans возвращает запреты изображений
+func (s *ModerationService) ImageBans(ctx context.Context) ([]*models.ImageBan, error) {
+	if s.imageService == nil {
+		return nil, nil
+	}
+	return s.imageService.ImageBans(ctx)
+}
+
+// DeleteImageBan снимает запрет изображения
+func (s *ModerationService) DeleteImageBan(ctx context.Context, id int64) error {
+	if s.imageService == nil {
+		return fmt.Errorf("%w: сервис изображений не настроен", ErrInvalidImageBan)
+	}
+	return s.imageService.DeleteImageBan(ctx, id)
+}
+
+// banImage передает запрет сервису изображений
+func (s *ModerationService) banImage(ctx context.Context, imageURL, reason string, threshold int) (*models.ImageBan, error) {
+	if s.imageService == nil {
+		return nil, fmt.Errorf("%w: сервис изображений не настроен", ErrInvalidImageBan)
+	}
+	slog.Info("Запрет изображения модератором", "url", imageURL, "threshold", threshold)
+	return s.imageService.BanImage(ctx, imageURL, reason, threshold)
+}
+
+// validateModerationStatus проверяет, что модератор выбрал итоговый статус
+func validateModerationStatus(status models.ModerationStatus) error {
+	switch status {
+	case models.ModerationVisible, models.ModerationShadowHidden:
+		return nil
+	default:
+		return fmt.Errorf("недопустимый статус модерации %q", status)
+	}
+}
@@ -0,0 +1,130 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/repositories"
+)
+
+var (
+	// ErrPollNotFound возвращается, если у треда нет опроса
+	ErrPollNotFound = errors.New("опрос не найден")
+	// ErrPollClosed возвращается при голосовании в закрытом опросе
+	ErrPollClosed = errors.New("опрос закрыт")
+	// ErrAlreadyVoted возвращается при повторном голосовании той же сессии
+	ErrAlreadyVoted = errors.New("вы уже голосовали в этом опросе")
+	// ErrInvalidVote возвращается, если выбраны чужие варианты или несколько в опросе с одним ответом
+	ErrInvalidVote = errors.New("неверный выбор вариантов")
+)
+
+// PollService предоставляет бизнес-логику опросов в тредах
+type PollService struct {
+	pollRepo repositories.PollRepository
+	postRepo repositories.PostRepository
+}
+
+// NewPollService создает новый экземпляр сервиса опросов
+func NewPollService(pollRepo repositories.PollRepository, postRepo repositories.PostRepository) *PollService {
+	return &PollService{
+		pollRepo: pollRepo,
+		postRepo: postRepo,
+	}
+}
+
+// CreatePoll прикрепляет к треду опрос из проверенного черновика
+func (s *PollService) CreatePoll(ctx context.Context, postID int64, draft *models.PollDraft) (*models.Poll, error) {
+	poll := &models.Poll{
+		PostID:    postID,
+		Multiple:  draft.Multiple,
+		ClosesAt:  draft.ClosesAt,
+		Options:   make([]*models.PollOption, len(draft.Options)),
+		Voted:     []int64{},
+		CreatedAt: time.Now(),
+	}
+	for i, text := range draft.Options {
+		poll.Options[i] = &models.PollOption{Text: text}
+	}
+
+	id, err := s.pollRepo.Create(ctx, poll)
+	if err != nil {
+		return nil, err
+	}
+	poll.ID = id
+	return poll, nil
+}
+
+// GetPoll возвращает опрос треда с результатами и выбором сессии viewerID.
+// Closed учитывает истекший срок
+func (s *PollService) GetPoll(ctx context.Context, postID, viewerID int64) (*models.Poll, error) {
+	poll, err := s.pollRepo.GetByPostID(ctx, postID, viewerID)
+	if err != nil {
+		return nil, err
+	}
+	if poll == nil {
+		return nil, ErrPollNotFound
+	}
+
+	poll.Closed = poll.IsClosed(time.Now())
+	if poll.Voted == nil {
+		poll.Voted = []int64{}
+	}
+	return poll, nil
+}
+
+// Vote принимает голос сессии userID и возвращает обновленные результаты.
+// Каждая сессия голосует один раз, в опросе с одним ответом выбирается один вариант
+func (s *PollService) Vote(ctx context.Context, postID, userID int64, optionIDs []int64) (*models.Poll, error) {
+	poll, err := s.GetPoll(ctx, postID, userID)
+	if err != nil {
+		return nil, err
+	}
+	if poll.Closed {
+		return nil, ErrPollClosed
+	}
+
+	// Опрос архивного треда закрыт, даже если флаг не успели сохранить
+	post, err := s.postRepo.GetByID(ctx, postID)
+	if err != nil {
+		return nil, err
+	}
+	if post.IsArchived {
+		return nil, ErrPollClosed
+	}
+
+	if poll.HasVoted() {
+		return nil, ErrAlreadyVoted
+	}
+
+	slices.Sort(optionIDs)
+	optionIDs = slices.Compact(optionIDs)
+	if len(optionIDs) == 0 || (!poll.Multiple && len(optionIDs) > 1) {
+		return nil, ErrInvalidVote
+	}
+	for _, id := range optionIDs {
+		if !slices.ContainsFunc(poll.Options, func(option *models.PollOption) bool { return option.ID == id }) {
+			return nil, fmt.Errorf("%w: варианта %d нет в опросе", ErrInvalidVote, id)
+		}
+	}
+
+	voted, err := s.pollRepo.Vote(ctx, poll.ID, userID, optionIDs)
+	if err != nil {
+		return nil, err
+	}
+	if !voted {
+		return nil, ErrAlreadyVoted
+	}
+
+	slog.Info("Голос в опросе принят", "post_id", postID, "user_id", userID, "options", optionIDs)
+	return s.GetPoll(ctx, postID, userID)
+}
+
+// ClosePoll закрывает опрос треда, вызывается при архивации
+func (s *PollService) ClosePoll(ctx context.Context, postID int64) error {
+	return s.pollRepo.CloseByPostID(ctx, postID)
+}
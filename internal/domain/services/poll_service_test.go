@@ -0,0 +1,209 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// MockPollRepository имитирует репозиторий опросов для тестирования
+type MockPollRepository struct {
+	polls     map[int64]*models.Poll
+	votes     map[int64]map[int64][]int64
+	currentID int64
+}
+
+// NewMockPollRepository создает новый экземпляр мок-репозитория опросов
+func NewMockPollRepository() *MockPollRepository {
+	return &MockPollRepository{
+		polls:     make(map[int64]*models.Poll),
+		votes:     make(map[int64]map[int64][]int64),
+		currentID: 1,
+	}
+}
+
+// Create сохраняет опрос и нумерует его варианты
+func (m *MockPollRepository) Create(ctx context.Context, poll *models.Poll) (int64, error) {
+	stored := *poll
+	stored.ID = m.currentID
+	stored.Options = make([]*models.PollOption, len(poll.Options))
+	for i, option := range poll.Options {
+		stored.Options[i] = &models.PollOption{ID: m.currentID*100 + int64(i) + 1, Text: option.Text}
+	}
+	m.polls[poll.PostID] = &stored
+	m.votes[stored.ID] = make(map[int64][]int64)
+	m.currentID++
+	return stored.ID, nil
+}
+
+// GetByPostID возвращает копию опроса с подсчитанными голосами
+func (m *MockPollRepository) GetByPostID(ctx context.Context, postID, viewerID int64) (*models.Poll, error) {
+	stored, exists := m.polls[postID]
+	if !exists {
+		return nil, nil
+	}
+
+	poll := *stored
+	votes := m.votes[poll.ID]
+	poll.Voters = len(votes)
+	poll.Voted = slices.Clone(votes[viewerID])
+	poll.Options = make([]*models.PollOption, len(stored.Options))
+	for i, option := range stored.Options {
+		counted := &models.PollOption{ID: option.ID, Text: option.Text}
+		for _, chosen := range votes {
+			if slices.Contains(chosen, option.ID) {
+				counted.Votes++
+			}
+		}
+		poll.Options[i] = counted
+	}
+	return &poll, nil
+}
+
+// Vote сохраняет голос, если сессия еще не голосовала
+func (m *MockPollRepository) Vote(ctx context.Context, pollID, userID int64, optionIDs []int64) (bool, error) {
+	if _, voted := m.votes[pollID][userID]; voted {
+		return false, nil
+	}
+	m.votes[pollID][userID] = slices.Clone(optionIDs)
+	return true, nil
+}
+
+// CloseByPostID помечает опрос закрытым
+func (m *MockPollRepository) CloseByPostID(ctx context.Context, postID int64) error {
+	if poll, exists := m.polls[postID]; exists {
+		poll.Closed = true
+	}
+	return nil
+}
+
+// newPollFixture создает тред с опросом и возвращает сервис и созданный опрос
+func newPollFixture(t *testing.T, draft *models.PollDraft) (*services.PollService, *MockPollRepository, *MockPostRepository, *models.Poll) {
+	t.Helper()
+
+	postRepo := NewMockPostRepository()
+	postRepo.posts[1] = &models.Post{ID: 1, Title: "Опрос", UserID: 1, CreatedAt: time.Now()}
+	pollRepo := NewMockPollRepository()
+	service := services.NewPollService(pollRepo, postRepo)
+
+	poll, err := service.CreatePoll(context.Background(), 1, draft)
+	if err != nil {
+		t.Fatalf("Ошибка создания опроса: %v", err)
+	}
+	created, err := service.GetPoll(context.Background(), 1, 0)
+	if err != nil {
+		t.Fatalf("Ошибка получения опроса %d: %v", poll.ID, err)
+	}
+	return service, pollRepo, postRepo, created
+}
+
+// TestPollVote проверяет голосование и повторный голос той же сессии
+func TestPollVote(t *testing.T) {
+	ctx := context.Background()
+	service, _, _, poll := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет"}})
+
+	first := poll.Options[0].ID
+	result, err := service.Vote(ctx, 1, 10, []int64{first})
+	if err != nil {
+		t.Fatalf("Ошибка голосования: %v", err)
+	}
+	if result.Voters != 1 || result.Options[0].Votes != 1 || result.Options[1].Votes != 0 {
+		t.Errorf("Неверные результаты: голосов %d, варианты %d/%d", result.Voters, result.Options[0].Votes, result.Options[1].Votes)
+	}
+	if !result.VotedFor(first) {
+		t.Errorf("Выбор сессии не отмечен")
+	}
+	if result.Percent(result.Options[0].Votes) != 100 {
+		t.Errorf("Неверная доля варианта: %d", result.Percent(result.Options[0].Votes))
+	}
+
+	if _, err := service.Vote(ctx, 1, 10, []int64{poll.Options[1].ID}); !errors.Is(err, services.ErrAlreadyVoted) {
+		t.Errorf("Ожидалась ошибка повторного голоса, получено %v", err)
+	}
+
+	// Другая сессия голосует независимо
+	if _, err := service.Vote(ctx, 1, 11, []int64{poll.Options[1].ID}); err != nil {
+		t.Errorf("Ошибка голосования второй сессии: %v", err)
+	}
+}
+
+// TestPollVoteInvalid проверяет выбор вариантов в опросах с одним и несколькими ответами
+func TestPollVoteInvalid(t *testing.T) {
+	ctx := context.Background()
+	service, _, _, poll := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет", "Не знаю"}})
+	ids := []int64{poll.Options[0].ID, poll.Options[1].ID}
+
+	tests := []struct {
+		name      string
+		optionIDs []int64
+	}{
+		{"Без выбора", nil},
+		{"Несколько вариантов", ids},
+		{"Чужой вариант", []int64{999}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := service.Vote(ctx, 1, 10, tt.optionIDs); !errors.Is(err, services.ErrInvalidVote) {
+				t.Errorf("Ожидалась ошибка выбора, получено %v", err)
+			}
+		})
+	}
+
+	// Повтор одного варианта считается одним выбором
+	if _, err := service.Vote(ctx, 1, 10, []int64{ids[0], ids[0]}); err != nil {
+		t.Errorf("Ошибка голосования: %v", err)
+	}
+
+	multiple, _, _, multiplePoll := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет"}, Multiple: true})
+	result, err := multiple.Vote(ctx, 1, 10, []int64{multiplePoll.Options[0].ID, multiplePoll.Options[1].ID})
+	if err != nil {
+		t.Fatalf("Ошибка голосования за несколько вариантов: %v", err)
+	}
+	if result.Voters != 1 || len(result.Voted) != 2 {
+		t.Errorf("Неверные результаты: голосов %d, выбрано %d", result.Voters, len(result.Voted))
+	}
+}
+
+// TestPollClosed проверяет, что закрытый, истекший и архивный опросы не принимают голоса
+func TestPollClosed(t *testing.T) {
+	ctx := context.Background()
+
+	expired := time.Now().Add(-time.Minute)
+	service, _, _, poll := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет"}, ClosesAt: &expired})
+	if !poll.Closed {
+		t.Errorf("Опрос с истекшим сроком не отмечен закрытым")
+	}
+	if _, err := service.Vote(ctx, 1, 10, []int64{poll.Options[0].ID}); !errors.Is(err, services.ErrPollClosed) {
+		t.Errorf("Ожидалась ошибка закрытого опроса, получено %v", err)
+	}
+
+	service, _, postRepo, poll := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет"}})
+	postRepo.posts[1].IsArchived = true
+	if _, err := service.Vote(ctx, 1, 10, []int64{poll.Options[0].ID}); !errors.Is(err, services.ErrPollClosed) {
+		t.Errorf("Ожидалась ошибка для архивного треда, получено %v", err)
+	}
+
+	if _, err := service.GetPoll(ctx, 2, 10); !errors.Is(err, services.ErrPollNotFound) {
+		t.Errorf("Ожидалась ошибка отсутствующего опроса, получено %v", err)
+	}
+}
+
+// TestArchivePostClosesPoll проверяет закрытие опроса при архивации треда
+func TestArchivePostClosesPoll(t *testing.T) {
+	ctx := context.Background()
+	pollService, pollRepo, postRepo, _ := newPollFixture(t, &models.PollDraft{Options: []string{"Да", "Нет"}})
+
+	postService := services.NewPostService(postRepo, NewMockUserRepository())
+	postService.SetPollService(pollService)
+	if err := postService.ArchivePost(ctx, 1); err != nil {
+		t.Fatalf("Ошибка при архивации поста: %v", err)
+	}
+	if !pollRepo.polls[1].Closed {
+		t.Errorf("Опрос архивированного треда не закрыт")
+	}
+}
@@ -6,27 +6,69 @@ import (
 	"time"
 
 	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/validation"
 	"1337b04rd/internal/ports/repositories"
 )
 
+// CatalogPreviewReplies число последних ответов в превью карточки каталога
+const CatalogPreviewReplies = 3
+
 // PostService предоставляет бизнес-логику для работы с постами
 type PostService struct {
-	postRepo repositories.PostRepository
-	userRepo repositories.UserRepository
+	postRepo      repositories.PostRepository
+	userRepo      repositories.UserRepository
+	contentFilter *ContentFilter
+	spamScorer    *SpamScorer
+	pollService   *PollService
+	attachRepo    repositories.AttachmentRepository
+	validator     *validation.Validator
 }
 
 // NewPostService создает новый экземпляр сервиса постов
 func NewPostService(postRepo repositories.PostRepository, userRepo repositories.UserRepository) *PostService {
 	return &PostService{
-		postRepo: postRepo,
-		userRepo: userRepo,
+		postRepo:  postRepo,
+		userRepo:  userRepo,
+		validator: validation.NewValidator(validation.DefaultLimits()),
 	}
 }
 
-// GetPostByID возвращает пост по ID
+// SetContentFilter включает проверку новых постов фильтром содержимого
+func (s *PostService) SetContentFilter(contentFilter *ContentFilter) {
+	s.contentFilter = contentFilter
+}
+
+// SetSpamScorer включает спам-оценку новых постов
+func (s *PostService) SetSpamScorer(spamScorer *SpamScorer) {
+	s.spamScorer = spamScorer
+}
+
+// SetPollService включает опросы в новых тредах и их закрытие при архивации
+func (s *PostService) SetPollService(pollService *PollService) {
+	s.pollService = pollService
+}
+
+// SetAttachmentRepository включает чтение галерей постов
+func (s *PostService) SetAttachmentRepository(attachRepo repositories.AttachmentRepository) {
+	s.attachRepo = attachRepo
+}
+
+// GetPostByID возвращает пост по ID вместе с его файлами
 func (s *PostService) GetPostByID(ctx context.Context, id int64) (*models.Post, error) {
 	slog.Info("Получение поста", "id", id)
-	return s.postRepo.GetByID(ctx, id)
+	post, err := s.postRepo.GetByID(ctx, id)
+	if err != nil || post == nil || s.attachRepo == nil {
+		return post, err
+	}
+
+	// Без галереи пост показывается с одним изображением из ImageURL
+	attachments, err := s.attachRepo.GetByOwners(ctx, models.AttachmentPost, []int64{post.ID})
+	if err != nil {
+		slog.Error("Ошибка получения файлов поста", "id", id, "error", err)
+		return post, nil
+	}
+	post.Attachments = attachments[post.ID]
+	return post, nil
 }
 
 // GetAllPosts возвращает список постов
@@ -40,36 +82,83 @@ func (s *PostService) GetAllPosts(ctx context.Context, limit, offset int, archiv
 	return s.postRepo.GetAll(ctx, limit, offset, archived)
 }
 
-// GetTotalPostsCount возвращает общее количество постов
-func (s *PostService) GetTotalPostsCount(ctx context.Context, archived bool) (int, error) {
-	slog.Info("Получение общего количества постов", "archived", archived)
-	// В реальной реализации здесь бы был дополнительный метод в репозитории
-	// для подсчета общего количества постов
+// GetCatalog возвращает карточки каталога со сводкой по ответам и последними ответами
+// и общее число постов каталога
+func (s *PostService) GetCatalog(ctx context.Context, limit, offset int, archived bool) ([]*models.CatalogEntry, int, error) {
+	slog.Info("Получение каталога", "limit", limit, "offset", offset, "archived", archived)
+
+	if limit <= 0 {
+		limit = 10 // По умолчанию 10 постов
+	}
 
-	// Сейчас просто возвращаем фиктивные данные для демонстрации
-	if archived {
-		return 50, nil // Предположим, что в архиве 50 постов
+	entries, total, err := s.postRepo.GetCatalog(ctx, limit, offset, archived, CatalogPreviewReplies)
+	if err != nil {
+		return nil, 0, err
 	}
-	return 100, nil // Предположим, что в основном каталоге 100 постов
+	for _, entry := range entries {
+		if entry.LastReplies == nil {
+			entry.LastReplies = []*models.Comment{}
+		}
+	}
+	return entries, total, nil
 }
 
 // CreatePost создает новый пост
 func (s *PostService) CreatePost(ctx context.Context, title, content, imageURL string, userID int64) (*models.Post, error) {
-	user, err := s.userRepo.GetByID(ctx, userID)
+	return s.SubmitPost(ctx, &models.PostDraft{
+		Title:    title,
+		Content:  content,
+		ImageURL: imageURL,
+		UserID:   userID,
+	})
+}
+
+// SubmitPost нормализует и проверяет черновик, пропускает его через фильтр
+// и спам-оценщик и сохраняет пост. Ошибки полей возвращаются как validation.Errors
+func (s *PostService) SubmitPost(ctx context.Context, draft *models.PostDraft) (*models.Post, error) {
+	if err := s.validator.Post(draft); err != nil {
+		slog.Warn("Пост не прошел проверку", "user_id", draft.UserID, "error", err)
+		return nil, err
+	}
+
+	user, err := s.userRepo.GetByID(ctx, draft.UserID)
 	if err != nil {
 		slog.Error("Ошибка получения пользователя", "error", err)
 		return nil, err
 	}
 
+	spamInput := models.SpamInput{
+		Text:          draft.Title + "\n" + draft.Content,
+		ImageHash:     draft.ImageHash,
+		UserCreatedAt: user.CreatedAt,
+	}
+	checked, err := screenSubmission(ctx, s.contentFilter, s.spamScorer, spamInput, draft.Title, draft.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	userName := user.Username
+	if draft.Name != "" {
+		userName = draft.Name
+	}
+
 	post := &models.Post{
-		Title:      title,
-		Content:    content,
-		ImageURL:   imageURL,
-		UserID:     userID,
-		UserName:   user.Username,
+		Title:      checked.texts[0],
+		Content:    checked.texts[1],
+		ImageURL:   draft.ImageURL,
+		UserID:     draft.UserID,
+		UserName:   userName,
 		AvatarURL:  user.AvatarURL,
 		CreatedAt:  time.Now(),
 		IsArchived: false,
+		Status:     checked.status,
+		SpamScore:  checked.spamScore,
+
+		ImageWidth:          draft.ImageWidth,
+		ImageHeight:         draft.ImageHeight,
+		ThumbnailURL:        draft.ThumbnailURL,
+		CatalogThumbnailURL: draft.CatalogThumbnailURL,
+		Attachments:         draft.Attachments,
 	}
 
 	id, err := s.postRepo.Create(ctx, post)
@@ -77,13 +166,35 @@ func (s *PostService) CreatePost(ctx context.Context, title, content, imageURL s
 		slog.Error("Ошибка создания поста", "error", err)
 		return nil, err
 	}
-
 	post.ID = id
+
+	if s.spamScorer != nil {
+		s.spamScorer.Remember(ctx, models.FingerprintPost, post.ID, post.UserID, spamInput)
+	}
+
+	// Тред уже создан, поэтому ошибка опроса не отменяет публикацию
+	if draft.Poll != nil {
+		if s.pollService == nil {
+			slog.Warn("Опросы отключены, опрос не сохранен", "post_id", post.ID)
+		} else if _, err := s.pollService.CreatePoll(ctx, post.ID, draft.Poll); err != nil {
+			slog.Error("Ошибка создания опроса", "post_id", post.ID, "error", err)
+		}
+	}
+
 	return post, nil
 }
 
 // ArchivePost архивирует пост
 func (s *PostService) ArchivePost(ctx context.Context, id int64) error {
 	slog.Info("Архивация поста", "id", id)
-	return s.postRepo.Archive(ctx, id)
+	if err := s.postRepo.Archive(ctx, id); err != nil {
+		return err
+	}
+
+	if s.pollService != nil {
+		if err := s.pollService.ClosePoll(ctx, id); err != nil {
+			slog.Error("Ошибка закрытия опроса архивированного треда", "post_id", id, "error", err)
+		}
+	}
+	return nil
 }
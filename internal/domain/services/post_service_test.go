@@ -12,9 +12,10 @@ import (
 
 // MockPostRepository имитирует репозиторий постов для тестирования
 type MockPostRepository struct {
-	posts      map[int64]*models.Post
-	currentID  int64
-	archiveErr error
+	posts           map[int64]*models.Post
+	currentID       int64
+	archiveErr      error
+	catalogPreviews int
 }
 
 // NewMockPostRepository создает новый экземпляр мок-репозитория
@@ -53,6 +54,26 @@ func (m *MockPostRepository) GetAll(ctx context.Context, limit, offset int, arch
 	return result[offset:end], nil
 }
 
+// GetCatalog возвращает карточки каталога без сводки по ответам
+func (m *MockPostRepository) GetCatalog(ctx context.Context, limit, offset int, archived bool, previews int) ([]*models.CatalogEntry, int, error) {
+	m.catalogPreviews = previews
+	posts, err := m.GetAll(ctx, limit, offset, archived)
+	if err != nil {
+		return nil, 0, err
+	}
+	entries := make([]*models.CatalogEntry, len(posts))
+	for i, post := range posts {
+		entries[i] = &models.CatalogEntry{Post: post}
+	}
+	total := 0
+	for _, post := range m.posts {
+		if post.IsArchived == archived {
+			total++
+		}
+	}
+	return entries, total, nil
+}
+
 // GetAllForArchiving возвращает все неархивированные посты
 func (m *MockPostRepository) GetAllForArchiving(ctx context.Context) ([]*models.Post, error) {
 	var result []*models.Post
@@ -64,6 +85,17 @@ func (m *MockPostRepository) GetAllForArchiving(ctx context.Context) ([]*models.
 	return result, nil
 }
 
+// CountCreatedSince возвращает количество постов, созданных после момента since
+func (m *MockPostRepository) CountCreatedSince(ctx context.Context, since time.Time) (int, error) {
+	count := 0
+	for _, post := range m.posts {
+		if post.CreatedAt.After(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
 // Create создает новый пост
 func (m *MockPostRepository) Create(ctx context.Context, post *models.Post) (int64, error) {
 	id := m.currentID
@@ -86,6 +118,67 @@ func (m *MockPostRepository) Archive(ctx context.Context, id int64) error {
 	return nil
 }
 
+// Delete удаляет пост и возвращает адреса его изображений
+func (m *MockPostRepository) Delete(ctx context.Context, id int64) ([]string, error) {
+	post, exists := m.posts[id]
+	if !exists {
+		return nil, fmt.Errorf("пост с ID %d не найден", id)
+	}
+	delete(m.posts, id)
+
+	var imageURLs []string
+	for _, url := range []string{post.ImageURL, post.ThumbnailURL, post.CatalogThumbnailURL} {
+		if url != "" {
+			imageURLs = append(imageURLs, url)
+		}
+	}
+	return imageURLs, nil
+}
+
+// GetByStatus возвращает посты с указанными статусами модерации
+func (m *MockPostRepository) GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Post, error) {
+	var result []*models.Post
+	for _, item := range m.posts {
+		for _, status := range statuses {
+			if item.Status == status {
+				result = append(result, item)
+				break
+			}
+		}
+	}
+	return result, nil
+}
+
+// SetStatus меняет статус модерации
+func (m *MockPostRepository) SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.Status = status
+	return nil
+}
+
+// SetSticky меняет флаг закрепления поста
+func (m *MockPostRepository) SetSticky(ctx context.Context, id int64, sticky bool) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.IsSticky = sticky
+	return nil
+}
+
+// SetLocked меняет флаг закрытия поста
+func (m *MockPostRepository) SetLocked(ctx context.Context, id int64, locked bool) error {
+	item, exists := m.posts[id]
+	if !exists {
+		return fmt.Errorf("запись с ID %d не найдена", id)
+	}
+	item.IsLocked = locked
+	return nil
+}
+
 // Тесты для сервиса постов
 func TestCreatePost(t *testing.T) {
 	// Инициализация мок-репозиториев
@@ -220,3 +313,30 @@ func TestArchivePost(t *testing.T) {
 		t.Errorf("Пост не был архивирован")
 	}
 }
+
+// TestGetCatalog проверяет получение карточек каталога
+func TestGetCatalog(t *testing.T) {
+	mockPostRepo := NewMockPostRepository()
+	mockUserRepo := NewMockUserRepository()
+	postService := services.NewPostService(mockPostRepo, mockUserRepo)
+
+	mockPostRepo.posts[1] = &models.Post{ID: 1, Title: "Активный тред", ReplyCount: 4}
+	mockPostRepo.posts[2] = &models.Post{ID: 2, Title: "Архивный тред", IsArchived: true}
+
+	entries, total, err := postService.GetCatalog(context.Background(), 0, 0, false)
+	if err != nil {
+		t.Fatalf("Ошибка при получении каталога: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != 1 || entries[0].ReplyCount != 4 {
+		t.Fatalf("Ожидалась одна карточка активного треда, получено %d", len(entries))
+	}
+	if total != 1 {
+		t.Errorf("Ожидался один пост в каталоге, получено %d", total)
+	}
+	if entries[0].LastReplies == nil {
+		t.Error("Последние ответы должны быть пустым списком, а не nil")
+	}
+	if mockPostRepo.catalogPreviews != services.CatalogPreviewReplies {
+		t.Errorf("Ожидалось %d ответов в превью, запрошено %d", services.CatalogPreviewReplies, mockPostRepo.catalogPreviews)
+	}
+}
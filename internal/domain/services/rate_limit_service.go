@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// staleBucketCleaner реализуется хранилищами, которым нужна периодическая очистка
+type staleBucketCleaner interface {
+	DeleteStale(ctx context.Context, maxAge time.Duration) (int64, error)
+}
+
+// RateLimitService ограничивает частоту действий пользователей
+// по нескольким ключам (сессия, IP-адрес) одновременно
+type RateLimitService struct {
+	repo   repositories.RateLimitRepository
+	config models.RateLimitConfig
+}
+
+// NewRateLimitService создает новый экземпляр сервиса ограничения частоты
+func NewRateLimitService(repo repositories.RateLimitRepository, config models.RateLimitConfig) *RateLimitService {
+	return &RateLimitService{
+		repo:   repo,
+		config: config,
+	}
+}
+
+// Allow проверяет, можно ли выполнить действие на доске для всех переданных ключей.
+// Действие разрешено, только если токен нашелся в каждой корзине. Если какая-то
+// корзина пуста, токены, уже забранные из остальных, возвращаются: отклоненный
+// запрос не расходует лимит. Доска, которой нет в настройках, считается доской
+// по умолчанию, чтобы клиент не мог получать новые корзины, меняя имя доски
+func (s *RateLimitService) Allow(ctx context.Context, board string, action models.RateLimitAction, keys ...string) (models.RateLimitDecision, error) {
+	board = s.config.Board(board)
+	rule := s.config.Rule(board, action)
+	if rule.Disabled() {
+		return models.RateLimitDecision{Allowed: true}, nil
+	}
+
+	now := time.Now()
+	result := models.RateLimitDecision{Allowed: true, Remaining: rule.Burst}
+	var taken []string
+
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+
+		bucketKey := string(action) + ":" + board + ":" + key
+		decision, err := s.repo.Take(ctx, bucketKey, rule, now)
+		if err != nil {
+			slog.Error("Ошибка проверки ограничения частоты", "key", bucketKey, "error", err)
+			s.refund(ctx, taken, rule)
+			return models.RateLimitDecision{}, err
+		}
+
+		if !decision.Allowed {
+			result.Allowed = false
+			if decision.RetryAfter > result.RetryAfter {
+				result.RetryAfter = decision.RetryAfter
+			}
+		} else {
+			taken = append(taken, bucketKey)
+		}
+		if decision.Remaining < result.Remaining {
+			result.Remaining = decision.Remaining
+		}
+	}
+
+	if !result.Allowed {
+		s.refund(ctx, taken, rule)
+		result.Remaining = 0
+		slog.Warn("Превышен лимит частоты",
+			"board", board,
+			"action", action,
+			"retry_after", result.RetryAfter)
+	}
+
+	return result, nil
+}
+
+// refund возвращает токены в корзины отклоненного действия
+func (s *RateLimitService) refund(ctx context.Context, bucketKeys []string, rule models.RateLimitRule) {
+	for _, bucketKey := range bucketKeys {
+		if err := s.repo.Refund(ctx, bucketKey, rule); err != nil {
+			slog.Error("Ошибка возврата токена", "key", bucketKey, "error", err)
+		}
+	}
+}
+
+// StartCleanupJob периодически удаляет устаревшие корзины, если хранилище это поддерживает
+func (s *RateLimitService) StartCleanupJob(ctx context.Context, interval time.Duration) {
+	cleaner, ok := s.repo.(staleBucketCleaner)
+	if !ok {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				deleted, err := cleaner.DeleteStale(ctx, 24*time.Hour)
+				if err != nil {
+					slog.Error("Ошибка очистки корзин ограничения частоты", "error", err)
+					continue
+				}
+				if deleted > 0 {
+					slog.Info("Удалены устаревшие корзины ограничения частоты", "count", deleted)
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
@@ -0,0 +1,142 @@
+package services_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/adapters/secondary/memory"
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// TestRateLimitAllow проверяет, что после исчерпания корзины действие запрещается
+func TestRateLimitAllow(t *testing.T) {
+	config := models.DefaultRateLimitConfig()
+	config.Default[models.RateLimitThread] = models.RateLimitRule{Burst: 2, Interval: time.Minute}
+
+	limiter := services.NewRateLimitService(memory.NewRateLimitRepository(), config)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		decision, err := limiter.Allow(ctx, "b", models.RateLimitThread, "session:1", "ip:127.0.0.1")
+		if err != nil {
+			t.Fatalf("Ошибка проверки лимита: %v", err)
+		}
+		if !decision.Allowed {
+			t.Fatalf("Попытка %d должна быть разрешена", i+1)
+		}
+	}
+
+	decision, err := limiter.Allow(ctx, "b", models.RateLimitThread, "session:1", "ip:127.0.0.1")
+	if err != nil {
+		t.Fatalf("Ошибка проверки лимита: %v", err)
+	}
+	if decision.Allowed {
+		t.Errorf("Третья попытка должна быть запрещена")
+	}
+	if decision.RetryAfter <= 0 || decision.RetryAfter > time.Minute {
+		t.Errorf("Неверное значение RetryAfter: %v", decision.RetryAfter)
+	}
+
+	// Другая сессия с того же IP тоже ограничена
+	decision, _ = limiter.Allow(ctx, "b", models.RateLimitThread, "session:2", "ip:127.0.0.1")
+	if decision.Allowed {
+		t.Errorf("Лимит по IP должен распространяться на другие сессии")
+	}
+
+	// Ответы ограничиваются отдельно от тредов
+	decision, _ = limiter.Allow(ctx, "b", models.RateLimitReply, "session:1", "ip:127.0.0.1")
+	if !decision.Allowed {
+		t.Errorf("Лимит тредов не должен влиять на ответы")
+	}
+}
+
+// TestRateLimitBoardOverride проверяет переопределение правил для отдельной доски
+func TestRateLimitBoardOverride(t *testing.T) {
+	config := models.DefaultRateLimitConfig()
+	config.Default[models.RateLimitReply] = models.RateLimitRule{Burst: 1, Interval: time.Hour}
+	config.Boards["g"] = models.RateLimitPolicy{
+		models.RateLimitReply: {Burst: 0, Interval: 0},
+	}
+
+	limiter := services.NewRateLimitService(memory.NewRateLimitRepository(), config)
+	ctx := context.Background()
+
+	for i := 0; i < 5; i++ {
+		decision, _ := limiter.Allow(ctx, "g", models.RateLimitReply, "session:1")
+		if !decision.Allowed {
+			t.Fatalf("На доске без ограничений попытка %d должна быть разрешена", i+1)
+		}
+	}
+
+	limiter.Allow(ctx, "b", models.RateLimitReply, "session:1")
+	decision, _ := limiter.Allow(ctx, "b", models.RateLimitReply, "session:1")
+	if decision.Allowed {
+		t.Errorf("На доске по умолчанию вторая попытка должна быть запрещена")
+	}
+}
+
+// TestRateLimitUnknownBoard проверяет, что неизвестное имя доски не дает новых корзин
+func TestRateLimitUnknownBoard(t *testing.T) {
+	config := models.DefaultRateLimitConfig()
+	config.Known = models.NewBoardSet("g")
+	config.Default[models.RateLimitThread] = models.RateLimitRule{Burst: 1, Interval: time.Hour}
+
+	limiter := services.NewRateLimitService(memory.NewRateLimitRepository(), config)
+	ctx := context.Background()
+
+	if decision, _ := limiter.Allow(ctx, "b", models.RateLimitThread, "ip:127.0.0.1"); !decision.Allowed {
+		t.Fatal("Первая попытка должна быть разрешена")
+	}
+	for _, board := range []string{"x1", "x2", " B "} {
+		if decision, _ := limiter.Allow(ctx, board, models.RateLimitThread, "ip:127.0.0.1"); decision.Allowed {
+			t.Errorf("Доска %q должна использовать корзину доски по умолчанию", board)
+		}
+	}
+
+	// Настроенная доска ограничивается отдельно
+	if decision, _ := limiter.Allow(ctx, "g", models.RateLimitThread, "ip:127.0.0.1"); !decision.Allowed {
+		t.Error("Настроенная доска должна иметь свою корзину")
+	}
+}
+
+// TestRateLimitRefund проверяет, что отклоненное действие не расходует токены других корзин
+func TestRateLimitRefund(t *testing.T) {
+	config := models.DefaultRateLimitConfig()
+	config.Default[models.RateLimitReply] = models.RateLimitRule{Burst: 1, Interval: time.Hour}
+
+	limiter := services.NewRateLimitService(memory.NewRateLimitRepository(), config)
+	ctx := context.Background()
+
+	// Сессия исчерпала лимит с другого адреса
+	limiter.Allow(ctx, "b", models.RateLimitReply, "ip:10.0.0.1", "session:1")
+
+	decision, _ := limiter.Allow(ctx, "b", models.RateLimitReply, "ip:10.0.0.2", "session:1")
+	if decision.Allowed {
+		t.Fatal("Запрос исчерпавшей лимит сессии должен быть отклонен")
+	}
+
+	// Токен адреса, забранный отклоненным запросом, возвращен
+	decision, _ = limiter.Allow(ctx, "b", models.RateLimitReply, "ip:10.0.0.2", "session:2")
+	if !decision.Allowed {
+		t.Error("Отклоненный запрос не должен расходовать лимит адреса")
+	}
+}
+
+// TestParseRateLimitRule проверяет разбор правил из строки
+func TestParseRateLimitRule(t *testing.T) {
+	rule, err := models.ParseRateLimitRule("3/10m")
+	if err != nil {
+		t.Fatalf("Ошибка разбора правила: %v", err)
+	}
+	if rule.Burst != 3 || rule.Interval != 10*time.Minute {
+		t.Errorf("Неверное правило: %v", rule)
+	}
+
+	for _, value := range []string{"", "3", "x/1m", "3/abc", "-1/1m"} {
+		if _, err := models.ParseRateLimitRule(value); err == nil {
+			t.Errorf("Ожидалась ошибка для %q", value)
+		}
+	}
+}
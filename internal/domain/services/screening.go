@@ -0,0 +1,49 @@
+package services
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// screening результат проверки отправки перед сохранением
+type screening struct {
+	texts     []string
+	status    models.ModerationStatus
+	spamScore float64
+}
+
+// screenSubmission прогоняет отправку через фильтр содержимого и спам-оценщик,
+// если они подключены. Возвращает тексты после замен фильтра
+func screenSubmission(
+	ctx context.Context,
+	filter *ContentFilter,
+	scorer *SpamScorer,
+	input models.SpamInput,
+	texts ...string,
+) (*screening, error) {
+	result := &screening{
+		texts:  texts,
+		status: models.ModerationVisible,
+	}
+
+	if filter != nil {
+		filtered, err := filter.Apply(ctx, texts...)
+		if err != nil {
+			return nil, err
+		}
+		result.texts = filtered.Texts
+		result.status = filtered.Status
+	}
+
+	if scorer != nil {
+		verdict := scorer.Score(ctx, input)
+		if verdict.Decision == models.SpamReject {
+			return nil, ErrSpamRejected
+		}
+		result.spamScore = verdict.Score
+		result.status = result.status.Stricter(verdict.Status())
+	}
+
+	return result, nil
+}
@@ -0,0 +1,202 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/ports/repositories"
+)
+
+// ErrSpamRejected возвращается, когда спам-оценка отправки превысила порог отклонения
+var ErrSpamRejected = errors.New("сообщение похоже на спам")
+
+// shingleSize количество слов в одном шингле
+const shingleSize = 3
+
+// linkPattern находит ссылки в тексте
+var linkPattern = regexp.MustCompile(`(?i)(https?://|www\.)\S+`)
+
+// SpamScorer оценивает отправки по признакам спама: повтор текста и изображений
+// среди последних отправок, плотность ссылок и возраст сессии
+type SpamScorer struct {
+	fingerprintRepo repositories.FingerprintRepository
+	config          models.SpamConfig
+}
+
+// NewSpamScorer создает новый экземпляр спам-оценщика
+func NewSpamScorer(fingerprintRepo repositories.FingerprintRepository, config models.SpamConfig) *SpamScorer {
+	return &SpamScorer{
+		fingerprintRepo: fingerprintRepo,
+		config:          config,
+	}
+}
+
+// Score вычисляет спам-оценку отправки и решение по ней.
+// При ошибке чтения истории оценивается только сама отправка
+func (s *SpamScorer) Score(ctx context.Context, input models.SpamInput) *models.SpamVerdict {
+	verdict := &models.SpamVerdict{}
+	add := func(weight float64, reason string) {
+		if weight <= 0 {
+			return
+		}
+		verdict.Score += weight
+		verdict.Reasons = append(verdict.Reasons, reason)
+	}
+
+	history, err := s.fingerprintRepo.Recent(ctx, s.config.HistorySize)
+	if err != nil {
+		slog.Error("Ошибка загрузки истории отправок", "error", err)
+	}
+
+	// Повтор текста: точный или по сходству шинглов
+	normalized := normalizeText(input.Text)
+	if len([]rune(normalized)) >= s.config.MinDuplicateLength {
+		similarity := maxSimilarity(normalized, history)
+		if similarity >= s.config.NearDuplicateSimilarity {
+			add(s.config.DuplicateWeight*similarity, fmt.Sprintf("повтор текста (сходство %.2f)", similarity))
+		}
+	}
+
+	// Повтор изображения
+	if input.ImageHash != "" {
+		for _, fp := range history {
+			if fp.ImageHash == input.ImageHash {
+				add(s.config.ImageRepostWeight, "повтор изображения")
+				break
+			}
+		}
+	}
+
+	// Плотность ссылок: доля ссылок среди слов, насыщается на каждой четвертой
+	if links := len(linkPattern.FindAllString(input.Text, -1)); links > 0 {
+		words := len(strings.Fields(input.Text))
+		density := float64(links) / float64(max(words, 1))
+		add(s.config.LinkWeight*math.Min(1, density*4), fmt.Sprintf("ссылки (%d на %d слов)", links, words))
+	}
+
+	// Новая сессия
+	if !input.UserCreatedAt.IsZero() && time.Since(input.UserCreatedAt) < s.config.NewSessionAge {
+		add(s.config.NewSessionWeight, "новая сессия")
+	}
+
+	verdict.Score = math.Round(verdict.Score*1000) / 1000
+	verdict.Decision = s.config.Decide(verdict.Score)
+	if verdict.Decision != models.SpamAllow {
+		slog.Warn("Подозрение на спам",
+			"score", verdict.Score,
+			"decision", verdict.Decision,
+			"reasons", verdict.Reasons)
+	}
+	return verdict
+}
+
+// Remember сохраняет отпечаток опубликованной отправки для сравнения с последующими
+func (s *SpamScorer) Remember(ctx context.Context, kind string, refID, userID int64, input models.SpamInput) {
+	fingerprint := &models.ContentFingerprint{
+		Kind:      kind,
+		RefID:     refID,
+		UserID:    userID,
+		Text:      normalizeText(input.Text),
+		ImageHash: input.ImageHash,
+		CreatedAt: time.Now(),
+	}
+	if err := s.fingerprintRepo.Save(ctx, fingerprint); err != nil {
+		slog.Error("Ошибка сохранения отпечатка", "kind", kind, "ref_id", refID, "error", err)
+	}
+}
+
+// StartCleanupJob периодически удаляет отпечатки, которые уже не участвуют в сравнении.
+// Хранится десятикратный запас истории, чтобы было на чем подбирать пороги
+func (s *SpamScorer) StartCleanupJob(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := s.fingerprintRepo.Trim(ctx, s.config.HistorySize*10); err != nil {
+					slog.Error("Ошибка очистки отпечатков", "error", err)
+				}
+			case <-ctx.Done():
+				slog.Info("Остановка очистки отпечатков")
+				return
+			}
+		}
+	}()
+}
+
+// normalizeText приводит текст к нижнему регистру, убирает ссылки, пунктуацию
+// и лишние пробелы, чтобы мелкие правки не мешали поиску повторов
+func normalizeText(text string) string {
+	text = linkPattern.ReplaceAllString(strings.ToLower(text), " ")
+	text = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return ' '
+	}, text)
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// shingles возвращает множество хэшей последовательностей из shingleSize слов
+func shingles(normalized string) map[uint64]struct{} {
+	words := strings.Fields(normalized)
+	set := make(map[uint64]struct{})
+	if len(words) == 0 {
+		return set
+	}
+
+	hash := func(parts []string) uint64 {
+		h := fnv.New64a()
+		h.Write([]byte(strings.Join(parts, " ")))
+		return h.Sum64()
+	}
+
+	if len(words) < shingleSize {
+		set[hash(words)] = struct{}{}
+		return set
+	}
+	for i := 0; i+shingleSize <= len(words); i++ {
+		set[hash(words[i:i+shingleSize])] = struct{}{}
+	}
+	return set
+}
+
+// maxSimilarity возвращает наибольшее сходство текста с историей:
+// 1 для точного совпадения, иначе коэффициент Жаккара по шинглам
+func maxSimilarity(normalized string, history []*models.ContentFingerprint) float64 {
+	current := shingles(normalized)
+	best := 0.0
+
+	for _, fp := range history {
+		if fp.Text == "" {
+			continue
+		}
+		if fp.Text == normalized {
+			return 1
+		}
+
+		other := shingles(fp.Text)
+		intersection := 0
+		for h := range current {
+			if _, ok := other[h]; ok {
+				intersection++
+			}
+		}
+		union := len(current) + len(other) - intersection
+		if union > 0 {
+			best = math.Max(best, float64(intersection)/float64(union))
+		}
+	}
+	return best
+}
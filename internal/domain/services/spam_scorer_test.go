@@ -0,0 +1,123 @@
+package services_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/services"
+)
+
+// MockFingerprintRepository хранит отпечатки в памяти для тестов
+type MockFingerprintRepository struct {
+	fingerprints []*models.ContentFingerprint
+}
+
+// Recent возвращает последние отпечатки, новые первыми
+func (m *MockFingerprintRepository) Recent(ctx context.Context, limit int) ([]*models.ContentFingerprint, error) {
+	var result []*models.ContentFingerprint
+	for i := len(m.fingerprints) - 1; i >= 0 && len(result) < limit; i-- {
+		result = append(result, m.fingerprints[i])
+	}
+	return result, nil
+}
+
+// Save сохраняет отпечаток
+func (m *MockFingerprintRepository) Save(ctx context.Context, fp *models.ContentFingerprint) error {
+	m.fingerprints = append(m.fingerprints, fp)
+	return nil
+}
+
+// Trim оставляет только последние keep отпечатков
+func (m *MockFingerprintRepository) Trim(ctx context.Context, keep int) error {
+	if len(m.fingerprints) > keep {
+		m.fingerprints = m.fingerprints[len(m.fingerprints)-keep:]
+	}
+	return nil
+}
+
+const spamText = "Лучшие цены на часы только сегодня, заходите в наш магазин и получите скидку"
+
+// TestSpamScorerDuplicates проверяет оценку точных и почти точных повторов
+func TestSpamScorerDuplicates(t *testing.T) {
+	ctx := context.Background()
+	scorer := services.NewSpamScorer(&MockFingerprintRepository{}, models.DefaultSpamConfig())
+
+	first := scorer.Score(ctx, models.SpamInput{Text: spamText})
+	if first.Score != 0 || first.Decision != models.SpamAllow {
+		t.Fatalf("Первая отправка не должна считаться спамом: %+v", first)
+	}
+	scorer.Remember(ctx, models.FingerprintPost, 1, 1, models.SpamInput{Text: spamText, ImageHash: "abc"})
+
+	exact := scorer.Score(ctx, models.SpamInput{Text: "ЛУЧШИЕ цены на часы только сегодня!!! Заходите в наш магазин и получите скидку"})
+	if exact.Decision != models.SpamQueue {
+		t.Errorf("Повтор с другой пунктуацией должен отправляться на модерацию: %+v", exact)
+	}
+
+	near := scorer.Score(ctx, models.SpamInput{Text: spamText + " прямо сейчас"})
+	if near.Score <= 0 {
+		t.Errorf("Почти точный повтор должен получать оценку: %+v", near)
+	}
+
+	different := scorer.Score(ctx, models.SpamInput{Text: "Сегодня попробовал новый рецепт борща, делюсь впечатлениями с вами"})
+	if different.Score != 0 {
+		t.Errorf("Другой текст не должен получать оценку: %+v", different)
+	}
+
+	image := scorer.Score(ctx, models.SpamInput{Text: "другой текст", ImageHash: "abc"})
+	if image.Score == 0 {
+		t.Errorf("Повтор изображения должен получать оценку: %+v", image)
+	}
+}
+
+// TestSpamScorerReject проверяет отклонение при сумме признаков выше порога
+func TestSpamScorerReject(t *testing.T) {
+	ctx := context.Background()
+	scorer := services.NewSpamScorer(&MockFingerprintRepository{}, models.DefaultSpamConfig())
+	scorer.Remember(ctx, models.FingerprintPost, 1, 1, models.SpamInput{Text: spamText, ImageHash: "abc"})
+
+	verdict := scorer.Score(ctx, models.SpamInput{
+		Text:          spamText + " https://spam.example/a https://spam.example/b",
+		ImageHash:     "abc",
+		UserCreatedAt: time.Now(),
+	})
+	if verdict.Decision != models.SpamReject {
+		t.Errorf("Ожидалось отклонение, получено: %+v", verdict)
+	}
+}
+
+// TestSubmitPostSpamQueue проверяет, что повтор поста уходит на модерацию, а спам отклоняется
+func TestSubmitPostSpamQueue(t *testing.T) {
+	ctx := context.Background()
+	userRepo := NewMockUserRepository()
+	userRepo.Create(ctx, &models.User{Username: "Rick"})
+
+	postService := services.NewPostService(NewMockPostRepository(), userRepo)
+	postService.SetSpamScorer(services.NewSpamScorer(&MockFingerprintRepository{}, models.DefaultSpamConfig()))
+
+	draft := &models.PostDraft{Title: "Часы", Content: spamText, UserID: 1}
+	first, err := postService.SubmitPost(ctx, draft)
+	if err != nil {
+		t.Fatalf("Ошибка создания поста: %v", err)
+	}
+	if first.Status != models.ModerationVisible {
+		t.Errorf("Первый пост должен быть виден, статус: %s", first.Status)
+	}
+
+	second, err := postService.SubmitPost(ctx, draft)
+	if err != nil {
+		t.Fatalf("Ошибка создания поста: %v", err)
+	}
+	if second.Status != models.ModerationPending || second.SpamScore == 0 {
+		t.Errorf("Повтор должен уйти на модерацию: статус %s, оценка %v", second.Status, second.SpamScore)
+	}
+
+	draft.ImageHash = "abc"
+	draft.Content += " https://spam.example"
+	postService.SubmitPost(ctx, &models.PostDraft{Title: "Часы", Content: "картинка", ImageHash: "abc", UserID: 1})
+	if _, err := postService.SubmitPost(ctx, draft); !errors.Is(err, services.ErrSpamRejected) {
+		t.Errorf("Ожидалось отклонение спама, получено: %v", err)
+	}
+}
@@ -0,0 +1,243 @@
+package validation
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+
+	"1337b04rd/internal/domain/markup"
+	"1337b04rd/internal/domain/models"
+)
+
+// Имена полей в ошибках совпадают с именами полей HTML форм
+const (
+	FieldName    = "name"
+	FieldTitle   = "subject"
+	FieldContent = "comment"
+	FieldReplyTo = "reply_to_id"
+	FieldFile    = "file"
+
+	FieldPollOptions  = "poll_options"
+	FieldPollClosesIn = "poll_closes_in"
+)
+
+// MaxPollDuration наибольший срок, на который можно открыть опрос
+const MaxPollDuration = 30 * 24 * time.Hour
+
+// Limits ограничения длины полей в символах
+type Limits struct {
+	Name    int
+	Title   int
+	Content int
+	// Quotes наибольшее число ссылок >>id в одном сообщении
+	Quotes int
+	// PollOptions наибольшее число вариантов в опросе, PollOption - длина варианта
+	PollOptions int
+	PollOption  int
+	// Attachments наибольшее число файлов в сообщении
+	Attachments int
+}
+
+// DefaultLimits возвращает ограничения по умолчанию.
+// Имя и заголовок укладываются в VARCHAR(255) с запасом
+func DefaultLimits() Limits {
+	return Limits{
+		Name:    64,
+		Title:   150,
+		Content: 8000,
+		Quotes:  20,
+
+		PollOptions: 10,
+		PollOption:  100,
+
+		Attachments: models.MaxAttachments,
+	}
+}
+
+// FieldError ошибка в одном поле формы
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Errors набор ошибок по полям, возвращается сервисами как error
+type Errors []FieldError
+
+// Error объединяет сообщения всех полей
+func (e Errors) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldErr := range e {
+		messages[i] = fieldErr.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Fields возвращает сообщения по именам полей, удобно для шаблонов и JSON
+func (e Errors) Fields() map[string]string {
+	fields := make(map[string]string, len(e))
+	for _, fieldErr := range e {
+		if _, ok := fields[fieldErr.Field]; !ok {
+			fields[fieldErr.Field] = fieldErr.Message
+		}
+	}
+	return fields
+}
+
+// add добавляет ошибку поля
+func (e *Errors) add(field, format string, args ...interface{}) {
+	*e = append(*e, FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+}
+
+// err возвращает nil, если ошибок нет
+func (e Errors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Validator нормализует и проверяет черновики перед сохранением
+type Validator struct {
+	limits Limits
+}
+
+// NewValidator создает новый валидатор с указанными ограничениями
+func NewValidator(limits Limits) *Validator {
+	return &Validator{limits: limits}
+}
+
+// Post нормализует поля черновика треда и проверяет их.
+// Заголовок необязателен, тред должен содержать текст или изображение
+func (v *Validator) Post(draft *models.PostDraft) error {
+	draft.Name = strings.TrimSpace(Normalize(draft.Name))
+	draft.Title = strings.TrimSpace(Normalize(draft.Title))
+	draft.Content = normalizeContent(draft.Content)
+
+	var errs Errors
+	v.checkLength(&errs, FieldName, "Имя", draft.Name, v.limits.Name)
+	v.checkLength(&errs, FieldTitle, "Заголовок", draft.Title, v.limits.Title)
+	if draft.Content == "" && draft.ImageURL == "" && draft.ImageHash == "" {
+		errs.add(FieldContent, "Добавьте текст или изображение")
+	}
+	v.checkLength(&errs, FieldContent, "Текст", draft.Content, v.limits.Content)
+	v.attachments(&errs, draft.Attachments)
+	if draft.Poll != nil {
+		v.poll(&errs, draft.Poll)
+	}
+	return errs.err()
+}
+
+// poll нормализует варианты опроса, убирает пустые строки и проверяет число вариантов и срок
+func (v *Validator) poll(errs *Errors, draft *models.PollDraft) {
+	options := make([]string, 0, len(draft.Options))
+	for _, option := range draft.Options {
+		option = strings.TrimSpace(Normalize(option))
+		if option == "" {
+			continue
+		}
+		if slices.Contains(options, option) {
+			errs.add(FieldPollOptions, "Вариант «%s» повторяется", option)
+			return
+		}
+		v.checkLength(errs, FieldPollOptions, "Вариант ответа", option, v.limits.PollOption)
+		options = append(options, option)
+	}
+	draft.Options = options
+
+	switch {
+	case len(options) < 2:
+		errs.add(FieldPollOptions, "Добавьте хотя бы два варианта ответа")
+	case v.limits.PollOptions > 0 && len(options) > v.limits.PollOptions:
+		errs.add(FieldPollOptions, "Не больше %d вариантов ответа", v.limits.PollOptions)
+	}
+
+	if draft.ClosesAt != nil {
+		if until := time.Until(*draft.ClosesAt); until <= 0 || until > MaxPollDuration {
+			errs.add(FieldPollClosesIn, "Опрос должен закрываться в будущем и не позже чем через %d дней", int(MaxPollDuration.Hours()/24))
+		}
+	}
+}
+
+// Comment нормализует текст черновика комментария и проверяет его.
+// Комментарий должен содержать текст или изображение
+func (v *Validator) Comment(draft *models.CommentDraft) error {
+	draft.Content = normalizeContent(draft.Content)
+
+	var errs Errors
+	if draft.Content == "" && draft.ImageURL == "" && draft.ImageHash == "" {
+		errs.add(FieldContent, "Добавьте текст или изображение")
+	}
+	v.checkLength(&errs, FieldContent, "Текст", draft.Content, v.limits.Content)
+	if v.limits.Quotes > 0 && len(markup.QuoteIDs(draft.Content)) > v.limits.Quotes {
+		errs.add(FieldContent, "Не больше %d ссылок >>id в одном комментарии", v.limits.Quotes)
+	}
+	v.attachments(&errs, draft.Attachments)
+	return errs.err()
+}
+
+// maxFilenameLength длина имени файла в символах, укладывается в VARCHAR(255)
+const maxFilenameLength = 255
+
+// attachments проверяет число файлов и нормализует их имена. Длинные имена
+// обрезаются: имя только подписывает файл в галерее
+func (v *Validator) attachments(errs *Errors, attachments []*models.Attachment) {
+	if v.limits.Attachments > 0 && len(attachments) > v.limits.Attachments {
+		errs.add(FieldFile, "Не больше %d файлов в одном сообщении", v.limits.Attachments)
+	}
+	for _, attachment := range attachments {
+		filename := []rune(strings.TrimSpace(Normalize(attachment.Filename)))
+		if len(filename) > maxFilenameLength {
+			filename = filename[:maxFilenameLength]
+		}
+		attachment.Filename = string(filename)
+	}
+}
+
+// checkLength проверяет длину поля в символах
+func (v *Validator) checkLength(errs *Errors, field, label, value string, limit int) {
+	if limit > 0 && utf8.RuneCountInString(value) > limit {
+		errs.add(field, "%s длиннее %d символов", label, limit)
+	}
+}
+
+// Normalize приводит строку к форме NFC, заменяет некорректные последовательности UTF-8
+// и удаляет невидимые символы нулевой ширины и управления направлением текста,
+// которыми маскируют спам и подделывают чужие имена
+func Normalize(s string) string {
+	s = strings.ToValidUTF8(s, "�")
+	s = strings.Map(func(r rune) rune {
+		if isInvisible(r) {
+			return -1
+		}
+		return r
+	}, s)
+	return norm.NFC.String(s)
+}
+
+// normalizeContent нормализует многострочный текст: переводы строк приводятся к \n,
+// пробелы по краям текста убираются
+func normalizeContent(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.TrimSpace(Normalize(s))
+}
+
+// isInvisible сообщает, что символ невидим и не несет смысла в тексте поста
+func isInvisible(r rune) bool {
+	switch {
+	case r >= '\u200B' && r <= '\u200F': // нулевой ширины, LRM и RLM
+		return true
+	case r >= '\u202A' && r <= '\u202E': // встраивание и переопределение направления
+		return true
+	case r >= '\u2060' && r <= '\u2064': // word joiner и невидимые операторы
+		return true
+	case r >= '\u2066' && r <= '\u2069': // изоляция направления
+		return true
+	case r == '\uFEFF', r == '\u00AD': // BOM и мягкий перенос
+		return true
+	}
+	return false
+}
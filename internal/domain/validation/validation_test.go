@@ -0,0 +1,140 @@
+package validation_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+	"1337b04rd/internal/domain/validation"
+)
+
+// TestNormalize проверяет приведение к NFC и удаление невидимых символов
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"NFC", "е\u0308ж", "ёж"},
+		{"Нулевая ширина", "спа\u200Bм", "спам"},
+		{"Переопределение направления", "\u202Egnp.exe", "gnp.exe"},
+		{"BOM", "\uFEFFпривет", "привет"},
+		{"Некорректный UTF-8", "a\xffb", "a�b"},
+	}
+
+	for _, tt := range tests {
+		if got := validation.Normalize(tt.input); got != tt.want {
+			t.Errorf("%s: ожидалось %q, получено %q", tt.name, tt.want, got)
+		}
+	}
+}
+
+// TestValidatePost проверяет ограничения полей треда
+func TestValidatePost(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits())
+
+	draft := &models.PostDraft{Title: "  Заголовок\u200B ", Content: "\r\nтекст\r\n"}
+	if err := validator.Post(draft); err != nil {
+		t.Fatalf("Ожидался корректный черновик, получено: %v", err)
+	}
+	if draft.Title != "Заголовок" || draft.Content != "текст" {
+		t.Errorf("Черновик не нормализован: %q, %q", draft.Title, draft.Content)
+	}
+
+	imageOnly := &models.PostDraft{ImageHash: "abc"}
+	if err := validator.Post(imageOnly); err != nil {
+		t.Errorf("Тред только с изображением и без заголовка должен проходить проверку: %v", err)
+	}
+
+	err := validator.Post(&models.PostDraft{
+		Name:    strings.Repeat("я", 65),
+		Title:   strings.Repeat("я", validation.DefaultLimits().Title+1),
+		Content: " ",
+	})
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Ожидались ошибки полей, получено: %v", err)
+	}
+	fields := errs.Fields()
+	for _, field := range []string{validation.FieldName, validation.FieldTitle, validation.FieldContent} {
+		if fields[field] == "" {
+			t.Errorf("Ожидалась ошибка поля %s, получено: %v", field, fields)
+		}
+	}
+}
+
+// TestValidatePoll проверяет варианты и срок опроса треда
+func TestValidatePoll(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits())
+
+	poll := &models.PollDraft{Options: []string{" Да ", "", "Не\u200Bт", "  "}}
+	if err := validator.Post(&models.PostDraft{Title: "Опрос", Content: "текст", Poll: poll}); err != nil {
+		t.Fatalf("Ожидался корректный опрос, получено: %v", err)
+	}
+	if len(poll.Options) != 2 || poll.Options[0] != "Да" || poll.Options[1] != "Нет" {
+		t.Errorf("Варианты не нормализованы: %q", poll.Options)
+	}
+
+	past := time.Now().Add(-time.Hour)
+	tooLate := time.Now().Add(validation.MaxPollDuration + time.Hour)
+	tests := []struct {
+		name  string
+		poll  *models.PollDraft
+		field string
+	}{
+		{"Один вариант", &models.PollDraft{Options: []string{"Да", " "}}, validation.FieldPollOptions},
+		{"Повтор варианта", &models.PollDraft{Options: []string{"Да", "Да "}}, validation.FieldPollOptions},
+		{"Слишком много вариантов", &models.PollDraft{Options: strings.Split("a b c d e f g h i j k", " ")}, validation.FieldPollOptions},
+		{"Длинный вариант", &models.PollDraft{Options: []string{"Да", strings.Repeat("н", 101)}}, validation.FieldPollOptions},
+		{"Срок в прошлом", &models.PollDraft{Options: []string{"Да", "Нет"}, ClosesAt: &past}, validation.FieldPollClosesIn},
+		{"Слишком долгий срок", &models.PollDraft{Options: []string{"Да", "Нет"}, ClosesAt: &tooLate}, validation.FieldPollClosesIn},
+	}
+	for _, tt := range tests {
+		err := validator.Post(&models.PostDraft{Title: "Опрос", Content: "текст", Poll: tt.poll})
+		var errs validation.Errors
+		if !errors.As(err, &errs) || errs.Fields()[tt.field] == "" {
+			t.Errorf("%s: ожидалась ошибка поля %s, получено: %v", tt.name, tt.field, err)
+		}
+	}
+}
+
+// TestValidateComment проверяет ограничения комментария
+func TestValidateComment(t *testing.T) {
+	validator := validation.NewValidator(validation.Limits{Content: 10})
+
+	if err := validator.Comment(&models.CommentDraft{Content: "\u2066\u2069"}); err == nil {
+		t.Error("Пустой комментарий без изображения должен отклоняться")
+	}
+	if err := validator.Comment(&models.CommentDraft{ImageURL: "http://s3/a.png"}); err != nil {
+		t.Errorf("Комментарий только с изображением должен проходить проверку: %v", err)
+	}
+	if err := validator.Comment(&models.CommentDraft{Content: strings.Repeat("ё", 11)}); err == nil {
+		t.Error("Слишком длинный комментарий должен отклоняться")
+	}
+}
+
+// TestValidateAttachments проверяет число файлов и нормализацию их имен
+func TestValidateAttachments(t *testing.T) {
+	validator := validation.NewValidator(validation.DefaultLimits())
+
+	files := make([]*models.Attachment, models.MaxAttachments)
+	for i := range files {
+		files[i] = &models.Attachment{Filename: " cat\u200b.png "}
+	}
+	draft := &models.CommentDraft{ImageHash: "abc", Attachments: files}
+	if err := validator.Comment(draft); err != nil {
+		t.Errorf("Галерея из %d файлов должна проходить проверку: %v", models.MaxAttachments, err)
+	}
+	if files[0].Filename != "cat.png" {
+		t.Errorf("Имя файла не нормализовано: %q", files[0].Filename)
+	}
+
+	draft.Attachments = append(files, &models.Attachment{})
+	var errs validation.Errors
+	err := validator.Comment(draft)
+	if !errors.As(err, &errs) || errs.Fields()[validation.FieldFile] == "" {
+		t.Errorf("Лишний файл должен отклоняться ошибкой поля file, получено %v", err)
+	}
+}
@@ -0,0 +1,7 @@
+package external
+
+// CaptchaRenderer представляет интерфейс для отрисовки изображения капчи
+type CaptchaRenderer interface {
+	// Render рисует искаженный текст и возвращает изображение в формате PNG
+	Render(text string) ([]byte, error)
+}
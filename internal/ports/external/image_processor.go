@@ -0,0 +1,18 @@
+package external
+
+import (
+	"errors"
+	"io"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ErrUnsupportedImage возвращается обработчиком для файлов, которые он не умеет декодировать
+var ErrUnsupportedImage = errors.New("неподдерживаемый формат изображения")
+
+// ImageProcessor представляет интерфейс для обработки загруженных изображений
+type ImageProcessor interface {
+	// Process декодирует изображение, перекодирует оригинал без метаданных
+	// и строит уменьшенные копии указанных размеров
+	Process(src io.ReadSeeker, sizes []models.ThumbnailSize) (*models.ProcessedImage, error)
+}
@@ -1,11 +1,17 @@
 package external
 
-import "context"
+import (
+	"context"
+	"io"
+
+	"1337b04rd/internal/domain/models"
+)
 
 // ImageStorage представляет интерфейс для работы с хранилищем изображений
 type ImageStorage interface {
-	// UploadImage загружает изображение в хранилище и возвращает URL для доступа к нему
-	UploadImage(ctx context.Context, bucketName, objectKey string, data []byte) (string, error)
+	// UploadImage загружает изображение в хранилище потоком и возвращает адрес объекта,
+	// см. ObjectURL. size - длина данных или -1, если она неизвестна
+	UploadImage(ctx context.Context, bucketName, objectKey string, body io.Reader, size int64) (string, error)
 
 	// GetImage получает изображение из хранилища по имени бакета и ключу объекта
 	GetImage(ctx context.Context, bucketName, objectKey string) ([]byte, error)
@@ -13,6 +19,14 @@ type ImageStorage interface {
 	// DeleteImage удаляет изображение из хранилища
 	DeleteImage(ctx context.Context, bucketName, objectKey string) error
 
-	// GenerateObjectKey генерирует уникальный ключ для объекта
-	GenerateObjectKey(originalFilename string) string
+	// ListObjects возвращает все объекты бакета
+	ListObjects(ctx context.Context, bucketName string) ([]models.StoredObject, error)
+
+	// GenerateObjectKey возвращает ключ объекта по его содержимому: SHA-256 в hex
+	// и расширение. Одинаковые файлы получают одинаковый ключ
+	GenerateObjectKey(data []byte, extension string) string
+
+	// ObjectURL возвращает адрес объекта внутри сети хранилища. Он не сохраняется в БД
+	// и не показывается браузеру, для этого есть URLBuilder
+	ObjectURL(bucketName, objectKey string) string
 }
@@ -0,0 +1,8 @@
+package external
+
+// URLBuilder строит адреса, по которым браузер получает объекты хранилища.
+// В БД хранятся только бакет и ключ, поэтому адреса можно менять без миграций
+type URLBuilder interface {
+	// ObjectURL возвращает адрес объекта key в бакете bucket
+	ObjectURL(bucket, key string) string
+}
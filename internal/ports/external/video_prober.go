@@ -0,0 +1,24 @@
+package external
+
+import (
+	"errors"
+	"io"
+
+	"1337b04rd/internal/domain/models"
+)
+
+var (
+	// ErrNotVideo возвращается для файлов без сигнатуры WebM или MP4,
+	// такие файлы обрабатываются как изображения
+	ErrNotVideo = errors.New("файл не является видео")
+	// ErrUnsupportedVideo возвращается для поврежденных контейнеров
+	// и видео с кодеками, которые не воспроизводятся в браузерах
+	ErrUnsupportedVideo = errors.New("неподдерживаемое видео")
+)
+
+// VideoProber представляет интерфейс для чтения заголовков видеоконтейнеров
+type VideoProber interface {
+	// Probe читает длительность, размеры кадра и кодеки из заголовков контейнера
+	// без декодирования кадров. Чтение может закончиться в любом месте файла
+	Probe(src io.ReadSeeker) (*models.VideoInfo, error)
+}
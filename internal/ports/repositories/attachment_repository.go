@@ -0,0 +1,14 @@
+package repositories
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// AttachmentRepository представляет интерфейс хранилища файлов постов и комментариев.
+// Файлы сохраняются и удаляются вместе с записью в репозиториях постов и комментариев
+type AttachmentRepository interface {
+	// GetByOwners возвращает файлы записей вида ownerType по ID записи в порядке галереи
+	GetByOwners(ctx context.Context, ownerType string, ownerIDs []int64) (map[int64][]*models.Attachment, error)
+}
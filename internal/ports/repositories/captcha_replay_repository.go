@@ -0,0 +1,13 @@
+package repositories
+
+import (
+	"context"
+	"time"
+)
+
+// CaptchaReplayRepository хранит идентификаторы уже использованных задач капчи
+type CaptchaReplayRepository interface {
+	// MarkUsed отмечает задачу как использованную до expiresAt.
+	// Возвращает false, если задача уже была использована
+	MarkUsed(ctx context.Context, id string, expiresAt time.Time) (bool, error)
+}
@@ -13,12 +13,35 @@ type CommentRepository interface {
 	// GetByPostID возвращает все комментарии к указанному посту
 	GetByPostID(ctx context.Context, postID int64, limit, offset int) ([]*models.Comment, error)
 
+	// GetPageAfter возвращает до limit комментариев поста, созданных после комментария afterID,
+	// в порядке (created_at, id). При afterID = 0 выборка начинается с первого комментария.
+	// Скрытые комментарии, кроме комментариев viewerID, пропускаются
+	GetPageAfter(ctx context.Context, postID, viewerID, afterID int64, limit int) ([]*models.Comment, error)
+
+	// GetLinks возвращает цитаты указанных комментариев и опубликованные ответы на них одним запросом
+	GetLinks(ctx context.Context, ids []int64) (*models.CommentLinks, error)
+
+	// FindInPost возвращает те из указанных ID, которые принадлежат комментариям поста
+	FindInPost(ctx context.Context, postID int64, ids []int64) ([]int64, error)
+
+	// GetTreeByPostID возвращает ветки ответов для limit корневых комментариев поста,
+	// начиная с offset, в обходе в глубину. Скрытые комментарии, кроме комментариев viewerID,
+	// не попадают в дерево вместе с ответами на них
+	GetTreeByPostID(ctx context.Context, postID, viewerID int64, maxDepth, limit, offset int) ([]*models.Comment, error)
+
 	// GetLastCommentByPostID возвращает последний комментарий к посту
 	GetLastCommentByPostID(ctx context.Context, postID int64) (*models.Comment, error)
 
-	// Create создает новый комментарий
+	// Create создает новый комментарий вместе с его цитатами
 	Create(ctx context.Context, comment *models.Comment) (int64, error)
 
-	// Delete удаляет комментарий по ID
-	Delete(ctx context.Context, id int64) error
+	// Delete удаляет комментарий по ID вместе с ответами на него и возвращает
+	// адреса изображений удаленных комментариев
+	Delete(ctx context.Context, id int64) ([]string, error)
+
+	// GetByStatus возвращает комментарии с указанными статусами модерации
+	GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Comment, error)
+
+	// SetStatus меняет статус модерации комментария
+	SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error
 }
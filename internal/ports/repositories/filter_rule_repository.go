@@ -0,0 +1,25 @@
+package repositories
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// FilterRuleRepository представляет интерфейс хранилища правил фильтра содержимого
+type FilterRuleRepository interface {
+	// GetAll возвращает все правила, включая отключенные
+	GetAll(ctx context.Context) ([]*models.FilterRule, error)
+
+	// GetByID возвращает правило по его ID
+	GetByID(ctx context.Context, id int64) (*models.FilterRule, error)
+
+	// Create создает новое правило
+	Create(ctx context.Context, rule *models.FilterRule) (int64, error)
+
+	// Update обновляет правило
+	Update(ctx context.Context, rule *models.FilterRule) error
+
+	// Delete удаляет правило по ID
+	Delete(ctx context.Context, id int64) error
+}
@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// FingerprintRepository представляет интерфейс хранилища отпечатков отправок
+type FingerprintRepository interface {
+	// Recent возвращает последние limit отпечатков, новые первыми
+	Recent(ctx context.Context, limit int) ([]*models.ContentFingerprint, error)
+
+	// Save сохраняет отпечаток
+	Save(ctx context.Context, fingerprint *models.ContentFingerprint) error
+
+	// Trim удаляет все отпечатки, кроме последних keep
+	Trim(ctx context.Context, keep int) error
+}
@@ -0,0 +1,19 @@
+package repositories
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ImageBanRepository представляет интерфейс хранилища запрещенных изображений
+type ImageBanRepository interface {
+	// GetAll возвращает все запреты, новые первыми
+	GetAll(ctx context.Context) ([]*models.ImageBan, error)
+
+	// Create сохраняет запрет и возвращает его ID
+	Create(ctx context.Context, ban *models.ImageBan) (int64, error)
+
+	// Delete снимает запрет
+	Delete(ctx context.Context, id int64) error
+}
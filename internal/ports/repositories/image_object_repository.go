@@ -0,0 +1,34 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// ImageObjectRepository представляет интерфейс учета ссылок на объекты хранилища изображений
+type ImageObjectRepository interface {
+	// Acquire добавляет ссылку на объект. Возвращает true, если объект еще не отмечен
+	// загруженным: его нет или загрузка другого запроса не завершилась. Такой объект
+	// вызывающий загружает сам
+	Acquire(ctx context.Context, object *models.ImageObject) (bool, error)
+
+	// MarkUploaded отмечает, что объект записан в хранилище
+	MarkUploaded(ctx context.Context, bucket, objectKey string) error
+
+	// Get возвращает учтенный объект или nil, если объекта нет
+	Get(ctx context.Context, bucket, objectKey string) (*models.ImageObject, error)
+
+	// Release убирает ссылку на объект. Возвращает true, если ссылок не осталось
+	// и объект нужно удалить из хранилища. Для неучтенных объектов возвращает false
+	Release(ctx context.Context, bucket, objectKey string) (bool, error)
+
+	// ReferencedURLs возвращает адреса оригиналов и миниатюр всех постов, комментариев и их файлов
+	ReferencedURLs(ctx context.Context) ([]string, error)
+
+	// Forget удаляет запись объекта, на который не ссылается ни один пост или комментарий.
+	// Запись, ссылка на которую добавлена после before, сохраняется: загрузка еще может
+	// дойти до сохранения записи. Возвращает true, если учета объекта больше нет
+	Forget(ctx context.Context, bucket, objectKey string, before time.Time) (bool, error)
+}
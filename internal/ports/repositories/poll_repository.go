@@ -0,0 +1,24 @@
+package repositories
+
+import (
+	"context"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// PollRepository представляет интерфейс для работы с хранилищем опросов
+type PollRepository interface {
+	// Create создает опрос вместе с вариантами ответа и возвращает его ID
+	Create(ctx context.Context, poll *models.Poll) (int64, error)
+
+	// GetByPostID возвращает опрос треда с результатами и выбором сессии viewerID.
+	// Если у треда нет опроса, возвращает nil без ошибки
+	GetByPostID(ctx context.Context, postID, viewerID int64) (*models.Poll, error)
+
+	// Vote сохраняет голос сессии userID за варианты optionIDs.
+	// Возвращает false, если сессия уже голосовала в этом опросе
+	Vote(ctx context.Context, pollID, userID int64, optionIDs []int64) (bool, error)
+
+	// CloseByPostID закрывает опрос треда, если он есть
+	CloseByPostID(ctx context.Context, postID int64) error
+}
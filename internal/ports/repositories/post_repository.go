@@ -1,8 +1,10 @@
 package repositories
 
 import (
-	"1337b04rd/internal/domain/models"
 	"context"
+	"time"
+
+	"1337b04rd/internal/domain/models"
 )
 
 // PostRepository представляет интерфейс для работы с хранилищем постов
@@ -10,15 +12,39 @@ type PostRepository interface {
 	// GetByID возвращает пост по его ID
 	GetByID(ctx context.Context, id int64) (*models.Post, error)
 
-	// GetAll возвращает все посты с возможной фильтрацией
+	// GetAll возвращает все посты с возможной фильтрацией, закрепленные первыми
 	GetAll(ctx context.Context, limit, offset int, archived bool) ([]*models.Post, error)
 
-	// GetAllForArchiving возвращает все неархивированные посты для проверки архивации
+	// GetCatalog возвращает посты каталога вместе с числом ответов и изображений,
+	// временем последнего ответа и previews последними ответами одним запросом,
+	// а также общее число постов каталога для постраничной навигации
+	GetCatalog(ctx context.Context, limit, offset int, archived bool, previews int) ([]*models.CatalogEntry, int, error)
+
+	// GetAllForArchiving возвращает неархивированные и незакрепленные посты для проверки архивации
 	GetAllForArchiving(ctx context.Context) ([]*models.Post, error)
 
+	// CountCreatedSince возвращает количество постов, созданных после указанного момента
+	CountCreatedSince(ctx context.Context, since time.Time) (int, error)
+
 	// Create создает новый пост
 	Create(ctx context.Context, post *models.Post) (int64, error)
 
 	// Archive архивирует пост
 	Archive(ctx context.Context, id int64) error
+
+	// Delete удаляет пост вместе с комментариями и возвращает адреса изображений
+	// поста и его комментариев
+	Delete(ctx context.Context, id int64) ([]string, error)
+
+	// GetByStatus возвращает посты с указанными статусами модерации
+	GetByStatus(ctx context.Context, statuses []models.ModerationStatus, limit int) ([]*models.Post, error)
+
+	// SetStatus меняет статус модерации поста
+	SetStatus(ctx context.Context, id int64, status models.ModerationStatus) error
+
+	// SetSticky закрепляет тред или снимает закрепление
+	SetSticky(ctx context.Context, id int64, sticky bool) error
+
+	// SetLocked закрывает тред для новых ответов или открывает его
+	SetLocked(ctx context.Context, id int64, locked bool) error
 }
@@ -0,0 +1,16 @@
+package repositories
+
+import (
+	"context"
+	"time"
+
+	"1337b04rd/internal/domain/models"
+)
+
+// RateLimitRepository представляет интерфейс хранилища корзин токенов
+type RateLimitRepository interface {
+	// Take атомарно пополняет корзину по ключу и забирает из нее один токен
+	Take(ctx context.Context, key string, rule models.RateLimitRule, now time.Time) (models.RateLimitDecision, error)
+	// Refund возвращает в корзину токен, забранный Take для отклоненного действия
+	Refund(ctx context.Context, key string, rule models.RateLimitRule) error
+}